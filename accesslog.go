@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clfTime is the timestamp layout of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog writes a line for every request in the Combined Log Format of
+// Apache and nginx, for log analyzers such as GoAccess and AWStats. It's
+// kept apart from the blog's own logs, in access_log.file, which is
+// rotated by size and time. A nil *AccessLog writes nothing.
+type AccessLog struct {
+	file *rotatingFile
+	// skip are the paths not logged, such as probes.
+	skip map[string]bool
+}
+
+// openAccessLog opens the access log configured in cfg, or returns nil
+// when requests aren't logged to a file.
+func openAccessLog(cfg AccessLogConfig, skipPaths ...string) (*AccessLog, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+
+	file, err := openRotatingFile(cfg.File, int64(cfg.MaxSize)<<20, time.Duration(cfg.Rotate), cfg.Keep)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &AccessLog{file: file, skip: make(map[string]bool, len(skipPaths))}
+	for _, path := range skipPaths {
+		l.skip[path] = true
+	}
+
+	return l, nil
+}
+
+// Middleware logs each request once it completes. It runs before the
+// blog's own middleware, so every response is logged as sent, compressed
+// size included.
+func (l *AccessLog) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		if l == nil || l.skip[ctx.Request.URL.Path] {
+			return
+		}
+
+		_, err := l.file.Write([]byte(combinedLogLine(ctx, start)))
+		if err != nil {
+			slog.Warn("writing access log", "file", l.file.name, "error", err)
+		}
+	}
+}
+
+// Close closes the log file.
+func (l *AccessLog) Close() error {
+	return l.file.Close()
+}
+
+// combinedLogLine formats the request of ctx, received at start, as a line
+// of the Combined Log Format:
+//
+//	host ident user [time] "request" status bytes "referer" "user-agent"
+func combinedLogLine(ctx *gin.Context, start time.Time) string {
+	req := ctx.Request
+
+	size := "-"
+	if n := ctx.Writer.Size(); n > 0 {
+		size = strconv.Itoa(n)
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		ctx.ClientIP(),
+		start.Format(clfTime),
+		clfEscape(req.Method), clfEscape(req.RequestURI), clfEscape(req.Proto),
+		ctx.Writer.Status(),
+		size,
+		clfEscape(firstNonEmpty(req.Referer(), "-")),
+		clfEscape(firstNonEmpty(req.UserAgent(), "-")),
+	)
+}
+
+// clfEscape escapes quotes, backslashes and control characters in a field
+// of a log line the way Apache does, so clients can't forge lines.
+func clfEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// rotatingFile is a log file that's moved aside for a new one once it
+// grows past maxSize, or when a new period of every starts, such as each
+// day at midnight UTC. Moved files are named after the time they were
+// moved, and only the keep most recent are kept. A zero maxSize or every
+// doesn't rotate by size or time, and a zero keep keeps every file.
+type rotatingFile struct {
+	name    string
+	maxSize int64
+	every   time.Duration
+	keep    int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+}
+
+func openRotatingFile(name string, maxSize int64, every time.Duration, keep int) (*rotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rotatingFile{name: name, maxSize: maxSize, every: every, keep: keep}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// open opens the file for appending, carrying on with its current period
+// if it already exists.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, info.Size()
+	f.period = f.periodOf(time.Now())
+	if f.size > 0 {
+		f.period = f.periodOf(info.ModTime())
+	}
+
+	return nil
+}
+
+// periodOf returns the start of the rotation period t is in.
+func (f *rotatingFile) periodOf(t time.Time) time.Time {
+	if f.every <= 0 {
+		return time.Time{}
+	}
+
+	return t.UTC().Truncate(f.every)
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Empty files are kept, whatever their period.
+	period := f.periodOf(time.Now())
+	full := f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize
+	if f.size > 0 && (full || !period.Equal(f.period)) {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	f.period = period
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// rotate moves the file aside and opens a new one in its place, then
+// removes the moved files beyond keep.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+
+	moved := f.name + "." + time.Now().UTC().Format("20060102T150405.000")
+	err = os.Rename(f.name, moved)
+	if err != nil {
+		// Carry on in the same file, trying again on the next write.
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	err = f.open()
+	if err != nil {
+		return err
+	}
+
+	if f.keep > 0 {
+		old, err := filepath.Glob(f.name + ".*")
+		if err != nil {
+			return err
+		}
+
+		// Their names sort by the time they were moved.
+		slices.Sort(old)
+		for _, name := range old[:max(len(old)-f.keep, 0)] {
+			if err := os.Remove(name); err != nil {
+				slog.Warn("removing old log file", "file", name, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// The blog can be followed from Mastodon and other fediverse servers as
+// the ActivityPub actor @<username>@<host>. WebFinger resolves that handle
+// to the actor document, whose outbox lists the posts as Articles. Follow
+// requests arriving at the inbox are accepted right away, and every newly
+// published post is delivered to the followers' inboxes. Everything the
+// blog sends is signed with the actor's key, and only signed activities
+// are accepted.
+
+const (
+	activityStreams   = "https://www.w3.org/ns/activitystreams"
+	activityPublic    = activityStreams + "#Public"
+	activityJSON      = "application/activity+json"
+	maxActivityLength = 1 << 20
+)
+
+// ActivityPub is the blog's actor: its key, followers and which posts have
+// been delivered, the latter two kept in SQLite.
+type ActivityPub struct {
+	db     *sql.DB
+	key    *rsa.PrivateKey
+	client *http.Client
+	// base is the blog's base URL, which the actor and its objects are
+	// identified by.
+	base string
+
+	keysMu sync.Mutex
+	// keys caches the public keys of remote actors by key ID.
+	keys map[string]remoteKey
+
+	// deliverMu keeps deliveries from overlapping when posts are reloaded
+	// in quick succession.
+	deliverMu sync.Mutex
+}
+
+type remoteKey struct {
+	owner string
+	key   *rsa.PublicKey
+}
+
+// openActivityPub loads the actor's key and opens the database configured
+// in cfg for the blog at base, or returns nil when ActivityPub is disabled.
+func openActivityPub(cfg ActivityPubConfig, base string) (*ActivityPub, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	key, err := loadOrCreateKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "activitypub.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS followers (
+		actor   TEXT PRIMARY KEY,
+		inbox   TEXT NOT NULL,
+		created INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS delivered (
+		object TEXT PRIMARY KEY
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &ActivityPub{
+		db:     db,
+		key:    key,
+		client: outboundClient(cfg.AllowPrivate),
+		keys:   map[string]remoteKey{},
+		base:   base,
+	}, nil
+}
+
+func (ap *ActivityPub) Close() error {
+	return ap.db.Close()
+}
+
+// actorURL is the actor of the blog at base.
+func actorURL(base string) string {
+	return base + "/ap/actor"
+}
+
+func actorKeyID(base string) string {
+	return actorURL(base) + "#main-key"
+}
+
+// actorHost is the host part of the handle of the actor of the blog at
+// base.
+func actorHost(base string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// activityJSONResponse writes v as an ActivityStreams document.
+func activityJSONResponse(ctx *gin.Context, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		ctx.Error(err)
+		ctx.String(http.StatusInternalServerError, "Couldn't encode document")
+		return
+	}
+
+	ctx.Data(status, activityJSON+"; charset=utf-8", b)
+}
+
+// WebFingerHandler resolves acct:<username>@<host> to the actor.
+func WebFingerHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		subject := "acct:" + cfg.ActivityPub.Username + "@" + actorHost(cfg.BaseURL)
+		if !strings.EqualFold(ctx.Query("resource"), subject) && ctx.Query("resource") != actorURL(cfg.BaseURL) {
+			ctx.String(http.StatusNotFound, "Unknown resource")
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Origin", "*")
+		ctx.Header("Content-Type", "application/jrd+json; charset=utf-8")
+		ctx.JSON(http.StatusOK, gin.H{
+			"subject": subject,
+			"aliases": []string{actorURL(cfg.BaseURL), cfg.BaseURL + "/"},
+			"links": []gin.H{
+				{"rel": "self", "type": activityJSON, "href": actorURL(cfg.BaseURL)},
+				{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": cfg.BaseURL + "/"},
+			},
+		})
+	}
+}
+
+// ActorHandler serves the actor document.
+func ActorHandler(ap *ActivityPub, site SiteData) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		publicKey, err := publicKeyPEM(ap.key)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't encode key")
+			return
+		}
+
+		activityJSONResponse(ctx, http.StatusOK, gin.H{
+			"@context":          []string{activityStreams, "https://w3id.org/security/v1"},
+			"id":                actorURL(cfg.BaseURL),
+			"type":              "Person",
+			"preferredUsername": cfg.ActivityPub.Username,
+			"name":              site.Title,
+			"summary":           site.Description,
+			"url":               cfg.BaseURL + "/",
+			"inbox":             cfg.BaseURL + "/ap/inbox",
+			"outbox":            cfg.BaseURL + "/ap/outbox",
+			"followers":         cfg.BaseURL + "/ap/followers",
+			"publicKey": gin.H{
+				"id":           actorKeyID(cfg.BaseURL),
+				"owner":        actorURL(cfg.BaseURL),
+				"publicKeyPem": publicKey,
+			},
+		})
+	}
+}
+
+// articleObject is post as an ActivityStreams Article of the blog at base.
+func articleObject(base string, post PostData) gin.H {
+	var tags []gin.H
+	for _, tag := range post.Tags {
+		tags = append(tags, gin.H{
+			"type": "Hashtag",
+			"name": "#" + strings.ReplaceAll(tag, " ", ""),
+			"href": base + tagURL(tag),
+		})
+	}
+
+	return gin.H{
+		"id":           base + post.URL,
+		"type":         "Article",
+		"name":         post.Title,
+		"summary":      post.Description,
+		"content":      string(post.Content()),
+		"url":          base + post.URL,
+		"published":    post.Date.UTC().Format(time.RFC3339),
+		"attributedTo": actorURL(base),
+		"to":           []string{activityPublic},
+		"cc":           []string{base + "/ap/followers"},
+		"tag":          tags,
+	}
+}
+
+// createActivity wraps the Article of post in a Create activity of the
+// blog at base.
+func createActivity(base string, post PostData) gin.H {
+	return gin.H{
+		"@context":  activityStreams,
+		"id":        base + post.URL + "#create",
+		"type":      "Create",
+		"actor":     actorURL(base),
+		"published": post.Date.UTC().Format(time.RFC3339),
+		"to":        []string{activityPublic},
+		"cc":        []string{base + "/ap/followers"},
+		"object":    articleObject(base, post),
+	}
+}
+
+// wantsActivity reports whether the request asks for an ActivityStreams
+// document rather than HTML, as servers resolving a post's URL do.
+func wantsActivity(ctx *gin.Context) bool {
+	accept := ctx.GetHeader("Accept")
+	return strings.Contains(accept, activityJSON) || strings.Contains(accept, "application/ld+json")
+}
+
+// OutboxHandler lists the published posts, newest first, as Create
+// activities.
+func OutboxHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		posts := publishedPosts(store)
+		sortPostsByDate(posts)
+
+		items := make([]gin.H, 0, len(posts))
+		for _, post := range posts {
+			items = append(items, createActivity(cfg.BaseURL, post))
+		}
+
+		activityJSONResponse(ctx, http.StatusOK, gin.H{
+			"@context":     activityStreams,
+			"id":           cfg.BaseURL + "/ap/outbox",
+			"type":         "OrderedCollection",
+			"totalItems":   len(items),
+			"orderedItems": items,
+		})
+	}
+}
+
+// FollowersHandler tells how many followers the blog has, but not who.
+func FollowersHandler(ap *ActivityPub) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var n int
+		err := ap.db.QueryRow(`SELECT COUNT(*) FROM followers`).Scan(&n)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't count followers")
+			return
+		}
+
+		activityJSONResponse(ctx, http.StatusOK, gin.H{
+			"@context":   activityStreams,
+			"id":         requestConfig(ctx).BaseURL + "/ap/followers",
+			"type":       "OrderedCollection",
+			"totalItems": n,
+		})
+	}
+}
+
+// activity is the part of an incoming activity the inbox looks at.
+type activity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// objectID returns the ID of an activity's object, which may be given
+// as just the ID or as the whole object.
+func (a activity) objectID() string {
+	var id string
+	if json.Unmarshal(a.Object, &id) == nil {
+		return id
+	}
+
+	var object activity
+	if json.Unmarshal(a.Object, &object) == nil {
+		return object.ID
+	}
+
+	return ""
+}
+
+// undoesFollow reports whether an Undo activity takes back a Follow of
+// the actor.
+func (a activity) undoesFollow(actor string) bool {
+	var object activity
+	if json.Unmarshal(a.Object, &object) != nil {
+		return false
+	}
+
+	return object.Type == "Follow" && object.objectID() == actor
+}
+
+// InboxHandler accepts signed activities. Follows of the blog are
+// accepted, and undoing them or deleting the following account removes
+// the follower; anything else is acknowledged and ignored.
+func InboxHandler(ap *ActivityPub) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxActivityLength))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Couldn't read activity")
+			return
+		}
+
+		var act activity
+		err = json.Unmarshal(body, &act)
+		if err != nil || act.Actor == "" {
+			ctx.String(http.StatusBadRequest, "Invalid activity")
+			return
+		}
+
+		owner, err := ap.verify(ctx.Request, body)
+		if err != nil {
+			slog.Warn("rejecting activity", "actor", act.Actor, "type", act.Type, "error", err)
+			ctx.String(http.StatusUnauthorized, "Invalid signature")
+			return
+		}
+		if owner != act.Actor {
+			ctx.String(http.StatusUnauthorized, "Activity not signed by its actor")
+			return
+		}
+
+		switch {
+		case act.Type == "Follow" && act.objectID() == actorURL(ap.base):
+			err = ap.follow(act, body)
+		case act.Type == "Undo" && act.undoesFollow(actorURL(ap.base)),
+			act.Type == "Delete" && act.objectID() == act.Actor:
+			_, err = ap.db.Exec(`DELETE FROM followers WHERE actor = ?`, act.Actor)
+		}
+		if err != nil {
+			slog.Error("handling activity", "actor", act.Actor, "type", act.Type, "error", err)
+			ctx.String(http.StatusInternalServerError, "Couldn't handle activity")
+			return
+		}
+
+		ctx.Status(http.StatusAccepted)
+	}
+}
+
+// remoteActor is the part of another actor's document the blog uses.
+type remoteActor struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// follow stores the follower and sends them an Accept.
+func (ap *ActivityPub) follow(act activity, body []byte) error {
+	actor, err := ap.fetchActor(act.Actor)
+	if err != nil {
+		return err
+	}
+
+	inbox := firstNonEmpty(actor.Endpoints.SharedInbox, actor.Inbox)
+	if inbox == "" {
+		return errors.New("follower has no inbox")
+	}
+
+	_, err = ap.db.Exec(`INSERT INTO followers (actor, inbox, created) VALUES (?, ?, ?)
+		ON CONFLICT (actor) DO UPDATE SET inbox = excluded.inbox`, act.Actor, inbox, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	slog.Info("new follower", "actor", act.Actor)
+
+	accept := gin.H{
+		"@context": activityStreams,
+		"id":       actorURL(ap.base) + "#accept-" + url.QueryEscape(firstNonEmpty(act.ID, act.Actor)),
+		"type":     "Accept",
+		"actor":    actorURL(ap.base),
+		"object":   json.RawMessage(body),
+	}
+	// The follower's server may be slow to answer; it shouldn't hold up
+	// the response to its own request.
+	go func() {
+		err := ap.post(actor.Inbox, accept)
+		if err != nil {
+			slog.Warn("accepting follow", "actor", act.Actor, "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// verify checks the signature of an inbox request and returns the actor
+// owning the key it was made with. Keys are cached; a signature failing
+// with a cached key is checked again with a freshly fetched one, in case
+// the actor changed keys.
+func (ap *ActivityPub) verify(req *http.Request, body []byte) (owner string, err error) {
+	sig, err := parseSignature(req.Header.Get("Signature"))
+	if err != nil {
+		return "", err
+	}
+
+	ap.keysMu.Lock()
+	cached, ok := ap.keys[sig.KeyID]
+	ap.keysMu.Unlock()
+	if ok && verifyRequest(req, body, sig, cached.key) == nil {
+		return cached.owner, nil
+	}
+
+	actor, err := ap.fetchActor(sig.KeyID)
+	if err != nil {
+		return "", fmt.Errorf("fetching key: %w", err)
+	}
+	if actor.PublicKey.ID != sig.KeyID {
+		return "", errors.New("key not found at its ID")
+	}
+
+	key, err := parsePublicKeyPEM(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return "", err
+	}
+
+	owner = firstNonEmpty(actor.PublicKey.Owner, actor.ID)
+	ap.keysMu.Lock()
+	ap.keys[sig.KeyID] = remoteKey{owner: owner, key: key}
+	ap.keysMu.Unlock()
+
+	return owner, verifyRequest(req, body, sig, key)
+}
+
+// fetchActor fetches the actor document at id, which may be a key ID
+// pointing into it. The request is signed, for servers that only answer
+// signed requests.
+func (ap *ActivityPub) fetchActor(id string) (remoteActor, error) {
+	var actor remoteActor
+
+	u, err := url.Parse(id)
+	if err != nil || !httpURL(u) {
+		return actor, fmt.Errorf("invalid actor %q", id)
+	}
+	u.Fragment = ""
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return actor, err
+	}
+	req.Header.Set("Accept", activityJSON)
+	err = signRequest(req, nil, actorKeyID(ap.base), ap.key)
+	if err != nil {
+		return actor, err
+	}
+
+	resp, err := ap.client.Do(req)
+	if err != nil {
+		return actor, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return actor, errors.New(resp.Status)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxActivityLength)).Decode(&actor)
+
+	return actor, err
+}
+
+// post delivers a signed activity to inbox.
+func (ap *ActivityPub) post(inbox string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", activityJSON)
+	err = signRequest(req, body, actorKeyID(ap.base), ap.key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ap.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(resp.Status)
+	}
+
+	return nil
+}
+
+// Deliver sends the published posts that haven't been delivered yet to
+// every follower, oldest first. Posts published while nobody followed the
+// blog are marked delivered too, so new followers aren't flooded with old
+// posts.
+func (ap *ActivityPub) Deliver(posts []PostData) {
+	if ap == nil {
+		return
+	}
+
+	ap.deliverMu.Lock()
+	defer ap.deliverMu.Unlock()
+
+	inboxes, err := ap.inboxes()
+	if err != nil {
+		slog.Error("loading followers", "error", err)
+		return
+	}
+
+	now := time.Now()
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Date.Before(posts[j].Date) })
+	for _, post := range posts {
+		object := ap.base + post.URL
+		if !post.Listed(now) || ap.delivered(object) {
+			continue
+		}
+
+		create := createActivity(ap.base, post)
+		for _, inbox := range inboxes {
+			err = ap.post(inbox, create)
+			if err != nil {
+				slog.Warn("delivering post", "slug", post.Slug, "inbox", inbox, "error", err)
+			}
+		}
+
+		_, err = ap.db.Exec(`INSERT OR IGNORE INTO delivered (object) VALUES (?)`, object)
+		if err != nil {
+			slog.Error("saving delivered post", "slug", post.Slug, "error", err)
+		}
+	}
+}
+
+// inboxes returns the distinct inboxes of the followers; followers on the
+// same server usually share one.
+func (ap *ActivityPub) inboxes() ([]string, error) {
+	rows, err := ap.db.Query(`SELECT DISTINCT inbox FROM followers ORDER BY inbox`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inboxes []string
+	for rows.Next() {
+		var inbox string
+		err = rows.Scan(&inbox)
+		if err != nil {
+			return nil, err
+		}
+
+		inboxes = append(inboxes, inbox)
+	}
+
+	return inboxes, rows.Err()
+}
+
+func (ap *ActivityPub) delivered(object string) bool {
+	var n int
+	err := ap.db.QueryRow(`SELECT COUNT(*) FROM delivered WHERE object = ?`, object).Scan(&n)
+
+	return err == nil && n > 0
+}
+
+// publishedPosts returns the posts published by now, in any language.
+func publishedPosts(store PostStore) []PostData {
+	now := time.Now()
+	var published []PostData
+	for _, post := range store.Posts() {
+		if post.Listed(now) {
+			published = append(published, post)
+		}
+	}
+
+	return published
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// newPostFrontmatter prefills the editor for new posts.
+const newPostFrontmatter = `Title: 
+Slug: 
+Date: 
+Draft: true
+Description: 
+Tags: []
+`
+
+// adminRoutes registers the post editor and the stats dashboard under
+// /admin, behind basic auth, see AdminAuth.
+func adminRoutes(route *gin.Engine, cfg *Config, store PostStore, renderer Renderer, subscribers *SubscriberStore, analytics *Analytics, referrers *Referrers, maintenance *Maintenance) {
+	admin := route.Group("/admin",
+		AdminAuth(cfg.Admin.User, cfg.Admin.Password, cfg.RateLimit),
+		sameOrigin(),
+		func(ctx *gin.Context) {
+			ctx.Header("Cache-Control", "no-store")
+		},
+	)
+
+	// Posts from remote sources would be overwritten by the next fetch, so
+	// they can only be edited where they come from.
+	if store.Dir() != "" {
+		admin.GET("", AdminHandler(store, maintenance))
+		admin.GET("/new", AdminEditHandler(store))
+		admin.GET("/edit/:slug", AdminEditHandler(store))
+		admin.POST("/preview", AdminPreviewHandler(renderer))
+		admin.POST("/save", AdminSaveHandler(store))
+		admin.POST("/delete/:slug", AdminDeleteHandler(store))
+	}
+	if subscribers != nil {
+		admin.GET("/subscribers.csv", AdminSubscribersHandler(subscribers))
+		admin.GET("/digest", AdminDigestHandler(route, store, subscribers))
+		admin.POST("/digest", AdminDigestHandler(route, store, subscribers))
+	}
+	if analytics != nil {
+		admin.GET("/stats", AdminStatsHandler(analytics))
+	}
+	if referrers != nil {
+		admin.GET("/referrers", AdminReferrersHandler(referrers))
+	}
+	admin.POST("/maintenance", AdminMaintenanceHandler(maintenance))
+}
+
+// sameOrigin rejects state-changing requests coming from other sites.
+// Browsers resend basic auth credentials on their own, so without this any
+// page could make a logged in admin's browser delete posts.
+func sameOrigin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead {
+			return
+		}
+
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			origin = ctx.GetHeader("Referer")
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != ctx.Request.Host {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+}
+
+// AdminHandler lists every post, drafts included.
+func AdminHandler(store PostStore, maintenance *Maintenance) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		posts := store.Posts()
+		sortPostsByDate(posts)
+
+		renderHTML(ctx, http.StatusOK, "admin.html", gin.H{
+			"Title":        "Admin",
+			"Posts":        posts,
+			"PreviewToken": cfg.PreviewToken,
+			"Stats":        cfg.Analytics.Enabled,
+			"Maintenance":  maintenance.On(),
+		})
+	}
+}
+
+// AdminEditHandler shows the editor, empty for /admin/new and with the
+// post's file for /admin/edit/:slug.
+func AdminEditHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data := gin.H{
+			"Title":       "New post",
+			"Frontmatter": newPostFrontmatter,
+		}
+
+		if slug := ctx.Param("slug"); slug != "" {
+			post, ok := store.Get(slug)
+			if !ok {
+				notFound(ctx, "Post not found")
+				return
+			}
+
+			content, err := os.ReadFile(post.File)
+			if err != nil {
+				ctx.Error(err)
+				ctx.String(http.StatusInternalServerError, "Couldn't read the post")
+				return
+			}
+
+			// Broken frontmatter is left in the body to be fixed.
+			front, body, _ := splitFrontmatter(content)
+			data["Title"] = "Edit " + post.Title
+			data["Slug"] = post.Slug
+			data["Frontmatter"] = string(front)
+			data["Body"] = string(body)
+		}
+
+		renderHTML(ctx, http.StatusOK, "admin_edit.html", data)
+	}
+}
+
+// AdminPreviewHandler renders the posted markdown for the editor's preview
+// pane.
+func AdminPreviewHandler(renderer Renderer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body := normalizeNewlines(ctx.PostForm("body"))
+
+		html, _, err := renderer.Render(ctx.Request.Context(), []byte(body), "preview", false)
+		if err != nil {
+			ctx.String(http.StatusUnprocessableEntity, "Couldn't render the post")
+			return
+		}
+
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+	}
+}
+
+// AdminSaveHandler writes a post back to the content directory and reloads
+// the store. The form's slug field is the post being edited, empty for a
+// new post, which is saved as <Slug>.md.
+func AdminSaveHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		front := strings.TrimSpace(normalizeNewlines(ctx.PostForm("frontmatter")))
+		body := normalizeNewlines(ctx.PostForm("body"))
+
+		var post PostData
+		err := yaml.Unmarshal([]byte(front), &post)
+		if err != nil {
+			adminError(ctx, fmt.Sprintf("Invalid frontmatter: %v", err))
+			return
+		}
+
+		var file string
+		if slug := ctx.PostForm("slug"); slug != "" {
+			existing, ok := store.Get(slug)
+			if !ok {
+				notFound(ctx, "Post not found")
+				return
+			}
+			file = existing.File
+		} else {
+			if !validSlug(post.Slug) {
+				adminError(ctx, "New posts need a Slug of letters, digits, - and _")
+				return
+			}
+
+			file = filepath.Join(store.Dir(), post.Slug+".md")
+			if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+				adminError(ctx, "A post with this slug already exists")
+				return
+			}
+		}
+
+		var content bytes.Buffer
+		content.WriteString("---\n")
+		content.WriteString(front)
+		content.WriteString("\n---\n")
+		content.WriteString(body)
+
+		err = writeFileAtomic(file, content.Bytes())
+		if err == nil {
+			err = store.Reload()
+		}
+		if err != nil {
+			ctx.Error(err)
+			adminError(ctx, "Couldn't save the post")
+			return
+		}
+
+		ctx.Redirect(http.StatusSeeOther, "/admin")
+	}
+}
+
+// AdminDeleteHandler removes a post's file and reloads the store.
+func AdminDeleteHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		post, ok := store.Get(ctx.Param("slug"))
+		if !ok {
+			notFound(ctx, "Post not found")
+			return
+		}
+
+		err := os.Remove(post.File)
+		if err == nil {
+			err = store.Reload()
+		}
+		if err != nil {
+			ctx.Error(err)
+			adminError(ctx, "Couldn't delete the post")
+			return
+		}
+
+		ctx.Redirect(http.StatusSeeOther, "/admin")
+	}
+}
+
+func adminError(ctx *gin.Context, message string) {
+	ctx.String(http.StatusUnprocessableEntity, message)
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// writeFileAtomic replaces name with data through a temporary file, so the
+// file watcher never reloads a half written post.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark/ast"
+)
+
+// AllPostsHandler renders every post in full on a single printable page.
+func AllPostsHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		posts := visiblePosts(ctx, store)
+		sortPosts(posts, requestConfig(ctx).Sort)
+		if !renderPosts(ctx, posts...) {
+			return
+		}
+
+		renderHTML(ctx, http.StatusOK, "all.html", gin.H{
+			"Title": "All posts",
+			"Posts": posts,
+		})
+	}
+}
+
+// prefixedIDs generates heading ids prefixed with a post's slug, so that
+// anchors stay unique when several posts are rendered on one page.
+type prefixedIDs struct {
+	prefix string
+	used   map[string]bool
+}
+
+func newPrefixedIDs(prefix string) *prefixedIDs {
+	return &prefixedIDs{prefix: prefix, used: map[string]bool{}}
+}
+
+func (ids *prefixedIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var id []rune
+	for _, r := range string(value) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			id = append(id, unicode.ToLower(r))
+		case r == ' ' || r == '-' || r == '_':
+			if len(id) > 0 && id[len(id)-1] != '-' {
+				id = append(id, '-')
+			}
+		}
+	}
+
+	base := ids.prefix + "-" + string(id)
+	if len(id) == 0 {
+		base = ids.prefix + "-heading"
+	}
+
+	result := base
+	for i := 1; ids.used[result]; i++ {
+		result = base + "-" + strconv.Itoa(i)
+	}
+	ids.used[result] = true
+
+	return []byte(result)
+}
+
+func (ids *prefixedIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAllPosts(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	w := get(route, "/all")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"first post, with a",
+		"reads into a buffer",
+		`id="hello-world-a-heading"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/all doesn't contain %q", want)
+		}
+	}
+	for _, hidden := range []string{"Not yet.", "Published after the fixture clock."} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("/all contains %q of an unpublished post", hidden)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// Analytics counts page views without tracking readers: no cookies are
+// set, and neither addresses nor full user agents are stored. Views are
+// kept as counts by day, path, referring site and browser family, batched
+// in memory and written every flush interval like ViewCounter's. A nil
+// *Analytics records nothing.
+type Analytics struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	pending map[pageView]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// pageView is what's recorded of a view.
+type pageView struct {
+	Day      string
+	Path     string
+	Referrer string
+	Browser  string
+}
+
+// openAnalytics opens the database configured in cfg and starts flushing
+// to it, or returns nil when analytics are disabled.
+func openAnalytics(cfg AnalyticsConfig) (*Analytics, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "analytics.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS pageviews (
+		day      TEXT NOT NULL,
+		path     TEXT NOT NULL,
+		referrer TEXT NOT NULL,
+		browser  TEXT NOT NULL,
+		count    INTEGER NOT NULL,
+		PRIMARY KEY (day, path, referrer, browser)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	a := &Analytics{
+		db:      db,
+		pending: make(map[pageView]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.flushEvery(time.Duration(cfg.FlushInterval))
+
+	return a, nil
+}
+
+// Middleware records successful GET requests for HTML pages, cached ones
+// included. Bots, the admin pages and readers asking not to be tracked
+// with Do Not Track or Global Privacy Control aren't counted.
+func (a *Analytics) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if a == nil || ctx.Request.Method != http.MethodGet || ctx.Writer.Status() != http.StatusOK ||
+			!strings.HasPrefix(ctx.Writer.Header().Get("Content-Type"), "text/html") ||
+			strings.HasPrefix(ctx.Request.URL.Path, "/admin") || previewing(ctx) ||
+			ctx.GetHeader("DNT") == "1" || ctx.GetHeader("Sec-GPC") == "1" {
+			return
+		}
+
+		browser := browserFamily(ctx.Request.UserAgent())
+		if browser == "" {
+			return
+		}
+
+		a.hit(pageView{
+			Day:      time.Now().UTC().Format("2006-01-02"),
+			Path:     ctx.Request.URL.Path,
+			Referrer: referrerHost(ctx.Request),
+			Browser:  browser,
+		})
+	}
+}
+
+func (a *Analytics) hit(view pageView) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[view]++
+}
+
+// referrerHost returns the site a request was referred from, or "" for
+// direct visits and links within the blog.
+func referrerHost(req *http.Request) string {
+	u, err := url.Parse(req.Referer())
+	if err != nil || u.Host == "" || u.Host == req.Host {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// browserFamily reduces a user agent to the browser's name, or "" for
+// bots.
+func browserFamily(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case ua == "", strings.Contains(lower, "bot"), strings.Contains(lower, "spider"),
+		strings.Contains(lower, "crawl"), strings.Contains(lower, "curl"), strings.Contains(lower, "wget"),
+		strings.Contains(lower, "headless"):
+		return ""
+	// Order matters: Edge and Opera claim to be Chrome, which claims to
+	// be Safari.
+	case strings.Contains(ua, "Edg/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	}
+
+	return "Other"
+}
+
+func (a *Analytics) flushEvery(interval time.Duration) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.logFlush()
+		case <-a.stop:
+			a.logFlush()
+			return
+		}
+	}
+}
+
+func (a *Analytics) logFlush() {
+	if err := a.flush(); err != nil {
+		slog.Warn("saving page views", "error", err)
+	}
+}
+
+// flush writes the pending views in one transaction, keeping them pending
+// for the next flush if that fails.
+func (a *Analytics) flush() error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[pageView]int64)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := a.write(pending)
+	if err != nil {
+		a.mu.Lock()
+		for view, n := range pending {
+			a.pending[view] += n
+		}
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+func (a *Analytics) write(pending map[pageView]int64) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for view, n := range pending {
+		_, err = tx.Exec(`INSERT INTO pageviews (day, path, referrer, browser, count) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (day, path, referrer, browser) DO UPDATE SET count = count + excluded.count`,
+			view.Day, view.Path, view.Referrer, view.Browser, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Close writes the pending views and closes the database.
+func (a *Analytics) Close() error {
+	close(a.stop)
+	<-a.done
+
+	return a.db.Close()
+}
+
+// statsCount is a row of the stats dashboard: a day, path, referrer or
+// browser and its views.
+type statsCount struct {
+	Key   string
+	Views int64
+	// Percent is of the largest count in the list, for drawing bars.
+	Percent int64
+}
+
+// Stats summarizes the views since the start of the day days ago: the
+// views of each day, oldest first and including days without any, and the
+// most viewed paths, referrers and browsers.
+type Stats struct {
+	Days      int
+	Total     int64
+	Daily     []statsCount
+	Paths     []statsCount
+	Referrers []statsCount
+	Browsers  []statsCount
+}
+
+// Stats returns the views of the last days days, with up to limit paths
+// and referrers. Pending views are written first so they're included.
+func (a *Analytics) Stats(days, limit int) (Stats, error) {
+	stats := Stats{Days: days}
+	err := a.flush()
+	if err != nil {
+		return stats, err
+	}
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -days+1).Format("2006-01-02")
+
+	daily, err := a.counts(`SELECT day, SUM(count) FROM pageviews WHERE day >= ? GROUP BY day`, since)
+	if err != nil {
+		return stats, err
+	}
+	byDay := make(map[string]int64, len(daily))
+	for _, c := range daily {
+		byDay[c.Key] = c.Views
+		stats.Total += c.Views
+	}
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format("2006-01-02")
+		stats.Daily = append(stats.Daily, statsCount{Key: day, Views: byDay[day]})
+	}
+
+	stats.Paths, err = a.counts(`SELECT path, SUM(count) AS views FROM pageviews WHERE day >= ?
+		GROUP BY path ORDER BY views DESC, path LIMIT ?`, since, limit)
+	if err != nil {
+		return stats, err
+	}
+	stats.Referrers, err = a.counts(`SELECT referrer, SUM(count) AS views FROM pageviews WHERE day >= ? AND referrer != ''
+		GROUP BY referrer ORDER BY views DESC, referrer LIMIT ?`, since, limit)
+	if err != nil {
+		return stats, err
+	}
+	stats.Browsers, err = a.counts(`SELECT browser, SUM(count) AS views FROM pageviews WHERE day >= ?
+		GROUP BY browser ORDER BY views DESC, browser`, since)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, list := range [][]statsCount{stats.Daily, stats.Paths, stats.Referrers, stats.Browsers} {
+		setPercents(list)
+	}
+
+	return stats, nil
+}
+
+func (a *Analytics) counts(query string, args ...any) ([]statsCount, error) {
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []statsCount
+	for rows.Next() {
+		var c statsCount
+		err = rows.Scan(&c.Key, &c.Views)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+func setPercents(counts []statsCount) {
+	var most int64
+	for _, c := range counts {
+		most = max(most, c.Views)
+	}
+	if most == 0 {
+		return
+	}
+
+	for i := range counts {
+		counts[i].Percent = counts[i].Views * 100 / most
+	}
+}
+
+// AdminStatsHandler shows the analytics dashboard, for the last ?days=
+// days, 30 by default.
+func AdminStatsHandler(analytics *Analytics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		days := 30
+		if n, err := strconv.Atoi(ctx.Query("days")); err == nil && n > 0 && n <= 366 {
+			days = n
+		}
+
+		stats, err := analytics.Stats(days, 20)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't load stats")
+			return
+		}
+
+		renderHTML(ctx, http.StatusOK, "admin_stats.html", gin.H{
+			"Title": "Stats",
+			"Stats": stats,
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIPost is the metadata of a post as served by the JSON API.
+type APIPost struct {
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url"`
+	Description string     `json:"description,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	WordCount   int        `json:"word_count"`
+	ReadingTime string     `json:"reading_time"`
+}
+
+// APIPostDetail is a full post. Only one of HTML and Markdown is set,
+// depending on the requested format.
+type APIPostDetail struct {
+	APIPost
+	HTML     string `json:"html,omitempty"`
+	Markdown string `json:"markdown,omitempty"`
+}
+
+type APIPostList struct {
+	Posts      []APIPost `json:"posts"`
+	Page       int       `json:"page"`
+	TotalPages int       `json:"total_pages"`
+	Prev       string    `json:"prev,omitempty"`
+	Next       string    `json:"next,omitempty"`
+}
+
+func newAPIPost(ctx *gin.Context, post PostData) APIPost {
+	p := APIPost{
+		Title:       post.Title,
+		Slug:        post.Slug,
+		URL:         absoluteURL(ctx, post.URL),
+		Description: post.Description,
+		Author:      post.Author.Name,
+		Tags:        post.Tags,
+		Category:    post.Category,
+		WordCount:   post.WordCount(),
+		ReadingTime: post.ReadingTime(),
+	}
+	if !post.Date.IsZero() {
+		p.Date = &post.Date
+	}
+
+	return p
+}
+
+func apiPostsPageURL(page int) string {
+	return "/api/posts?page=" + strconv.Itoa(page)
+}
+
+// APIPostsHandler lists post metadata newest first, a page at a time.
+func APIPostsHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+
+		posts := visiblePosts(ctx, store)
+		sortPosts(posts, cfg.Sort)
+
+		posts, pagination, ok := paginate(posts, page, cfg.PageSize, apiPostsPageURL)
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "page not found"})
+			return
+		}
+
+		list := APIPostList{
+			Posts:      make([]APIPost, 0, len(posts)),
+			Page:       pagination.Page,
+			TotalPages: pagination.TotalPages,
+			Prev:       pagination.PrevURL,
+			Next:       pagination.NextURL,
+		}
+		for _, post := range posts {
+			list.Posts = append(list.Posts, newAPIPost(ctx, post))
+		}
+
+		ctx.JSON(http.StatusOK, list)
+	}
+}
+
+// APIPostHandler returns a single post, rendered as HTML by default or as
+// its markdown source with ?format=markdown.
+func APIPostHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		post, ok := visiblePost(ctx, store, ctx.Param("slug"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+
+		detail := APIPostDetail{APIPost: newAPIPost(ctx, post)}
+		switch ctx.DefaultQuery("format", "html") {
+		case "html":
+			detail.HTML = string(post.Content())
+		case "markdown":
+			detail.Markdown = post.Markdown
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be html or markdown"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, detail)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ArchiveYear groups the posts of one year by month, newest first.
+type ArchiveYear struct {
+	Year   int
+	URL    string
+	Months []ArchiveMonth
+}
+
+type ArchiveMonth struct {
+	Month time.Month
+	URL   string
+	Posts []PostData
+}
+
+// archiveURL returns the path of the archive of a year, or of a single
+// month when month is non-zero.
+func archiveURL(year int, month time.Month) string {
+	if month == 0 {
+		return fmt.Sprintf("/archive/%d", year)
+	}
+
+	return fmt.Sprintf("/archive/%d/%02d", year, month)
+}
+
+// archiveYears groups posts, which must be sorted newest first, by year and
+// month. Undated posts are left out.
+func archiveYears(posts []PostData) []ArchiveYear {
+	var years []ArchiveYear
+	for _, post := range posts {
+		if post.Date.IsZero() {
+			continue
+		}
+
+		year, month := post.Date.Year(), post.Date.Month()
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, ArchiveYear{Year: year, URL: archiveURL(year, 0)})
+		}
+
+		y := &years[len(years)-1]
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Month != month {
+			y.Months = append(y.Months, ArchiveMonth{Month: month, URL: archiveURL(year, month)})
+		}
+
+		m := &y.Months[len(y.Months)-1]
+		m.Posts = append(m.Posts, post)
+	}
+
+	return years
+}
+
+// ArchiveHandler lists posts grouped by year and month, optionally limited
+// to the year and month given in the path.
+func ArchiveHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		posts := visiblePosts(ctx, store)
+		sortPostsByDate(posts)
+		years := archiveYears(posts)
+		title := "Archive"
+
+		if ctx.Param("year") != "" {
+			year, err := strconv.Atoi(ctx.Param("year"))
+			if err != nil {
+				notFound(ctx, "Page not found")
+				return
+			}
+
+			var month time.Month
+			if ctx.Param("month") != "" {
+				m, err := strconv.Atoi(ctx.Param("month"))
+				if err != nil || m < 1 || m > 12 {
+					notFound(ctx, "Page not found")
+					return
+				}
+				month = time.Month(m)
+			}
+
+			years = filterArchive(years, year, month)
+			if month == 0 {
+				title = fmt.Sprintf("Archive %d", year)
+			} else {
+				title = fmt.Sprintf("Archive %s %d", month, year)
+			}
+		}
+
+		if len(years) == 0 {
+			notFound(ctx, "No posts in this period")
+			return
+		}
+
+		renderHTML(ctx, http.StatusOK, "archive.html", gin.H{
+			"Title": title,
+			"Years": years,
+		})
+	}
+}
+
+// filterArchive keeps only the given year and, when month is non-zero, the
+// given month of it.
+func filterArchive(years []ArchiveYear, year int, month time.Month) []ArchiveYear {
+	for _, y := range years {
+		if y.Year != year {
+			continue
+		}
+		if month == 0 {
+			return []ArchiveYear{y}
+		}
+
+		for _, m := range y.Months {
+			if m.Month == month {
+				y.Months = []ArchiveMonth{m}
+				return []ArchiveYear{y}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Assets maps the static files to fingerprinted names such as
+// css/style.3f2a9c1b04.css, which change whenever the content does and so
+// can be cached forever.
+type Assets struct {
+	fsys     fs.FS             // see staticFS
+	hashed   map[string]string // name -> fingerprinted name
+	original map[string]string // fingerprinted name -> name
+	// dev leaves names as they are, see URL.
+	dev bool
+}
+
+// loadAssets fingerprints every file in fsys. On error the returned Assets
+// is still usable and serves whatever was hashed so far.
+func loadAssets(fsys fs.FS) (*Assets, error) {
+	assets := &Assets{
+		fsys:     fsys,
+		hashed:   map[string]string{},
+		original: map[string]string{},
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		sum, err := fileHash(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + sum[:10] + ext
+		assets.hashed[name] = hashed
+		assets.original[hashed] = name
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return assets, err
+	}
+
+	return assets, nil
+}
+
+func fileHash(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// URL returns the path of a static file, fingerprinted unless in dev mode,
+// where files change while the server runs. name is relative to the static
+// directory, e.g. "css/style.css".
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := a.hashed[name]; ok && !a.dev {
+		return "/static/" + hashed
+	}
+
+	return "/static/" + name
+}
+
+// Handler serves /static/*filepath. Fingerprinted names are cached for a
+// year; plain names must be revalidated on every use.
+func (a *Assets) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		name := strings.TrimPrefix(ctx.Param("filepath"), "/")
+
+		cacheControl := "no-cache"
+		if original, ok := a.original[name]; ok {
+			name = original
+			cacheControl = "public, max-age=31536000, immutable"
+		}
+
+		info, err := fs.Stat(a.fsys, name)
+		if err != nil || info.IsDir() {
+			notFound(ctx, "Page not found")
+			return
+		}
+
+		ctx.Header("Cache-Control", cacheControl)
+		http.ServeFileFS(ctx.Writer, ctx.Request, a.fsys, name)
+	}
+}
+
+// writeHashed copies every file under out, which holds a copy of the static
+// directories, to its fingerprinted name as well.
+func (a *Assets) writeHashed(out string) error {
+	for name, hashed := range a.hashed {
+		err := copyFile(filepath.Join(out, filepath.FromSlash(name)), filepath.Join(out, filepath.FromSlash(hashed)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Author is who wrote a post. In frontmatter it is either written out in
+// full or, more usually, a key into authors.yaml:
+//
+//	author: gilang
+type Author struct {
+	Key    string `yaml:"-"`
+	Name   string `yaml:"name"`
+	Email  string `yaml:"email"`
+	Bio    string `yaml:"bio"`
+	Avatar string `yaml:"avatar"`
+	Social []Link `yaml:"social"`
+}
+
+func (a *Author) UnmarshalYAML(unmarshal func(any) error) error {
+	var key string
+	if unmarshal(&key) == nil {
+		*a = Author{Key: key}
+		return nil
+	}
+
+	type plain Author
+	return unmarshal((*plain)(a))
+}
+
+// URL returns the path of the author's page, or "" for authors not listed
+// in authors.yaml.
+func (a Author) URL() string {
+	if a.Key == "" {
+		return ""
+	}
+
+	return "/authors/" + url.PathEscape(a.Key)
+}
+
+// loadAuthors reads the authors file, keyed by the names posts use to
+// refer to them. A missing file means there are no shared authors.
+func loadAuthors(path string) (map[string]Author, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var authors map[string]Author
+	err = yaml.UnmarshalStrict(b, &authors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, author := range authors {
+		// Keys end up in URLs and, for static builds, file paths.
+		if !validSlug(key) {
+			return nil, fmt.Errorf("%s: invalid author key %q", path, key)
+		}
+		if author.Name == "" {
+			return nil, fmt.Errorf("%s: author %q needs a name", path, key)
+		}
+
+		author.Key = key
+		authors[key] = author
+	}
+
+	return authors, nil
+}
+
+func postsByAuthor(posts []PostData, key string) []PostData {
+	var matched []PostData
+	for _, post := range posts {
+		if post.Author.Key == key {
+			matched = append(matched, post)
+		}
+	}
+
+	return matched
+}
+
+// AuthorHandler shows an author's bio and lists their posts.
+func AuthorHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		posts := postsByAuthor(visiblePosts(ctx, store), ctx.Param("name"))
+		if len(posts) == 0 {
+			notFound(ctx, "Author not found")
+			return
+		}
+		sortPostsByDate(posts)
+
+		addFeeds(ctx, siteData(ctx).Title+": "+posts[0].Author.Name, posts[0].Author.URL())
+		renderHTML(ctx, http.StatusOK, "author.html", gin.H{
+			"Title":  posts[0].Author.Name,
+			"Author": posts[0].Author,
+			"Posts":  posts,
+		})
+	}
+}
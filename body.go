@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// postBody is the rendered body of a post. Posts are loaded with only
+// their frontmatter read; the body is rendered on first use and shared by
+// every copy of the post. Unless content.lazy is set, loading renders every
+// body right away so broken posts fail the reload. Bodies rendered before,
+// by this or a previous run, come from the render cache, see RenderCache.
+type postBody struct {
+	renderer *MarkdownRenderer
+	// source is the markdown without the <!--more--> marker, and lead the
+	// part before it, nil without one.
+	source []byte
+	lead   []byte
+	slug   string
+
+	// mu is held while rendering, which sets rendered and the fields
+	// after it.
+	mu       sync.Mutex
+	rendered bool
+	content  template.HTML
+	toc      []TOCEntry
+	excerpt  template.HTML
+	words    int
+	err      error
+}
+
+// render renders the post's body unless that's been done already.
+func (post PostData) render() *postBody {
+	b, _ := post.renderBody(context.Background())
+	return b
+}
+
+// renderBody renders the post's body unless that's been done already, or
+// c is done first. A render given up on returns c's error and is left for
+// the next caller to do.
+func (post PostData) renderBody(c context.Context) (*postBody, error) {
+	b := post.body
+	if b == nil {
+		return &postBody{}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rendered {
+		return b, nil
+	}
+
+	key := ""
+	if cache := b.renderer.cache; cache != nil && post.Hash != "" {
+		key = b.renderer.cacheKey(post.Hash, b.slug)
+		if cached, ok := cache.Get(key); ok {
+			b.content, b.toc, b.excerpt, b.words = cached.Content, cached.TOC, cached.Excerpt, cached.Words
+			b.rendered, b.source, b.lead = true, nil, nil
+			return b, nil
+		}
+	}
+
+	// Heading ids are namespaced by file name so several posts can share
+	// a page, see AllPostsHandler.
+	content, toc, err := b.renderer.Render(c, b.source, b.slug, post.Unsafe)
+	var excerpt template.HTML
+	if err == nil {
+		excerpt, err = postExcerpt(c, b.renderer, post, content, b.lead, b.slug+"-excerpt")
+	}
+	if err != nil && c.Err() != nil {
+		return b, c.Err()
+	}
+	b.content, b.toc, b.excerpt, b.err = content, toc, excerpt, err
+	b.words = wordCount(string(b.content))
+	b.rendered, b.source, b.lead = true, nil, nil
+
+	if b.err != nil {
+		b.err = fmt.Errorf("%s: %w", post.File, b.err)
+		// Without content.lazy the error fails the load instead.
+		if b.renderer.cfg.Content.Lazy {
+			slog.Error("rendering post", "error", b.err)
+		}
+		return b, nil
+	}
+
+	if key != "" {
+		err := b.renderer.cache.Put(key, renderedBody{Content: b.content, TOC: b.toc, Excerpt: b.excerpt, Words: b.words})
+		if err != nil {
+			slog.Warn("keeping rendered post", "file", post.File, "error", err)
+		}
+	}
+
+	return b, nil
+}
+
+// renderContext renders the bodies of posts, unless ctx is done first.
+// A body then rendering stops before goldmark starts on it; once started,
+// goldmark can't be interrupted, so the body finishes in the background
+// for the next request to use. The posts after it are left until they're
+// needed.
+func renderContext(c context.Context, posts ...PostData) error {
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, post := range posts {
+			if _, err = post.renderBody(c); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// renderPosts renders the bodies of posts within the request's time,
+// answering it with the 503 page and returning false if they take longer.
+func renderPosts(ctx *gin.Context, posts ...PostData) bool {
+	err := renderContext(ctx.Request.Context(), posts...)
+	if err != nil {
+		tooSlow(ctx, err)
+		return false
+	}
+
+	return true
+}
+
+// Content is the post's body as HTML.
+func (post PostData) Content() template.HTML {
+	return post.render().content
+}
+
+// TOC is the post's table of contents.
+func (post PostData) TOC() []TOCEntry {
+	return post.render().toc
+}
+
+// Excerpt is the post's excerpt as HTML, see postExcerpt.
+func (post PostData) Excerpt() template.HTML {
+	return post.render().excerpt
+}
+
+// WordCount is the number of words in the post's body.
+func (post PostData) WordCount() int {
+	return post.render().words
+}
+
+// ReadingTime is how long the post takes to read, such as "3 min read".
+func (post PostData) ReadingTime() string {
+	return readingTime(post.WordCount())
+}
+
+// Text is the post's text without markup, for search and related posts.
+// With content.lazy it's taken from the markdown, sparing the rendering of
+// every post for indexing them.
+func (post PostData) Text() string {
+	if post.body != nil && post.body.renderer.cfg.Content.Lazy {
+		return post.body.renderer.Text([]byte(post.Markdown))
+	}
+
+	return stripHTML(string(post.Content()))
+}
+
+// Text returns the words of source without rendering it, dropping
+// shortcodes and markup.
+func (r *MarkdownRenderer) Text(source []byte) string {
+	source = shortcodePattern.ReplaceAll(source, nil)
+	doc := r.md.Parser().Parse(text.NewReader(source))
+
+	var b strings.Builder
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		if n.Type() == ast.TypeBlock {
+			b.WriteByte(' ')
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *diffBlock:
+			for i := range n.Lines().Len() {
+				line := n.Lines().At(i)
+				b.Write(line.Value(source))
+			}
+		case *galleryBlock:
+			_, captions := n.galleryImages(source)
+			b.WriteString(strings.Join(captions, " "))
+		case *ast.RawHTML, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"testing"
+	"time"
+)
+
+func TestRenderContext(t *testing.T) {
+	cfg := defaultConfig()
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPost := func() PostData {
+		return PostData{body: &postBody{renderer: renderer, source: []byte("*Hello*")}}
+	}
+
+	post := newPost()
+	err = renderContext(context.Background(), post)
+	if err != nil || post.body.content != "<p><em>Hello</em></p>\n" {
+		t.Errorf("renderContext = %v, rendered %q", err, post.body.content)
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	post = newPost()
+	err = renderContext(c, post)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("renderContext after the request was cancelled = %v, want %v", err, context.Canceled)
+	}
+	if post.body.content != "" {
+		t.Error("renderContext rendered a post after the request was cancelled")
+	}
+	if got := post.Content(); got != "<p><em>Hello</em></p>\n" {
+		t.Errorf("Content of the post left unrendered = %q", got)
+	}
+}
+
+func TestRenderContextTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shortcode stands for a render that takes longer than the
+	// request may.
+	slow := make(chan struct{})
+	renderer.shortcodes = map[string]*template.Template{
+		"slow": template.Must(template.New("slow").Funcs(template.FuncMap{
+			"wait": func() string { <-slow; return "" },
+		}).Parse("{{wait}}")),
+	}
+	post := PostData{body: &postBody{renderer: renderer, source: []byte("{{< slow >}} *Hello*")}}
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = renderContext(c, post)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("renderContext of a slow post = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Let the render go on; it should give up rather than finish.
+	close(slow)
+	post.body.mu.Lock()
+	rendered := post.body.rendered
+	post.body.mu.Unlock()
+	if rendered {
+		t.Error("the render went on after the request timed out")
+	}
+	if got := post.Content(); got != "<p> <em>Hello</em></p>\n" {
+		t.Errorf("Content of the post given up on = %q", got)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// build renders the site to plain files for static hosting. Pages are
+// produced by sending requests through the same router the server uses,
+// so the output matches what the server would return.
+func build(cfg *Config, args []string, renderer *MarkdownRenderer) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	out := flags.String("out", "public", "directory to write the site to")
+	force := flags.Bool("force", false, "build even if posts fail the publish checks of build.checks")
+	flags.Parse(args)
+
+	if cfg.BaseURL == "" {
+		slog.Warn("base_url is not set, feeds will link to http://localhost")
+	}
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		return err
+	}
+
+	// Static sites have no /out to count clicks with.
+	cfg.Links.Track = false
+
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewContentStore(source, renderer)
+	if err != nil {
+		return err
+	}
+
+	// Every page is requested from the same made up client, which isn't
+	// one to slow down, and only once, which isn't worth caching.
+	cfg.RateLimit = RateLimitConfig{}
+	cfg.Cache.Enabled = false
+	// There's no server to print PDFs on, so posts link to the print
+	// dialog instead.
+	cfg.PDF.Enabled = false
+	pageStore, err := NewPageStore(cfg.PagesDir, renderer)
+	if err != nil {
+		return err
+	}
+
+	route, err := NewRouter(cfg, Deps{Store: store, Pages: optionalStore(pageStore), Renderer: renderer, Site: site})
+	if err != nil {
+		return err
+	}
+
+	var posts []PostData
+	now := time.Now()
+	for _, post := range store.Posts() {
+		if (cfg.Preview || post.Published(now)) && !post.Private() {
+			posts = append(posts, post)
+		}
+	}
+
+	// Refused builds leave the last one in place.
+	problems, err := checkPublishable(cfg, route, posts, cfg.Build.Checks)
+	if err != nil {
+		return err
+	}
+	if failed := printProblemsByFile(os.Stdout, problems); failed > 0 {
+		if !*force {
+			if failed == 1 {
+				return errors.New("1 post fails the publish checks, build with -force to build anyway")
+			}
+			return fmt.Errorf("%d posts fail the publish checks, build with -force to build anyway", failed)
+		}
+		slog.Warn("building despite failed publish checks", "posts", failed)
+	}
+
+	err = os.RemoveAll(*out)
+	if err != nil {
+		return err
+	}
+
+	pages := buildPages(cfg, posts)
+	if pageStore != nil {
+		for _, page := range pageStore.Posts() {
+			if (cfg.Preview || page.Published(now)) && !page.Private() {
+				pages = append(pages, page.URL)
+			}
+		}
+	}
+	if len(cfg.Images.Widths) > 0 {
+		images, err := imageVariantPaths(cfg)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, images...)
+	}
+	if cfg.Images.OG {
+		pages = append(pages, ogImagePaths(posts)...)
+	}
+
+	for _, page := range pages {
+		err = buildPage(route, cfg.BaseURL, *out, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = copyDir(staticFS(cfg), filepath.Join(*out, "static"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	assets, err := loadAssets(staticFS(cfg))
+	if err != nil {
+		return err
+	}
+
+	err = assets.writeHashed(filepath.Join(*out, "static"))
+	if err != nil {
+		return err
+	}
+
+	redirects, err := loadRedirects(cfg.RedirectsFile, cfg.DefaultLanguage)
+	if err != nil {
+		return err
+	}
+	redirects.SetPosts(posts)
+
+	return writeRedirectsFile(*out, redirects)
+}
+
+// buildPages lists the path of every page of the static site.
+func buildPages(cfg *Config, posts []PostData) []string {
+	pages := []string{"/", "/tags", "/all", "/archive", "/sitemap.xml", "/robots.txt"}
+	pages = append(pages, feedPaths(cfg, "")...)
+	if slices.Contains(cfg.Feeds, "rss") {
+		pages = append(pages, "/feeds.opml")
+	}
+	if cfg.IndexNow.Enabled {
+		pages = append(pages, indexNowKeyPath(cfg.IndexNow.Key))
+	}
+
+	for _, post := range posts {
+		pages = append(pages, post.URL, post.URL+".md", post.URL+".txt")
+	}
+
+	if cfg.multilingual() {
+		// Each language has its own index and feeds, and the unprefixed
+		// index only lists the default language.
+		perLang := map[string]int{}
+		for _, post := range posts {
+			perLang[post.Lang]++
+		}
+
+		pages = append(pages, indexPages("", perLang[cfg.DefaultLanguage], cfg.PageSize)...)
+		for _, lang := range cfg.Languages {
+			prefix := langPrefix(lang)
+			pages = append(pages, prefix+"/")
+			pages = append(pages, feedPaths(cfg, prefix)...)
+			pages = append(pages, indexPages(prefix, perLang[lang], cfg.PageSize)...)
+		}
+	} else {
+		pages = append(pages, indexPages("", len(posts), cfg.PageSize)...)
+	}
+
+	// Sections have their own index and feeds, in every language.
+	perSection := map[string]int{}
+	for _, post := range posts {
+		perSection[langPrefix(post.Lang)+sectionPrefix(post.Section)]++
+	}
+	prefixes := []string{""}
+	for _, lang := range cfg.Languages {
+		prefixes = append(prefixes, langPrefix(lang))
+	}
+	for _, section := range cfg.Sections {
+		for _, prefix := range prefixes {
+			count := perSection[prefix+sectionPrefix(section)]
+			if prefix == "" && cfg.multilingual() {
+				// Like the unprefixed index, it only lists the default
+				// language.
+				count = perSection[langPrefix(cfg.DefaultLanguage)+sectionPrefix(section)]
+			}
+
+			prefix += sectionPrefix(section)
+			pages = append(pages, prefix+"/")
+			pages = append(pages, feedPaths(cfg, prefix)...)
+			pages = append(pages, indexPages(prefix, count, cfg.PageSize)...)
+		}
+	}
+
+	for _, tag := range tagCounts(posts) {
+		url := tagURL(tag.Name)
+		pages = append(pages, url)
+		pages = append(pages, feedPaths(cfg, url)...)
+	}
+
+	sortPostsByDate(posts)
+	for _, year := range archiveYears(posts) {
+		pages = append(pages, year.URL)
+		for _, month := range year.Months {
+			pages = append(pages, month.URL)
+		}
+	}
+
+	authors := map[string]bool{}
+	for _, post := range posts {
+		if url := post.Author.URL(); url != "" && !authors[url] {
+			authors[url] = true
+			pages = append(pages, url)
+			pages = append(pages, feedPaths(cfg, url)...)
+		}
+	}
+
+	series := map[string]bool{}
+	for _, post := range posts {
+		url := langPrefix(post.Lang) + seriesURL(post.Series)
+		if post.Series != "" && !series[url] {
+			series[url] = true
+			pages = append(pages, url)
+		}
+	}
+
+	categories := map[string]bool{}
+	for _, post := range posts {
+		if post.Category != "" && !categories[strings.ToLower(post.Category)] {
+			categories[strings.ToLower(post.Category)] = true
+			pages = append(pages, categoryURL(post.Category))
+		}
+	}
+
+	return pages
+}
+
+// indexPages lists the index pages after the first for count posts, under
+// prefix, pageSize posts a page.
+func indexPages(prefix string, count, pageSize int) []string {
+	var pages []string
+	total := (count + pageSize - 1) / pageSize
+	for page := 2; page <= total; page++ {
+		pages = append(pages, prefix+indexPageURL(page))
+	}
+
+	return pages
+}
+
+// buildPage requests urlPath from route, as the host of baseURL, and writes
+// the response under out. Paths without an extension become directories
+// with an index.html, so the same URLs work on static hosts.
+func buildPage(route *gin.Engine, baseURL, out string, urlPath string) error {
+	req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+	if baseURL != "" {
+		if base, err := url.Parse(baseURL); err == nil {
+			req.Host = base.Host
+		}
+	} else {
+		req.Host = "localhost"
+	}
+
+	rec := httptest.NewRecorder()
+	route.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("building %s: status %d", urlPath, rec.Code)
+	}
+
+	file, err := url.PathUnescape(urlPath)
+	if err != nil {
+		return err
+	}
+	if path.Ext(file) == "" {
+		file = path.Join(file, "index.html")
+	}
+
+	dest, err := safeJoin(out, filepath.FromSlash(strings.TrimPrefix(file, "/")))
+	if err != nil {
+		return fmt.Errorf("building %s: %w", urlPath, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dest, rec.Body.Bytes(), 0o644)
+}
+
+// copyDir copies every file of fsys under dest.
+func copyDir(fsys fs.FS, dest string) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		in, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		return createFrom(target, in)
+	})
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return createFrom(dest, in)
+}
+
+// createFrom writes everything read from in to the file dest.
+func createFrom(dest string, in io.Reader) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
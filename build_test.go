@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildFixture builds the blog of testConfig, with the posts in content
+// and the given publish checks, to a temporary directory it returns.
+func buildFixture(t *testing.T, content map[string]string, checks []string, args ...string) (string, error) {
+	t.Helper()
+
+	cfg := testConfig(t)
+	cfg.ContentDir = writeContent(t, content)
+	cfg.Build.Checks = checks
+
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "public")
+	return out, build(&cfg, append([]string{"-out", out}, args...), renderer)
+}
+
+func TestBuildPublishChecks(t *testing.T) {
+	content := map[string]string{
+		"ready.md": "---\nTitle: Ready\nDate: 2025-01-01\nSlug: ready\nDescription: Done\nTags: [go]\n---\n\n" +
+			"Links to [the other post](/posts/sketchy).\n",
+		"sketchy.md": "---\nTitle: Sketchy\nDate: 2025-01-02\nSlug: sketchy\n---\n\nLinks to [nowhere](/posts/nowhere).\n",
+	}
+
+	t.Run("failing post blocks the build", func(t *testing.T) {
+		out, err := buildFixture(t, content, []string{"description", "tags", "links"})
+		if err == nil || !strings.Contains(err.Error(), "1 post fails the publish checks") {
+			t.Errorf("build error %v, want the sketchy post to fail", err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("refused build wrote %s", out)
+		}
+	})
+
+	t.Run("force", func(t *testing.T) {
+		out, err := buildFixture(t, content, []string{"description", "tags", "links"}, "-force")
+		if err != nil {
+			t.Fatalf("forced build: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(out, "posts", "sketchy", "index.html")); err != nil {
+			t.Errorf("forced build left out the failing post: %v", err)
+		}
+	})
+
+	t.Run("passing checks", func(t *testing.T) {
+		_, err := buildFixture(t, content, []string{"frontmatter"})
+		if err != nil {
+			t.Errorf("build: %v", err)
+		}
+	})
+
+	t.Run("unfinished draft", func(t *testing.T) {
+		content := map[string]string{
+			"ready.md": content["ready.md"],
+			"draft.md": "---\nTitle: Draft\nDate: someday\nSlug: not-the-file-name\nDraft: true\n---\n\nTo do.\n",
+		}
+		_, err := buildFixture(t, content, []string{"frontmatter"})
+		if err != nil {
+			t.Errorf("an invalid draft that isn't built failed the build: %v", err)
+		}
+	})
+
+	t.Run("invalid post", func(t *testing.T) {
+		content := map[string]string{
+			"ready.md": "---\nTitle: Ready\nDate: 2025-01-01\nSlug: not-the-file-name\n---\n\nReady.\n",
+		}
+		_, err := buildFixture(t, content, []string{"frontmatter"})
+		if err == nil || !strings.Contains(err.Error(), "1 post fails the publish checks") {
+			t.Errorf("build error %v, want the post with invalid frontmatter to fail", err)
+		}
+	})
+}
+
+func TestCheckPublishable(t *testing.T) {
+	var config Config
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.ContentDir = writeContent(t, map[string]string{
+			"bare.md": "---\nTitle: Bare\nDate: 2025-01-01\nSlug: bare\n---\n\nSee [the missing](/posts/missing) and [the real](/posts/bare).\n",
+		})
+		config = *cfg
+	})
+	renderer, err := NewMarkdownRenderer(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewContentStore(dirSource{dir: config.ContentDir}, renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	problems, err := checkPublishable(&config, route, store.Posts(), publishChecks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, p := range problems {
+		messages = append(messages, p.Message)
+	}
+	want := []string{
+		"missing Description",
+		"no Tags",
+		"missing cover, set MetaImage",
+		"broken link http://blog.example/posts/missing: status 404",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publishChecks are the checks build.checks can require of every post
+// built, see BuildConfig.
+var publishChecks = []string{"frontmatter", "description", "tags", "links", "cover"}
+
+// checkPublishable runs checks on the posts about to be built, requesting
+// their links from route, and returns what fails. frontmatter reports the
+// problems validate would find in them; drafts and other posts left out
+// of the build may be as unfinished as they like. route serves the blog
+// cfg configures.
+func checkPublishable(cfg *Config, route *gin.Engine, posts []PostData, checks []string) ([]Problem, error) {
+	var problems []Problem
+	if slices.Contains(checks, "frontmatter") {
+		lint, err := lintSource(cfg)
+		if err != nil {
+			return nil, err
+		}
+		built := map[string]bool{}
+		for _, post := range posts {
+			built[post.File] = true
+		}
+		for _, p := range lint {
+			if built[p.File] {
+				problems = append(problems, p)
+			}
+		}
+	}
+
+	var links *linkChecker
+	if slices.Contains(checks, "links") {
+		links = newLinkChecker(route, cfg.BaseURL)
+	}
+
+	for _, post := range posts {
+		report := func(message string) {
+			problems = append(problems, Problem{File: post.File, Message: message})
+		}
+
+		if slices.Contains(checks, "description") && post.Description == "" {
+			report("missing Description")
+		}
+		if slices.Contains(checks, "tags") && len(post.Tags) == 0 {
+			report("no Tags")
+		}
+		if slices.Contains(checks, "cover") && post.MetaImage == "" {
+			report("missing cover, set MetaImage")
+		}
+		if links != nil {
+			broken, _, err := links.checkPost(post)
+			if err != nil {
+				return nil, err
+			}
+			for _, link := range broken {
+				report("broken link " + link.Link + ": " + link.Problem)
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// printProblemsByFile prints problems under the file they're in, files in
+// the order they first come up, and returns how many files have some.
+func printProblemsByFile(w io.Writer, problems []Problem) int {
+	var files []string
+	byFile := map[string][]Problem{}
+	for _, p := range problems {
+		if _, ok := byFile[p.File]; !ok {
+			files = append(files, p.File)
+		}
+		byFile[p.File] = append(byFile[p.File], p)
+	}
+
+	for _, file := range files {
+		fmt.Fprintln(w, file+":")
+		for _, p := range byFile[file] {
+			if p.Line > 0 {
+				fmt.Fprintf(w, "  line %d: %s\n", p.Line, p.Message)
+			} else {
+				fmt.Fprintf(w, "  %s\n", p.Message)
+			}
+		}
+	}
+
+	return len(files)
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var pageCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "blog_page_cache_lookups_total",
+	Help: "Page cache lookups by result (hit or miss).",
+}, []string{"result"})
+
+// cachedRoutes are the routes whose pages PageCache keeps, in any
+// language.
+var cachedRoutes = map[string]bool{
+	"/":                    true,
+	"/page/:page":          true,
+	"/posts/:slug":         true,
+	"/:year/:month/:slug":  true,
+	"/tags":                true,
+	"/tags/:tag":           true,
+	"/feed.xml":            true,
+	"/atom.xml":            true,
+	"/feed.json":           true,
+	"/feeds.opml":          true,
+	"/tags/:tag/feed.xml":  true,
+	"/tags/:tag/atom.xml":  true,
+	"/tags/:tag/feed.json": true,
+}
+
+// PageCache keeps fully rendered pages in memory, keyed by absolute URL,
+// so most requests are answered without rendering anything. Pages are
+// tagged with surrogate keys naming what they show: "post:<slug>" for a post,
+// "tag:<tag>" and "series:<name>" for the posts with a tag or in a series,
+// and "all" for anything listing every post.
+// When posts change, only the pages with their keys are dropped.
+//
+// Responses carrying Cache-Control no-store or private are never kept, nor
+// are previews.
+type PageCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	pages map[string]*cachedPage
+	// posts remembers each post as of the last reload, to tell which ones
+	// changed.
+	posts map[string]cachedPost
+	// publishAt are the upcoming dates of scheduled posts, which appear
+	// on listings without a reload.
+	publishAt []time.Time
+}
+
+type cachedPage struct {
+	status  int
+	header  http.Header
+	body    []byte
+	nonce   string
+	keys    []string
+	expires time.Time
+	// onHit is run for every request the page answers, see cacheOnHit.
+	onHit []func(*gin.Context)
+	// unlessCookies are cookies that personalize the page, see
+	// cacheUnlessCookie.
+	unlessCookies []string
+}
+
+type cachedPost struct {
+	file      string
+	hash      string
+	published bool
+	tags      []string
+	series    string
+}
+
+// NewPageCache returns a cache keeping pages for up to ttl, and at most
+// maxEntries of them.
+func NewPageCache(ttl time.Duration, maxEntries int) *PageCache {
+	return &PageCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		pages:      map[string]*cachedPage{},
+	}
+}
+
+// Middleware answers requests for cached routes from the cache, or renders
+// and caches them. Caching is off for a nil PageCache.
+func (c *PageCache) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if c == nil {
+			return
+		}
+		cfg := requestConfig(ctx)
+		ctx.Set("PageCache", c)
+
+		if ctx.Request.Method != http.MethodGet || !matchRoute(cfg, cachedRoutes, ctx.FullPath()) || previewing(ctx) {
+			return
+		}
+
+		// Without a base URL, pages link to the host they were asked
+		// for, so a request with a forged Host mustn't be kept for
+		// everyone else.
+		key := absoluteURL(ctx, ctx.Request.URL.RequestURI())
+		if cfg.ActivityPub.Enabled && wantsActivity(ctx) {
+			key += " activity"
+		} else if format := acceptedRawFormat(ctx); format != "" {
+			key += " " + format
+		}
+		// Pages are rendered in the reader's theme.
+		key += " " + siteData(ctx).Theme
+
+		if page, ok := c.get(key, ctx.Request, time.Now()); ok {
+			pageCacheLookups.WithLabelValues("hit").Inc()
+			c.serve(ctx, page)
+			ctx.Abort()
+			return
+		}
+		pageCacheLookups.WithLabelValues("miss").Inc()
+
+		before := ctx.Writer.Header().Clone()
+		w := ctx.Writer
+		buf := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+		ctx.Writer = buf
+		defer func() { ctx.Writer = w }()
+
+		w.Header().Set("X-Cache", "MISS")
+		ctx.Next()
+
+		w.WriteHeader(buf.status)
+		if buf.body.Len() == 0 {
+			w.WriteHeaderNow()
+		} else {
+			w.Write(buf.body.Bytes())
+		}
+
+		if buf.status != http.StatusOK || len(ctx.Errors) > 0 {
+			return
+		}
+		cacheControl := w.Header().Get("Cache-Control")
+		if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+			return
+		}
+
+		page := &cachedPage{
+			status:        buf.status,
+			header:        http.Header{},
+			body:          bytes.Clone(buf.body.Bytes()),
+			nonce:         cspNonce(ctx),
+			keys:          ctx.GetStringSlice("CacheKeys"),
+			onHit:         cacheHooks(ctx),
+			unlessCookies: ctx.GetStringSlice("CacheUnlessCookies"),
+		}
+		if personalized(ctx.Request, page.unlessCookies) {
+			return
+		}
+		if len(page.keys) == 0 {
+			page.keys = []string{"all"}
+		}
+
+		// Only what the handler set is kept; the rest comes from
+		// middleware that runs for hits as well.
+		for name, values := range w.Header() {
+			if name != "Set-Cookie" && name != "X-Cache" && !slices.Equal(before[name], values) {
+				page.header[name] = slices.Clone(values)
+			}
+		}
+
+		c.put(key, page)
+	}
+}
+
+// serve answers the request with page, swapping the CSP nonce it was
+// rendered with for the request's own.
+func (c *PageCache) serve(ctx *gin.Context, page *cachedPage) {
+	for name, values := range page.header {
+		ctx.Writer.Header()[name] = slices.Clone(values)
+	}
+	ctx.Header("X-Cache", "HIT")
+
+	for _, hook := range page.onHit {
+		hook(ctx)
+	}
+
+	body := page.body
+	if nonce := cspNonce(ctx); page.nonce != "" && nonce != "" {
+		body = bytes.ReplaceAll(body, []byte(page.nonce), []byte(nonce))
+	}
+
+	ctx.Status(page.status)
+	ctx.Writer.Write(body)
+}
+
+func (c *PageCache) get(key string, req *http.Request, now time.Time) (*cachedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.publishAt) > 0 && !now.Before(c.publishAt[0]) {
+		// A scheduled post went live.
+		clear(c.pages)
+		for len(c.publishAt) > 0 && !now.Before(c.publishAt[0]) {
+			c.publishAt = c.publishAt[1:]
+		}
+	}
+
+	page, ok := c.pages[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(page.expires) {
+		delete(c.pages, key)
+		return nil, false
+	}
+	if personalized(req, page.unlessCookies) {
+		return nil, false
+	}
+
+	return page, true
+}
+
+func (c *PageCache) put(key string, page *cachedPage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	page.expires = now.Add(c.ttl)
+
+	if len(c.pages) >= c.maxEntries {
+		for k, p := range c.pages {
+			if now.After(p.expires) {
+				delete(c.pages, k)
+			}
+		}
+	}
+	if len(c.pages) >= c.maxEntries {
+		// Any page will do, they're all cheap to render again.
+		for k := range c.pages {
+			delete(c.pages, k)
+			break
+		}
+	}
+
+	c.pages[key] = page
+}
+
+// Purge drops every page tagged with one of keys.
+func (c *PageCache) Purge(keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, page := range c.pages {
+		for _, key := range keys {
+			if slices.Contains(page.keys, key) {
+				delete(c.pages, k)
+				break
+			}
+		}
+	}
+}
+
+// SetPosts purges the pages of the posts that changed since the last call,
+// for ContentStore.OnReload.
+func (c *PageCache) SetPosts(posts []PostData) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	current := make(map[string]cachedPost, len(posts))
+	var publishAt []time.Time
+	for _, post := range posts {
+		tags := make([]string, len(post.Tags))
+		for i, tag := range post.Tags {
+			tags[i] = strings.ToLower(tag)
+		}
+		current[post.Lang+"/"+post.Slug] = cachedPost{
+			file:      post.File,
+			hash:      post.Hash,
+			published: post.Published(now),
+			tags:      tags,
+			series:    strings.ToLower(post.Series),
+		}
+
+		if !post.Draft && post.PublishTime().After(now) {
+			publishAt = append(publishAt, post.PublishTime())
+		}
+	}
+	slices.SortFunc(publishAt, func(a, b time.Time) int { return a.Compare(b) })
+
+	c.mu.Lock()
+	previous := c.posts
+	c.posts = current
+	c.publishAt = publishAt
+	c.mu.Unlock()
+
+	var keys []string
+	changed := func(slug string, post cachedPost) {
+		keys = append(keys, "post:"+slug)
+		for _, tag := range post.tags {
+			keys = append(keys, "tag:"+tag)
+		}
+		if post.series != "" {
+			keys = append(keys, "series:"+post.series)
+		}
+	}
+	for key, post := range current {
+		old, ok := previous[key]
+		if !ok || old.file != post.file || old.hash != post.hash || old.published != post.published {
+			_, slug, _ := strings.Cut(key, "/")
+			changed(slug, post)
+			changed(slug, old)
+		}
+	}
+	for key, old := range previous {
+		if _, ok := current[key]; !ok {
+			_, slug, _ := strings.Cut(key, "/")
+			changed(slug, old)
+		}
+	}
+
+	if len(keys) > 0 {
+		c.Purge(append(keys, "all")...)
+	}
+}
+
+// cacheKeys tags the response with surrogate keys, see PageCache. Pages
+// without keys are tagged "all".
+func cacheKeys(ctx *gin.Context, keys ...string) {
+	ctx.Set("CacheKeys", append(ctx.GetStringSlice("CacheKeys"), keys...))
+}
+
+// cacheOnHit registers hook to run for every request a cached copy of the
+// response answers, for side effects of the handler such as counting a
+// view.
+func cacheOnHit(ctx *gin.Context, hook func(*gin.Context)) {
+	ctx.Set("CacheHooks", append(cacheHooks(ctx), hook))
+}
+
+func cacheHooks(ctx *gin.Context) []func(*gin.Context) {
+	hooks, _ := ctx.Value("CacheHooks").([]func(*gin.Context))
+	return hooks
+}
+
+// cacheUnlessCookie marks the response as personalized for readers sending
+// the cookie name: their requests neither use nor fill the cache.
+func cacheUnlessCookie(ctx *gin.Context, name string) {
+	ctx.Set("CacheUnlessCookies", append(ctx.GetStringSlice("CacheUnlessCookies"), name))
+}
+
+func personalized(req *http.Request, cookies []string) bool {
+	for _, name := range cookies {
+		if _, err := req.Cookie(name); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// purgeCache drops the cached pages tagged with keys, for handlers that
+// change what pages show.
+func purgeCache(ctx *gin.Context, keys ...string) {
+	c, _ := ctx.Value("PageCache").(*PageCache)
+	c.Purge(keys...)
+}
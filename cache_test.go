@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageCacheKeysByHost(t *testing.T) {
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.BaseURL = ""
+		cfg.Cache = CacheConfig{Enabled: true, TTL: Duration(time.Hour), MaxEntries: 100}
+	})
+
+	feed := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+		req.Host = host
+		return do(route, req)
+	}
+
+	if w := feed("evil.example"); w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: X-Cache %q, want MISS", w.Header().Get("X-Cache"))
+	}
+	w := feed("blog.example")
+	if got := w.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("another host: X-Cache %q, want MISS", got)
+	}
+	if strings.Contains(w.Body.String(), "evil.example") {
+		t.Error("the feed links to the host of another request")
+	}
+
+	if w := feed("blog.example"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("same host again: X-Cache %q, want HIT", w.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	xhtml "golang.org/x/net/html"
+)
+
+// brokenLink is a link of a post that leads nowhere.
+type brokenLink struct {
+	File    string
+	Link    string
+	Problem string
+}
+
+func (l brokenLink) String() string {
+	return l.File + ": " + l.Link + ": " + l.Problem
+}
+
+// checkLinks renders every post and page and reports their links that
+// lead nowhere. Links within the blog are requested through the same
+// router the server uses, so they're checked against the posts, tags,
+// pages and static files it would serve; links to headings must match an
+// id on the page. With -external, links to other sites are checked too.
+func checkLinks(cfg *Config, args []string, renderer *MarkdownRenderer) error {
+	flags := flag.NewFlagSet("checklinks", flag.ExitOnError)
+	checkExternal := flags.Bool("external", false, "also check links to other sites")
+	concurrency := flags.Int("concurrency", 8, "how many links to other sites to check at once")
+	timeout := flags.Duration("timeout", 10*time.Second, "how long to wait for each site")
+	flags.Parse(args)
+
+	// Links must come out as written, and every page is requested from the
+	// same made up client.
+	cfg.Links.Track = false
+	cfg.RateLimit = RateLimitConfig{}
+	cfg.Cache.Enabled = false
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		return err
+	}
+
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewContentStore(source, renderer)
+	if err != nil {
+		return err
+	}
+
+	pageStore, err := NewPageStore(cfg.PagesDir, renderer)
+	if err != nil {
+		return err
+	}
+
+	route, err := NewRouter(cfg, Deps{Store: store, Pages: optionalStore(pageStore), Renderer: renderer, Site: site})
+	if err != nil {
+		return err
+	}
+	checker := newLinkChecker(route, cfg.BaseURL)
+	checker.timeout = *timeout
+
+	posts := store.Posts()
+	if pageStore != nil {
+		posts = append(posts, pageStore.Posts()...)
+	}
+
+	var broken []brokenLink
+	externalLinks := map[string][]string{}
+	now := time.Now()
+	for _, post := range posts {
+		if !cfg.Preview && !post.Published(now) {
+			continue
+		}
+
+		postBroken, external, err := checker.checkPost(post)
+		if err != nil {
+			return err
+		}
+		broken = append(broken, postBroken...)
+		if *checkExternal {
+			for _, link := range external {
+				externalLinks[link] = append(externalLinks[link], post.File)
+			}
+		}
+	}
+
+	var toCheck []string
+	for link := range externalLinks {
+		toCheck = append(toCheck, link)
+	}
+	slices.Sort(toCheck)
+	for link, problem := range checker.checkExternal(toCheck, *concurrency) {
+		for _, file := range externalLinks[link] {
+			broken = append(broken, brokenLink{file, link, problem})
+		}
+	}
+
+	slices.SortFunc(broken, func(a, b brokenLink) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	for _, link := range broken {
+		fmt.Println(link)
+	}
+	if len(broken) > 0 {
+		return fmt.Errorf("%d broken links found", len(broken))
+	}
+
+	return nil
+}
+
+type linkChecker struct {
+	route *gin.Engine
+	host  string
+	// internal remembers the problem with each path of the blog, empty
+	// for those that work.
+	internal map[string]string
+
+	client  *http.Client
+	timeout time.Duration
+}
+
+// newLinkChecker checks links against route, as the blog at baseURL.
+func newLinkChecker(route *gin.Engine, baseURL string) *linkChecker {
+	checker := &linkChecker{
+		route:    route,
+		host:     "localhost",
+		internal: map[string]string{},
+		client:   outboundClient(true),
+		timeout:  10 * time.Second,
+	}
+	if base, err := url.Parse(baseURL); err == nil && base.Host != "" {
+		checker.host = base.Host
+	}
+
+	return checker
+}
+
+// checkPost checks the links of post within the blog, returning those
+// that are broken and the links to other sites, unchecked and without
+// their fragments.
+func (c *linkChecker) checkPost(post PostData) (broken []brokenLink, external []string, err error) {
+	base := &url.URL{Scheme: "http", Host: c.host, Path: post.URL}
+	links, ids, err := htmlLinks(string(post.Content()), base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", post.File, err)
+	}
+
+	for _, link := range links {
+		u, err := url.Parse(link)
+		switch {
+		case err != nil:
+			broken = append(broken, brokenLink{post.File, link, "malformed URL"})
+		case u.Scheme != "http" && u.Scheme != "https":
+			// mailto: and the like.
+		case u.Host == c.host:
+			if problem := c.checkInternal(u, post.URL, ids); problem != "" {
+				broken = append(broken, brokenLink{post.File, link, problem})
+			}
+		default:
+			u.Fragment = ""
+			external = append(external, u.String())
+		}
+	}
+
+	return broken, external, nil
+}
+
+// checkInternal checks a link to the blog from the page at from, whose
+// element ids are ids.
+func (c *linkChecker) checkInternal(u *url.URL, from string, ids map[string]bool) string {
+	if u.Path == from || u.Path == "" {
+		if u.Fragment != "" && !ids[u.Fragment] {
+			return "no #" + u.Fragment + " on the page"
+		}
+		return ""
+	}
+
+	target := u.RequestURI()
+	problem, ok := c.internal[target]
+	if ok {
+		return problem
+	}
+
+	// Redirects within the blog are followed; old URLs of moved posts
+	// still work.
+	problem = "too many redirects"
+	for range 5 {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		c.route.ServeHTTP(rec, req)
+
+		location := rec.Header().Get("Location")
+		if rec.Code >= 300 && rec.Code < 400 && location != "" {
+			next, err := u.Parse(location)
+			if err == nil && next.Host == c.host {
+				target = next.RequestURI()
+				continue
+			}
+		}
+
+		problem = ""
+		if rec.Code != http.StatusOK {
+			problem = fmt.Sprintf("status %d", rec.Code)
+		}
+		break
+	}
+
+	c.internal[u.RequestURI()] = problem
+	return problem
+}
+
+// checkExternal requests links, concurrency of them at once, returning the
+// problem with each broken one.
+func (c *linkChecker) checkExternal(links []string, concurrency int) map[string]string {
+	var mu sync.Mutex
+	problems := map[string]string{}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(1, concurrency))
+	for _, link := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if problem := c.checkExternalLink(link); problem != "" {
+				mu.Lock()
+				problems[link] = problem
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return problems
+}
+
+func (c *linkChecker) checkExternalLink(link string) string {
+	status, err := c.request(http.MethodHead, link)
+	// Plenty of sites don't answer HEAD requests properly.
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusForbidden || status == http.StatusNotImplemented) {
+		status, err = c.request(http.MethodGet, link)
+	}
+
+	switch {
+	case err != nil:
+		return err.Error()
+	case status >= 400:
+		return fmt.Sprintf("status %d", status)
+	}
+
+	return ""
+}
+
+func (c *linkChecker) request(method, link string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "go_blog checklinks")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// htmlLinks returns the absolute targets of the links and images in an
+// HTML fragment, and the ids of its elements.
+func htmlLinks(fragment string, base *url.URL) (links []string, ids map[string]bool, err error) {
+	doc, err := xhtml.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids = map[string]bool{}
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			if id, ok := htmlAttr(n, "id"); ok {
+				ids[id] = true
+			}
+
+			attr := ""
+			switch n.Data {
+			case "a":
+				attr = "href"
+			case "img":
+				attr = "src"
+			}
+			if ref, ok := htmlAttr(n, attr); ok && attr != "" {
+				if u, err := base.Parse(ref); err == nil {
+					links = append(links, u.String())
+				} else {
+					links = append(links, ref)
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links, ids, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeBlocks extends fenced code blocks: ```go:main.go names the file the
+// code is from, shown above the block, and diff blocks have their added and
+// removed lines marked for styling instead of being highlighted. Blocks
+// are wrapped by wrap, see codeBlockWrapper.
+type codeBlocks struct {
+	wrap highlighting.WrapperRenderer
+}
+
+func (e codeBlocks) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(codeBlockTransformer{}, 600)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(diffRenderer{wrap: e.wrap}, 500),
+	))
+}
+
+var kindDiffBlock = ast.NewNodeKind("DiffBlock")
+
+// diffBlock is a fenced code block in the diff language.
+type diffBlock struct {
+	ast.BaseBlock
+}
+
+func (n *diffBlock) Kind() ast.NodeKind { return kindDiffBlock }
+
+func (n *diffBlock) IsRaw() bool { return true }
+
+func (n *diffBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// codeBlockTransformer runs before the other transformers, as the
+// language of code blocks is cached the first time it's asked for.
+type codeBlockTransformer struct{}
+
+// Transform moves the file name of ```lang:file blocks to their filename
+// attribute, leaving lang as their language, and turns diff blocks into
+// diffBlocks. Attributes written after the info string, such as
+// {hl_lines=[2]}, are kept: once a block has attributes of its own,
+// they're all the highlighter looks at.
+func (codeBlockTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var blocks []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering && block.Info != nil {
+			blocks = append(blocks, block)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		segment := block.Info.Segment
+		info := segment.Value(source)
+
+		end := bytes.IndexAny(info, " {")
+		if end < 0 {
+			end = len(info)
+		}
+		lang, file, hasFile := bytes.Cut(info[:end], []byte(":"))
+		isDiff := string(lang) == "diff"
+		if !hasFile && !isDiff {
+			continue
+		}
+
+		if start := bytes.IndexByte(info, '{'); start >= 0 {
+			if attrs, ok := parser.ParseAttributes(text.NewReader(info[start:])); ok {
+				for _, attr := range attrs {
+					block.SetAttribute(attr.Name, attr.Value)
+				}
+			}
+		}
+		if len(file) > 0 {
+			block.SetAttributeString("filename", file)
+		}
+
+		if isDiff {
+			diff := &diffBlock{}
+			diff.SetLines(block.Lines())
+			for _, attr := range block.Attributes() {
+				diff.SetAttribute(attr.Name, attr.Value)
+			}
+			block.Parent().ReplaceChild(block.Parent(), block, diff)
+			continue
+		}
+
+		if len(lang) == 0 {
+			block.Info = nil
+		} else {
+			block.Info = ast.NewTextSegment(text.NewSegment(segment.Start, segment.Start+len(lang)))
+		}
+	}
+}
+
+type diffRenderer struct {
+	wrap highlighting.WrapperRenderer
+}
+
+func (r diffRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindDiffBlock, r.render)
+}
+
+// diffLineClasses are the classes of diff lines, by their first character.
+var diffLineClasses = map[byte]string{
+	'+': "diff-add",
+	'-': "diff-del",
+	'@': "diff-hunk",
+}
+
+func (r diffRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	c := diffContext{node}
+	r.wrap(w, c, true)
+
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := segment.Value(source)
+
+		class := ""
+		if len(line) > 0 {
+			class = diffLineClasses[line[0]]
+		}
+		if class == "" {
+			_, _ = w.Write(util.EscapeHTML(line))
+			continue
+		}
+
+		_, _ = w.WriteString(`<span class="` + class + `">`)
+		_, _ = w.Write(util.EscapeHTML(bytes.TrimRight(line, "\n")))
+		_, _ = w.WriteString("</span>\n")
+	}
+
+	r.wrap(w, c, false)
+
+	return ast.WalkSkipChildren, nil
+}
+
+// diffContext describes a diffBlock to the code block wrapper like the
+// highlighter does its blocks.
+type diffContext struct {
+	node ast.Node
+}
+
+func (c diffContext) Language() ([]byte, bool) { return []byte("diff"), true }
+
+func (c diffContext) Highlighted() bool { return false }
+
+func (c diffContext) Attributes() highlighting.ImmutableAttributes { return c }
+
+func (c diffContext) Get(name []byte) (any, bool) { return c.node.Attribute(name) }
+
+func (c diffContext) GetString(name string) (any, bool) { return c.node.AttributeString(name) }
+
+func (c diffContext) All() []ast.Attribute { return c.node.Attributes() }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// themeCookie holds the reader's choice of the dark or light theme. It's
+// readable by scripts, which switch themes without a reload.
+const themeCookie = "theme"
+
+func validTheme(theme string) bool {
+	return theme == "dark" || theme == "light"
+}
+
+// requestTheme returns the theme the reader picked, or the site's default.
+func requestTheme(ctx *gin.Context, site SiteData) string {
+	if theme, err := ctx.Cookie(themeCookie); err == nil && validTheme(theme) {
+		return theme
+	}
+
+	return site.Theme
+}
+
+// ThemeHandler stores the theme picked with the header's toggle, or the
+// opposite of the current one, and sends the reader back to the page they
+// were on.
+func ThemeHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		theme := ctx.PostForm("theme")
+		if !validTheme(theme) {
+			theme = "dark"
+			if siteData(ctx).Theme == "dark" {
+				theme = "light"
+			}
+		}
+
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(themeCookie, theme, int((365 * 24 * time.Hour).Seconds()), "/", "", false, false)
+
+		target := "/"
+		if referer, err := url.Parse(ctx.Request.Referer()); err == nil && referer.Host == ctx.Request.Host && referer.Path != "" {
+			target = referer.RequestURI()
+		}
+		ctx.Redirect(http.StatusSeeOther, target)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Comment is a reader's comment on a post. Email is kept for the author
+// of the blog only and never shown.
+type Comment struct {
+	ID       int64     `json:"id"`
+	Slug     string    `json:"slug"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email,omitempty"`
+	Body     string    `json:"body"`
+	Created  time.Time `json:"created"`
+	Approved bool      `json:"approved"`
+}
+
+// CommentStore persists comments. Implementations must be safe for
+// concurrent use.
+type CommentStore interface {
+	// Add stores c, assigning its ID.
+	Add(c Comment) (Comment, error)
+	// Approved returns the approved comments on a post, oldest first.
+	Approved(slug string) ([]Comment, error)
+	// CommentCount returns the number of approved comments on a post.
+	CommentCount(slug string) (int, error)
+	Close() error
+}
+
+// openCommentStore opens the store configured in cfg, or returns nil when
+// comments are disabled.
+func openCommentStore(cfg CommentsConfig) (CommentStore, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	switch cfg.Storage {
+	case "json":
+		return openJSONCommentStore(firstNonEmpty(cfg.Path, "comments.json"))
+	case "sqlite":
+		return openSQLiteCommentStore(firstNonEmpty(cfg.Path, "comments.db"))
+	}
+
+	return nil, fmt.Errorf("unknown comment storage %q", cfg.Storage)
+}
+
+const (
+	maxCommentName = 100
+	maxCommentBody = 5000
+	// commentInterval is how long a client must wait between comments.
+	commentInterval = 30 * time.Second
+)
+
+var errCommentInvalid = errors.New("comment needs a name and a body of reasonable length")
+
+// newComment validates and normalizes the submitted form fields.
+func newComment(slug, name, email, body string) (Comment, error) {
+	c := Comment{
+		Slug:    slug,
+		Name:    strings.TrimSpace(name),
+		Email:   strings.TrimSpace(email),
+		Body:    strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n")),
+		Created: time.Now().UTC(),
+	}
+
+	if c.Name == "" || utf8.RuneCountInString(c.Name) > maxCommentName ||
+		c.Body == "" || utf8.RuneCountInString(c.Body) > maxCommentBody ||
+		len(c.Email) > 254 {
+		return c, errCommentInvalid
+	}
+
+	return c, nil
+}
+
+// commentLimiter allows each client one comment per commentInterval.
+type commentLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func (l *commentLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last == nil {
+		l.last = map[string]time.Time{}
+	}
+	for c, t := range l.last {
+		if now.Sub(t) >= commentInterval {
+			delete(l.last, c)
+		}
+	}
+
+	if _, ok := l.last[client]; ok {
+		return false
+	}
+	l.last[client] = now
+
+	return true
+}
+
+// CommentHandler accepts the comment form posted from a post page and
+// redirects back to it, with ?comment= telling the page what happened.
+// Submissions filling in the hidden "website" field are bots; they are
+// told their comment awaits moderation and dropped.
+func CommentHandler(store PostStore, comments CommentStore) gin.HandlerFunc {
+	var limiter commentLimiter
+
+	return func(ctx *gin.Context) {
+		post, ok := visiblePost(ctx, store, ctx.Param("slug"))
+		if !ok || !post.Published(requestTime(ctx)) {
+			notFound(ctx, "Post not found")
+			return
+		}
+
+		back := func(status string) {
+			ctx.Redirect(http.StatusSeeOther, post.URL+"?comment="+status+"#comments")
+		}
+
+		if ctx.PostForm("website") != "" {
+			back("pending")
+			return
+		}
+
+		c, err := newComment(post.Slug, ctx.PostForm("name"), ctx.PostForm("email"), ctx.PostForm("body"))
+		if err != nil {
+			back("invalid")
+			return
+		}
+
+		if !limiter.allow(ctx.ClientIP(), time.Now()) {
+			back("slow")
+			return
+		}
+
+		c.Approved = !requestConfig(ctx).Comments.Moderate
+		_, err = comments.Add(c)
+		if err != nil {
+			slog.Error("saving comment", "slug", post.Slug, "error", err)
+			back("failed")
+			return
+		}
+
+		if c.Approved {
+			purgeCache(ctx, "post:"+post.Slug)
+			back("posted")
+		} else {
+			back("pending")
+		}
+	}
+}
+
+// CommentCounts caches the comment counts of posts for a while, so post
+// cards and headers can show them without asking the store on every page.
+// A nil *CommentCounts, with comments disabled, counts none.
+type CommentCounts struct {
+	store CommentStore
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	counts map[string]commentCount
+}
+
+type commentCount struct {
+	n       int
+	expires time.Time
+}
+
+// newCommentCounts returns counts of the comments in store kept for ttl,
+// or nil without a store.
+func newCommentCounts(store CommentStore, ttl time.Duration) *CommentCounts {
+	if store == nil {
+		return nil
+	}
+
+	return &CommentCounts{store: store, ttl: ttl, counts: map[string]commentCount{}}
+}
+
+// Count returns the number of comments on the post with slug. It's 0, and
+// the count is hidden, when the store can't tell; the failure is cached
+// like a count so a struggling store isn't asked for every card.
+func (c *CommentCounts) Count(slug string) int {
+	if c == nil {
+		return 0
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	count, ok := c.counts[slug]
+	c.mu.Unlock()
+	if ok && now.Before(count.expires) {
+		return count.n
+	}
+
+	n, err := c.store.CommentCount(slug)
+	if err != nil {
+		slog.Warn("counting comments", "slug", slug, "error", err)
+		n = 0
+	}
+
+	c.mu.Lock()
+	c.counts[slug] = commentCount{n: n, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return n
+}
+
+// postComments returns the approved comments on post, logging failures
+// so a broken store doesn't take post pages down with it.
+func postComments(comments CommentStore, slug string) []Comment {
+	if comments == nil {
+		return nil
+	}
+
+	list, err := comments.Approved(slug)
+	if err != nil {
+		slog.Error("loading comments", "slug", slug, "error", err)
+	}
+
+	return list
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// jsonCommentStore keeps every comment in memory and rewrites a single
+// JSON file on each change, which is plenty for a personal blog.
+type jsonCommentStore struct {
+	path     string
+	mu       sync.Mutex
+	comments []Comment
+	nextID   int64
+}
+
+func openJSONCommentStore(path string) (*jsonCommentStore, error) {
+	s := &jsonCommentStore{path: path, nextID: 1}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &s.comments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range s.comments {
+		s.nextID = max(s.nextID, c.ID+1)
+	}
+
+	return s, nil
+}
+
+func (s *jsonCommentStore) Add(c Comment) (Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.ID = s.nextID
+	comments := append(s.comments[:len(s.comments):len(s.comments)], c)
+
+	err := s.save(comments)
+	if err != nil {
+		return c, err
+	}
+
+	s.comments = comments
+	s.nextID++
+
+	return c, nil
+}
+
+func (s *jsonCommentStore) Approved(slug string) ([]Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var approved []Comment
+	for _, c := range s.comments {
+		if c.Slug == slug && c.Approved {
+			approved = append(approved, c)
+		}
+	}
+
+	return approved, nil
+}
+
+func (s *jsonCommentStore) CommentCount(slug string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, c := range s.comments {
+		if c.Slug == slug && c.Approved {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// save writes comments to a temporary file and renames it into place, so
+// a crash never leaves a truncated file behind.
+func (s *jsonCommentStore) save(comments []Comment) error {
+	b, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".comments-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *jsonCommentStore) Close() error {
+	return nil
+}
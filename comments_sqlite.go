@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type sqliteCommentStore struct {
+	db *sql.DB
+}
+
+func openSQLiteCommentStore(path string) (*sqliteCommentStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS comments (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		slug     TEXT NOT NULL,
+		name     TEXT NOT NULL,
+		email    TEXT NOT NULL,
+		body     TEXT NOT NULL,
+		created  INTEGER NOT NULL,
+		approved INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS comments_slug ON comments (slug)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteCommentStore{db: db}, nil
+}
+
+func (s *sqliteCommentStore) Add(c Comment) (Comment, error) {
+	res, err := s.db.Exec(`INSERT INTO comments (slug, name, email, body, created, approved) VALUES (?, ?, ?, ?, ?, ?)`,
+		c.Slug, c.Name, c.Email, c.Body, c.Created.Unix(), c.Approved)
+	if err != nil {
+		return c, err
+	}
+
+	c.ID, err = res.LastInsertId()
+	return c, err
+}
+
+func (s *sqliteCommentStore) Approved(slug string) ([]Comment, error) {
+	rows, err := s.db.Query(`SELECT id, slug, name, email, body, created, approved FROM comments WHERE slug = ? AND approved ORDER BY created, id`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		var created int64
+		err = rows.Scan(&c.ID, &c.Slug, &c.Name, &c.Email, &c.Body, &created, &c.Approved)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Created = time.Unix(created, 0).UTC()
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+func (s *sqliteCommentStore) CommentCount(slug string) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM comments WHERE slug = ? AND approved`, slug).Scan(&n)
+	return n, err
+}
+
+func (s *sqliteCommentStore) Close() error {
+	return s.db.Close()
+}
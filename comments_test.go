@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubComments is a comments provider with a fixed count for every post,
+// or failing with err.
+type stubComments struct {
+	count int
+	err   error
+	// asked counts the calls to CommentCount.
+	asked atomic.Int32
+}
+
+func (s *stubComments) Add(c Comment) (Comment, error) {
+	return c, errors.New("stub comments are read-only")
+}
+
+func (s *stubComments) Approved(slug string) ([]Comment, error) {
+	return nil, s.err
+}
+
+func (s *stubComments) CommentCount(slug string) (int, error) {
+	s.asked.Add(1)
+	return s.count, s.err
+}
+
+func (s *stubComments) Close() error {
+	return nil
+}
+
+func TestCommentCountsAreShown(t *testing.T) {
+	comments := &stubComments{count: 7}
+	route := newTestRouterWith(t, nil, Deps{Comments: comments})
+
+	for _, path := range []string{"/", "/posts/hello-world"} {
+		if body := get(route, path).Body.String(); !strings.Contains(body, "7 comments") {
+			t.Errorf("GET %s doesn't show the comment count", path)
+		}
+	}
+}
+
+func TestCommentCountsFailureIsHidden(t *testing.T) {
+	comments := &stubComments{count: 7, err: errors.New("provider down")}
+	route := newTestRouterWith(t, nil, Deps{Comments: comments})
+
+	for _, path := range []string{"/", "/posts/hello-world"} {
+		w := get(route, path)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d with the comments provider down", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "7 comments") {
+			t.Errorf("GET %s shows a comment count the provider failed to give", path)
+		}
+	}
+}
+
+func TestCommentCountsCache(t *testing.T) {
+	comments := &stubComments{count: 2}
+	counts := newCommentCounts(comments, time.Hour)
+
+	for range 3 {
+		if n := counts.Count("hello-world"); n != 2 {
+			t.Fatalf("Count = %d, want 2", n)
+		}
+	}
+	if asked := comments.asked.Load(); asked != 1 {
+		t.Errorf("provider asked %d times within the TTL, want once", asked)
+	}
+
+	expired := newCommentCounts(comments, 0)
+	expired.Count("hello-world")
+	expired.Count("hello-world")
+	if asked := comments.asked.Load(); asked != 3 {
+		t.Errorf("provider asked %d times in all, want 3 with a zero TTL", asked)
+	}
+
+	var disabled *CommentCounts
+	if n := disabled.Count("hello-world"); n != 0 {
+		t.Errorf("Count without comments = %d, want 0", n)
+	}
+}
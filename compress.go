@@ -0,0 +1,181 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressibleTypes are the media types worth compressing; images other
+// than SVG, fonts and the like are already compressed.
+var compressibleTypes = map[string]bool{
+	"application/atom+xml":   true,
+	"application/feed+json":  true,
+	"application/javascript": true,
+	"application/json":       true,
+	"application/rss+xml":    true,
+	"application/xml":        true,
+	"image/svg+xml":          true,
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}
+	brotliWriters = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}}
+)
+
+// Compress compresses text responses with brotli or gzip, whichever the
+// client prefers.
+func Compress() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptedEncoding(ctx.GetHeader("Accept-Encoding"))
+		if encoding == "" || ctx.Request.Method == http.MethodHead {
+			ctx.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: ctx.Writer, encoding: encoding}
+		ctx.Writer = w
+		defer w.Close()
+
+		ctx.Next()
+	}
+}
+
+// acceptedEncoding picks "br" or "gzip" from an Accept-Encoding header, or
+// "" if the client accepts neither.
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+
+	return ""
+}
+
+// compressWriter decides whether to compress on the first write, once the
+// handler has set the status and Content-Type.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	decided  bool
+	w        io.WriteCloser
+}
+
+func (cw *compressWriter) decide() {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+
+	header := cw.Header()
+	if !compressible(cw.Status(), header) {
+		return
+	}
+
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", cw.encoding)
+
+	switch cw.encoding {
+	case "br":
+		w := brotliWriters.Get().(*brotli.Writer)
+		w.Reset(cw.ResponseWriter)
+		cw.w = w
+	case "gzip":
+		w := gzipWriters.Get().(*gzip.Writer)
+		w.Reset(cw.ResponseWriter)
+		cw.w = w
+	}
+}
+
+func compressible(status int, header http.Header) bool {
+	switch {
+	case status < http.StatusOK,
+		status == http.StatusNoContent,
+		status == http.StatusPartialContent,
+		status == http.StatusNotModified:
+		return false
+	case header.Get("Content-Encoding") != "":
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	// Event streams must reach the client as they are written.
+	if mediaType == "text/event-stream" {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+func (cw *compressWriter) WriteHeaderNow() {
+	cw.decide()
+	cw.ResponseWriter.WriteHeaderNow()
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	cw.decide()
+	if cw.w == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+
+	return cw.w.Write(b)
+}
+
+func (cw *compressWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
+
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	cw.ResponseWriter.Flush()
+}
+
+// Close flushes the compressed stream and returns the encoder to its pool.
+func (cw *compressWriter) Close() {
+	if cw.w == nil {
+		return
+	}
+
+	cw.w.Close()
+	switch w := cw.w.(type) {
+	case *brotli.Writer:
+		w.Reset(nil)
+		brotliWriters.Put(w)
+	case *gzip.Writer:
+		w.Reset(nil)
+		gzipWriters.Put(w)
+	}
+	cw.w = nil
+}
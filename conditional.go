@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Conditional buffers successful GET responses to give them an ETag, and
+// answers requests whose If-None-Match or If-Modified-Since still match
+// with 304 Not Modified. Pages differing only in their CSP nonce share an
+// ETag. Static files are left to http.ServeFile, which does the same from
+// file modification times, and event streams never complete.
+func Conditional() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet || strings.HasPrefix(ctx.Request.URL.Path, "/static/") ||
+			ctx.GetHeader("Accept") == "text/event-stream" {
+			ctx.Next()
+			return
+		}
+
+		w := ctx.Writer
+		buf := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+		ctx.Writer = buf
+		// Restore the real writer even on panic, so Recovery can still
+		// respond.
+		defer func() { ctx.Writer = w }()
+
+		ctx.Next()
+
+		if buf.status == http.StatusOK {
+			// The CSP nonce differs on every request, so it's left out of
+			// the ETag as PageCache leaves it out of cached pages.
+			body := buf.body.Bytes()
+			nonce := cspNonce(ctx)
+			if nonce != "" {
+				body = bytes.ReplaceAll(body, []byte(nonce), []byte("nonce"))
+			}
+			sum := sha256.Sum256(body)
+			w.Header().Set("ETag", `W/"`+hex.EncodeToString(sum[:8])+`"`)
+
+			if notModified(ctx.Request, w.Header()) {
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				// The client keeps the policy it got with its copy,
+				// whose scripts carry the nonce of that one.
+				if nonce != "" {
+					w.Header().Del("Content-Security-Policy")
+				}
+				w.WriteHeader(http.StatusNotModified)
+				w.WriteHeaderNow()
+				return
+			}
+		}
+
+		w.WriteHeader(buf.status)
+		if buf.body.Len() == 0 {
+			w.WriteHeaderNow()
+			return
+		}
+		w.Write(buf.body.Bytes())
+	}
+}
+
+// notModified reports whether the client's cached copy, described by the
+// request's validators, matches the response headers. If-Modified-Since is
+// only consulted without If-None-Match.
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// setLastModified sets the Last-Modified header to the latest ModTime of
+// posts, if any.
+func setLastModified(ctx *gin.Context, posts ...PostData) {
+	var latest time.Time
+	for _, post := range posts {
+		if post.ModTime.After(latest) {
+			latest = post.ModTime
+		}
+	}
+
+	if !latest.IsZero() {
+		ctx.Header("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
+
+// bufferWriter holds the status and body written by a handler until
+// Conditional decides what to send.
+type bufferWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Written() bool {
+	return false
+}
+
+// Flush is a no-op: buffered responses are sent only once complete.
+func (w *bufferWriter) Flush() {}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalIgnoresNonce(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"euler.md": "---\nTitle: Euler\nDate: 2025-01-01\nSlug: euler\nMath: true\n---\n\n$e^{i\\pi} + 1 = 0$\n",
+	})
+	route := newTestRouter(t, func(cfg *Config) { cfg.ContentDir = dir })
+
+	first := get(route, "/posts/euler")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /posts/euler: status %d, ETag %q", first.Code, etag)
+	}
+	if cspNonceOf(first.Header()) == "" {
+		t.Fatal("the Math post has no nonced script to test with")
+	}
+
+	if again := get(route, "/posts/euler").Header().Get("ETag"); again != etag {
+		t.Errorf("ETag changed from %s to %s between requests", etag, again)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/posts/euler", nil)
+	req.Header.Set("If-None-Match", etag)
+	w := do(route, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidating: status %d, want 304", w.Code)
+	}
+	if w.Header().Get("Content-Security-Policy") != "" {
+		t.Error("304 replaces the policy the cached page's nonce belongs to")
+	}
+}
@@ -0,0 +1,1296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/styles"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the blog. Values come from the defaults,
+// then the YAML config file, then BLOG_* environment variables.
+type Config struct {
+	// Addr is the address the server listens on (BLOG_ADDR), or use
+	// BLOG_PORT to only change the port.
+	Addr       string `yaml:"addr"`
+	ContentDir string `yaml:"content_dir"`
+	// PagesDir holds standalone pages such as about.md, served at /about
+	// and left out of listings and feeds, see PageHandler.
+	PagesDir string `yaml:"pages_dir"`
+	// Theme is the theme whose templates and static files the blog uses.
+	// Files in TemplatesDir and StaticDir replace the theme's files of the
+	// same name.
+	Theme string `yaml:"theme"`
+	// ThemesDir, when set, reads the themes from this directory rather
+	// than the ones built into the binary, such as while working on a
+	// theme.
+	ThemesDir    string `yaml:"themes_dir"`
+	TemplatesDir string `yaml:"templates_dir"`
+	StaticDir    string `yaml:"static_dir"`
+	SiteFile     string `yaml:"site_file"`
+	// AuthorsFile lists the authors posts can refer to by key.
+	AuthorsFile string `yaml:"authors_file"`
+	// Author is the key of the author new posts are credited to, see
+	// newPost.
+	Author string `yaml:"author"`
+	// RedirectsFile maps old paths to new URLs, see loadRedirects.
+	RedirectsFile string `yaml:"redirects_file"`
+	// MenuFile defines the site's menus, see Navigation.
+	MenuFile string `yaml:"menu_file"`
+	// Sites serves several blogs from one server: each hostname maps to
+	// the config file of its blog, with its own content, theme and base
+	// URL. This config then only sets up the front server dispatching
+	// requests by Host, see serveSites.
+	Sites map[string]string `yaml:"sites"`
+
+	// Languages makes the blog multilingual: posts are in one of these
+	// languages, set by their Lang frontmatter or a directory such as
+	// markdown/id/, and each language has its index, posts and feeds under
+	// a prefix such as /id/. Pages outside the prefixes show the
+	// DefaultLanguage.
+	Languages       []string `yaml:"languages"`
+	DefaultLanguage string   `yaml:"default_language"`
+	// I18nDir holds <lang>.yaml files translating template strings.
+	I18nDir string `yaml:"i18n_dir"`
+
+	// BaseURL is the public root of the blog, e.g. https://blog.example.com,
+	// used for absolute links in feeds and share URLs. When empty, the
+	// scheme and host of the current request are used.
+	BaseURL string `yaml:"base_url"`
+	// DatePrefixedURLs serves posts under /YYYY/MM/slug instead of
+	// /posts/slug.
+	DatePrefixedURLs bool `yaml:"date_prefixed_urls"`
+	// Sections are content directories, such as markdown/projects/, whose
+	// posts are served under their own prefix, /projects/slug, with an
+	// index and feeds of their own. Posts can also set their Section
+	// frontmatter. A section's index and posts are rendered with the
+	// templates SectionTemplates names, else its own <section>_index.html
+	// and <section>_post.html when the theme or site has them.
+	Sections []string `yaml:"sections"`
+	// SectionTemplates names the templates of sections, by section.
+	SectionTemplates map[string]SectionTemplates `yaml:"section_templates"`
+	// TagAliases maps spellings of a tag, matched case insensitively, to
+	// the tag posts using them are listed under, such as golang and
+	// go-lang to go. Other tags are only trimmed and lowercased.
+	TagAliases map[string]string `yaml:"tag_aliases"`
+
+	// Preview shows drafts and future-dated posts everywhere, for local
+	// writing. PreviewToken instead shows them only on requests carrying
+	// ?preview=<token>.
+	Preview      bool   `yaml:"preview"`
+	PreviewToken string `yaml:"preview_token"`
+
+	// Dev re-parses templates on every request, so template changes show
+	// up without restarting the server.
+	Dev bool `yaml:"dev"`
+
+	PageSize int `yaml:"page_size"`
+	// Sort orders the index and other listings: "date", newest first, or
+	// "order", by each post's Order. Pinned posts always come first.
+	Sort string `yaml:"sort"`
+	// Feeds are the formats the blog's feeds are served in, and advertised
+	// for autodiscovery on its pages: "rss", "atom" and "json". Every
+	// listing with feeds has one in each. An empty list serves none.
+	Feeds []string `yaml:"feeds"`
+	// FeedFullContent includes each post's rendered HTML in feed items;
+	// otherwise only the excerpt is sent. Posts can choose otherwise with
+	// their FeedContent.
+	FeedFullContent bool `yaml:"feed_full_content"`
+	// Related is where the related posts under a post come from, in
+	// order until there are enough: "tags", posts sharing tags or similar
+	// in content, "category", posts in the same category, and "recent",
+	// the latest posts. An empty list shows none.
+	Related []string `yaml:"related"`
+
+	// RobotsTxt replaces the default /robots.txt, which allows everything
+	// and links the sitemap.
+	RobotsTxt string `yaml:"robots_txt"`
+
+	// TrustedProxies are the IPs or CIDR ranges of reverse proxies in
+	// front of the blog, whose X-Forwarded-For and X-Real-IP headers are
+	// believed. Without them, a request's client is the address it came
+	// from, as anyone could send those headers.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// Server timeouts. ReadTimeout also bounds reading request headers.
+	ReadTimeout  Duration `yaml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGINT or SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// RequestTimeout is how long a request may wait on rendering posts
+	// before it's answered with 503, see RequestTimeout. Zero waits as
+	// long as it takes.
+	RequestTimeout Duration `yaml:"request_timeout"`
+
+	// SlowRequestThreshold is the latency above which requests are logged
+	// at WARN instead of INFO.
+	SlowRequestThreshold Duration `yaml:"slow_request_threshold"`
+
+	Content     ContentConfig     `yaml:"content"`
+	Markdown    MarkdownConfig    `yaml:"markdown"`
+	Comments    CommentsConfig    `yaml:"comments"`
+	Views       ViewsConfig       `yaml:"views"`
+	Likes       LikesConfig       `yaml:"likes"`
+	Referrers   ReferrersConfig   `yaml:"referrers"`
+	Analytics   AnalyticsConfig   `yaml:"analytics"`
+	Newsletter  NewsletterConfig  `yaml:"newsletter"`
+	Contact     ContactConfig     `yaml:"contact"`
+	Webmention  WebmentionConfig  `yaml:"webmention"`
+	IndexNow    IndexNowConfig    `yaml:"indexnow"`
+	WebSub      WebSubConfig      `yaml:"websub"`
+	ActivityPub ActivityPubConfig `yaml:"activitypub"`
+	Deploy      DeployConfig      `yaml:"deploy"`
+	Admin       AdminConfig       `yaml:"admin"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Images      ImagesConfig      `yaml:"images"`
+	PDF         PDFConfig         `yaml:"pdf"`
+	Private     PrivateConfig     `yaml:"private"`
+	Links       LinksConfig       `yaml:"links"`
+	Security    SecurityConfig    `yaml:"security"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Pprof       PprofConfig       `yaml:"pprof"`
+	Maintenance MaintenanceConfig `yaml:"maintenance"`
+	Lint        LintConfig        `yaml:"lint"`
+	Build       BuildConfig       `yaml:"build"`
+	AccessLog   AccessLogConfig   `yaml:"access_log"`
+}
+
+// ContentConfig chooses where posts are read from, see ContentSource.
+type ContentConfig struct {
+	// Source is "dir" for ContentDir, "embed" for the markdown directory
+	// built into the binary, "git" for a repository or "s3" for a bucket.
+	Source string `yaml:"source"`
+	// CacheDir is where the git and s3 sources keep their copy of the
+	// content.
+	CacheDir string `yaml:"cache_dir"`
+	// Refresh is how often the git and s3 sources are fetched again. With
+	// 0, they're only fetched at start and on deploy hooks.
+	Refresh Duration `yaml:"refresh"`
+	// PublishCheck is how often scheduled posts are checked for having
+	// gone live, see ContentStore.PublishScheduled. 0 turns it off; the posts
+	// still appear on time, but feeds and caches may lag behind.
+	PublishCheck Duration `yaml:"publish_check"`
+	// Lazy renders posts when they're first shown rather than all while
+	// loading, for starting quickly with many posts. Posts that fail to
+	// render are then logged instead of failing the load.
+	Lazy bool `yaml:"lazy"`
+	// RevisionsFile keeps the hash of every post file between restarts,
+	// so posts are only taken as modified when their content changes,
+	// see Revisions. Empty keeps them in memory only. Blogs served
+	// together, see Sites, each need a file of their own.
+	RevisionsFile string `yaml:"revisions_file"`
+	// RenderCacheDir keeps rendered posts between restarts, so starting
+	// only renders the posts changed since, see RenderCache. Empty
+	// renders every post on each start. Posts showing static images that
+	// have been replaced since need the directory cleared.
+	RenderCacheDir string    `yaml:"render_cache_dir"`
+	Git            GitConfig `yaml:"git"`
+	S3             S3Config  `yaml:"s3"`
+}
+
+// GitConfig is the repository the git content source clones.
+type GitConfig struct {
+	URL string `yaml:"url"`
+	// Branch is fetched instead of the remote's default branch.
+	Branch string `yaml:"branch"`
+}
+
+// S3Config is the bucket the s3 content source mirrors.
+type S3Config struct {
+	// Endpoint defaults to AWS, https://s3.<region>.amazonaws.com. Use
+	// https://storage.googleapis.com for Google Cloud Storage.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix limits the content to keys under it, such as "posts/".
+	Prefix string `yaml:"prefix"`
+	// AccessKey and SecretKey sign requests; public buckets don't need
+	// them.
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// MarkdownConfig controls how post bodies are rendered.
+type MarkdownConfig struct {
+	// HighlightStyle is the Chroma style of code blocks, such as "dracula"
+	// or "monokai".
+	HighlightStyle string `yaml:"highlight_style"`
+	// LineNumbers numbers the lines of every code block. Blocks can also
+	// turn them on with {linenos=true} after the language.
+	LineNumbers bool `yaml:"line_numbers"`
+	// CodeBlockClass is the class of the div wrapping every code block,
+	// code-block unless set.
+	CodeBlockClass string `yaml:"code_block_class"`
+	// HardWraps renders single newlines as <br>.
+	HardWraps bool `yaml:"hard_wraps"`
+	// XHTML emits XHTML style void elements (<br />).
+	XHTML bool `yaml:"xhtml"`
+	// Unsafe passes raw HTML and javascript: links through to the page.
+	// Anyone who can write a post can then inject scripts into every
+	// reader's page, so it is only honored together with
+	// UnsafeIUnderstandTheRisk.
+	Unsafe                   bool `yaml:"unsafe"`
+	UnsafeIUnderstandTheRisk bool `yaml:"unsafe_i_understand_the_risk"`
+	// Sanitize passes raw HTML in posts through a sanitizer that keeps safe
+	// markup and drops scripts, event handlers and the like, for sites
+	// taking posts from people they don't fully trust. Posts with
+	// Unsafe: true in their frontmatter are left alone.
+	Sanitize bool `yaml:"sanitize"`
+	// Tables, Strikethrough, TaskLists and Linkify are the GitHub Flavored
+	// Markdown extensions, all on by default.
+	Tables        bool `yaml:"tables"`
+	Strikethrough bool `yaml:"strikethrough"`
+	TaskLists     bool `yaml:"task_lists"`
+	Linkify       bool `yaml:"linkify"`
+	// Footnotes turns on [^1] style footnotes, with reference links carrying
+	// the footnote text.
+	Footnotes bool `yaml:"footnotes"`
+	// Typographer turns straight quotes, -- and ... into their typographic
+	// forms.
+	Typographer bool `yaml:"typographer"`
+	// DefinitionLists turns on PHP Markdown Extra style definition lists.
+	DefinitionLists bool `yaml:"definition_lists"`
+	// ShortcodesDir holds custom shortcode templates, see Shortcode.
+	ShortcodesDir string `yaml:"shortcodes_dir"`
+	// Math renders $...$ and $$...$$ as math with KaTeX. Posts containing
+	// math, or with Math: true in their frontmatter, load KaTeX.
+	Math bool `yaml:"math"`
+	// HeadingAnchors adds a ¶ permalink to every heading, shown on hover.
+	// Headings get ids from their text, or a fixed one written after it
+	// as {#id}, which keeps links working when the text changes.
+	HeadingAnchors bool `yaml:"heading_anchors"`
+	// Emoji replaces GitHub style shortcodes such as :smile: with their
+	// emoji, in posts and in frontmatter rendered with markdownify.
+	Emoji bool `yaml:"emoji"`
+}
+
+// CommentsConfig controls reader comments on posts.
+type CommentsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Storage is "json" for a single JSON file or "sqlite".
+	Storage string `yaml:"storage"`
+	// Path is the JSON file or SQLite database, comments.json or
+	// comments.db by default.
+	Path string `yaml:"path"`
+	// Moderate holds new comments back until approved instead of showing
+	// them right away.
+	Moderate bool `yaml:"moderate"`
+	// CountTTL is how long the comment counts shown on post cards and
+	// headers are cached.
+	CountTTL Duration `yaml:"count_ttl"`
+}
+
+// ViewsConfig controls counting post views.
+type ViewsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, views.db by default.
+	Path string `yaml:"path"`
+	// FlushInterval is how often counted views are written to the
+	// database.
+	FlushInterval Duration `yaml:"flush_interval"`
+	// Popular is the number of posts in the popular posts list.
+	Popular int `yaml:"popular"`
+}
+
+// LikesConfig controls the like button of posts, see Likes.
+type LikesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, likes.db by default.
+	Path string `yaml:"path"`
+	// Secret keys the hashes of readers' addresses. When empty, a random
+	// key is generated and kept in the database.
+	Secret string `yaml:"secret"`
+}
+
+// ReferrersConfig controls collecting the pages that send readers to
+// posts, listed at /admin/referrers and optionally under the posts, see
+// Referrers.
+type ReferrersConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, referrers.db by default.
+	Path string `yaml:"path"`
+	// FlushInterval is how often collected referrals are written to the
+	// database.
+	FlushInterval Duration `yaml:"flush_interval"`
+	// Show lists the pages under posts as "Mentioned by", those that sent
+	// at least MinCount readers, so one-off spam doesn't make it there.
+	Show     bool `yaml:"show"`
+	MinCount int  `yaml:"min_count"`
+	// Blocklist are more sites to ignore besides the known referrer
+	// spammers, each with its subdomains.
+	Blocklist []string `yaml:"blocklist"`
+}
+
+// AnalyticsConfig controls counting page views for the /admin/stats
+// dashboard, see Analytics.
+type AnalyticsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, analytics.db by default.
+	Path string `yaml:"path"`
+	// FlushInterval is how often counted views are written to the
+	// database.
+	FlushInterval Duration `yaml:"flush_interval"`
+}
+
+// NewsletterConfig controls newsletter subscriptions, see
+// SubscribeHandler.
+type NewsletterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, subscribers.db by default.
+	Path string     `yaml:"path"`
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig is the mail server confirmation mails are sent through.
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// User and Password authenticate with the server unless User is
+	// empty.
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// From is the sender, such as "Blog <blog@example.com>".
+	From string `yaml:"from"`
+}
+
+// ContactConfig controls the contact form, see ContactHandler. Messages
+// are posted to Webhook if set, and mailed to To through SMTP otherwise.
+type ContactConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// To is the address messages are mailed to.
+	To   string     `yaml:"to"`
+	SMTP SMTPConfig `yaml:"smtp"`
+	// Webhook receives each message as a JSON object with name, email,
+	// message and sent fields.
+	Webhook string `yaml:"webhook"`
+}
+
+// WebmentionConfig controls sending and receiving webmentions, see
+// Webmentions.
+type WebmentionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the SQLite database, webmentions.db by default.
+	Path string `yaml:"path"`
+	// AllowPrivate lets the blog fetch pages on private addresses, for
+	// blogs on an internal network.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// IndexNowConfig controls notifying search engines of new and changed
+// posts, see IndexNow. It needs BaseURL.
+type IndexNowConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Key is any 8 to 128 letters, digits and dashes, served as
+	// /<key>.txt to prove it's the blog's.
+	Key string `yaml:"key"`
+	// Endpoint is the IndexNow API submissions go to.
+	Endpoint string `yaml:"endpoint"`
+	// Ping are sitemap ping URLs requested along with each submission,
+	// with {sitemap} standing for the sitemap's escaped URL.
+	Ping []string `yaml:"ping"`
+}
+
+// WebSubConfig controls publishing feed updates to a WebSub hub, see
+// WebSub. It needs BaseURL, which the feeds' URLs are made of.
+type WebSubConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Hub is the hub's URL, declared in the feeds and told of updates.
+	Hub string `yaml:"hub"`
+}
+
+// ActivityPubConfig controls federating the blog, see ActivityPub. It
+// needs BaseURL, which the actor's IDs are made of.
+type ActivityPubConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Username makes up the blog's handle, @<username>@<host>.
+	Username string `yaml:"username"`
+	// KeyFile holds the actor's private key, which is created on first
+	// start.
+	KeyFile string `yaml:"key_file"`
+	// Path is the SQLite database, activitypub.db by default.
+	Path string `yaml:"path"`
+	// AllowPrivate lets the blog talk to servers on private addresses.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// DeployConfig controls the /hooks/deploy webhook pulling the content
+// directory, see DeployHandler. The hook is disabled while Secret is
+// empty.
+type DeployConfig struct {
+	// Secret is the webhook secret set on GitHub, or the secret token on
+	// GitLab.
+	Secret string `yaml:"secret"`
+	// Branch, when set, limits deploys to pushes to this branch.
+	Branch string `yaml:"branch"`
+}
+
+// AdminConfig guards the /admin post editor with basic auth. The editor
+// is disabled while Password is empty.
+type AdminConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// MaintenanceConfig controls maintenance mode, see Maintenance.
+type MaintenanceConfig struct {
+	// Enabled starts the blog in maintenance.
+	Enabled bool `yaml:"enabled"`
+	// File turns maintenance on while it exists, for scripts such as
+	// content migrations.
+	File string `yaml:"file"`
+	// RetryAfter is when readers are told to come back.
+	RetryAfter Duration `yaml:"retry_after"`
+}
+
+// AccessLogConfig sets up the access log, see AccessLog.
+type AccessLogConfig struct {
+	// File is where requests are logged, none when empty.
+	File string `yaml:"file"`
+	// MaxSize is how many megabytes the file may grow to before it's
+	// rotated, 0 for no limit.
+	MaxSize int `yaml:"max_size"`
+	// Rotate is how often the file is rotated regardless of its size,
+	// such as 24h for every day at midnight UTC. 0 rotates by size only.
+	Rotate Duration `yaml:"rotate"`
+	// Keep is how many rotated files are kept, 0 for all of them.
+	Keep int `yaml:"keep"`
+}
+
+// LintConfig sets up the prose checks of the lint command: long-sentence,
+// alt-text, absolute-link and todo.
+type LintConfig struct {
+	// MaxSentenceWords is how many words a sentence may have before
+	// long-sentence flags it; 0 allows any.
+	MaxSentenceWords int `yaml:"max_sentence_words"`
+	// Markers are the words todo looks for, such as TODO and FIXME.
+	Markers []string `yaml:"markers"`
+	// Disabled are the checks not to run, by name.
+	Disabled []string `yaml:"disabled"`
+}
+
+// BuildConfig sets up the build command.
+type BuildConfig struct {
+	// Checks are the publish checks every post built must pass, or the
+	// build is refused unless forced: frontmatter, the problems validate
+	// reports, description, tags, links, its links within the blog
+	// working, as checklinks checks them, and cover, a MetaImage.
+	Checks []string `yaml:"checks"`
+}
+
+// SectionTemplates are the templates a section's pages are rendered
+// with, such as notes_list.html. Either may be left empty for the usual
+// one, see sectionTemplate.
+type SectionTemplates struct {
+	Index string `yaml:"index"`
+	Post  string `yaml:"post"`
+}
+
+// RateLimitConfig limits how fast each client may use the routes that do
+// real work, see RateLimit. A limit is off while its rate is 0.
+type RateLimitConfig struct {
+	// PerMinute is how many requests a minute a client may make to
+	// expensive routes such as search, feeds, the API and image variants,
+	// in bursts of up to Burst.
+	PerMinute int `yaml:"per_minute"`
+	Burst     int `yaml:"burst"`
+	// PostsPerMinute and PostBurst limit posting comments, subscriptions,
+	// webmentions and other forms.
+	PostsPerMinute int `yaml:"posts_per_minute"`
+	PostBurst      int `yaml:"post_burst"`
+	// AdminFailuresPerMinute and AdminFailureBurst limit wrong admin
+	// passwords, see AdminAuth.
+	AdminFailuresPerMinute int `yaml:"admin_failures_per_minute"`
+	AdminFailureBurst      int `yaml:"admin_failure_burst"`
+}
+
+// CacheConfig controls the in-memory cache of rendered pages, see
+// PageCache.
+type CacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// TTL bounds how long a page is served from the cache. Pages are
+	// dropped as soon as the posts they show change, so this only matters
+	// for what changes without a reload, such as view counts.
+	TTL Duration `yaml:"ttl"`
+	// MaxEntries is how many pages are kept at most.
+	MaxEntries int `yaml:"max_entries"`
+}
+
+// PDFConfig controls the PDF downloads of posts at /posts/<slug>.pdf,
+// printed with headless Chrome and kept in Images.CacheDir. Without
+// Chrome, readers are offered their browser's print dialog instead.
+type PDFConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Chrome is the Chrome or Chromium binary, looked up in PATH by its
+	// usual names if empty.
+	Chrome string `yaml:"chrome"`
+	// Timeout is how long printing a post may take.
+	Timeout Duration `yaml:"timeout"`
+}
+
+// PrivateConfig controls how readers of private posts are remembered, see
+// Private. Logging in at /login takes the admin credentials.
+type PrivateConfig struct {
+	// Secret signs the login and password cookies. A random one is used
+	// when empty, which logs everyone out whenever the blog restarts.
+	Secret string `yaml:"secret"`
+	// Remember is how long logins and passwords are remembered.
+	Remember Duration `yaml:"remember"`
+}
+
+// ImagesConfig controls the resized variants served for JPEG and PNG
+// images under the static directory that posts reference.
+type ImagesConfig struct {
+	// Widths are the variant widths in pixels. Leaving it empty turns
+	// variants off.
+	Widths []int `yaml:"widths"`
+	// CacheDir is where generated variants are kept.
+	CacheDir string `yaml:"cache_dir"`
+	// WebP also offers each variant as WebP. The encoder is lossless, so
+	// this pays off for screenshots and diagrams more than for photos.
+	WebP bool `yaml:"webp"`
+	// OG generates a social card for every post without a MetaImage,
+	// showing its title, author and the site's name, at /og/<slug>.png.
+	OG bool `yaml:"og"`
+	// OGTemplate is a PNG drawn behind the text of social cards, scaled to
+	// cover them. Cards have a plain background without one.
+	OGTemplate string `yaml:"og_template"`
+}
+
+// LinksConfig controls links in posts to other sites, meaning absolute
+// URLs to hosts other than BaseURL's and the exempt domains.
+type LinksConfig struct {
+	// Rel is the rel attribute of external links, empty for none.
+	Rel string `yaml:"rel"`
+	// NewTab opens external links in a new tab.
+	NewTab bool `yaml:"new_tab"`
+	// Exempt are domains, along with their subdomains, whose links are
+	// left alone.
+	Exempt []string `yaml:"exempt"`
+	// Track routes external links through /out, counting clicks by host in
+	// the blog_outbound_clicks_total metric. It's off in static builds.
+	Track bool `yaml:"track"`
+	// Secret signs /out links so they only lead where posts link to. A
+	// random one is used when empty, which breaks /out links in pages
+	// cached elsewhere whenever the blog restarts.
+	Secret string `yaml:"secret"`
+}
+
+// SecurityConfig controls the security headers sent with every response.
+type SecurityConfig struct {
+	// CSP replaces the default Content-Security-Policy; "{nonce}" in it
+	// stands for the request's nonce, and "off" sends no policy at all.
+	CSP            string `yaml:"csp"`
+	ReferrerPolicy string `yaml:"referrer_policy"`
+	FrameOptions   string `yaml:"frame_options"`
+	// HSTS is the max-age of Strict-Transport-Security, which is only sent
+	// when set. Only turn it on once the site is reachable over HTTPS.
+	HSTS Duration `yaml:"hsts"`
+}
+
+// TLSConfig serves the blog over HTTPS with certificates from Let's
+// Encrypt, so it can run without a reverse proxy. It is off while Hosts is
+// empty. When on, Addr should usually be ":443".
+type TLSConfig struct {
+	// Hosts are the domain names to get certificates for. Requests for
+	// other names are refused.
+	Hosts []string `yaml:"hosts"`
+	// CacheDir keeps certificates and the ACME account key across
+	// restarts, so they aren't requested again every time.
+	CacheDir string `yaml:"cache_dir"`
+	// Email is given to Let's Encrypt for expiry notices.
+	Email string `yaml:"email"`
+	// HTTPAddr serves ACME challenges and redirects plain HTTP to HTTPS.
+	HTTPAddr string `yaml:"http_addr"`
+}
+
+// MetricsConfig exposes Prometheus metrics at /metrics.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Token, when set, must be sent as a bearer token to read metrics.
+	Token string `yaml:"token"`
+	// Addr, when set, serves /metrics on its own listener, such as
+	// "127.0.0.1:9090", instead of next to the blog.
+	Addr string `yaml:"addr"`
+}
+
+// PprofConfig exposes the runtime profiles of net/http/pprof at
+// /debug/pprof/, for tracking down slow or memory hungry requests.
+type PprofConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Token, when set, must be sent as a bearer token to read profiles.
+	Token string `yaml:"token"`
+	// Addr, when set, serves the profiles on their own listener, such as
+	// "localhost:6060", instead of next to the blog. Without a Token, Addr
+	// is required and must be a loopback address.
+	Addr string `yaml:"addr"`
+}
+
+// Duration is a time.Duration written as a string such as "500ms" in the
+// config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		Addr:                 ":8080",
+		ContentDir:           "markdown",
+		PagesDir:             "pages",
+		Theme:                "default",
+		TemplatesDir:         "templates",
+		StaticDir:            "static",
+		SiteFile:             "site.yaml",
+		AuthorsFile:          "authors.yaml",
+		RedirectsFile:        "redirects.yaml",
+		MenuFile:             "menu.yaml",
+		DefaultLanguage:      "en",
+		I18nDir:              "i18n",
+		PageSize:             10,
+		Sort:                 "date",
+		Feeds:                []string{"rss", "atom", "json"},
+		Related:              []string{"tags", "category", "recent"},
+		ReadTimeout:          Duration(10 * time.Second),
+		WriteTimeout:         Duration(30 * time.Second),
+		IdleTimeout:          Duration(2 * time.Minute),
+		ShutdownTimeout:      Duration(15 * time.Second),
+		RequestTimeout:       Duration(10 * time.Second),
+		SlowRequestThreshold: Duration(time.Second),
+		Content: ContentConfig{
+			Source:         "dir",
+			CacheDir:       "cache/content",
+			RevisionsFile:  "cache/revisions.json",
+			RenderCacheDir: "cache/render",
+			PublishCheck:   Duration(time.Minute),
+		},
+		Markdown: MarkdownConfig{
+			HighlightStyle: "dracula",
+			ShortcodesDir:  "shortcodes",
+			Tables:         true,
+			Strikethrough:  true,
+			TaskLists:      true,
+			Linkify:        true,
+			HeadingAnchors: true,
+		},
+		Comments: CommentsConfig{
+			Storage:  "json",
+			Moderate: true,
+			CountTTL: Duration(5 * time.Minute),
+		},
+		Views: ViewsConfig{
+			FlushInterval: Duration(10 * time.Second),
+			Popular:       5,
+		},
+		Referrers: ReferrersConfig{
+			FlushInterval: Duration(10 * time.Second),
+			MinCount:      3,
+		},
+		Analytics: AnalyticsConfig{
+			FlushInterval: Duration(10 * time.Second),
+		},
+		Newsletter: NewsletterConfig{
+			SMTP: SMTPConfig{Port: 587},
+		},
+		Contact: ContactConfig{
+			SMTP: SMTPConfig{Port: 587},
+		},
+		IndexNow: IndexNowConfig{
+			Endpoint: "https://api.indexnow.org/indexnow",
+		},
+		WebSub: WebSubConfig{
+			Hub: "https://pubsubhubbub.appspot.com/",
+		},
+		ActivityPub: ActivityPubConfig{
+			Username: "blog",
+			KeyFile:  "activitypub.pem",
+		},
+		Admin: AdminConfig{
+			User: "admin",
+		},
+		RateLimit: RateLimitConfig{
+			PerMinute:              300,
+			Burst:                  30,
+			PostsPerMinute:         30,
+			PostBurst:              10,
+			AdminFailuresPerMinute: 5,
+			AdminFailureBurst:      10,
+		},
+		Cache: CacheConfig{
+			TTL:        Duration(5 * time.Minute),
+			MaxEntries: 1000,
+		},
+		Security: SecurityConfig{
+			ReferrerPolicy: "strict-origin-when-cross-origin",
+			FrameOptions:   "DENY",
+		},
+		Links: LinksConfig{
+			Rel:    "nofollow noopener",
+			NewTab: true,
+		},
+		Maintenance: MaintenanceConfig{
+			RetryAfter: Duration(5 * time.Minute),
+		},
+		AccessLog: AccessLogConfig{
+			MaxSize: 100,
+			Rotate:  Duration(24 * time.Hour),
+			Keep:    14,
+		},
+		Lint: LintConfig{
+			MaxSentenceWords: 40,
+			Markers:          []string{"TODO", "FIXME", "XXX", "TK"},
+		},
+		Images: ImagesConfig{
+			Widths:   []int{480, 960, 1600},
+			CacheDir: "cache/images",
+			OG:       true,
+		},
+		PDF: PDFConfig{
+			Timeout: Duration(30 * time.Second),
+		},
+		Private: PrivateConfig{
+			Remember: Duration(30 * 24 * time.Hour),
+		},
+		TLS: TLSConfig{
+			CacheDir: "cache/autocert",
+			HTTPAddr: ":80",
+		},
+	}
+}
+
+// loadConfig reads the YAML config file at path on top of the defaults and
+// applies environment overrides. A missing file is not an error, so the
+// blog runs with no config file at all.
+func loadConfig(path string) (Config, error) {
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.applyEnv()
+
+	err = cfg.validate()
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	return cfg, nil
+}
+
+// readConfigFile reads the config at path over the defaults, without
+// environment overrides. A missing file leaves the defaults.
+func readConfigFile(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, err
+	}
+
+	if err == nil {
+		err = yaml.UnmarshalStrict(b, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) applyEnv() {
+	envString("BLOG_ADDR", &cfg.Addr)
+	if port := os.Getenv("BLOG_PORT"); port != "" {
+		cfg.Addr = ":" + port
+	}
+	envString("BLOG_CONTENT_DIR", &cfg.ContentDir)
+	envString("BLOG_PAGES_DIR", &cfg.PagesDir)
+	envString("BLOG_THEME", &cfg.Theme)
+	envString("BLOG_THEMES_DIR", &cfg.ThemesDir)
+	envString("BLOG_TEMPLATES_DIR", &cfg.TemplatesDir)
+	envString("BLOG_STATIC_DIR", &cfg.StaticDir)
+	envString("BLOG_SITE_FILE", &cfg.SiteFile)
+	envString("BLOG_AUTHORS_FILE", &cfg.AuthorsFile)
+	envString("BLOG_AUTHOR", &cfg.Author)
+	envString("BLOG_REDIRECTS_FILE", &cfg.RedirectsFile)
+	envString("BLOG_MENU_FILE", &cfg.MenuFile)
+	envStrings("BLOG_LANGUAGES", &cfg.Languages)
+	envString("BLOG_DEFAULT_LANGUAGE", &cfg.DefaultLanguage)
+	envString("BLOG_I18N_DIR", &cfg.I18nDir)
+	envString("BLOG_BASE_URL", &cfg.BaseURL)
+	envBool("BLOG_DATE_URLS", &cfg.DatePrefixedURLs)
+	envStrings("BLOG_SECTIONS", &cfg.Sections)
+	envBool("BLOG_PREVIEW", &cfg.Preview)
+	envString("BLOG_PREVIEW_TOKEN", &cfg.PreviewToken)
+	envBool("BLOG_DEV", &cfg.Dev)
+	envInt("BLOG_PAGE_SIZE", &cfg.PageSize)
+	envString("BLOG_SORT", &cfg.Sort)
+	envBool("BLOG_FEED_FULL_CONTENT", &cfg.FeedFullContent)
+	envStrings("BLOG_FEEDS", &cfg.Feeds)
+	envStrings("BLOG_RELATED", &cfg.Related)
+	envStrings("BLOG_TRUSTED_PROXIES", &cfg.TrustedProxies)
+	envDuration("BLOG_READ_TIMEOUT", &cfg.ReadTimeout)
+	envDuration("BLOG_WRITE_TIMEOUT", &cfg.WriteTimeout)
+	envDuration("BLOG_IDLE_TIMEOUT", &cfg.IdleTimeout)
+	envDuration("BLOG_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	envDuration("BLOG_REQUEST_TIMEOUT", &cfg.RequestTimeout)
+	envDuration("BLOG_SLOW_REQUEST_THRESHOLD", &cfg.SlowRequestThreshold)
+	envString("BLOG_CONTENT_SOURCE", &cfg.Content.Source)
+	envString("BLOG_CONTENT_CACHE_DIR", &cfg.Content.CacheDir)
+	envDuration("BLOG_CONTENT_REFRESH", &cfg.Content.Refresh)
+	envDuration("BLOG_CONTENT_PUBLISH_CHECK", &cfg.Content.PublishCheck)
+	envBool("BLOG_CONTENT_LAZY", &cfg.Content.Lazy)
+	envString("BLOG_CONTENT_REVISIONS_FILE", &cfg.Content.RevisionsFile)
+	envString("BLOG_CONTENT_RENDER_CACHE_DIR", &cfg.Content.RenderCacheDir)
+	envString("BLOG_CONTENT_GIT_URL", &cfg.Content.Git.URL)
+	envString("BLOG_CONTENT_GIT_BRANCH", &cfg.Content.Git.Branch)
+	envString("BLOG_S3_ENDPOINT", &cfg.Content.S3.Endpoint)
+	envString("BLOG_S3_REGION", &cfg.Content.S3.Region)
+	envString("BLOG_S3_BUCKET", &cfg.Content.S3.Bucket)
+	envString("BLOG_S3_PREFIX", &cfg.Content.S3.Prefix)
+	envString("BLOG_S3_ACCESS_KEY", &cfg.Content.S3.AccessKey)
+	envString("BLOG_S3_SECRET_KEY", &cfg.Content.S3.SecretKey)
+	envString("BLOG_HIGHLIGHT_STYLE", &cfg.Markdown.HighlightStyle)
+	envBool("BLOG_HIGHLIGHT_LINE_NUMBERS", &cfg.Markdown.LineNumbers)
+	envString("BLOG_CODE_BLOCK_CLASS", &cfg.Markdown.CodeBlockClass)
+	envBool("BLOG_MARKDOWN_HARD_WRAPS", &cfg.Markdown.HardWraps)
+	envBool("BLOG_MARKDOWN_XHTML", &cfg.Markdown.XHTML)
+	envBool("BLOG_MARKDOWN_UNSAFE", &cfg.Markdown.Unsafe)
+	envBool("BLOG_MARKDOWN_UNSAFE_I_UNDERSTAND_THE_RISK", &cfg.Markdown.UnsafeIUnderstandTheRisk)
+	envBool("BLOG_MARKDOWN_TABLES", &cfg.Markdown.Tables)
+	envBool("BLOG_MARKDOWN_STRIKETHROUGH", &cfg.Markdown.Strikethrough)
+	envBool("BLOG_MARKDOWN_TASK_LISTS", &cfg.Markdown.TaskLists)
+	envBool("BLOG_MARKDOWN_LINKIFY", &cfg.Markdown.Linkify)
+	envBool("BLOG_MARKDOWN_FOOTNOTES", &cfg.Markdown.Footnotes)
+	envBool("BLOG_MARKDOWN_TYPOGRAPHER", &cfg.Markdown.Typographer)
+	envBool("BLOG_MARKDOWN_DEFINITION_LISTS", &cfg.Markdown.DefinitionLists)
+	envBool("BLOG_MARKDOWN_SANITIZE", &cfg.Markdown.Sanitize)
+	envBool("BLOG_MARKDOWN_MATH", &cfg.Markdown.Math)
+	envBool("BLOG_MARKDOWN_HEADING_ANCHORS", &cfg.Markdown.HeadingAnchors)
+	envBool("BLOG_MARKDOWN_EMOJI", &cfg.Markdown.Emoji)
+	envString("BLOG_SHORTCODES_DIR", &cfg.Markdown.ShortcodesDir)
+	envBool("BLOG_COMMENTS", &cfg.Comments.Enabled)
+	envString("BLOG_COMMENTS_STORAGE", &cfg.Comments.Storage)
+	envString("BLOG_COMMENTS_PATH", &cfg.Comments.Path)
+	envBool("BLOG_COMMENTS_MODERATE", &cfg.Comments.Moderate)
+	envDuration("BLOG_COMMENTS_COUNT_TTL", &cfg.Comments.CountTTL)
+	envStrings("BLOG_BUILD_CHECKS", &cfg.Build.Checks)
+	envBool("BLOG_VIEWS", &cfg.Views.Enabled)
+	envString("BLOG_VIEWS_PATH", &cfg.Views.Path)
+	envDuration("BLOG_VIEWS_FLUSH_INTERVAL", &cfg.Views.FlushInterval)
+	envInt("BLOG_VIEWS_POPULAR", &cfg.Views.Popular)
+	envBool("BLOG_LIKES", &cfg.Likes.Enabled)
+	envString("BLOG_LIKES_PATH", &cfg.Likes.Path)
+	envString("BLOG_LIKES_SECRET", &cfg.Likes.Secret)
+	envBool("BLOG_REFERRERS", &cfg.Referrers.Enabled)
+	envString("BLOG_REFERRERS_PATH", &cfg.Referrers.Path)
+	envDuration("BLOG_REFERRERS_FLUSH_INTERVAL", &cfg.Referrers.FlushInterval)
+	envBool("BLOG_REFERRERS_SHOW", &cfg.Referrers.Show)
+	envInt("BLOG_REFERRERS_MIN_COUNT", &cfg.Referrers.MinCount)
+	envStrings("BLOG_REFERRERS_BLOCKLIST", &cfg.Referrers.Blocklist)
+	envBool("BLOG_ANALYTICS", &cfg.Analytics.Enabled)
+	envString("BLOG_ANALYTICS_PATH", &cfg.Analytics.Path)
+	envDuration("BLOG_ANALYTICS_FLUSH_INTERVAL", &cfg.Analytics.FlushInterval)
+	envBool("BLOG_NEWSLETTER", &cfg.Newsletter.Enabled)
+	envString("BLOG_NEWSLETTER_PATH", &cfg.Newsletter.Path)
+	envString("BLOG_SMTP_HOST", &cfg.Newsletter.SMTP.Host)
+	envInt("BLOG_SMTP_PORT", &cfg.Newsletter.SMTP.Port)
+	envString("BLOG_SMTP_USER", &cfg.Newsletter.SMTP.User)
+	envString("BLOG_SMTP_PASSWORD", &cfg.Newsletter.SMTP.Password)
+	envString("BLOG_SMTP_FROM", &cfg.Newsletter.SMTP.From)
+	envBool("BLOG_CONTACT", &cfg.Contact.Enabled)
+	envString("BLOG_CONTACT_TO", &cfg.Contact.To)
+	envString("BLOG_CONTACT_WEBHOOK", &cfg.Contact.Webhook)
+	envString("BLOG_CONTACT_SMTP_HOST", &cfg.Contact.SMTP.Host)
+	envInt("BLOG_CONTACT_SMTP_PORT", &cfg.Contact.SMTP.Port)
+	envString("BLOG_CONTACT_SMTP_USER", &cfg.Contact.SMTP.User)
+	envString("BLOG_CONTACT_SMTP_PASSWORD", &cfg.Contact.SMTP.Password)
+	envString("BLOG_CONTACT_SMTP_FROM", &cfg.Contact.SMTP.From)
+	envBool("BLOG_WEBMENTION", &cfg.Webmention.Enabled)
+	envString("BLOG_WEBMENTION_PATH", &cfg.Webmention.Path)
+	envBool("BLOG_WEBMENTION_ALLOW_PRIVATE", &cfg.Webmention.AllowPrivate)
+	envBool("BLOG_INDEXNOW", &cfg.IndexNow.Enabled)
+	envString("BLOG_INDEXNOW_KEY", &cfg.IndexNow.Key)
+	envString("BLOG_INDEXNOW_ENDPOINT", &cfg.IndexNow.Endpoint)
+	envStrings("BLOG_INDEXNOW_PING", &cfg.IndexNow.Ping)
+	envBool("BLOG_WEBSUB", &cfg.WebSub.Enabled)
+	envString("BLOG_WEBSUB_HUB", &cfg.WebSub.Hub)
+	envBool("BLOG_ACTIVITYPUB", &cfg.ActivityPub.Enabled)
+	envString("BLOG_ACTIVITYPUB_USERNAME", &cfg.ActivityPub.Username)
+	envString("BLOG_ACTIVITYPUB_KEY_FILE", &cfg.ActivityPub.KeyFile)
+	envString("BLOG_ACTIVITYPUB_PATH", &cfg.ActivityPub.Path)
+	envBool("BLOG_ACTIVITYPUB_ALLOW_PRIVATE", &cfg.ActivityPub.AllowPrivate)
+	envString("BLOG_DEPLOY_SECRET", &cfg.Deploy.Secret)
+	envString("BLOG_DEPLOY_BRANCH", &cfg.Deploy.Branch)
+	envString("BLOG_ADMIN_USER", &cfg.Admin.User)
+	envString("BLOG_ADMIN_PASSWORD", &cfg.Admin.Password)
+	envInt("BLOG_RATE_LIMIT_PER_MINUTE", &cfg.RateLimit.PerMinute)
+	envInt("BLOG_RATE_LIMIT_BURST", &cfg.RateLimit.Burst)
+	envInt("BLOG_RATE_LIMIT_POSTS_PER_MINUTE", &cfg.RateLimit.PostsPerMinute)
+	envInt("BLOG_RATE_LIMIT_POST_BURST", &cfg.RateLimit.PostBurst)
+	envInt("BLOG_RATE_LIMIT_ADMIN_FAILURES_PER_MINUTE", &cfg.RateLimit.AdminFailuresPerMinute)
+	envInt("BLOG_RATE_LIMIT_ADMIN_FAILURE_BURST", &cfg.RateLimit.AdminFailureBurst)
+	envBool("BLOG_CACHE", &cfg.Cache.Enabled)
+	envDuration("BLOG_CACHE_TTL", &cfg.Cache.TTL)
+	envInt("BLOG_CACHE_MAX_ENTRIES", &cfg.Cache.MaxEntries)
+	envString("BLOG_IMAGE_CACHE_DIR", &cfg.Images.CacheDir)
+	envBool("BLOG_IMAGE_WEBP", &cfg.Images.WebP)
+	envBool("BLOG_IMAGE_OG", &cfg.Images.OG)
+	envBool("BLOG_PDF", &cfg.PDF.Enabled)
+	envString("BLOG_PDF_CHROME", &cfg.PDF.Chrome)
+	envDuration("BLOG_PDF_TIMEOUT", &cfg.PDF.Timeout)
+	envString("BLOG_PRIVATE_SECRET", &cfg.Private.Secret)
+	envDuration("BLOG_PRIVATE_REMEMBER", &cfg.Private.Remember)
+	envString("BLOG_LINKS_REL", &cfg.Links.Rel)
+	envBool("BLOG_LINKS_NEW_TAB", &cfg.Links.NewTab)
+	envStrings("BLOG_LINKS_EXEMPT", &cfg.Links.Exempt)
+	envBool("BLOG_LINKS_TRACK", &cfg.Links.Track)
+	envString("BLOG_LINKS_SECRET", &cfg.Links.Secret)
+	envString("BLOG_IMAGE_OG_TEMPLATE", &cfg.Images.OGTemplate)
+	envString("BLOG_CSP", &cfg.Security.CSP)
+	envDuration("BLOG_HSTS", &cfg.Security.HSTS)
+	envStrings("BLOG_TLS_HOSTS", &cfg.TLS.Hosts)
+	envString("BLOG_TLS_CACHE_DIR", &cfg.TLS.CacheDir)
+	envString("BLOG_TLS_EMAIL", &cfg.TLS.Email)
+	envString("BLOG_TLS_HTTP_ADDR", &cfg.TLS.HTTPAddr)
+	envBool("BLOG_METRICS", &cfg.Metrics.Enabled)
+	envString("BLOG_METRICS_TOKEN", &cfg.Metrics.Token)
+	envString("BLOG_METRICS_ADDR", &cfg.Metrics.Addr)
+	envBool("BLOG_PPROF", &cfg.Pprof.Enabled)
+	envString("BLOG_PPROF_TOKEN", &cfg.Pprof.Token)
+	envString("BLOG_PPROF_ADDR", &cfg.Pprof.Addr)
+	envBool("BLOG_MAINTENANCE", &cfg.Maintenance.Enabled)
+	envString("BLOG_MAINTENANCE_FILE", &cfg.Maintenance.File)
+	envDuration("BLOG_MAINTENANCE_RETRY_AFTER", &cfg.Maintenance.RetryAfter)
+	envString("BLOG_ACCESS_LOG", &cfg.AccessLog.File)
+	envInt("BLOG_ACCESS_LOG_MAX_SIZE", &cfg.AccessLog.MaxSize)
+	envDuration("BLOG_ACCESS_LOG_ROTATE", &cfg.AccessLog.Rotate)
+	envInt("BLOG_ACCESS_LOG_KEEP", &cfg.AccessLog.Keep)
+	envInt("BLOG_LINT_MAX_SENTENCE_WORDS", &cfg.Lint.MaxSentenceWords)
+	envStrings("BLOG_LINT_MARKERS", &cfg.Lint.Markers)
+	envStrings("BLOG_LINT_DISABLED", &cfg.Lint.Disabled)
+}
+
+func (cfg Config) validate() error {
+	if cfg.PageSize <= 0 {
+		return errors.New("page_size must be positive")
+	}
+
+	if cfg.Sort != "date" && cfg.Sort != "order" {
+		return errors.New(`sort must be "date" or "order"`)
+	}
+
+	for _, check := range cfg.Build.Checks {
+		if !slices.Contains(publishChecks, check) {
+			return fmt.Errorf("unknown build check %q, use %s", check, strings.Join(publishChecks, ", "))
+		}
+	}
+
+	for _, feed := range cfg.Feeds {
+		if !slices.ContainsFunc(feedFormats, func(f feedFormat) bool { return f.name == feed }) {
+			return fmt.Errorf(`invalid feed %q, must be "rss", "atom" or "json"`, feed)
+		}
+	}
+
+	for _, source := range cfg.Related {
+		if source != "tags" && source != "category" && source != "recent" {
+			return fmt.Errorf(`invalid related %q, must be "tags", "category" or "recent"`, source)
+		}
+	}
+
+	for _, lang := range cfg.Languages {
+		if !validSlug(lang) {
+			return fmt.Errorf("invalid language %q", lang)
+		}
+	}
+
+	if len(cfg.Languages) > 0 && !slices.Contains(cfg.Languages, cfg.DefaultLanguage) {
+		return errors.New("default_language must be one of languages")
+	}
+
+	for _, section := range cfg.Sections {
+		if !validSlug(section) || reservedSections[section] || slices.Contains(cfg.Languages, section) {
+			return fmt.Errorf("invalid section %q", section)
+		}
+	}
+	for section := range cfg.SectionTemplates {
+		if !slices.Contains(cfg.Sections, section) {
+			return fmt.Errorf("section_templates: %q isn't one of sections", section)
+		}
+	}
+
+	aliases := map[string]string{}
+	for alias, tag := range cfg.TagAliases {
+		key := strings.ToLower(strings.TrimSpace(alias))
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if key == "" || tag == "" {
+			return fmt.Errorf("invalid tag alias %q: %q", alias, tag)
+		}
+		if other, ok := aliases[key]; ok && other != tag {
+			return fmt.Errorf("tag alias %q maps to both %q and %q", alias, other, tag)
+		}
+		aliases[key] = tag
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+	}
+
+	for host, file := range cfg.Sites {
+		if host == "" || strings.ContainsAny(host, ":/ ") || file == "" {
+			return fmt.Errorf("invalid site %q: sites map hostnames to config files", host)
+		}
+	}
+
+	if cfg.ReadTimeout <= 0 || cfg.WriteTimeout <= 0 || cfg.IdleTimeout <= 0 || cfg.ShutdownTimeout <= 0 {
+		return errors.New("server timeouts must be positive")
+	}
+
+	if cfg.RequestTimeout < 0 {
+		return errors.New("request_timeout can't be negative")
+	}
+
+	if cfg.SlowRequestThreshold <= 0 {
+		return errors.New("slow_request_threshold must be positive")
+	}
+
+	// The profiles give away a lot about the server, and taking them
+	// slows it down.
+	if cfg.Pprof.Enabled && cfg.Pprof.Token == "" && !loopbackAddr(cfg.Pprof.Addr) {
+		return errors.New("pprof needs a token, or a loopback addr of its own")
+	}
+
+	if cfg.Maintenance.RetryAfter < 0 {
+		return errors.New("maintenance.retry_after can't be negative")
+	}
+	if cfg.AccessLog.MaxSize < 0 || cfg.AccessLog.Rotate < 0 || cfg.AccessLog.Keep < 0 {
+		return errors.New("access_log.max_size, rotate and keep can't be negative")
+	}
+	if cfg.Lint.MaxSentenceWords < 0 {
+		return errors.New("lint.max_sentence_words can't be negative")
+	}
+
+	switch cfg.Content.Source {
+	case "dir", "embed":
+	case "git":
+		if cfg.Content.Git.URL == "" {
+			return errors.New("content.git.url must be set")
+		}
+	case "s3":
+		if cfg.Content.S3.Bucket == "" || cfg.Content.S3.Region == "" {
+			return errors.New("content.s3.bucket and content.s3.region must be set")
+		}
+	default:
+		return errors.New(`content.source must be "dir", "embed", "git" or "s3"`)
+	}
+
+	if (cfg.Content.Source == "git" || cfg.Content.Source == "s3") && cfg.Content.CacheDir == "" {
+		return errors.New("content.cache_dir must be set")
+	}
+
+	if cfg.Content.Refresh < 0 {
+		return errors.New("content.refresh must not be negative")
+	}
+
+	if cfg.Content.PublishCheck < 0 {
+		return errors.New("content.publish_check must not be negative")
+	}
+
+	if _, ok := styles.Registry[cfg.Markdown.HighlightStyle]; !ok {
+		return fmt.Errorf("unknown markdown.highlight_style %q", cfg.Markdown.HighlightStyle)
+	}
+
+	for _, width := range cfg.Images.Widths {
+		if width <= 0 {
+			return errors.New("images.widths must be positive")
+		}
+	}
+
+	if cfg.Comments.Storage != "json" && cfg.Comments.Storage != "sqlite" {
+		return errors.New(`comments.storage must be "json" or "sqlite"`)
+	}
+
+	if cfg.Views.FlushInterval <= 0 {
+		return errors.New("views.flush_interval must be positive")
+	}
+
+	if cfg.Referrers.FlushInterval <= 0 {
+		return errors.New("referrers.flush_interval must be positive")
+	}
+	if cfg.Referrers.MinCount < 1 {
+		return errors.New("referrers.min_count must be at least 1")
+	}
+
+	if cfg.Analytics.FlushInterval <= 0 {
+		return errors.New("analytics.flush_interval must be positive")
+	}
+
+	if cfg.RateLimit.PerMinute < 0 || cfg.RateLimit.PostsPerMinute < 0 || cfg.RateLimit.AdminFailuresPerMinute < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	if cfg.RateLimit.PerMinute > 0 && cfg.RateLimit.Burst < 1 || cfg.RateLimit.PostsPerMinute > 0 && cfg.RateLimit.PostBurst < 1 ||
+		cfg.RateLimit.AdminFailuresPerMinute > 0 && cfg.RateLimit.AdminFailureBurst < 1 {
+		return errors.New("rate limit bursts must be at least 1")
+	}
+
+	if cfg.Cache.Enabled && (cfg.Cache.TTL <= 0 || cfg.Cache.MaxEntries < 1) {
+		return errors.New("cache.ttl and cache.max_entries must be positive")
+	}
+
+	if cfg.Newsletter.Enabled && (cfg.Newsletter.SMTP.Host == "" || cfg.Newsletter.SMTP.From == "") {
+		return errors.New("newsletter.smtp.host and newsletter.smtp.from must be set")
+	}
+
+	if cfg.Contact.Enabled && cfg.Contact.Webhook == "" && (cfg.Contact.To == "" || cfg.Contact.SMTP.Host == "" || cfg.Contact.SMTP.From == "") {
+		return errors.New("contact needs a webhook, or to, smtp.host and smtp.from")
+	}
+
+	if cfg.IndexNow.Enabled {
+		if cfg.BaseURL == "" {
+			return errors.New("indexnow needs base_url")
+		}
+		if !indexNowKey.MatchString(cfg.IndexNow.Key) {
+			return errors.New("indexnow.key must be 8 to 128 letters, digits and dashes")
+		}
+	}
+
+	if cfg.WebSub.Enabled {
+		if cfg.BaseURL == "" {
+			return errors.New("websub needs base_url")
+		}
+		if !isHTTPURL(cfg.WebSub.Hub) {
+			return errors.New("websub.hub must be an http(s) URL")
+		}
+	}
+
+	if cfg.ActivityPub.Enabled {
+		if cfg.BaseURL == "" {
+			return errors.New("activitypub needs base_url")
+		}
+		if !validSlug(cfg.ActivityPub.Username) {
+			return errors.New("activitypub.username must be lowercase letters, digits and dashes")
+		}
+	}
+
+	if cfg.PDF.Enabled && cfg.PDF.Timeout <= 0 {
+		return errors.New("pdf.timeout must be positive")
+	}
+
+	if cfg.Private.Remember <= 0 {
+		return errors.New("private.remember must be positive")
+	}
+
+	if len(cfg.TLS.Hosts) > 0 && cfg.TLS.CacheDir == "" {
+		return errors.New("tls.cache_dir must be set")
+	}
+
+	return nil
+}
+
+// loopbackAddr reports whether addr listens only on the loopback
+// interface, so no one else can reach it.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func envString(name string, value *string) {
+	if v := os.Getenv(name); v != "" {
+		*value = v
+	}
+}
+
+// envStrings reads a comma separated list.
+func envStrings(name string, value *[]string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+
+	*value = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*value = append(*value, s)
+		}
+	}
+}
+
+func envBool(name string, value *bool) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("ignoring invalid environment variable", "name", name, "value", v)
+		return
+	}
+
+	*value = b
+}
+
+func envInt(name string, value *int) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("ignoring invalid environment variable", "name", name, "value", v)
+		return
+	}
+
+	*value = n
+}
+
+func envDuration(name string, value *Duration) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("ignoring invalid environment variable", "name", name, "value", v)
+		return
+	}
+
+	*value = Duration(d)
+}
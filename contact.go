@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxContactMessage = 5000
+	// contactCookie holds the token the form must send back, so other
+	// sites can't post it on a reader's behalf.
+	contactCookie = "contact_token"
+)
+
+// contactMessage is a message sent through the contact form, and the JSON
+// object posted to the contact webhook.
+type contactMessage struct {
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Message string    `json:"message"`
+	Sent    time.Time `json:"sent"`
+}
+
+// ContactHandler shows the contact form on GET, and on POST delivers the
+// message and redirects back, with ?status= telling the page what
+// happened. Like comments, submissions filling in the hidden "website"
+// field are bots, which are thanked and ignored.
+func ContactHandler() gin.HandlerFunc {
+	var limiter commentLimiter
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method == http.MethodGet {
+			contactPage(ctx)
+			return
+		}
+
+		back := func(status string) {
+			ctx.Redirect(http.StatusSeeOther, "/contact?status="+status)
+		}
+
+		token, err := ctx.Cookie(contactCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(ctx.PostForm("token"))) != 1 {
+			back("expired")
+			return
+		}
+
+		if ctx.PostForm("website") != "" {
+			back("sent")
+			return
+		}
+
+		msg, err := newContactMessage(ctx.PostForm("name"), ctx.PostForm("email"), ctx.PostForm("message"))
+		if err != nil {
+			back("invalid")
+			return
+		}
+
+		if !limiter.allow(ctx.ClientIP(), time.Now()) {
+			back("slow")
+			return
+		}
+
+		// Unlike confirmation mails, the reader should know whether their
+		// message got through.
+		err = sendContactMessage(ctx.Request.Context(), requestConfig(ctx).Contact, siteData(ctx).Title, msg)
+		if err != nil {
+			slog.Error("sending contact message", "error", err)
+			back("failed")
+			return
+		}
+
+		back("sent")
+	}
+}
+
+// contactPage renders contact.html, setting the form's token cookie if the
+// reader doesn't have one yet.
+func contactPage(ctx *gin.Context) {
+	token, err := ctx.Cookie(contactCookie)
+	if err != nil || token == "" {
+		token, err = newSubscriberToken()
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't show the contact form")
+			return
+		}
+
+		ctx.SetSameSite(http.SameSiteStrictMode)
+		ctx.SetCookie(contactCookie, token, 0, "/contact", "", ctx.Request.TLS != nil, true)
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	renderHTML(ctx, http.StatusOK, "contact.html", gin.H{
+		"Title":  "Contact",
+		"Token":  token,
+		"Status": ctx.Query("status"),
+	})
+}
+
+// newContactMessage validates and normalizes the submitted form fields.
+// The email address is required, as there'd be no way to reply otherwise.
+func newContactMessage(name, email, message string) (contactMessage, error) {
+	// The name ends up in the mail's subject.
+	name = strings.Join(strings.Fields(name), " ")
+	email, err := subscriberEmail(email)
+	if err != nil {
+		return contactMessage{}, err
+	}
+
+	msg := contactMessage{
+		Name:    name,
+		Email:   email,
+		Message: strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")),
+		Sent:    time.Now().UTC(),
+	}
+	if msg.Name == "" || utf8.RuneCountInString(msg.Name) > maxCommentName ||
+		msg.Message == "" || utf8.RuneCountInString(msg.Message) > maxContactMessage {
+		return msg, errCommentInvalid
+	}
+
+	return msg, nil
+}
+
+// sendContactMessage posts msg to the webhook of cfg, or mails it with
+// the sender as Reply-To.
+func sendContactMessage(ctx context.Context, cfg ContactConfig, site string, msg contactMessage) error {
+	if cfg.Webhook != "" {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Webhook, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// The webhook is the blog owner's, and may well be on their
+		// network.
+		resp, err := outboundClient(true).Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("contact webhook: status %d", resp.StatusCode)
+		}
+
+		return nil
+	}
+
+	body := fmt.Sprintf("%s <%s> wrote through the contact form:\r\n\r\n%s\r\n", msg.Name, msg.Email, strings.ReplaceAll(msg.Message, "\n", "\r\n"))
+
+	return sendMail(cfg.SMTP, cfg.To, "Message from "+msg.Name+" via "+site, body, map[string]string{
+		"Reply-To": msg.Email,
+	})
+}
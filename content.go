@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchTimeout bounds fetching the content of a remote source.
+const fetchTimeout = 2 * time.Minute
+
+// ContentSource is where posts are read from, chosen by content.source.
+// Load is called on every reload and returns the content as a file system
+// of markdown files; remote sources fetch it first.
+type ContentSource interface {
+	Load() (fs.FS, error)
+	// String is the directory the files are in, or what stands for it,
+	// which post files are named after.
+	String() string
+}
+
+// embeddedContent is the markdown directory at build time, for running
+// the blog from a single binary with no content on disk.
+//
+//go:embed all:markdown
+var embeddedContent embed.FS
+
+// openContentSource returns the source cfg selects.
+func openContentSource(cfg Config) (ContentSource, error) {
+	switch cfg.Content.Source {
+	case "dir":
+		return dirSource{dir: cfg.ContentDir}, nil
+	case "embed":
+		return embedSource{}, nil
+	case "git":
+		return &gitSource{url: cfg.Content.Git.URL, branch: cfg.Content.Git.Branch, dir: cfg.Content.CacheDir}, nil
+	case "s3":
+		return newS3Source(cfg.Content.S3, cfg.Content.CacheDir), nil
+	}
+
+	return nil, fmt.Errorf("unknown content source %q", cfg.Content.Source)
+}
+
+// dirSource reads posts from a local directory, which is watched for
+// changes and can be edited from /admin.
+type dirSource struct {
+	dir string
+}
+
+func (src dirSource) Load() (fs.FS, error) {
+	// os.DirFS doesn't fail for a missing directory until it's read.
+	_, err := os.Stat(src.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.DirFS(src.dir), nil
+}
+
+func (src dirSource) String() string {
+	return src.dir
+}
+
+// embedSource reads the posts built into the binary.
+type embedSource struct{}
+
+func (embedSource) Load() (fs.FS, error) {
+	return fs.Sub(embeddedContent, "markdown")
+}
+
+func (embedSource) String() string {
+	return "embed:markdown"
+}
+
+// gitSource reads posts from a shallow clone of a git repository kept in
+// dir, fetching the branch, or the remote's default branch, on every load.
+type gitSource struct {
+	url    string
+	branch string
+	dir    string
+
+	mu sync.Mutex
+}
+
+func (src *gitSource) Load() (fs.FS, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	_, err := os.Stat(filepath.Join(src.dir, ".git"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		args := []string{"clone", "--depth", "1"}
+		if src.branch != "" {
+			args = append(args, "--branch", src.branch)
+		}
+		_, err = git(ctx, append(args, "--", src.url, src.dir)...)
+
+	case err == nil:
+		_, err = git(ctx, "-C", src.dir, "fetch", "--depth", "1", "origin", firstNonEmpty(src.branch, "HEAD"))
+		if err == nil {
+			_, err = git(ctx, "-C", src.dir, "reset", "--hard", "FETCH_HEAD")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return os.DirFS(src.dir), nil
+}
+
+func (src *gitSource) String() string {
+	return src.dir
+}
+
+// git runs git with args, returning its output. Failures carry the output,
+// where git explains what went wrong.
+func git(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+	if err != nil {
+		// Named by the subcommand only, as URLs can carry credentials.
+		name := args[0]
+		if name == "-C" && len(args) > 2 {
+			name = args[2]
+		}
+		return "", fmt.Errorf("git %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
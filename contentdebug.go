@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contentStatus is how the last load of a store went.
+type contentStatus struct {
+	Name     string
+	Source   string
+	Loaded   int
+	LoadedAt time.Time
+	// Problems are the files skipped, such as those with broken
+	// frontmatter.
+	Problems []Problem
+}
+
+func newContentStatus(name string, store PostStore) contentStatus {
+	return contentStatus{
+		Name:     name,
+		Source:   store.String(),
+		Loaded:   len(store.Posts()),
+		LoadedAt: store.LoadedAt(),
+		Problems: store.Problems(),
+	}
+}
+
+// DebugContentHandler lists the posts and pages the last load skipped and
+// why, with the line of the file at fault where known. It's only served in
+// dev mode, as file paths are nobody else's business.
+func DebugContentHandler(store, pages PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		stores := []contentStatus{newContentStatus("Posts", store)}
+		if pages != nil {
+			stores = append(stores, newContentStatus("Pages", pages))
+		}
+
+		ctx.Header("Cache-Control", "no-store")
+		setCanonical(ctx, "")
+		renderHTML(ctx, http.StatusOK, "debug_content.html", gin.H{
+			"Title":  "Content",
+			"Stores": stores,
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDatePrefixedURLs(t *testing.T) {
+	route := newTestRouter(t, func(cfg *Config) { cfg.DatePrefixedURLs = true })
+
+	w := get(route, "/2025/01/hello-world")
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /2025/01/hello-world: status %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `<link rel="canonical" href="https://blog.example/2025/01/hello-world" />`) {
+		t.Error("the post's canonical URL isn't date-prefixed")
+	}
+
+	for _, path := range []string{"/2024/03/hello-world", "/posts/hello-world"} {
+		w := get(route, path)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/2025/01/hello-world" {
+			t.Errorf("GET %s: status %d to %q, want 301 to /2025/01/hello-world", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	if w := get(route, "/2025/01/readers"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/2025/02/readers" {
+		t.Errorf("GET /2025/01/readers: status %d to %q, want 301 to /2025/02/readers", w.Code, w.Header().Get("Location"))
+	}
+
+	for _, path := range []string{"/feed.xml", "/sitemap.xml"} {
+		body := get(route, path).Body.String()
+		if !strings.Contains(body, "https://blog.example/2025/01/hello-world") {
+			t.Errorf("%s doesn't link to the date-prefixed URL", path)
+		}
+		if strings.Contains(body, "https://blog.example/posts/hello-world") {
+			t.Errorf("%s links to the undated URL", path)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Publishing can be a git push: when the content directory is a clone of
+// a repository, or content comes from the git source, point a GitHub or
+// GitLab push webhook at /hooks/deploy and the blog pulls and reloads the
+// posts.
+
+// deployTimeout bounds a git pull, so a hanging remote can't pile up
+// deploys.
+const deployTimeout = 2 * time.Minute
+
+// DeployHandler verifies a push webhook and pulls the content directory in
+// the background, answering right away since GitHub gives up on slow
+// hooks. GitHub requests are verified by the HMAC of their body in
+// X-Hub-Signature-256, GitLab ones by the secret token in X-Gitlab-Token.
+func DeployHandler(store PostStore) gin.HandlerFunc {
+	var mu sync.Mutex
+
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, 1<<20))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Couldn't read payload")
+			return
+		}
+
+		if !deploySigned(ctx.Request, body, cfg.Deploy.Secret) {
+			ctx.String(http.StatusUnauthorized, "Invalid signature")
+			return
+		}
+
+		switch ctx.GetHeader("X-GitHub-Event") + ctx.GetHeader("X-Gitlab-Event") {
+		case "ping":
+			ctx.String(http.StatusOK, "pong")
+			return
+		case "push", "Push Hook":
+		default:
+			ctx.String(http.StatusAccepted, "Ignoring event")
+			return
+		}
+
+		var push struct {
+			Ref string `json:"ref"`
+		}
+		err = json.Unmarshal(body, &push)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid payload")
+			return
+		}
+		if cfg.Deploy.Branch != "" && push.Ref != "refs/heads/"+cfg.Deploy.Branch {
+			ctx.String(http.StatusAccepted, "Ignoring push to "+push.Ref)
+			return
+		}
+
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			err := deploy(store)
+			if err != nil {
+				slog.Error("deploying content", "error", err)
+			}
+		}()
+
+		ctx.String(http.StatusAccepted, "Deploying")
+	}
+}
+
+// deploySigned reports whether a webhook request carries a valid
+// signature or token for secret.
+func deploySigned(req *http.Request, body []byte, secret string) bool {
+	if token := req.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	sig, ok := strings.CutPrefix(req.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// deploy fast-forwards the content directory to its upstream and reloads
+// the posts. Remote content sources fetch the new content themselves on
+// reload.
+func deploy(store PostStore) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deployTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var out string
+	if dir := store.Dir(); dir != "" {
+		var err error
+		out, err = git(ctx, "-C", dir, "pull", "--ff-only")
+		if err != nil {
+			return err
+		}
+	}
+
+	err := store.Reload()
+	if err != nil {
+		return err
+	}
+	slog.Info("deployed content", "source", store.String(), "duration", time.Since(start), "git", out)
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deps are what the router serves the blog from. Store and Renderer are
+// required; Clock defaults to the system's, and the others are nil when
+// disabled.
+type Deps struct {
+	Store       PostStore
+	Pages       PostStore
+	Renderer    Renderer
+	Clock       Clock
+	Site        SiteData
+	Comments    CommentStore
+	Views       *ViewCounter
+	Likes       *Likes
+	Referrers   *Referrers
+	Analytics   *Analytics
+	Subscribers *SubscriberStore
+	Mentions    *Webmentions
+	ActivityPub *ActivityPub
+	// Middleware runs before the blog's own middleware.
+	Middleware []gin.HandlerFunc
+}
+
+// PostStore is where handlers get posts, and standalone pages, from. A
+// ContentStore loads them from a content source; tests can serve a fixed
+// set.
+type PostStore interface {
+	// String names where the posts are loaded from, for logs.
+	fmt.Stringer
+	// Posts returns every post, drafts and scheduled ones included, in no
+	// particular order. The slice is the caller's.
+	Posts() []PostData
+	// Get returns the post with the given slug, see GetLang.
+	Get(slug string) (PostData, bool)
+	GetLang(lang, slug string) (PostData, bool)
+	// Problems are the files the last load skipped.
+	Problems() []Problem
+	// Source returns the file post was written in.
+	Source(post PostData) ([]byte, error)
+	// Reload loads the posts again, and OnReload adds a hook run after
+	// every load with the posts loaded.
+	Reload() error
+	OnReload(hook func([]PostData))
+	LoadedAt() time.Time
+	// Readable reports whether the posts could be loaded again.
+	Readable() bool
+	// Dir is the directory the posts are in, "" for remote sources, whose
+	// posts can't be edited in place.
+	Dir() string
+}
+
+// Renderer renders markdown that isn't part of a post, such as editor
+// previews and frontmatter fields, the way posts are rendered.
+type Renderer interface {
+	Render(c context.Context, source []byte, idPrefix string, trusted bool) (template.HTML, []TOCEntry, error)
+}
+
+// Clock tells handlers the time, which decides what's published: a post
+// scheduled for later stays hidden until then.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ConfigMiddleware makes cfg the config of every request, see
+// requestConfig.
+func ConfigMiddleware(cfg *Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Config", cfg)
+	}
+}
+
+// requestConfig is the config the router serving the request was set up
+// with.
+func requestConfig(ctx *gin.Context) *Config {
+	return ctx.MustGet("Config").(*Config)
+}
+
+// ClockMiddleware makes clock the time of every request, see requestTime.
+func ClockMiddleware(clock Clock) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Clock", clock)
+	}
+}
+
+// requestTime is the time the request is served at, by the router's
+// Clock.
+func requestTime(ctx *gin.Context) time.Time {
+	if clock, ok := ctx.Get("Clock"); ok {
+		return clock.(Clock).Now()
+	}
+
+	return time.Now()
+}
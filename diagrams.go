@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mermaidDiagrams renders ```mermaid code blocks as diagrams instead of
+// highlighted source. They come out as <pre class="mermaid"> holding the
+// diagram source, which Mermaid turns into SVG in the browser, see
+// static/js/diagrams.js in the theme.
+type mermaidDiagrams struct{}
+
+func (mermaidDiagrams) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(mermaidTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(mermaidRenderer{}, 500),
+	))
+}
+
+var kindMermaid = ast.NewNodeKind("Mermaid")
+
+type mermaidBlock struct {
+	ast.BaseBlock
+}
+
+func (n *mermaidBlock) Kind() ast.NodeKind { return kindMermaid }
+
+func (n *mermaidBlock) IsRaw() bool { return true }
+
+func (n *mermaidBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mermaidTransformer swaps mermaid code blocks for mermaidBlocks before
+// highlighting gets to them.
+type mermaidTransformer struct{}
+
+func (mermaidTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var blocks []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering {
+			if bytes.Equal(block.Language(source), []byte("mermaid")) {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		diagram := &mermaidBlock{}
+		diagram.SetLines(block.Lines())
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+type mermaidRenderer struct{}
+
+func (r mermaidRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMermaid, r.renderMermaid)
+}
+
+func (r mermaidRenderer) renderMermaid(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString(`<pre class="mermaid">`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+	_, _ = w.WriteString("</pre>\n")
+
+	return ast.WalkContinue, nil
+}
+
+// hasDiagrams reports whether rendered HTML contains diagrams, so Mermaid
+// is only loaded on the pages that need it.
+func hasDiagrams(html []byte) bool {
+	return bytes.Contains(html, []byte(`<pre class="mermaid">`))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// The digest is an HTML mail of the posts published in the last few
+// days, rendered with the digest.html template. It's sent to the
+// newsletter's confirmed subscribers with `digest -send`, typically from
+// cron, or from the admin with POST /admin/digest; both can print or
+// preview it first.
+
+// Digest is the data digest.html is rendered with.
+type Digest struct {
+	Site SiteData
+	// Subject is the subject of the mail, also the title of the page.
+	Subject string
+	// Since is when the oldest post included may have been published.
+	Since time.Time
+	Posts []DigestPost
+	// Unsubscribe is the unsubscribe link of the subscriber the digest is
+	// rendered for, empty when it's printed or previewed.
+	Unsubscribe string
+}
+
+// DigestPost is a post in a Digest. Its URL and the links in its excerpt
+// are absolute, as mail clients have nothing to resolve them against.
+type DigestPost struct {
+	Title   string
+	URL     string
+	Date    time.Time
+	Author  string
+	Excerpt template.HTML
+}
+
+// newDigest returns the digest of the posts listed as of now and published
+// in the last days, newest first, linking to the blog at base.
+func newDigest(site SiteData, posts []PostData, base string, days int, now time.Time) Digest {
+	since := now.AddDate(0, 0, -days)
+	digest := Digest{
+		Site:    site,
+		Subject: fmt.Sprintf("%s: new posts since %s", site.Title, since.Format("January 2")),
+		Since:   since,
+	}
+
+	posts = slices.Clone(posts)
+	sortPostsByDate(posts)
+	for _, post := range posts {
+		if !post.Listed(now) || post.Date.Before(since) {
+			continue
+		}
+
+		link := base + post.URL
+		digest.Posts = append(digest.Posts, DigestPost{
+			Title:   post.Title,
+			URL:     link,
+			Date:    post.Date,
+			Author:  post.Author.Name,
+			Excerpt: template.HTML(absoluteHTML(string(post.Excerpt()), link)),
+		})
+	}
+
+	return digest
+}
+
+// renderDigest renders digest with the digest.html template, through the
+// engine's renderer so a theme's or site's version of it is used.
+func renderDigest(route *gin.Engine, digest Digest) (string, error) {
+	instance, ok := route.HTMLRender.Instance("digest.html", digest).(render.HTML)
+	if !ok {
+		return "", errors.New("digest: unexpected HTML renderer")
+	}
+
+	var buf bytes.Buffer
+	err := instance.Template.ExecuteTemplate(&buf, "digest.html", digest)
+
+	return buf.String(), err
+}
+
+// sendDigest mails digest to every confirmed subscriber, each with their
+// own unsubscribe link, and returns how many it was sent to. It carries on
+// past failed mails, returning the first error.
+func sendDigest(route *gin.Engine, smtp SMTPConfig, subscribers *SubscriberStore, digest Digest, base string) (int, error) {
+	subs, err := subscribers.Confirmed()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var firstErr error
+	for _, sub := range subs {
+		digest.Unsubscribe = base + "/unsubscribe?token=" + url.QueryEscape(sub.Token)
+		body, err := renderDigest(route, digest)
+		if err == nil {
+			err = sendMail(smtp, sub.Email, digest.Subject, body, map[string]string{
+				"Content-Type":          "text/html; charset=utf-8",
+				"List-Unsubscribe":      "<" + digest.Unsubscribe + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			})
+		}
+		if err != nil {
+			slog.Warn("sending digest", "to", sub.Email, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sent++
+	}
+
+	return sent, firstErr
+}
+
+// writeDigest compiles the digest of the posts of the last -days days and
+// prints it, writes it to the file -out, or with -send mails it to the
+// newsletter's subscribers. Nothing is sent without new posts.
+func writeDigest(cfg *Config, args []string, renderer *MarkdownRenderer) error {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	days := flags.Int("days", 7, "include the posts of this many days")
+	out := flags.String("out", "", "write the digest to this file instead of printing it")
+	send := flags.Bool("send", false, "mail the digest to the newsletter's subscribers")
+	flags.Parse(args)
+
+	if *days <= 0 {
+		return errors.New("digest: -days must be positive")
+	}
+	// Mail clients need absolute links, and there's no request to take
+	// the blog's address from.
+	if cfg.BaseURL == "" {
+		return errors.New("digest: base_url is required")
+	}
+	if *send && !cfg.Newsletter.Enabled {
+		return errors.New("digest: the newsletter is disabled")
+	}
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		return err
+	}
+	site.BaseURL = cfg.BaseURL
+	site.Lang = cfg.DefaultLanguage
+	site.Year = time.Now().Year()
+
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewContentStore(source, renderer)
+	if err != nil {
+		return err
+	}
+
+	route, err := NewRouter(cfg, Deps{Store: store, Renderer: renderer, Site: site})
+	if err != nil {
+		return err
+	}
+
+	digest := newDigest(site, store.Posts(), cfg.BaseURL, *days, time.Now())
+	if len(digest.Posts) == 0 {
+		slog.Info("no posts for the digest", "days", *days)
+		return nil
+	}
+
+	if *send {
+		subscribers, err := openSubscriberStore(cfg.Newsletter)
+		if err != nil {
+			return err
+		}
+		defer subscribers.Close()
+
+		sent, err := sendDigest(route, cfg.Newsletter.SMTP, subscribers, digest, cfg.BaseURL)
+		slog.Info("sent digest", "posts", len(digest.Posts), "subscribers", sent)
+		return err
+	}
+
+	body, err := renderDigest(route, digest)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return os.WriteFile(*out, []byte(body), 0o644)
+	}
+	_, err = fmt.Print(body)
+
+	return err
+}
+
+// AdminDigestHandler previews the digest of the last ?days=7 days on GET,
+// and mails it to the newsletter's subscribers on POST.
+func AdminDigestHandler(route *gin.Engine, store PostStore, subscribers *SubscriberStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		days, err := strconv.Atoi(ctx.DefaultQuery("days", "7"))
+		if err != nil || days <= 0 {
+			ctx.String(http.StatusBadRequest, "days must be a positive number")
+			return
+		}
+
+		base := absoluteURL(ctx, "")
+		digest := newDigest(siteData(ctx), store.Posts(), base, days, requestTime(ctx))
+
+		if ctx.Request.Method == http.MethodPost {
+			if len(digest.Posts) == 0 {
+				ctx.String(http.StatusOK, "No posts in the last %d days, nothing sent.\n", days)
+				return
+			}
+
+			sent, err := sendDigest(route, requestConfig(ctx).Newsletter.SMTP, subscribers, digest, base)
+			if err != nil {
+				ctx.Error(err)
+				ctx.String(http.StatusBadGateway, "Sent the digest to %d subscribers, some failed: %v\n", sent, err)
+				return
+			}
+			ctx.String(http.StatusOK, "Sent the digest of %d posts to %d subscribers.\n", len(digest.Posts), sent)
+			return
+		}
+
+		body, err := renderDigest(route, digest)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't render the digest")
+			return
+		}
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(body))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Published reports whether post is visible to readers at now: it isn't a
+// draft and its publish time has come.
+func (post PostData) Published(now time.Time) bool {
+	return !post.Draft && !post.PublishTime().After(now)
+}
+
+// PublishTime is when post goes live: its PublishAt, or its Date if that's
+// later.
+func (post PostData) PublishTime() time.Time {
+	if post.PublishAt.After(post.Date) {
+		return post.PublishAt
+	}
+
+	return post.Date
+}
+
+// previewing reports whether drafts and scheduled posts are shown for this
+// request, either because preview mode is on or because the request
+// carries ?preview= with the configured token.
+func previewing(ctx *gin.Context) bool {
+	cfg := requestConfig(ctx)
+	if cfg.Preview {
+		return true
+	}
+
+	token := ctx.Query("preview")
+	return cfg.PreviewToken != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(cfg.PreviewToken)) == 1
+}
+
+// visiblePosts returns the posts the current request may see, in its
+// language on multilingual blogs.
+func visiblePosts(ctx *gin.Context, store PostStore) []PostData {
+	posts := visiblePostsAnyLang(ctx, store)
+	if section := requestSection(ctx); section != "" {
+		posts = postsInSection(posts, section)
+	}
+	if !requestConfig(ctx).multilingual() {
+		return posts
+	}
+
+	lang := requestLang(ctx)
+	inLang := posts[:0]
+	for _, post := range posts {
+		if post.Lang == lang {
+			inLang = append(inLang, post)
+		}
+	}
+
+	return inLang
+}
+
+// visiblePostsAnyLang returns the posts the current request may see in
+// every language. Private posts are never listed, see Listed.
+func visiblePostsAnyLang(ctx *gin.Context, store PostStore) []PostData {
+	posts := store.Posts()
+	if previewing(ctx) {
+		return posts
+	}
+
+	now := requestTime(ctx)
+	visible := posts[:0]
+	for _, post := range posts {
+		if post.Listed(now) {
+			visible = append(visible, post)
+		}
+	}
+
+	return visible
+}
+
+// visibleSummaries returns up to limit of the summaries whose posts the
+// current request may see, leaving out private ones.
+func visibleSummaries(ctx *gin.Context, store PostStore, summaries []PostSummary, limit int) []PostSummary {
+	visible := make([]PostSummary, 0, limit)
+	for _, summary := range summaries {
+		if len(visible) == limit {
+			break
+		}
+
+		if post, ok := visiblePost(ctx, store, summary.Slug); ok && !post.Private() {
+			visible = append(visible, summary)
+		}
+	}
+
+	return visible
+}
+
+// visiblePost returns the post slug in the request's language, if the
+// request may see it. Responses showing a private post are marked
+// private, so they aren't cached for other readers.
+func visiblePost(ctx *gin.Context, store PostStore, slug string) (PostData, bool) {
+	if !validSlug(slug) {
+		return PostData{}, false
+	}
+
+	post, ok := store.GetLang(requestLang(ctx), slug)
+	return readablePost(ctx, post, ok)
+}
+
+// visiblePostAnyLang is visiblePost for a post in any language, preferring
+// the default one.
+func visiblePostAnyLang(ctx *gin.Context, store PostStore, slug string) (PostData, bool) {
+	if !validSlug(slug) {
+		return PostData{}, false
+	}
+
+	post, ok := store.Get(slug)
+	return readablePost(ctx, post, ok)
+}
+
+func readablePost(ctx *gin.Context, post PostData, ok bool) (PostData, bool) {
+	if !ok || !(post.Published(requestTime(ctx)) || previewing(ctx)) || !canRead(ctx, post) {
+		return PostData{}, false
+	}
+	if post.Private() {
+		ctx.Header("Cache-Control", "private, no-store")
+	}
+
+	return post, true
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// emojiExtension replaces :name: shortcodes, as on GitHub, with their
+// emoji. Unknown names are left as they are, so times such as 10:30:00
+// stay text.
+type emojiExtension struct{}
+
+func (emojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(emojiParser{}, 500)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(emojiRenderer{}, 500),
+	))
+}
+
+var kindEmoji = ast.NewNodeKind("Emoji")
+
+type emojiNode struct {
+	ast.BaseInline
+	name  string
+	emoji string
+}
+
+func (n *emojiNode) Kind() ast.NodeKind { return kindEmoji }
+
+func (n *emojiNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.name}, nil)
+}
+
+type emojiParser struct{}
+
+func (emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (emojiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+
+	for i := 1; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ':' && i > 1:
+			name := string(line[1:i])
+			emoji, ok := emojis[name]
+			if !ok {
+				return nil
+			}
+
+			block.Advance(i + 1)
+			return &emojiNode{name: name, emoji: emoji}
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '+', c == '-':
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+type emojiRenderer struct{}
+
+func (r emojiRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindEmoji, r.render)
+}
+
+func (r emojiRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(node.(*emojiNode).emoji)
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+// emojis are the shortcodes expanded, by name. They're the most used of
+// GitHub's, under the same names.
+var emojis = map[string]string{
+	"+1":                       "👍",
+	"-1":                       "👎",
+	"100":                      "💯",
+	"airplane":                 "✈️",
+	"alarm_clock":              "⏰",
+	"angry":                    "😠",
+	"apple":                    "🍎",
+	"arrow_down":               "⬇️",
+	"arrow_left":               "⬅️",
+	"arrow_right":              "➡️",
+	"arrow_up":                 "⬆️",
+	"art":                      "🎨",
+	"balloon":                  "🎈",
+	"bangbang":                 "‼️",
+	"beer":                     "🍺",
+	"bell":                     "🔔",
+	"bike":                     "🚲",
+	"blush":                    "😊",
+	"bomb":                     "💣",
+	"book":                     "📖",
+	"books":                    "📚",
+	"boom":                     "💥",
+	"bowtie":                   "🤵",
+	"broken_heart":             "💔",
+	"bug":                      "🐛",
+	"bulb":                     "💡",
+	"calendar":                 "📆",
+	"camera":                   "📷",
+	"cat":                      "🐱",
+	"chart_with_upwards_trend": "📈",
+	"check":                    "✔️",
+	"clap":                     "👏",
+	"clipboard":                "📋",
+	"closed_book":              "📕",
+	"cloud":                    "☁️",
+	"coffee":                   "☕",
+	"computer":                 "💻",
+	"confused":                 "😕",
+	"construction":             "🚧",
+	"cool":                     "🆒",
+	"cry":                      "😢",
+	"dart":                     "🎯",
+	"dizzy":                    "💫",
+	"dog":                      "🐶",
+	"exclamation":              "❗",
+	"eyes":                     "👀",
+	"facepalm":                 "🤦",
+	"fire":                     "🔥",
+	"flushed":                  "😳",
+	"gear":                     "⚙️",
+	"gem":                      "💎",
+	"ghost":                    "👻",
+	"gift":                     "🎁",
+	"globe_with_meridians":     "🌐",
+	"grey_question":            "❔",
+	"grimacing":                "😬",
+	"grin":                     "😁",
+	"grinning":                 "😀",
+	"hammer":                   "🔨",
+	"hammer_and_wrench":        "🛠️",
+	"hand":                     "✋",
+	"heart":                    "❤️",
+	"heart_eyes":               "😍",
+	"heavy_check_mark":         "✔️",
+	"heavy_minus_sign":         "➖",
+	"heavy_plus_sign":          "➕",
+	"hourglass":                "⌛",
+	"house":                    "🏠",
+	"hugs":                     "🤗",
+	"information_source":       "ℹ️",
+	"innocent":                 "😇",
+	"joy":                      "😂",
+	"key":                      "🔑",
+	"kissing_heart":            "😘",
+	"laughing":                 "😆",
+	"link":                     "🔗",
+	"lock":                     "🔒",
+	"loudspeaker":              "📢",
+	"mag":                      "🔍",
+	"mailbox":                  "📫",
+	"memo":                     "📝",
+	"moon":                     "🌔",
+	"muscle":                   "💪",
+	"musical_note":             "🎵",
+	"neutral_face":             "😐",
+	"no_entry":                 "⛔",
+	"no_entry_sign":            "🚫",
+	"ok":                       "🆗",
+	"ok_hand":                  "👌",
+	"open_mouth":               "😮",
+	"package":                  "📦",
+	"paperclip":                "📎",
+	"partying_face":            "🥳",
+	"pencil":                   "📝",
+	"pencil2":                  "✏️",
+	"penguin":                  "🐧",
+	"point_down":               "👇",
+	"point_left":               "👈",
+	"point_right":              "👉",
+	"point_up":                 "☝️",
+	"pray":                     "🙏",
+	"pushpin":                  "📌",
+	"question":                 "❓",
+	"rage":                     "😡",
+	"rainbow":                  "🌈",
+	"raised_hands":             "🙌",
+	"recycle":                  "♻️",
+	"relaxed":                  "☺️",
+	"relieved":                 "😌",
+	"rocket":                   "🚀",
+	"rofl":                     "🤣",
+	"rotating_light":           "🚨",
+	"scream":                   "😱",
+	"see_no_evil":              "🙈",
+	"shrug":                    "🤷",
+	"skull":                    "💀",
+	"sleeping":                 "😴",
+	"slightly_smiling_face":    "🙂",
+	"smile":                    "😄",
+	"smiley":                   "😃",
+	"smirk":                    "😏",
+	"snake":                    "🐍",
+	"snowflake":                "❄️",
+	"sob":                      "😭",
+	"sparkles":                 "✨",
+	"speech_balloon":           "💬",
+	"star":                     "⭐",
+	"star_struck":              "🤩",
+	"stuck_out_tongue":         "😛",
+	"sun_with_face":            "🌞",
+	"sunglasses":               "😎",
+	"sunny":                    "☀️",
+	"sweat":                    "😓",
+	"sweat_smile":              "😅",
+	"tada":                     "🎉",
+	"thinking":                 "🤔",
+	"thumbsdown":               "👎",
+	"thumbsup":                 "👍",
+	"trophy":                   "🏆",
+	"tulip":                    "🌷",
+	"unamused":                 "😒",
+	"unlock":                   "🔓",
+	"upside_down_face":         "🙃",
+	"v":                        "✌️",
+	"warning":                  "⚠️",
+	"wave":                     "👋",
+	"weary":                    "😩",
+	"white_check_mark":         "✅",
+	"wink":                     "😉",
+	"worried":                  "😟",
+	"wrench":                   "🔧",
+	"x":                        "❌",
+	"yum":                      "😋",
+	"zap":                      "⚡",
+	"zzz":                      "💤",
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notFound renders the 404 page, unless the page has moved, see Redirects.
+// message tells the reader what was missing and must not contain internal
+// error details.
+func notFound(ctx *gin.Context, message string) {
+	if redirectMoved(ctx) {
+		return
+	}
+
+	setCanonical(ctx, "")
+	renderHTML(ctx, http.StatusNotFound, "404.html", gin.H{
+		"Title":   "Not found",
+		"Message": message,
+	})
+}
+
+// NoRouteHandler renders the 404 page for paths no route matches.
+func NoRouteHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		notFound(ctx, "Page not found")
+	}
+}
+
+// serverError renders the 500 page for err, which is logged with the
+// request ID rather than shown.
+func serverError(ctx *gin.Context, err error) {
+	slog.Error("serving request", "request_id", requestID(ctx), "path", ctx.Request.URL.Path, "error", err)
+
+	setCanonical(ctx, "")
+	renderHTML(ctx, http.StatusInternalServerError, "500.html", gin.H{
+		"Title":     "Server error",
+		"RequestID": requestID(ctx),
+	})
+}
+
+// tooSlow renders the 503 page for requests that ran out of time, see
+// RequestTimeout.
+func tooSlow(ctx *gin.Context, err error) {
+	slog.Warn("request timed out", "request_id", requestID(ctx), "path", ctx.Request.URL.Path, "error", err)
+
+	ctx.Header("Retry-After", "30")
+	setCanonical(ctx, "")
+	renderHTML(ctx, http.StatusServiceUnavailable, "503.html", gin.H{
+		"Title":     "Try again later",
+		"RequestID": requestID(ctx),
+	})
+}
+
+// Recovery turns panics in handlers into the 500 page. The panic is only
+// logged, together with the request ID, so nothing internal reaches the
+// reader.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(ctx *gin.Context, err any) {
+		slog.Error("panic serving request", "request_id", requestID(ctx), "path", ctx.Request.URL.Path, "error", err)
+
+		if ctx.Writer.Written() {
+			ctx.Abort()
+			return
+		}
+
+		setCanonical(ctx, "")
+		renderHTML(ctx, http.StatusInternalServerError, "500.html", gin.H{
+			"Title":     "Server error",
+			"RequestID": requestID(ctx),
+		})
+		ctx.Abort()
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"strings"
+)
+
+// moreMarker ends a post's excerpt when placed in its body.
+const moreMarker = "<!--more-->"
+
+// excerptWords is the length of excerpts cut from the post text.
+const excerptWords = 50
+
+// postExcerpt picks a post's excerpt: the part of the body before
+// <!--more--> when lead is non-nil, else the Summary or Description
+// frontmatter, else the first excerptWords words of content, the rendered
+// post. idPrefix namespaces the excerpt's heading ids as for
+// MarkdownRenderer.Render, which c is passed to.
+func postExcerpt(c context.Context, renderer *MarkdownRenderer, post PostData, content template.HTML, lead []byte, idPrefix string) (template.HTML, error) {
+	if lead != nil {
+		html, _, err := renderer.Render(c, lead, idPrefix, post.Unsafe)
+		return html, err
+	}
+
+	if text := firstNonEmpty(post.Summary, post.Description); text != "" {
+		return template.HTML("<p>" + template.HTMLEscapeString(text) + "</p>"), nil
+	}
+
+	words := strings.Fields(stripHTML(string(content)))
+	text := strings.Join(words[:min(len(words), excerptWords)], " ")
+	if len(words) > excerptWords {
+		text += "…"
+	}
+
+	return template.HTML("<p>" + template.HTMLEscapeString(text) + "</p>"), nil
+}
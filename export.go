@@ -0,0 +1,420 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// An export archive holds the blog's content under content/, its
+// standalone pages under pages/ and its own static files under static/,
+// along with the site, authors and redirects files, and posts.json listing
+// every post's metadata for other tools. Import restores all of it but
+// posts.json.
+
+// exportManifest is posts.json.
+type exportManifest struct {
+	Exported time.Time    `json:"exported"`
+	Site     string       `json:"site"`
+	BaseURL  string       `json:"base_url,omitempty"`
+	Posts    []exportPost `json:"posts"`
+	Pages    []exportPost `json:"pages,omitempty"`
+}
+
+type exportPost struct {
+	// File is the post's path in the archive.
+	File        string     `json:"file"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url"`
+	Lang        string     `json:"lang,omitempty"`
+	Section     string     `json:"section,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+	Draft       bool       `json:"draft,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	Series      string     `json:"series,omitempty"`
+	Aliases     []string   `json:"aliases,omitempty"`
+	// CanonicalURL and SyndicatedTo are where else the post is published.
+	CanonicalURL string   `json:"canonical_url,omitempty"`
+	SyndicatedTo []string `json:"syndicated_to,omitempty"`
+}
+
+// exportFiles are the single files of cfg archived, by their name in the
+// archive.
+func exportFiles(cfg *Config) map[string]string {
+	return map[string]string{
+		"site.yaml":      cfg.SiteFile,
+		"authors.yaml":   cfg.AuthorsFile,
+		"redirects.yaml": cfg.RedirectsFile,
+	}
+}
+
+// exportArchive writes the blog to a .zip, .tar.gz or .tgz archive.
+func exportArchive(cfg *Config, args []string, renderer *MarkdownRenderer) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "blog-export-"+time.Now().Format("2006-01-02")+".tar.gz", "archive to write, .zip, .tar.gz or .tgz")
+	flags.Parse(args)
+
+	// Only frontmatter is needed.
+	cfg.Content.Lazy = true
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		return err
+	}
+
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewContentStore(source, renderer)
+	if err != nil {
+		return err
+	}
+
+	pageStore, err := NewPageStore(cfg.PagesDir, renderer)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	archive, err := newArchiveWriter(f, *out)
+	if err != nil {
+		return err
+	}
+
+	fsys, err := source.Load()
+	if err != nil {
+		return err
+	}
+	err = archiveDir(archive, "content", fsys)
+	if err != nil {
+		return err
+	}
+	if pageStore != nil {
+		err = archiveDir(archive, "pages", os.DirFS(cfg.PagesDir))
+		if err != nil {
+			return err
+		}
+	}
+	err = archiveDir(archive, "static", os.DirFS(cfg.StaticDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for name, file := range exportFiles(cfg) {
+		b, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = archive.add(name, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	manifest := exportManifest{
+		Exported: time.Now().UTC(),
+		Site:     site.Title,
+		BaseURL:  cfg.BaseURL,
+		Posts:    exportPosts(store.Posts(), "content", source.String()),
+	}
+	if pageStore != nil {
+		manifest.Pages = exportPosts(pageStore.Posts(), "pages", cfg.PagesDir)
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = archive.add("posts.json", b)
+	if err != nil {
+		return err
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("exported", "file", *out, "posts", len(manifest.Posts), "pages", len(manifest.Pages))
+	return f.Close()
+}
+
+// exportPosts lists the metadata of posts, whose files are under dir and
+// archived under prefix.
+func exportPosts(posts []PostData, prefix, dir string) []exportPost {
+	exported := make([]exportPost, 0, len(posts))
+	for _, post := range posts {
+		file := post.File
+		if rel, err := filepath.Rel(dir, post.File); err == nil {
+			file = path.Join(prefix, filepath.ToSlash(rel))
+		}
+
+		p := exportPost{
+			File:         file,
+			Title:        post.Title,
+			Slug:         post.Slug,
+			URL:          post.URL,
+			Lang:         post.Lang,
+			Section:      post.Section,
+			Draft:        post.Draft,
+			Description:  post.Description,
+			Author:       firstNonEmpty(post.Author.Key, post.Author.Name),
+			Tags:         post.Tags,
+			Category:     post.Category,
+			Series:       post.Series,
+			Aliases:      post.Aliases,
+			CanonicalURL: post.CanonicalURL,
+			SyndicatedTo: post.SyndicatedTo,
+		}
+		if !post.Date.IsZero() {
+			p.Date = &post.Date
+		}
+		exported = append(exported, p)
+	}
+
+	return exported
+}
+
+// archiveDir adds every file of fsys to archive under prefix.
+func archiveDir(archive archiveWriter, prefix string, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		return archive.add(path.Join(prefix, name), b)
+	})
+}
+
+// importArchive restores an archive made by export. Existing files are
+// only replaced with -force, and nothing is written if any would be. With
+// -from, it converts the posts of a Hugo or Jekyll site instead, see
+// importSite.
+func importArchive(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	force := flags.Bool("force", false, "replace existing files")
+	from := flags.String("from", "", `convert a "hugo" content directory or "jekyll" site`)
+	permalink := flags.String("permalink", "", "the converted site's permalink pattern, for aliases of the old URLs")
+	out := flags.String("out", cfg.ContentDir, "directory to write converted posts to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s import [-force] archive\n       %s import -from hugo|jekyll [-permalink pattern] [-out dir] dir\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *from != "" {
+		return importSite(*from, flags.Arg(0), *out, *permalink, cfg.DefaultLanguage)
+	}
+	if cfg.Content.Source != "dir" {
+		return errors.New(`import needs content.source "dir"`)
+	}
+
+	files, err := readArchive(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	roots := map[string]string{
+		"content": cfg.ContentDir,
+		"pages":   cfg.PagesDir,
+		"static":  cfg.StaticDir,
+	}
+	dests := map[string]string{}
+	for name := range files {
+		if name == "posts.json" {
+			continue
+		}
+
+		var dest string
+		if file, ok := exportFiles(cfg)[name]; ok {
+			dest = file
+		} else if top, rest, ok := strings.Cut(name, "/"); ok && roots[top] != "" {
+			dest, err = safeJoin(roots[top], filepath.FromSlash(rest))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		} else {
+			slog.Warn("skipping unknown file in archive", "file", name)
+			continue
+		}
+
+		if _, err := os.Stat(dest); err == nil && !*force {
+			return fmt.Errorf("%s already exists, use -force to replace it", dest)
+		}
+		dests[name] = dest
+	}
+
+	for name, dest := range dests {
+		err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = writeFileAtomic(dest, files[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("imported", "file", flags.Arg(0), "files", len(dests))
+	return nil
+}
+
+// archiveWriter writes a zip or gzipped tar archive.
+type archiveWriter interface {
+	add(name string, data []byte) error
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, name string) (archiveWriter, error) {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return zipWriter{zip.NewWriter(w)}, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz := gzip.NewWriter(w)
+		return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	}
+
+	return nil, fmt.Errorf("%s: archives must be .zip, .tar.gz or .tgz", name)
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w zipWriter) add(name string, data []byte) error {
+	f, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	return err
+}
+
+func (w zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarWriter) add(name string, data []byte) error {
+	err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.tw.Write(data)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	err := w.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return w.gz.Close()
+}
+
+// readArchive returns the files of a zip or gzipped tar archive by name.
+func readArchive(name string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			files[f.Name] = b
+		}
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			files[hdr.Name] = b
+		}
+	default:
+		return nil, fmt.Errorf("%s: archives must be .zip, .tar.gz or .tgz", name)
+	}
+
+	return files, nil
+}
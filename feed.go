@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/xml"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedFormat is a format feeds are served in, at the path file under
+// the listing's prefix.
+type feedFormat struct {
+	name      string
+	file      string
+	mediaType string
+}
+
+// feedFormats are the formats feeds can be served in, by the name the
+// feeds config enables them with.
+var feedFormats = []feedFormat{
+	{"rss", "/feed.xml", "application/rss+xml"},
+	{"atom", "/atom.xml", "application/atom+xml"},
+	{"json", "/feed.json", "application/feed+json"},
+}
+
+// enabledFeeds returns the formats cfg's feeds enables.
+func enabledFeeds(cfg *Config) []feedFormat {
+	var enabled []feedFormat
+	for _, f := range feedFormats {
+		if slices.Contains(cfg.Feeds, f.name) {
+			enabled = append(enabled, f)
+		}
+	}
+
+	return enabled
+}
+
+// feedRoutes serves the enabled feeds of the posts listed at prefix, such
+// as /tags/:tag.
+func feedRoutes(route gin.IRoutes, cfg *Config, prefix string, store PostStore) {
+	handlers := map[string]func(PostStore) gin.HandlerFunc{
+		"rss":  RSSHandler,
+		"atom": AtomHandler,
+		"json": JSONFeedHandler,
+	}
+	for _, f := range enabledFeeds(cfg) {
+		route.GET(prefix+f.file, handlers[f.name](store))
+	}
+}
+
+// feedPaths returns the paths of the enabled feeds under prefix.
+func feedPaths(cfg *Config, prefix string) []string {
+	var paths []string
+	for _, f := range enabledFeeds(cfg) {
+		paths = append(paths, prefix+f.file)
+	}
+
+	return paths
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr,omitempty"`
+	ItunesNS  string     `xml:"xmlns:itunes,attr,omitempty"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	Language      string     `xml:"language,omitempty"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	AtomLinks     []atomLink `xml:"atom:link"`
+	// The iTunes tags of podcasts, see Podcast.
+	ItunesAuthor   string          `xml:"itunes:author,omitempty"`
+	ItunesImage    *itunesImage    `xml:"itunes:image"`
+	ItunesCategory *itunesCategory `xml:"itunes:category"`
+	ItunesOwner    *itunesOwner    `xml:"itunes:owner"`
+	ItunesExplicit string          `xml:"itunes:explicit,omitempty"`
+	Items          []rssItem       `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Description string `xml:"description"`
+	Content     *cdata `xml:"content:encoded,omitempty"`
+	Author      string `xml:"author,omitempty"`
+	// The audio of podcast episodes, see Episode.
+	Enclosure      *rssEnclosure `xml:"enclosure"`
+	ItunesDuration string        `xml:"itunes:duration,omitempty"`
+	ItunesEpisode  int           `xml:"itunes:episode,omitempty"`
+	ItunesSeason   int           `xml:"itunes:season,omitempty"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Summary *atomContent `xml:"summary,omitempty"`
+	Content *atomContent `xml:"content,omitempty"`
+	Author  *atomAuthor  `xml:"author,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+// feedPosts returns the posts a feed lists, newest first: those of the
+// request's language and section, and on tag feeds only those with the
+// tag. ok is false for tags no post has.
+func feedPosts(ctx *gin.Context, store PostStore) (posts []PostData, ok bool) {
+	posts = visiblePosts(ctx, store)
+	if tag := ctx.Param("tag"); tag != "" {
+		posts = postsWithTag(posts, tag)
+		if len(posts) == 0 {
+			return nil, false
+		}
+		cacheKeys(ctx, "tag:"+strings.ToLower(tag))
+	}
+	if name := ctx.Param("name"); name != "" {
+		posts = postsByAuthor(posts, name)
+		if len(posts) == 0 {
+			return nil, false
+		}
+	}
+	sortPostsByDate(posts)
+
+	return posts, true
+}
+
+// feedTitle is the title of the request's feed, naming its tag or author
+// if any. posts are the feed's.
+func feedTitle(ctx *gin.Context, site SiteData, posts []PostData) string {
+	if tag := ctx.Param("tag"); tag != "" {
+		return site.Title + " #" + tag
+	}
+	if ctx.Param("name") != "" && len(posts) > 0 {
+		return site.Title + ": " + posts[0].Author.Name
+	}
+
+	return site.Title
+}
+
+// feedHome is the path of the page listing the request's feed's posts.
+func feedHome(ctx *gin.Context) string {
+	if tag := ctx.Param("tag"); tag != "" {
+		return tagURL(tag)
+	}
+	if name := ctx.Param("name"); name != "" {
+		return Author{Key: name}.URL()
+	}
+
+	return requestPrefix(ctx) + "/"
+}
+
+// feedNotFound answers a request for the feed of a tag or author without
+// posts.
+func feedNotFound(ctx *gin.Context) {
+	if name := ctx.Param("name"); name != "" {
+		notFound(ctx, "Author not found")
+		return
+	}
+
+	notFound(ctx, "No posts are tagged #"+ctx.Param("tag"))
+}
+
+// RSSHandler serves the posts as an RSS 2.0 feed.
+func RSSHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		site := siteData(ctx)
+		posts, ok := feedPosts(ctx, store)
+		if !ok {
+			feedNotFound(ctx)
+			return
+		}
+		if !renderPosts(ctx, posts...) {
+			return
+		}
+		setLastModified(ctx, posts...)
+
+		channel := rssChannel{
+			Title:       feedTitle(ctx, site, posts),
+			Link:        absoluteURL(ctx, feedHome(ctx)),
+			Description: site.Description,
+			Language:    site.Lang,
+			AtomLinks: append([]atomLink{{
+				Href: absoluteURL(ctx, ctx.Request.URL.Path),
+				Rel:  "self",
+				Type: "application/rss+xml",
+			}}, hubLinks(requestConfig(ctx))...),
+		}
+		if len(posts) > 0 && !posts[0].Date.IsZero() {
+			channel.LastBuildDate = posts[0].Date.Format(time.RFC1123Z)
+		}
+
+		podcast, full := false, false
+		for _, post := range posts {
+			link := absoluteURL(ctx, post.URL)
+			item := rssItem{
+				Title:       post.Title,
+				Link:        feedLink(ctx, post),
+				GUID:        link,
+				Description: absoluteHTML(string(post.Excerpt()), link),
+			}
+			if !post.Date.IsZero() {
+				item.PubDate = post.Date.Format(time.RFC1123Z)
+			}
+			if post.Author.Email != "" {
+				item.Author = post.Author.Email + " (" + post.Author.Name + ")"
+			}
+			if post.fullInFeeds(requestConfig(ctx).FeedFullContent) {
+				item.Content = &cdata{Value: absoluteHTML(string(post.Content()), link)}
+				full = true
+			}
+			if post.Audio.File != "" {
+				setEpisode(ctx, &item, post.Audio)
+				podcast = true
+			}
+
+			channel.Items = append(channel.Items, item)
+		}
+
+		feed := rssFeed{
+			Version: "2.0",
+			AtomNS:  "http://www.w3.org/2005/Atom",
+			Channel: channel,
+		}
+		if full {
+			feed.ContentNS = "http://purl.org/rss/1.0/modules/content/"
+		}
+		if podcast {
+			feed.ItunesNS = itunesNS
+			setPodcast(ctx, &feed.Channel, site.Podcast)
+		}
+
+		writeXML(ctx, "application/rss+xml; charset=utf-8", feed)
+	}
+}
+
+// AtomHandler serves the posts as an Atom feed.
+func AtomHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		site := siteData(ctx)
+		posts, ok := feedPosts(ctx, store)
+		if !ok {
+			feedNotFound(ctx)
+			return
+		}
+		if !renderPosts(ctx, posts...) {
+			return
+		}
+		setLastModified(ctx, posts...)
+
+		feed := atomFeed{
+			Title: feedTitle(ctx, site, posts),
+			ID:    absoluteURL(ctx, feedHome(ctx)),
+			Links: append([]atomLink{
+				{Href: absoluteURL(ctx, feedHome(ctx))},
+				{Href: absoluteURL(ctx, ctx.Request.URL.Path), Rel: "self", Type: "application/atom+xml"},
+			}, hubLinks(requestConfig(ctx))...),
+		}
+		var updated time.Time
+		for _, post := range posts {
+			if post.DateModified.After(updated) {
+				updated = post.DateModified
+			}
+		}
+		if !updated.IsZero() {
+			feed.Updated = updated.Format(time.RFC3339)
+		}
+
+		for _, post := range posts {
+			link := absoluteURL(ctx, post.URL)
+			entry := atomEntry{
+				Title:   post.Title,
+				ID:      link,
+				Updated: post.DateModified.Format(time.RFC3339),
+				Links:   []atomLink{{Href: feedLink(ctx, post)}},
+				Summary: &atomContent{Type: "html", Value: absoluteHTML(string(post.Excerpt()), link)},
+			}
+			if post.Author.Name != "" {
+				entry.Author = &atomAuthor{Name: post.Author.Name, Email: post.Author.Email}
+			}
+			if post.fullInFeeds(requestConfig(ctx).FeedFullContent) {
+				entry.Content = &atomContent{Type: "html", Value: absoluteHTML(string(post.Content()), link)}
+			}
+			if post.Audio.File != "" {
+				entry.Links = append(entry.Links, atomLink{
+					Href:   episodeURL(ctx, post.Audio),
+					Rel:    "enclosure",
+					Type:   post.Audio.MIMEType(),
+					Length: post.Audio.size(requestConfig(ctx)),
+				})
+			}
+
+			feed.Entries = append(feed.Entries, entry)
+		}
+
+		writeXML(ctx, "application/atom+xml; charset=utf-8", feed)
+	}
+}
+
+// jsonFeed is a JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/.
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url,omitempty"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []jsonAttachment `json:"attachments,omitempty"`
+}
+
+type jsonAttachment struct {
+	URL               string `json:"url"`
+	MIMEType          string `json:"mime_type"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// JSONFeedHandler serves the posts as a JSON Feed. Items always carry
+// their content, which JSON Feed requires, with the excerpt as summary
+// text.
+func JSONFeedHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		site := siteData(ctx)
+		posts, ok := feedPosts(ctx, store)
+		if !ok {
+			feedNotFound(ctx)
+			return
+		}
+		if !renderPosts(ctx, posts...) {
+			return
+		}
+		setLastModified(ctx, posts...)
+
+		feed := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       feedTitle(ctx, site, posts),
+			HomePageURL: absoluteURL(ctx, feedHome(ctx)),
+			FeedURL:     absoluteURL(ctx, ctx.Request.URL.Path),
+			Description: site.Description,
+			Language:    site.Lang,
+			Items:       []jsonFeedItem{},
+		}
+
+		for _, post := range posts {
+			link := absoluteURL(ctx, post.URL)
+			item := jsonFeedItem{
+				ID:          link,
+				URL:         link,
+				ExternalURL: post.CanonicalURL,
+				Title:       post.Title,
+				ContentHTML: absoluteHTML(string(post.Content()), link),
+				Summary:     stripHTML(string(post.Excerpt())),
+				Tags:        post.Tags,
+			}
+			if !post.Date.IsZero() {
+				item.DatePublished = post.Date.Format(time.RFC3339)
+			}
+			if !post.DateModified.IsZero() {
+				item.DateModified = post.DateModified.UTC().Format(time.RFC3339)
+			}
+			if post.Author.Name != "" {
+				author := jsonFeedAuthor{Name: post.Author.Name}
+				if url := post.Author.URL(); url != "" {
+					author.URL = absoluteURL(ctx, url)
+				}
+				item.Authors = []jsonFeedAuthor{author}
+			}
+			if post.Audio.File != "" {
+				seconds, _ := post.Audio.seconds()
+				item.Attachments = []jsonAttachment{{
+					URL:               episodeURL(ctx, post.Audio),
+					MIMEType:          post.Audio.MIMEType(),
+					SizeInBytes:       post.Audio.size(requestConfig(ctx)),
+					DurationInSeconds: seconds,
+				}}
+			}
+
+			feed.Items = append(feed.Items, item)
+		}
+
+		ctx.Header("Content-Type", "application/feed+json; charset=utf-8")
+		ctx.JSON(http.StatusOK, feed)
+	}
+}
+
+func writeXML(ctx *gin.Context, contentType string, v any) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Error generating feed")
+		return
+	}
+
+	ctx.Data(http.StatusOK, contentType, append([]byte(xml.Header), b...))
+}
+
+// fullInFeeds reports whether feeds carry the post's whole content rather
+// than only its excerpt: as its FeedContent says, or else as
+// byDefault, feed_full_content, does.
+func (post PostData) fullInFeeds(byDefault bool) bool {
+	switch strings.ToLower(post.FeedContent) {
+	case "full":
+		return true
+	case "summary":
+		return false
+	default:
+		return byDefault
+	}
+}
+
+// urlAttr matches the attributes of rendered HTML holding URLs.
+var urlAttr = regexp.MustCompile(`\s(href|src|poster|srcset)="([^"]*)"`)
+
+// absoluteHTML resolves the URLs in the links, images and media of content
+// against base, the absolute URL of the post it's from. Feed readers show
+// content away from the blog, where site paths such as /static/a.png
+// lead nowhere.
+func absoluteHTML(content, base string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return content
+	}
+
+	resolve := func(ref string) string {
+		u, err := url.Parse(ref)
+		if err != nil || ref == "" {
+			return ref
+		}
+		return baseURL.ResolveReference(u).String()
+	}
+
+	return urlAttr.ReplaceAllStringFunc(content, func(attr string) string {
+		m := urlAttr.FindStringSubmatch(attr)
+		name, value := m[1], html.UnescapeString(m[2])
+
+		if name == "srcset" {
+			// Candidates are a URL and a width or density each.
+			candidates := strings.Split(value, ",")
+			for i, candidate := range candidates {
+				fields := strings.Fields(candidate)
+				if len(fields) > 0 {
+					fields[0] = resolve(fields[0])
+				}
+				candidates[i] = strings.Join(fields, " ")
+			}
+			value = strings.Join(candidates, ", ")
+		} else {
+			value = resolve(value)
+		}
+
+		return " " + name + `="` + html.EscapeString(value) + `"`
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlErrorLine is the line number yaml.v2 starts its messages with.
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): `)
+
+// frontmatterError is frontmatter that doesn't parse, with the line of the
+// post file the problem is on.
+type frontmatterError struct {
+	// Line is counted from the top of the file, 0 if unknown.
+	Line    int
+	Message string
+}
+
+func (e *frontmatterError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid frontmatter on line %d: %s", e.Line, e.Message)
+	}
+
+	return "invalid frontmatter: " + e.Message
+}
+
+// fileProblem reports err loading file as a Problem, on the line of the
+// file it's about when known.
+func fileProblem(file string, err error) Problem {
+	var fe *frontmatterError
+	if errors.As(err, &fe) && fe.Line > 0 {
+		return Problem{File: file, Line: fe.Line, Message: "invalid frontmatter: " + fe.Message}
+	}
+
+	return Problem{File: file, Message: err.Error()}
+}
+
+// splitFrontmatter splits a post file into its YAML frontmatter, without
+// the "---" lines around it, and markdown body, see cutFrontmatter.
+func splitFrontmatter(content []byte) (front, body []byte, err error) {
+	return cutFrontmatter(content, "---")
+}
+
+// cutFrontmatter splits content into the frontmatter between a first line
+// of delim and the next one, and the body after it. front is nil when
+// content doesn't start with delim, and it's an error for the closing
+// delim to be missing, rather than taking the whole file as the body.
+// Windows line endings, trailing spaces after the delimiters and a byte
+// order mark are accepted; both parts come out with \n line endings.
+func cutFrontmatter(content []byte, delim string) (front, body []byte, err error) {
+	content = normalizeContent(content)
+
+	isDelim := func(line []byte) bool {
+		return string(bytes.TrimRight(line, " \t")) == delim
+	}
+
+	first, rest, _ := bytes.Cut(content, []byte("\n"))
+	if !isDelim(first) {
+		return nil, content, nil
+	}
+
+	for offset := 0; ; {
+		line, _, more := bytes.Cut(rest[offset:], []byte("\n"))
+		if isDelim(line) {
+			body = rest[min(offset+len(line)+1, len(rest)):]
+			return rest[:offset:offset], body, nil
+		}
+		if !more {
+			return nil, content, &frontmatterError{Line: 1, Message: "no closing " + delim}
+		}
+		offset += len(line) + 1
+	}
+}
+
+// normalizeContent drops the byte order mark some editors start files with
+// and turns Windows line endings into \n, keeping the lines where they are.
+func normalizeContent(content []byte) []byte {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// decodeFrontmatter unmarshals the YAML frontmatter of a post file into v,
+// reporting errors as a *frontmatterError with the line in the file.
+func decodeFrontmatter(front []byte, v any) error {
+	err := yaml.Unmarshal(front, v)
+	if err == nil {
+		return nil
+	}
+
+	// yaml.v2 puts each of several errors on a line of its own, numbered
+	// from the start of the frontmatter, the line after the opening ---.
+	fe := &frontmatterError{}
+	var messages []string
+	for _, msg := range strings.Split(strings.TrimPrefix(err.Error(), "yaml: "), "\n") {
+		msg = strings.TrimSpace(msg)
+		if msg == "" || msg == "unmarshal errors:" {
+			continue
+		}
+
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			msg = strings.TrimPrefix(msg, m[0])
+			if fe.Line == 0 {
+				fe.Line = n + 1
+			} else if n+1 != fe.Line {
+				msg = fmt.Sprintf("line %d: %s", n+1, msg)
+			}
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		return errors.New("invalid frontmatter: " + err.Error())
+	}
+	fe.Message = strings.Join(messages, "; ")
+
+	return fe
+}
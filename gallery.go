@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// gallerySizes is the width gallery images are shown at, for picking the
+// variant that serves as their thumbnail. It matches the grid of the
+// default theme.
+const gallerySizes = "(max-width: 40rem) 50vw, 20rem"
+
+// imageGalleries renders ```gallery code blocks as a grid of figures, one
+// per line of the block: the image's path followed by its caption, as in
+//
+//	```gallery
+//	/static/trip/beach.jpg The beach at dawn
+//	/static/trip/pier.jpg
+//	```
+//
+// Images under /static/ are shown as thumbnails made from their variants.
+// Each links to the full image, marked for lightboxes, see figureHTML.
+type imageGalleries struct {
+	cfg *Config
+}
+
+func (e imageGalleries) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(galleryTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(galleryRenderer{e.cfg}, 500),
+	))
+}
+
+var kindGallery = ast.NewNodeKind("Gallery")
+
+type galleryBlock struct {
+	ast.BaseBlock
+	// group tells the galleries of a post apart for lightboxes.
+	group string
+}
+
+func (n *galleryBlock) Kind() ast.NodeKind { return kindGallery }
+
+func (n *galleryBlock) IsRaw() bool { return true }
+
+func (n *galleryBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Group": n.group}, nil)
+}
+
+// galleryImages returns the images of the gallery as their paths and
+// captions.
+func (n *galleryBlock) galleryImages(source []byte) (srcs, captions []string) {
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		src, caption, _ := strings.Cut(strings.TrimSpace(string(line.Value(source))), " ")
+		if src == "" {
+			continue
+		}
+
+		srcs = append(srcs, src)
+		captions = append(captions, strings.TrimSpace(caption))
+	}
+
+	return srcs, captions
+}
+
+// galleryTransformer swaps gallery code blocks for galleryBlocks before
+// highlighting gets to them.
+type galleryTransformer struct{}
+
+func (galleryTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var blocks []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering {
+			if bytes.Equal(block.Language(source), []byte("gallery")) {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for i, block := range blocks {
+		gallery := &galleryBlock{group: "gallery-" + strconv.Itoa(i+1)}
+		gallery.SetLines(block.Lines())
+		block.Parent().ReplaceChild(block.Parent(), block, gallery)
+	}
+}
+
+type galleryRenderer struct {
+	cfg *Config
+}
+
+func (r galleryRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGallery, r.renderGallery)
+}
+
+func (r galleryRenderer) renderGallery(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*galleryBlock)
+	srcs, captions := n.galleryImages(source)
+
+	_, _ = w.WriteString(`<div class="gallery">`)
+	for i, src := range srcs {
+		_, _ = w.WriteString(figureHTML(r.cfg, src, captions[i], "", n.group, gallerySizes))
+	}
+	_, _ = w.WriteString("</div>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// figureHTML returns a <figure> of the image at src with its caption,
+// described by alt or else by the caption. The image links to itself at
+// full size, with the attributes lightbox scripts look for: data-lightbox
+// names the group of images browsed together and data-title is the
+// caption. Images under /static/ are shown at sizes from their variants,
+// see pictureHTML.
+func figureHTML(cfg *Config, src, caption, alt, group, sizes string) string {
+	escape := func(s string) string {
+		return string(util.EscapeHTML([]byte(s)))
+	}
+
+	href := ""
+	if !html.IsDangerousURL([]byte(src)) {
+		href = escape(string(util.URLEscape([]byte(src), true)))
+	}
+	attrs := ` alt="` + escape(firstNonEmpty(alt, caption)) + `"`
+
+	var b strings.Builder
+	b.WriteString(`<figure class="gallery-item"><a href="` + href + `" data-lightbox="` + escape(group) + `"`)
+	if caption != "" {
+		b.WriteString(` data-title="` + escape(caption) + `"`)
+	}
+	b.WriteString(">")
+
+	name, ok := strings.CutPrefix(src, "/static/")
+	picture := ""
+	if ok && resizable(name) {
+		picture, _ = pictureHTML(cfg, name, sizes, attrs)
+	}
+	if picture == "" {
+		picture = `<img src="` + href + `"` + attrs + ` loading="lazy" decoding="async">`
+	}
+	b.WriteString(picture)
+
+	b.WriteString("</a>")
+	if caption != "" {
+		b.WriteString("<figcaption>" + escape(caption) + "</figcaption>")
+	}
+	b.WriteString("</figure>")
+
+	return b.String()
+}
+
+// shortcodeFigure is the figure function of shortcode templates, which
+// the built-in figure shortcode is made with. Figures are lightbox groups
+// of their own.
+func shortcodeFigure(cfg *Config) func(src, caption, alt string) template.HTML {
+	return func(src, caption, alt string) template.HTML {
+		return template.HTML(figureHTML(cfg, src, caption, alt, "figure-"+src, ""))
+	}
+}
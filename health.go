@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler answers liveness probes. It only shows the process is
+// serving requests.
+func HealthHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// ReadyHandler answers readiness probes: the blog is ready once the posts
+// have loaded and while their content can be read, so reloads keep
+// working.
+func ReadyHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+
+		if store.LoadedAt().IsZero() {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "posts not loaded"})
+			return
+		}
+
+		if !store.Readable() {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "content unreadable"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok", "posts": len(store.Posts())})
+	}
+}
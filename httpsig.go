@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ActivityPub servers authenticate requests to each other with HTTP
+// signatures (draft-cavage-http-signatures) made with the sending actor's
+// RSA key, as Mastodon does.
+
+// maxSignatureAge is how far a signed request's Date may be from now.
+const maxSignatureAge = time.Hour
+
+// loadOrCreateKey reads the PEM encoded RSA private key at path, creating
+// one if the file doesn't exist yet.
+func loadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA key", path)
+	}
+
+	return key, nil
+}
+
+func createKey(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// publicKeyPEM encodes the public half of key as PEM, the way actor
+// documents publish it.
+func publicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func parsePublicKeyPEM(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM data in public key")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+
+	return key, nil
+}
+
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signRequest signs req, whose body is body, with key. POSTs also get a
+// Digest header covered by the signature.
+func signRequest(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := []string{"(request-target)", "host", "date"}
+	if req.Method == http.MethodPost {
+		req.Header.Set("Digest", bodyDigest(body))
+		headers = append(headers, "digest")
+	}
+
+	sum := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+
+	return nil
+}
+
+// signingString is the text signed for the given headers of req.
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines[i] = h + ": " + strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			lines[i] = h + ": " + req.Host
+		default:
+			lines[i] = h + ": " + strings.Join(req.Header.Values(h), ", ")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// httpSignature is a parsed Signature header.
+type httpSignature struct {
+	KeyID     string
+	Headers   []string
+	Signature []byte
+}
+
+var signatureParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var errNotSigned = errors.New("request is not signed")
+
+func parseSignature(header string) (httpSignature, error) {
+	if header == "" {
+		return httpSignature{}, errNotSigned
+	}
+
+	var sig httpSignature
+	var err error
+	for _, m := range signatureParam.FindAllStringSubmatch(header, -1) {
+		switch m[1] {
+		case "keyId":
+			sig.KeyID = m[2]
+		case "headers":
+			sig.Headers = strings.Fields(strings.ToLower(m[2]))
+		case "signature":
+			sig.Signature, err = base64.StdEncoding.DecodeString(m[2])
+			if err != nil {
+				return sig, fmt.Errorf("signature: %w", err)
+			}
+		case "algorithm":
+			// rsa-sha256, or hs2019 leaving it to the key, which has to be
+			// RSA here.
+			if m[2] != "rsa-sha256" && m[2] != "hs2019" {
+				return sig, fmt.Errorf("unsupported signature algorithm %q", m[2])
+			}
+		}
+	}
+
+	if sig.KeyID == "" || len(sig.Signature) == 0 {
+		return sig, errors.New("signature lacks keyId or signature")
+	}
+	if len(sig.Headers) == 0 {
+		sig.Headers = []string{"date"}
+	}
+
+	return sig, nil
+}
+
+// verifyRequest checks the signature of req, whose body is body, against
+// key. The signature has to cover the request target, host and date, and
+// the digest for requests with a body, and the date has to be recent.
+func verifyRequest(req *http.Request, body []byte, sig httpSignature, key *rsa.PublicKey) error {
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, h := range required {
+		if !slices.Contains(sig.Headers, h) {
+			return fmt.Errorf("signature doesn't cover %s", h)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("date: %w", err)
+	}
+	if age := time.Since(date).Abs(); age > maxSignatureAge {
+		return errors.New("signature date is too far from now")
+	}
+
+	if len(body) > 0 && req.Header.Get("Digest") != bodyDigest(body) {
+		return errors.New("digest doesn't match body")
+	}
+
+	sum := sha256.Sum256([]byte(signingString(req, sig.Headers)))
+
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig.Signature)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Alternate is a version of the current page in another language, linked
+// from the head with hreflang.
+type Alternate struct {
+	Lang string
+	URL  string
+}
+
+// multilingual reports whether posts are split by language, see
+// Config.Languages.
+func (cfg *Config) multilingual() bool {
+	return len(cfg.Languages) > 0
+}
+
+// postLang works out the language of the post at path: the Lang
+// frontmatter, else the language directory it is in, such as markdown/id/,
+// else the default language. It is empty while the site isn't
+// multilingual.
+func postLang(cfg *Config, dir, path, lang string) string {
+	if !cfg.multilingual() {
+		return ""
+	}
+	if lang != "" {
+		return lang
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err == nil {
+		first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if slices.Contains(cfg.Languages, first) {
+			return first
+		}
+	}
+
+	return cfg.DefaultLanguage
+}
+
+// langPrefix is the path prefix of lang's pages, such as "/id", or empty
+// while the site isn't multilingual.
+func langPrefix(lang string) string {
+	if lang == "" {
+		return ""
+	}
+
+	return "/" + lang
+}
+
+// linkTranslations sets the Translations of posts sharing a slug in
+// different languages, which are taken to be translations of each other.
+func linkTranslations(posts []PostData) {
+	bySlug := map[string][]Alternate{}
+	for _, post := range posts {
+		if post.Lang != "" {
+			bySlug[post.Slug] = append(bySlug[post.Slug], Alternate{Lang: post.Lang, URL: post.URL})
+		}
+	}
+
+	for i, post := range posts {
+		if alternates := bySlug[post.Slug]; len(alternates) > 1 {
+			posts[i].Translations = alternates
+		}
+	}
+}
+
+// LanguageMiddleware marks the requests of a language's route group with
+// that language.
+func LanguageMiddleware(lang string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Lang", lang)
+		ctx.Next()
+	}
+}
+
+// requestLang returns the language of the current request: the one of its
+// route group, else the default language. Outside the language groups,
+// listings show the default language's posts.
+func requestLang(ctx *gin.Context) string {
+	if lang := ctx.GetString("Lang"); lang != "" {
+		return lang
+	}
+
+	return requestConfig(ctx).DefaultLanguage
+}
+
+// requestPrefix is the path prefix of the current request's language and
+// section groups, empty outside of them.
+func requestPrefix(ctx *gin.Context) string {
+	return langPrefix(ctx.GetString("Lang")) + sectionPrefix(requestSection(ctx))
+}
+
+// setAlternates records the other language versions of the page being
+// rendered, see SiteData.Alternates.
+func setAlternates(ctx *gin.Context, alternates []Alternate) {
+	ctx.Set("Alternates", alternates)
+}
+
+// languageIndexes links the index page of every language.
+func languageIndexes(languages []string) []Alternate {
+	var alternates []Alternate
+	for _, lang := range languages {
+		alternates = append(alternates, Alternate{Lang: lang, URL: langPrefix(lang) + "/"})
+	}
+
+	return alternates
+}
+
+// languageRoutes serves the index, posts and feeds of every language under
+// its prefix, such as /id/posts/:slug.
+func languageRoutes(route *gin.Engine, cfg *Config, store PostStore, comments CommentStore, views *ViewCounter, likes *Likes, referrers *Referrers, mentions *Webmentions) {
+	for _, lang := range cfg.Languages {
+		group := route.Group(langPrefix(lang), LanguageMiddleware(lang))
+		group.GET("/", IndexHandler(store, views))
+		group.GET("/page/:page", IndexHandler(store, views))
+		group.GET("/posts/:slug", PostHandler(store, comments, views, likes, referrers, mentions))
+		if comments != nil {
+			group.POST("/posts/:slug/comments", CommentHandler(store, comments))
+		}
+		if likes != nil {
+			group.POST("/posts/:slug/like", LikeHandler(store, likes))
+		}
+		if cfg.DatePrefixedURLs {
+			group.GET("/:year/:month/:slug", PostHandler(store, comments, views, likes, referrers, mentions))
+		}
+		group.GET("/series/:name", SeriesHandler(store))
+		feedRoutes(group, cfg, "", store)
+		if cfg.Images.OG {
+			group.GET("/og/:file", OGImageHandler(store))
+		}
+		sectionRoutes(group, cfg, store, comments, views, likes, referrers, mentions)
+	}
+}
+
+// Translations holds the UI strings of each language, keyed by their
+// English text.
+type Translations map[string]map[string]string
+
+// loadTranslations reads <lang>.yaml under dir for each of languages.
+// The files are optional; untranslated strings are shown in English.
+func loadTranslations(dir string, languages []string) (Translations, error) {
+	translations := Translations{}
+	for _, lang := range languages {
+		b, err := os.ReadFile(filepath.Join(dir, lang+".yaml"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		err = yaml.UnmarshalStrict(b, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, lang+".yaml"), err)
+		}
+		translations[lang] = messages
+	}
+
+	return translations, nil
+}
+
+// T translates the UI string key to lang, for templates:
+//
+//	{{ t .Site.Lang "Comments" }}
+func (translations Translations) T(lang, key string) string {
+	if s, ok := translations[lang][key]; ok {
+		return s
+	}
+
+	return key
+}
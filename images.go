@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/image/draw"
+)
+
+// Images under the static directories that posts reference are served in
+// the configured widths through /images/<width>/<name>, and as WebP
+// through /images/<width>/<name>.webp. Variants are generated on first
+// request and kept in the image cache directory.
+
+// resizable reports whether name, relative to the static directory, is an
+// image we can make variants of.
+func resizable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+
+	return false
+}
+
+// variantWidths returns the widths of cfg narrower than an image of the
+// given width; images are never scaled up.
+func variantWidths(cfg ImagesConfig, width int) []int {
+	var widths []int
+	for _, w := range cfg.Widths {
+		if w < width {
+			widths = append(widths, w)
+		}
+	}
+	slices.Sort(widths)
+
+	return widths
+}
+
+func imageVariantURL(width int, name string, webp bool) string {
+	u := "/images/" + strconv.Itoa(width) + "/" + name
+	if webp {
+		u += ".webp"
+	}
+
+	return u
+}
+
+// responsiveImages renders local images as a <picture> with srcsets of
+// their variants, and with width and height so the page doesn't jump
+// around while images load.
+type responsiveImages struct {
+	cfg *Config
+}
+
+func (e responsiveImages) Extend(m goldmark.Markdown) {
+	// The default HTML renderer has priority 1000.
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(responsiveImageRenderer{e.cfg}, 500),
+	))
+}
+
+type responsiveImageRenderer struct {
+	cfg *Config
+}
+
+func (r responsiveImageRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindImage, r.renderImage)
+}
+
+func (r responsiveImageRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.Image)
+	src := string(n.Destination)
+
+	var attrs strings.Builder
+	attrs.WriteString(` alt="`)
+	attrs.Write(util.EscapeHTML([]byte(plainText(n, source))))
+	attrs.WriteString(`"`)
+	if n.Title != nil {
+		attrs.WriteString(` title="`)
+		attrs.Write(util.EscapeHTML(n.Title))
+		attrs.WriteString(`"`)
+	}
+
+	name, ok := strings.CutPrefix(src, "/static/")
+	if !ok || !resizable(name) {
+		_, _ = w.WriteString(`<img src="`)
+		if !html.IsDangerousURL(n.Destination) {
+			_, _ = w.Write(util.EscapeHTML(util.URLEscape(n.Destination, true)))
+		}
+		_, _ = w.WriteString(`"` + attrs.String() + `>`)
+		return ast.WalkSkipChildren, nil
+	}
+
+	picture, ok := pictureHTML(r.cfg, name, "", attrs.String())
+	if !ok {
+		_, _ = w.WriteString(`<img src="` + string(util.EscapeHTML([]byte(src))) + `"` + attrs.String() + `>`)
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = w.WriteString(picture)
+
+	return ast.WalkSkipChildren, nil
+}
+
+// pictureHTML returns a <picture> of the static image name with srcsets
+// of its variants, and attrs added to its <img>. sizes is the width the
+// image is shown at, as in the sizes attribute; it's the page's up to the
+// image's own width if empty. ok is false when the image can't be read.
+func pictureHTML(cfg *Config, name, sizes, attrs string) (picture string, ok bool) {
+	width, height, err := imageSize(cfg, name)
+	if err != nil {
+		return "", false
+	}
+
+	src := "/static/" + name
+	widths := variantWidths(cfg.Images, width)
+	srcset := func(webp bool) string {
+		var set []string
+		for _, vw := range widths {
+			set = append(set, fmt.Sprintf("%s %dw", imageVariantURL(vw, name, webp), vw))
+		}
+		if !webp {
+			set = append(set, fmt.Sprintf("%s %dw", src, width))
+		}
+
+		return string(util.EscapeHTML([]byte(strings.Join(set, ", "))))
+	}
+	if sizes == "" {
+		sizes = fmt.Sprintf("(max-width: %[1]dpx) 100vw, %[1]dpx", width)
+	}
+
+	var b strings.Builder
+	b.WriteString("<picture>")
+	if cfg.Images.WebP && len(widths) > 0 {
+		b.WriteString(`<source type="image/webp" srcset="` + srcset(true) + `">`)
+	}
+	fmt.Fprintf(&b, `<img src="%s" srcset="%s" sizes="%s" width="%d" height="%d"%s loading="lazy" decoding="async">`,
+		util.EscapeHTML([]byte(src)), srcset(false), sizes, width, height, attrs)
+	b.WriteString("</picture>")
+
+	return b.String(), true
+}
+
+// imageSize returns the dimensions of a static image.
+func imageSize(cfg *Config, name string) (width, height int, err error) {
+	f, err := staticFS(cfg).Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	img, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return img.Width, img.Height, nil
+}
+
+// imageMu serializes variant generation, which is memory hungry and would
+// otherwise run once per concurrent request for the same new variant.
+var imageMu sync.Mutex
+
+// ImageHandler serves image variants, generating them into the cache
+// directory on first request or when the original has changed since.
+func ImageHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		width, err := strconv.Atoi(ctx.Param("width"))
+		if err != nil || !slices.Contains(cfg.Images.Widths, width) {
+			notFound(ctx, "Image not found")
+			return
+		}
+
+		name := strings.TrimPrefix(ctx.Param("name"), "/")
+		original, webp := strings.CutSuffix(name, ".webp")
+		if webp && !cfg.Images.WebP || !resizable(original) {
+			notFound(ctx, "Image not found")
+			return
+		}
+
+		if !fs.ValidPath(original) {
+			notFound(ctx, "Image not found")
+			return
+		}
+		cached, err := safeJoin(filepath.Join(cfg.Images.CacheDir, strconv.Itoa(width)), filepath.FromSlash(name))
+		if err != nil {
+			notFound(ctx, "Image not found")
+			return
+		}
+
+		err = ensureVariant(staticFS(cfg), original, cached, width, webp)
+		if errors.Is(err, fs.ErrNotExist) {
+			notFound(ctx, "Image not found")
+			return
+		}
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't process image")
+			return
+		}
+
+		ctx.Header("Cache-Control", "public, max-age=86400")
+		http.ServeFile(ctx.Writer, ctx.Request, cached)
+	}
+}
+
+// ensureVariant writes the image src of fsys scaled to width into dest
+// unless dest is already newer than src.
+func ensureVariant(fsys fs.FS, src, dest string, width int, webp bool) error {
+	srcInfo, err := fs.Stat(fsys, src)
+	if err != nil {
+		return err
+	}
+
+	imageMu.Lock()
+	defer imageMu.Unlock()
+
+	if info, err := os.Stat(dest); err == nil && !info.ModTime().Before(srcInfo.ModTime()) {
+		return nil
+	}
+
+	f, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", src, err)
+	}
+
+	img = scaleImage(img, width)
+
+	var buf bytes.Buffer
+	switch {
+	case webp:
+		err = nativewebp.Encode(&buf, img, nil)
+	case strings.EqualFold(path.Ext(src), ".png"):
+		err = png.Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", dest, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(dest, buf.Bytes())
+}
+
+// scaleImage scales img down to width, keeping its aspect ratio.
+func scaleImage(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
+
+// imageVariantPaths lists every variant of the static images, for static
+// builds.
+func imageVariantPaths(cfg *Config) ([]string, error) {
+	var paths []string
+	err := fs.WalkDir(staticFS(cfg), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !resizable(name) {
+			return err
+		}
+
+		width, _, err := imageSize(cfg, name)
+		if err != nil {
+			return nil
+		}
+
+		for _, w := range variantWidths(cfg.Images, width) {
+			paths = append(paths, imageVariantURL(w, name, false))
+			if cfg.Images.WebP {
+				paths = append(paths, imageVariantURL(w, name, true))
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return paths, nil
+}
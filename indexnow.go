@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// indexNowKey is what IndexNow accepts as a key.
+var indexNowKey = regexp.MustCompile(`^[a-zA-Z0-9-]{8,128}$`)
+
+// IndexNow tells search engines about new, changed and removed posts as
+// soon as they're seen, through the IndexNow protocol and the sitemap ping
+// endpoints configured. Posts are compared with the previous reload of
+// their store, so what changed while the blog wasn't running goes
+// unnoticed; search engines still find it through the sitemap. A nil
+// *IndexNow notifies no one.
+type IndexNow struct {
+	cfg    *Config
+	client *http.Client
+}
+
+// newIndexNow returns the notifier, or nil when cfg disables IndexNow.
+func newIndexNow(cfg *Config) *IndexNow {
+	if !cfg.IndexNow.Enabled {
+		return nil
+	}
+
+	// Only the configured endpoints are requested.
+	return &IndexNow{cfg: cfg, client: outboundClient(true)}
+}
+
+// Watch notifies search engines of the changes every reload of store
+// makes to its published posts.
+func (n *IndexNow) Watch(store PostStore) {
+	if n == nil || store == nil {
+		return
+	}
+
+	// The URLs of the published posts as of the previous reload, and
+	// the hashes of their content.
+	var seen map[string]string
+	store.OnReload(func(posts []PostData) {
+		now := time.Now()
+		current := make(map[string]string, len(posts))
+		var changed []string
+		for _, post := range posts {
+			if !post.Listed(now) {
+				continue
+			}
+
+			u := n.cfg.BaseURL + post.URL
+			current[u] = post.Hash
+			if hash, ok := seen[u]; !ok || hash != post.Hash {
+				changed = append(changed, u)
+			}
+		}
+		for u := range seen {
+			if _, ok := current[u]; !ok {
+				changed = append(changed, u)
+			}
+		}
+
+		// The first call, at start, only takes stock.
+		first := seen == nil
+		seen = current
+		if first || len(changed) == 0 {
+			return
+		}
+
+		slices.Sort(changed)
+		go n.notify(changed)
+	})
+}
+
+func (n *IndexNow) notify(urls []string) {
+	err := n.submit(urls)
+	if err != nil {
+		slog.Warn("submitting to IndexNow", "urls", len(urls), "error", err)
+	} else {
+		slog.Info("submitted to IndexNow", "urls", len(urls))
+	}
+
+	sitemap := url.QueryEscape(n.cfg.BaseURL + "/sitemap.xml")
+	for _, ping := range n.cfg.IndexNow.Ping {
+		err = n.send(http.MethodGet, strings.ReplaceAll(ping, "{sitemap}", sitemap), nil)
+		if err != nil {
+			slog.Warn("pinging sitemap", "url", ping, "error", err)
+		}
+	}
+}
+
+// submit posts urls to the IndexNow endpoint, which shares them with the
+// other search engines taking part.
+func (n *IndexNow) submit(urls []string) error {
+	base, err := url.Parse(n.cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"host":        base.Host,
+		"key":         n.cfg.IndexNow.Key,
+		"keyLocation": n.cfg.BaseURL + indexNowKeyPath(n.cfg.IndexNow.Key),
+		"urlList":     urls,
+	})
+	if err != nil {
+		return err
+	}
+
+	return n.send(http.MethodPost, n.cfg.IndexNow.Endpoint, body)
+}
+
+func (n *IndexNow) send(method, target string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: status %d", target, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// indexNowKeyPath is where the key file proving the blog's ownership of
+// key is served.
+func indexNowKeyPath(key string) string {
+	return "/" + key + ".txt"
+}
+
+// IndexNowKeyHandler serves the key file.
+func IndexNowKeyHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, requestConfig(ctx).IndexNow.Key)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "time"
+
+// StructuredData is the schema.org BlogPosting of the post, rendered as
+// JSON-LD in the page's head so search engines can show it as an article:
+// https://developers.google.com/search/docs/appearance/structured-data/article.
+// Standalone pages aren't articles and have none.
+func (page PostPage) StructuredData() map[string]any {
+	if page.Standalone {
+		return nil
+	}
+
+	data := map[string]any{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"headline":         page.Title,
+		"url":              page.Canonical,
+		"mainEntityOfPage": map[string]any{"@type": "WebPage", "@id": page.Canonical},
+		"wordCount":        page.WordCount(),
+	}
+	if description := firstNonEmpty(page.MetaDescription, page.Description); description != "" {
+		data["description"] = description
+	}
+	if page.Image != "" {
+		data["image"] = []string{page.Image}
+	}
+	if page.Lang != "" {
+		data["inLanguage"] = page.Lang
+	}
+	if len(page.Tags) > 0 {
+		data["keywords"] = page.Tags
+	}
+
+	if !page.Date.IsZero() {
+		data["datePublished"] = page.Date.Format(time.RFC3339)
+	}
+	if !page.DateModified.IsZero() {
+		data["dateModified"] = page.DateModified.Format(time.RFC3339)
+	}
+
+	if page.Author.Name != "" {
+		author := map[string]any{"@type": "Person", "name": page.Author.Name}
+		if page.authorURL != "" {
+			author["url"] = page.authorURL
+		}
+		data["author"] = author
+	}
+	if page.Site.Title != "" {
+		data["publisher"] = map[string]any{"@type": "Organization", "name": page.Site.Title}
+	}
+
+	return data
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStructuredData(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"cover.md": "---\nTitle: With a Cover\nDate: 2025-02-01 08:30\nSlug: cover\nauthor: ada\nMetaImage: /static/cover.png\n---\n\nA post with a cover.\n",
+	})
+	modified := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	err := os.Chtimes(filepath.Join(dir, "cover.md"), modified, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := newTestRouter(t, func(cfg *Config) { cfg.ContentDir = dir })
+
+	w := get(route, "/posts/cover")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	_, after, _ := strings.Cut(w.Body.String(), `<script type="application/ld+json">`)
+	script, _, ok := strings.Cut(after, "</script>")
+	if !ok {
+		t.Fatal("the post has no JSON-LD")
+	}
+	var data map[string]any
+	err = json.Unmarshal([]byte(script), &data)
+	if err != nil {
+		t.Fatalf("%v in JSON-LD %s", err, script)
+	}
+
+	for key, want := range map[string]any{
+		"@type":         "BlogPosting",
+		"headline":      "With a Cover",
+		"author":        map[string]any{"@type": "Person", "name": "Ada Example", "url": "https://blog.example/authors/ada"},
+		"datePublished": "2025-02-01T08:30:00Z",
+		"dateModified":  "2025-03-04T05:06:07Z",
+		"image":         []any{"https://blog.example/static/cover.png"},
+	} {
+		if got := data[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// likerCookie identifies a reader who liked posts, so they can't like the
+// same one twice from another address.
+const likerCookie = "liker"
+
+// Likes counts anonymous likes of posts in SQLite, keyed by likeKey so
+// translations sharing a slug are counted apart. Each reader
+// likes a post once: a like is only counted if neither the reader's
+// address nor their liker cookie has liked it before. Addresses are kept
+// as an HMAC, so they can't be recovered from the database by hashing
+// every address there is. A nil *Likes counts nothing.
+type Likes struct {
+	db *sql.DB
+	// key is the HMAC key of addresses, see likesKey.
+	key []byte
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// openLikes opens the database configured in cfg, or returns nil when
+// likes are disabled.
+func openLikes(cfg LikesConfig) (*Likes, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "likes.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS likes (
+		post    TEXT NOT NULL,
+		ip      TEXT NOT NULL,
+		liker   TEXT NOT NULL,
+		created INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS likes_post ON likes (post);
+	CREATE TABLE IF NOT EXISTS likes_key (
+		secret BLOB NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	key, err := likesKey(db, cfg.Secret)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	counts, err := loadLikes(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Likes{db: db, key: key, counts: counts}, nil
+}
+
+// likesKey returns the key addresses are hashed with: secret, or else a
+// random key generated the first time the database is opened and kept in
+// it, so the same address hashes the same across restarts.
+func likesKey(db *sql.DB, secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+
+	var key []byte
+	err := db.QueryRow(`SELECT secret FROM likes_key`).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		key = make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec(`INSERT INTO likes_key (secret) VALUES (?)`, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func loadLikes(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query(`SELECT post, COUNT(*) FROM likes GROUP BY post`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var count int64
+		err = rows.Scan(&key, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[key] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// likeKey identifies post among the likes: its language and slug.
+func likeKey(post PostData) string {
+	return post.Lang + "/" + post.Slug
+}
+
+// Like records a like of post from the reader at ip with the liker
+// cookie, and reports whether it was counted: false if they already liked
+// it.
+func (l *Likes) Like(post PostData, ip, liker string) (bool, error) {
+	key := likeKey(post)
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(ip))
+	ipKey := hex.EncodeToString(mac.Sum(nil))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var n int
+	err := l.db.QueryRow(`SELECT COUNT(*) FROM likes WHERE post = ? AND (ip = ? OR liker = ?)`, key, ipKey, liker).Scan(&n)
+	if err != nil || n > 0 {
+		return false, err
+	}
+
+	_, err = l.db.Exec(`INSERT INTO likes (post, ip, liker, created) VALUES (?, ?, ?, ?)`, key, ipKey, liker, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	l.counts[key]++
+
+	return true, nil
+}
+
+// Count returns the number of likes of post.
+func (l *Likes) Count(post PostData) int64 {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.counts[likeKey(post)]
+}
+
+// Close closes the database.
+func (l *Likes) Close() error {
+	return l.db.Close()
+}
+
+// likeURL is where the like button of post posts to.
+func likeURL(post PostData) string {
+	return langPrefix(post.Lang) + "/posts/" + post.Slug + "/like"
+}
+
+// LikeHandler likes a post from the button on its page and redirects back
+// to it, with ?like= telling the page what happened.
+func LikeHandler(store PostStore, likes *Likes) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		post, ok := visiblePost(ctx, store, ctx.Param("slug"))
+		if !ok || !post.Published(requestTime(ctx)) {
+			notFound(ctx, "Post not found")
+			return
+		}
+
+		back := func(status string) {
+			ctx.Redirect(http.StatusSeeOther, post.URL+"?like="+status+"#likes")
+		}
+
+		liker, err := ctx.Cookie(likerCookie)
+		if err != nil || len(liker) != 32 {
+			liker, err = newSubscriberToken()
+			if err != nil {
+				serverError(ctx, err)
+				return
+			}
+			ctx.SetSameSite(http.SameSiteLaxMode)
+			ctx.SetCookie(likerCookie, liker, int((365 * 24 * time.Hour).Seconds()), "/", "", ctx.Request.TLS != nil, true)
+		}
+
+		counted, err := likes.Like(post, ctx.ClientIP(), liker)
+		if err != nil {
+			slog.Error("saving like", "post", post.URL, "error", err)
+			back("failed")
+			return
+		}
+		if !counted {
+			back("already")
+			return
+		}
+
+		purgeCache(ctx, "post:"+post.Slug)
+		back("thanks")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var likedPost = PostData{Slug: "hello-world", Lang: "en"}
+
+func TestLikesHashAddresses(t *testing.T) {
+	cfg := LikesConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "likes.db")}
+	likes, err := openLikes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	liked, err := likes.Like(likedPost, "192.0.2.1", "reader-1")
+	if err != nil || !liked {
+		t.Fatalf("first like: %v, %v", liked, err)
+	}
+
+	var stored string
+	err = likes.db.QueryRow(`SELECT ip FROM likes`).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := sha256.Sum256([]byte("192.0.2.1"))
+	if strings.Contains(stored, "192.0.2.1") || stored == hex.EncodeToString(plain[:]) {
+		t.Errorf("address stored as %q, which anyone can tell is 192.0.2.1", stored)
+	}
+	likes.Close()
+
+	// The generated key outlives the process, or the address could like
+	// again after a restart.
+	likes, err = openLikes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer likes.Close()
+	liked, err = likes.Like(likedPost, "192.0.2.1", "reader-2")
+	if err != nil || liked {
+		t.Errorf("like from the same address after reopening: %v, %v", liked, err)
+	}
+	if got := likes.Count(likedPost); got != 1 {
+		t.Errorf("Count = %d, want 1", got)
+	}
+}
+
+func TestLikesSecret(t *testing.T) {
+	dir := t.TempDir()
+	ipOf := func(secret string) string {
+		likes, err := openLikes(LikesConfig{Enabled: true, Path: filepath.Join(dir, secret+".db"), Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer likes.Close()
+
+		_, err = likes.Like(likedPost, "192.0.2.1", "reader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored string
+		err = likes.db.QueryRow(`SELECT ip FROM likes`).Scan(&stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return stored
+	}
+
+	if ipOf("one") == ipOf("two") {
+		t.Error("the same address hashes the same with different secrets")
+	}
+}
+
+func TestLikesTranslations(t *testing.T) {
+	likes, err := openLikes(LikesConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "likes.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer likes.Close()
+
+	translated := likedPost
+	translated.Lang = "id"
+	for _, post := range []PostData{likedPost, translated} {
+		liked, err := likes.Like(post, "192.0.2.1", "reader")
+		if err != nil || !liked {
+			t.Errorf("like of the %s post: %v, %v", post.Lang, liked, err)
+		}
+	}
+	_, err = likes.Like(translated, "192.0.2.2", "another-reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := likes.Count(likedPost); got != 1 {
+		t.Errorf("Count of the en post = %d, want 1", got)
+	}
+	if got := likes.Count(translated); got != 2 {
+		t.Errorf("Count of the id post = %d, want 2", got)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var outboundClicks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "blog_outbound_clicks_total",
+	Help: "Clicks on links to other sites, by host.",
+}, []string{"host"})
+
+// externalLinks applies the links config to links in posts pointing to
+// other sites: rel and target attributes, and routing through /out.
+type externalLinks struct {
+	cfg *Config
+}
+
+func (e externalLinks) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(externalLinkTransformer{e.cfg}, 500),
+	))
+}
+
+type externalLinkTransformer struct {
+	cfg *Config
+}
+
+func (t externalLinkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var autoLinks []*ast.AutoLink
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.Link:
+			if externalLink(t.cfg, string(n.Destination)) {
+				setExternalAttributes(t.cfg.Links, n)
+				if t.cfg.Links.Track {
+					n.Destination = []byte(outboundURL(t.cfg.Links, string(n.Destination)))
+				}
+			}
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL && externalLink(t.cfg, string(n.URL(source))) {
+				autoLinks = append(autoLinks, n)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	// Autolinks can't carry attributes or a destination other than their
+	// text, so they're made into plain links.
+	for _, n := range autoLinks {
+		dest := string(n.URL(source))
+		if t.cfg.Links.Track {
+			dest = outboundURL(t.cfg.Links, dest)
+		}
+
+		link := ast.NewLink()
+		link.Destination = []byte(dest)
+		link.AppendChild(link, ast.NewString(n.Label(source)))
+		setExternalAttributes(t.cfg.Links, link)
+		n.Parent().ReplaceChild(n.Parent(), n, link)
+	}
+}
+
+func setExternalAttributes(cfg LinksConfig, n ast.Node) {
+	if cfg.Rel != "" {
+		n.SetAttributeString("rel", []byte(cfg.Rel))
+	}
+	if cfg.NewTab {
+		n.SetAttributeString("target", []byte("_blank"))
+	}
+}
+
+// externalLink reports whether dest is an absolute http(s) URL to a site
+// other than the blog and cfg's exempt domains, subdomains included.
+func externalLink(cfg *Config, dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if base, err := url.Parse(cfg.BaseURL); err == nil && host == strings.ToLower(base.Hostname()) {
+		return false
+	}
+	for _, domain := range cfg.Links.Exempt {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// linkKey signs links while links.secret is unset, for as long as the
+// blog runs.
+var (
+	linkKeyOnce sync.Once
+	linkKey     []byte
+)
+
+// linkSignature signs dest with cfg's secret, so /out only redirects to
+// links the blog made rather than anywhere it's asked to.
+func linkSignature(cfg LinksConfig, dest string) string {
+	key := []byte(cfg.Secret)
+	if len(key) == 0 {
+		linkKeyOnce.Do(func() {
+			linkKey = make([]byte, 32)
+			_, _ = rand.Read(linkKey)
+		})
+		key = linkKey
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(dest))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// outboundURL is the /out link counting clicks on a link to dest.
+func outboundURL(cfg LinksConfig, dest string) string {
+	return "/out?" + url.Values{"u": {dest}, "s": {linkSignature(cfg, dest)}}.Encode()
+}
+
+// OutboundHandler counts a click on a link to another site and sends the
+// reader on to it.
+func OutboundHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		dest := ctx.Query("u")
+		if !hmac.Equal([]byte(ctx.Query("s")), []byte(linkSignature(cfg.Links, dest))) || !externalLink(cfg, dest) {
+			ctx.String(http.StatusBadRequest, "Invalid link")
+			return
+		}
+
+		u, _ := url.Parse(dest)
+		outboundClicks.WithLabelValues(strings.ToLower(u.Hostname())).Inc()
+
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Redirect(http.StatusFound, dest)
+	}
+}
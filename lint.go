@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// The prose checks of the lint command, by the names lint.disabled turns
+// them off with.
+const (
+	checkLongSentence = "long-sentence"
+	checkAltText      = "alt-text"
+	checkAbsoluteLink = "absolute-link"
+	checkTodo         = "todo"
+)
+
+// sentenceEnd ends a sentence: a full stop, question or exclamation mark
+// followed by a space or the end of the text.
+var sentenceEnd = regexp.MustCompile(`[.!?]+(\s+|$)`)
+
+// lintProse runs the prose checks over every post in the content source,
+// drafts included, or over the markdown files and directories in args,
+// printing each problem with its file and line. It fails if there are
+// any, so it can gate publishing in CI or a pre-commit hook.
+func lintProse(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Parse(args)
+
+	var problems []Problem
+	if flags.NArg() == 0 {
+		source, err := openContentSource(*cfg)
+		if err != nil {
+			return err
+		}
+		fsys, err := source.Load()
+		if err != nil {
+			return err
+		}
+
+		problems, err = lintProseFS(fsys, source.String(), cfg.Lint, cfg.BaseURL)
+		if err != nil {
+			return err
+		}
+	}
+	for _, arg := range flags.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+
+		var found []Problem
+		if info.IsDir() {
+			found, err = lintProseFS(os.DirFS(arg), arg, cfg.Lint, cfg.BaseURL)
+		} else {
+			found, err = lintProseFS(os.DirFS(filepath.Dir(arg)), filepath.Dir(arg), cfg.Lint, cfg.BaseURL, filepath.Base(arg))
+		}
+		if err != nil {
+			return err
+		}
+		problems = append(problems, found...)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+
+	return nil
+}
+
+// lintProseFS checks the markdown files names of fsys, or all of them
+// without names. Files are named as if fsys were the directory dir, and
+// links are checked as on the blog at baseURL.
+func lintProseFS(fsys fs.FS, dir string, cfg LintConfig, baseURL string, names ...string) ([]Problem, error) {
+	if len(names) == 0 {
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(name, ".md") {
+				names = append(names, name)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []Problem
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, lintPost(filepath.Join(dir, filepath.FromSlash(name)), content, cfg, baseURL)...)
+	}
+
+	return problems, nil
+}
+
+// lintPost runs the prose checks cfg enables over the body of the post
+// file path, a post of the blog at baseURL.
+func lintPost(path string, content []byte, cfg LintConfig, baseURL string) []Problem {
+	content = normalizeContent(content)
+	_, body, _ := splitFrontmatter(content)
+	// Lines are counted from the top of the file, frontmatter included.
+	firstLine := bytes.Count(content[:len(content)-len(body)], []byte("\n")) + 1
+	lineAt := func(offset int) int {
+		return firstLine + bytes.Count(body[:offset], []byte("\n"))
+	}
+
+	var problems []Problem
+	report := func(offset int, format string, args ...any) {
+		problems = append(problems, Problem{File: path, Line: lineAt(offset), Message: fmt.Sprintf(format, args...)})
+	}
+	enabled := func(check string) bool {
+		return !slices.Contains(cfg.Disabled, check)
+	}
+
+	if enabled(checkTodo) && len(cfg.Markers) > 0 {
+		lintTodos(body, cfg.Markers, report)
+	}
+
+	var base *url.URL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		base = u
+	}
+
+	doc := goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser().Parse(text.NewReader(body))
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Paragraph, *ast.TextBlock:
+			if enabled(checkLongSentence) && cfg.MaxSentenceWords > 0 {
+				lintSentences(n, body, cfg.MaxSentenceWords, report)
+			}
+		case *ast.Image:
+			at := inlineOffset(n, body, n.Destination)
+			if enabled(checkAltText) && len(bytes.TrimSpace(n.Text(body))) == 0 {
+				report(at, "image %s has no alt text", n.Destination)
+			}
+			if enabled(checkAbsoluteLink) && base != nil {
+				lintAbsoluteLink(at, string(n.Destination), base, report)
+			}
+		case *ast.Link:
+			if enabled(checkAbsoluteLink) && base != nil {
+				lintAbsoluteLink(inlineOffset(n, body, n.Destination), string(n.Destination), base, report)
+			}
+		case *ast.AutoLink:
+			if enabled(checkAbsoluteLink) && base != nil {
+				lintAbsoluteLink(inlineOffset(n, body, n.URL(body)), string(n.URL(body)), base, report)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		return a.Line - b.Line
+	})
+
+	return problems
+}
+
+// lintTodos reports the lines of body with one of markers, such as TODO,
+// outside fenced code, where they're more likely part of an example.
+func lintTodos(body []byte, markers []string, report func(int, string, ...any)) {
+	quoted := make([]string, len(markers))
+	for i, marker := range markers {
+		quoted[i] = regexp.QuoteMeta(marker)
+	}
+	pattern := regexp.MustCompile(`\b(` + strings.Join(quoted, "|") + `)\b`)
+
+	fenced := false
+	offset := 0
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fenced = !fenced
+		} else if m := pattern.Find(line); !fenced && m != nil {
+			report(offset, "%s marker left in", m)
+		}
+		offset += len(line)
+	}
+}
+
+// lintSentences reports the sentences of the paragraph longer than
+// maxWords.
+func lintSentences(paragraph ast.Node, source []byte, maxWords int, report func(int, string, ...any)) {
+	// The paragraph's text is put together from its text nodes, code
+	// spans left out, remembering where each starts in source.
+	var b strings.Builder
+	var starts, offsets []int
+	_ = ast.Walk(paragraph, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if _, ok := n.(*ast.CodeSpan); ok {
+			return ast.WalkSkipChildren, nil
+		}
+		if t, ok := n.(*ast.Text); ok && entering {
+			starts = append(starts, b.Len())
+			offsets = append(offsets, t.Segment.Start)
+			b.Write(t.Segment.Value(source))
+			b.WriteByte(' ')
+		}
+		return ast.WalkContinue, nil
+	})
+	prose := b.String()
+
+	sourceOffset := func(at int) int {
+		i, found := slices.BinarySearch(starts, at)
+		if !found {
+			i--
+		}
+		if i < 0 {
+			return paragraph.Lines().At(0).Start
+		}
+		return offsets[i] + at - starts[i]
+	}
+
+	start := 0
+	for _, end := range append(sentenceEnd.FindAllStringIndex(prose, -1), []int{len(prose), len(prose)}) {
+		sentence := prose[start:end[0]]
+		if words := strings.Fields(sentence); len(words) > maxWords {
+			report(sourceOffset(start), "sentence of %d words, over %d: %q", len(words), maxWords, strings.Join(words[:min(len(words), 6)], " ")+" …")
+		}
+		start = end[1]
+		if start >= len(prose) {
+			break
+		}
+	}
+}
+
+// lintAbsoluteLink reports dest if it's an absolute URL of the blog
+// itself, which breaks on previews and other hosts.
+func lintAbsoluteLink(offset int, dest string, base *url.URL, report func(int, string, ...any)) {
+	u, err := url.Parse(dest)
+	if err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return
+	}
+
+	relative := firstNonEmpty(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		relative += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		relative += "#" + u.EscapedFragment()
+	}
+	report(offset, "absolute link to the blog %s, use %s", dest, relative)
+}
+
+// inlineOffset returns where the inline node n, written with dest, is in
+// source: dest's first occurrence in the block containing n, or the
+// block's start.
+func inlineOffset(n ast.Node, source, dest []byte) int {
+	block := n.Parent()
+	for block != nil && block.Type() != ast.TypeBlock {
+		block = block.Parent()
+	}
+	if block == nil || block.Lines().Len() == 0 {
+		return 0
+	}
+
+	start := block.Lines().At(0).Start
+	if i := bytes.Index(source[start:], dest); i >= 0 && len(dest) > 0 {
+		return start + i
+	}
+
+	return start
+}
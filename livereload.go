@@ -0,0 +1,144 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+)
+
+const liveReloadPath = "/_livereload"
+
+// liveReloadScript reloads the page when the server says so. EventSource
+// reconnects on its own after the server's write timeout or a restart.
+const liveReloadScript = `new EventSource("` + liveReloadPath + `").addEventListener("reload", () => location.reload());`
+
+// LiveReload tells open pages to reload, over server-sent events, when
+// posts, templates or static files change. It is only used in dev mode.
+type LiveReload struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func NewLiveReload() *LiveReload {
+	return &LiveReload{clients: map[chan struct{}]bool{}}
+}
+
+// Notify asks every connected page to reload.
+func (lr *LiveReload) Notify() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for client := range lr.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+			// A reload is already pending for this client.
+		}
+	}
+}
+
+// Handler streams reload events to a page until it goes away.
+func (lr *LiveReload) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		client := make(chan struct{}, 1)
+
+		lr.mu.Lock()
+		lr.clients[client] = true
+		lr.mu.Unlock()
+
+		defer func() {
+			lr.mu.Lock()
+			delete(lr.clients, client)
+			lr.mu.Unlock()
+		}()
+
+		ctx.Header("Cache-Control", "no-store")
+		ctx.SSEvent("hello", "")
+		ctx.Writer.Flush()
+
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-client:
+				ctx.SSEvent("reload", "")
+				return true
+			case <-ctx.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+// Watch notifies pages whenever something under dirs changes. Errors are
+// logged; live reload is a convenience and never stops the server.
+func (lr *LiveReload) Watch(dirs ...string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("live reload disabled", "error", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+
+			return watcher.Add(path)
+		})
+		if err != nil {
+			slog.Warn("live reload not watching", "dir", dir, "error", err)
+		}
+	}
+
+	go func() {
+		notify := time.NewTimer(reloadDelay)
+		notify.Stop()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						_ = watcher.Add(event.Name)
+					}
+				}
+
+				notify.Reset(reloadDelay)
+
+			case <-notify.C:
+				lr.Notify()
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				slog.Warn("live reload", "error", err)
+			}
+		}
+	}()
+}
+
+// liveReloadTag is the liveReload template function, which adds the
+// script, allowed by the request's CSP nonce, to pages in dev mode.
+func liveReloadTag(dev bool) func(nonce string) template.HTML {
+	return func(nonce string) template.HTML {
+		if !dev {
+			return ""
+		}
+
+		return template.HTML(`<script nonce="` + template.HTMLEscapeString(nonce) + `">` + liveReloadScript + `</script>`)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceExempt are the path prefixes still served in maintenance
+// mode: health checks, monitoring, the admin pages for turning it off and
+// the static files the maintenance page is styled with.
+var maintenanceExempt = []string{"/healthz", "/readyz", "/metrics", "/debug/pprof/", "/admin", "/login", "/logout", "/static/"}
+
+// Maintenance answers public requests with the maintenance page while it's
+// on, such as during content migrations. It's turned on and off at
+// /admin/maintenance, or from outside the blog by creating and removing
+// maintenance.file. A nil *Maintenance is never on.
+type Maintenance struct {
+	on atomic.Bool
+	// file turns maintenance on while it exists.
+	file       string
+	retryAfter time.Duration
+}
+
+// newMaintenance returns the maintenance switch, starting on if cfg says
+// so.
+func newMaintenance(cfg MaintenanceConfig) *Maintenance {
+	m := &Maintenance{file: cfg.File, retryAfter: time.Duration(cfg.RetryAfter)}
+	m.on.Store(cfg.Enabled)
+
+	return m
+}
+
+// On reports whether the blog is in maintenance.
+func (m *Maintenance) On() bool {
+	if m == nil {
+		return false
+	}
+	if m.on.Load() {
+		return true
+	}
+	if m.file == "" {
+		return false
+	}
+
+	_, err := os.Stat(m.file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("checking maintenance file", "file", m.file, "error", err)
+	}
+
+	return err == nil
+}
+
+// Set turns maintenance on or off. The maintenance file still turns it on
+// while it exists.
+func (m *Maintenance) Set(on bool) {
+	m.on.Store(on)
+	slog.Info("maintenance mode", "on", on)
+}
+
+// Middleware serves the maintenance page with 503 for every request but
+// the exempt ones while maintenance is on. It runs before the page cache,
+// so cached pages aren't served either.
+func (m *Maintenance) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !m.On() {
+			return
+		}
+
+		path := ctx.Request.URL.Path
+		for _, prefix := range maintenanceExempt {
+			if strings.HasPrefix(path, prefix) {
+				return
+			}
+		}
+
+		ctx.Header("Retry-After", strconv.Itoa(int(m.retryAfter.Seconds())))
+		ctx.Header("Cache-Control", "no-store")
+		setCanonical(ctx, "")
+		renderHTML(ctx, http.StatusServiceUnavailable, "maintenance.html", gin.H{
+			"Title": "Down for maintenance",
+		})
+		ctx.Abort()
+	}
+}
+
+// AdminMaintenanceHandler turns maintenance on with on=1 and off with
+// on=0, then goes back to the admin page it was posted from, if any.
+func AdminMaintenanceHandler(maintenance *Maintenance) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		on, err := strconv.ParseBool(ctx.PostForm("on"))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "on must be 1 or 0")
+			return
+		}
+
+		maintenance.Set(on)
+		if back, err := url.Parse(ctx.GetHeader("Referer")); err == nil && back.Host == ctx.Request.Host && back.Path != "" {
+			ctx.Redirect(http.StatusSeeOther, back.RequestURI())
+			return
+		}
+		ctx.String(http.StatusOK, "maintenance on: %t\n", on)
+	}
+}
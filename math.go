@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mathExtension parses $...$ as inline math and $$...$$, on a line or
+// across lines, as display math. The TeX source is emitted as is in
+// elements of class "math", for KaTeX to render in the browser, see
+// static/js/math.js in the theme.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 500)),
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 500)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(mathRenderer{}, 500),
+	))
+}
+
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+type mathInline struct {
+	ast.BaseInline
+	tex text.Segment
+	// display is set for $$...$$ within a paragraph.
+	display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.tex.Value(source))}, nil)
+}
+
+type mathBlock struct {
+	ast.BaseBlock
+	// closed is set for $$...$$ on a single line, which ends the block
+	// right away.
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse follows Pandoc's rules so that prices don't turn into math: the
+// opening $ must not be followed by a space, and the closing $ must not
+// be preceded by a space or followed by a digit. Math never contains an
+// unescaped $ that can't close it, so "$5 and $10" stays text.
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+
+	tex := line[delim:]
+	if len(tex) == 0 || util.IsSpace(tex[0]) {
+		return nil
+	}
+
+	for i := 1; i < len(tex); i++ {
+		switch {
+		case tex[i] == '\\':
+			i++
+		case tex[i] == '`':
+			// Code spans bind tighter than math.
+			return nil
+		case tex[i] != '$':
+		case util.IsSpace(tex[i-1]):
+			return nil
+		case delim == 2 && (i+1 >= len(tex) || tex[i+1] != '$'):
+		case delim == 1 && i+1 < len(tex) && tex[i+1] >= '0' && tex[i+1] <= '9':
+		default:
+			node := &mathInline{
+				tex:     text.NewSegment(segment.Start+delim, segment.Start+delim+i),
+				display: delim == 2,
+			}
+			block.Advance(delim + i + delim)
+			return node
+		}
+	}
+
+	return nil
+}
+
+type mathBlockParser struct{}
+
+var mathDelim = []byte("$$")
+
+func (mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], mathDelim) {
+		return nil, parser.NoChildren
+	}
+
+	node := &mathBlock{}
+	start := pos + len(mathDelim)
+	defer reader.Advance(segment.Len() - 1)
+
+	// $$ x^2 $$ on a single line.
+	if end := bytes.LastIndex(line, mathDelim); end >= start {
+		node.Lines().Append(text.NewSegment(segment.Start+start, segment.Start+end))
+		node.closed = true
+		return node, parser.NoChildren
+	}
+
+	if len(util.TrimLeftSpace(line[start:])) > 0 {
+		node.Lines().Append(text.NewSegment(segment.Start+start, segment.Stop))
+	}
+
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line == nil || node.(*mathBlock).closed {
+		return parser.Close
+	}
+	defer reader.Advance(segment.Len() - 1)
+
+	if end := bytes.LastIndex(line, mathDelim); end >= 0 {
+		if len(util.TrimLeftSpace(line[:end])) > 0 {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+end))
+		}
+		return parser.Close
+	}
+
+	node.Lines().Append(segment)
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type mathRenderer struct{}
+
+func (r mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, r.renderInline)
+	reg.Register(kindMathBlock, r.renderBlock)
+}
+
+func (r mathRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := node.(*mathInline)
+		if n.display {
+			_, _ = w.WriteString(`<span class="math math-display">`)
+		} else {
+			_, _ = w.WriteString(`<span class="math math-inline">`)
+		}
+		_, _ = w.Write(util.EscapeHTML(n.tex.Value(source)))
+		_, _ = w.WriteString(`</span>`)
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (r mathRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString(`<div class="math math-display">`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+	_, _ = w.WriteString("</div>\n")
+
+	return ast.WalkContinue, nil
+}
+
+// hasMath reports whether rendered HTML contains math, so KaTeX is only
+// loaded on the pages that need it.
+func hasMath(html []byte) bool {
+	return bytes.Contains(html, []byte(`class="math math-`))
+}
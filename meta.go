@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Meta is the SEO and social card metadata of a post. Every field is
+// optional and falls back to the post's Title and Description.
+type Meta struct {
+	MetaDescription         string `yaml:"MetaDescription"`
+	MetaPropertyTitle       string `yaml:"MetaPropertyTitle"`
+	MetaPropertyDescription string `yaml:"MetaPropertyDescription"`
+	MetaOgURL               string `yaml:"MetaOgURL"`
+	// MetaImage is an absolute URL or a site path such as
+	// /static/img/cover.png.
+	MetaImage string `yaml:"MetaImage"`
+	// MetaType is the og:type, "article" by default.
+	MetaType string `yaml:"MetaType"`
+	// TwitterCard is the twitter:card type, "summary_large_image" when the
+	// post has an image and "summary" otherwise.
+	TwitterCard string `yaml:"TwitterCard"`
+	// CanonicalURL is where the post was first published, for posts
+	// cross-posted from elsewhere. It becomes the canonical link, and
+	// feeds link there; the post is left out of the sitemap.
+	CanonicalURL string `yaml:"CanonicalURL"`
+}
+
+// PostPage is the data passed to post.html.
+type PostPage struct {
+	PostData
+	Site SiteData
+	// Canonical is the absolute URL of the post, or its CanonicalURL.
+	Canonical string
+	// Image is the absolute URL of MetaImage.
+	Image string
+	// Standalone marks pages, as opposed to posts.
+	Standalone bool
+	// authorURL is the absolute URL of the author's page, if any.
+	authorURL string
+
+	// SeriesNav is nil unless the post is part of a series.
+	SeriesNav *SeriesNav
+	// Prev and Next are the posts before and after this one in its
+	// section, if any, see computePrevNext.
+	Prev, Next *PostSummary
+	// Views is the number of times the post was viewed, 0 when views
+	// aren't counted.
+	Views int64
+
+	// Likes is the number of likes of the post, and LikesURL where its
+	// like button posts to, while likes are enabled. LikeStatus is the
+	// outcome of a like just posted, see LikeHandler.
+	Likes      int64
+	LikesURL   string
+	LikeStatus string
+
+	// Webmention is the endpoint receiving mentions of the post, and
+	// Mentions those received, while Webmention is enabled.
+	Webmention string
+	Mentions   []Webmention
+	// MentionedBy are the pages that sent readers to the post, while
+	// referrers.show is on.
+	MentionedBy []Referrer
+
+	CommentsEnabled bool
+	CommentsURL     string
+	Comments        []Comment
+	// CommentStatus is the outcome of a comment just posted, see
+	// CommentHandler.
+	CommentStatus string
+}
+
+func newPostPage(ctx *gin.Context, post PostData) PostPage {
+	canonical := firstNonEmpty(post.CanonicalURL, absoluteURL(ctx, post.URL))
+	setCanonical(ctx, canonical)
+	page := PostPage{
+		PostData:  post,
+		Site:      siteData(ctx),
+		Canonical: canonical,
+		Image:     post.MetaImage,
+	}
+	if strings.HasPrefix(page.Image, "/") {
+		page.Image = absoluteURL(ctx, page.Image)
+	}
+	if u := post.Author.URL(); u != "" {
+		page.authorURL = absoluteURL(ctx, u)
+	}
+	page.Math = post.Math || hasMath([]byte(post.Content()))
+	page.Diagrams = hasDiagrams([]byte(post.Content()))
+
+	return page
+}
+
+var metaTagsTemplate = template.Must(template.New("meta").Parse(`
+<meta name="description" content="{{ .Description }}" />
+<meta property="og:type" content="{{ .Type }}" />
+<meta property="og:title" content="{{ .Title }}" />
+<meta property="og:description" content="{{ .OgDescription }}" />
+<meta property="og:url" content="{{ .URL }}" />
+{{- with .SiteName }}
+<meta property="og:site_name" content="{{ . }}" />
+{{- end }}
+{{- with .Image }}
+<meta property="og:image" content="{{ . }}" />
+{{- end }}
+{{- with .Published }}
+<meta property="article:published_time" content="{{ . }}" />
+{{- end }}
+<meta name="twitter:card" content="{{ .Card }}" />
+<meta name="twitter:title" content="{{ .Title }}" />
+<meta name="twitter:description" content="{{ .OgDescription }}" />
+{{- with .Image }}
+<meta name="twitter:image" content="{{ . }}" />
+{{- end }}
+`))
+
+// MetaTags renders the description, Open Graph, and Twitter Card tags for
+// the post. Its canonical link is in PageMeta.
+func (page PostPage) MetaTags() (template.HTML, error) {
+	description := firstNonEmpty(page.MetaDescription, page.PostData.Description)
+	data := struct {
+		Description, Type, Title, OgDescription, URL string
+		SiteName, Image, Published, Card             string
+	}{
+		Description:   description,
+		Type:          firstNonEmpty(page.MetaType, "article"),
+		Title:         firstNonEmpty(page.MetaPropertyTitle, page.Title),
+		OgDescription: firstNonEmpty(page.MetaPropertyDescription, description),
+		URL:           firstNonEmpty(page.MetaOgURL, page.Canonical),
+		SiteName:      page.Site.Title,
+		Image:         page.Image,
+		Card:          page.TwitterCard,
+	}
+	if data.Card == "" {
+		data.Card = "summary"
+		if data.Image != "" {
+			data.Card = "summary_large_image"
+		}
+	}
+	if !page.Date.IsZero() {
+		data.Published = page.Date.Format(time.RFC3339)
+	}
+
+	var buf bytes.Buffer
+	err := metaTagsTemplate.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(strings.TrimSpace(buf.String())), nil
+}
+
+// syndicationLink is a copy of a post published elsewhere.
+type syndicationLink struct {
+	URL string
+	// Site is the host of URL, without www.
+	Site string
+}
+
+// Syndication returns the post's SyndicatedTo links, for the "also
+// published on" line of post pages.
+func (post PostData) Syndication() []syndicationLink {
+	var links []syndicationLink
+	for _, raw := range post.SyndicatedTo {
+		u, err := url.Parse(raw)
+		if err != nil || !httpURL(u) {
+			continue
+		}
+
+		links = append(links, syndicationLink{URL: raw, Site: strings.TrimPrefix(u.Hostname(), "www.")})
+	}
+
+	return links
+}
+
+// feedLink is where feeds link post to: its CanonicalURL, or its page on
+// the blog.
+func feedLink(ctx *gin.Context, post PostData) string {
+	return firstNonEmpty(post.CanonicalURL, absoluteURL(ctx, post.URL))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blog_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blog_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	postLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blog_post_cache_lookups_total",
+		Help: "Post lookups by slug in the post store, by result (hit or miss).",
+	}, []string{"result"})
+
+	renderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "blog_markdown_render_duration_seconds",
+		Help:    "Time spent rendering markdown to HTML.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+)
+
+// Metrics records the count and latency of every request. Requests are
+// labeled with their route pattern rather than path, so that metrics don't
+// grow a series per post or per bogus URL.
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route, ctx.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format. When
+// token is set, requests must carry it as "Authorization: Bearer <token>".
+func MetricsHandler(token string) gin.HandlerFunc {
+	handler := promhttp.Handler()
+	want := []byte("Bearer " + token)
+
+	return func(ctx *gin.Context) {
+		got := []byte(ctx.GetHeader("Authorization"))
+		if token != "" && subtle.ConstantTimeCompare(got, want) != 1 {
+			ctx.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
+
+// metricsServer serves only /metrics on addr, for keeping metrics off the
+// public listener.
+func metricsServer(addr, token string) *http.Server {
+	route := gin.New()
+	route.Use(gin.Recovery())
+	route.GET("/metrics", MetricsHandler(token))
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           route,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// An incoming X-Request-ID, e.g. from a load balancer, is kept if it looks
+// like an ID and replaced otherwise.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestLogger gives every request an ID, returned in the X-Request-ID
+// header, and logs the request once it completes. Requests slower than
+// slowThreshold are logged at WARN. Requests to skipPaths, such as probes,
+// still get an ID but are never logged; a skip path ending in /* skips
+// everything under it.
+func RequestLogger(slowThreshold time.Duration, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	var skipPrefixes []string
+	for _, path := range skipPaths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			skipPrefixes = append(skipPrefixes, prefix)
+			continue
+		}
+		skip[path] = true
+	}
+	skipped := func(path string) bool {
+		return skip[path] || slices.ContainsFunc(skipPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(path, prefix)
+		})
+	}
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		id := ctx.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		ctx.Set("RequestID", id)
+		ctx.Header(requestIDHeader, id)
+
+		ctx.Next()
+
+		if skipped(ctx.Request.URL.Path) {
+			return
+		}
+
+		duration := time.Since(start)
+		level, msg := slog.LevelInfo, "request"
+		if duration >= slowThreshold {
+			level, msg = slog.LevelWarn, "slow request"
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", ctx.Request.Method),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.String("route", ctx.FullPath()),
+			slog.Int("status", ctx.Writer.Status()),
+			slog.Duration("latency", duration),
+			slog.String("client_ip", ctx.ClientIP()),
+		}
+		if errs := ctx.Errors.String(); errs != "" {
+			attrs = append(attrs, slog.String("errors", errs))
+		}
+
+		slog.LogAttrs(ctx.Request.Context(), level, msg, attrs...)
+	}
+}
+
+// requestID returns the ID RequestLogger assigned to the request.
+func requestID(ctx *gin.Context) string {
+	return ctx.GetString("RequestID")
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestTimeout cancels the context of each request after timeout, so
+// handlers waiting on slow work, such as rendering pathological markdown,
+// stop waiting and answer 503 instead of leaving the reader hanging, see
+// renderPosts. A render already started isn't aborted, it finishes in the
+// background. Zero means no timeout.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if timeout <= 0 {
+			ctx.Next()
+			return
+		}
+
+		c, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureLog sends the default logger's records to the returned buffer
+// until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+func TestRequestLoggerSlowRequests(t *testing.T) {
+	route := gin.New()
+	route.Use(RequestLogger(50*time.Millisecond, "/healthz", "/metrics", "/debug/pprof/*"))
+	slow := func(ctx *gin.Context) {
+		time.Sleep(60 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	}
+	route.GET("/slow", slow)
+	route.GET("/fast", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	route.GET("/healthz", slow)
+	route.GET("/metrics", slow)
+	route.GET("/debug/pprof/*name", slow)
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/slow", `level=WARN msg="slow request"`},
+		{"/fast", "level=INFO msg=request"},
+		{"/healthz", ""},
+		{"/metrics", ""},
+		{"/debug/pprof/profile", ""},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			log := captureLog(t)
+			get(route, tc.path)
+
+			got := log.String()
+			if tc.want == "" {
+				if got != "" {
+					t.Errorf("GET %s logged %q", tc.path, got)
+				}
+				return
+			}
+			if !strings.Contains(got, tc.want) || !strings.Contains(got, "method=GET") || !strings.Contains(got, "path="+tc.path) || !strings.Contains(got, "latency=") {
+				t.Errorf("GET %s logged %q, want %s with the method, path and latency", tc.path, got, tc.want)
+			}
+		})
+	}
+}
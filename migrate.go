@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// Posts of Hugo and Jekyll sites are converted by importSite: their
+// frontmatter is mapped onto this blog's, and the URLs they had become
+// Aliases so links to the old site keep working.
+
+// defaultPermalinks are the URLs Hugo and Jekyll give posts unless
+// configured otherwise, see oldPostURL.
+var defaultPermalinks = map[string]string{
+	"hugo":   "/:section/:slug/",
+	"jekyll": "/:categories/:year/:month/:day/:title.html",
+}
+
+// jekyllPostName is the name of a Jekyll post file, such as
+// 2024-01-02-my-post.md.
+var jekyllPostName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+var datePlaceholder = regexp.MustCompile(`:(year|month|day)`)
+
+// liquidTag matches Jekyll's Liquid tags, which have no equivalent here.
+var liquidTag = regexp.MustCompile(`\{%.*?%\}`)
+
+// sitePost is a post of the site being imported.
+type sitePost struct {
+	// file is the post's path relative to the source directory.
+	file  string
+	front map[string]any
+	body  []byte
+	// slug and date come from the file name when the frontmatter lacks
+	// them; section is Hugo's, the directory the post is in.
+	slug    string
+	date    string
+	section string
+	lang    string
+	draft   bool
+}
+
+// importSite converts the posts of the Hugo content directory or Jekyll
+// site in src into posts under out, printing what couldn't be carried
+// over. Existing files are left alone, and posts in defaultLang go
+// straight under out.
+func importSite(from, src, out, permalink, defaultLang string) error {
+	if _, ok := defaultPermalinks[from]; !ok {
+		return fmt.Errorf(`unknown site kind %q, use "hugo" or "jekyll"`, from)
+	}
+	if permalink == "" {
+		permalink = defaultPermalinks[from]
+	}
+
+	posts, skipped, err := readSitePosts(from, os.DirFS(src))
+	if err != nil {
+		return err
+	}
+	for _, file := range skipped {
+		fmt.Printf("%s: skipped, not a post\n", filepath.Join(src, file))
+	}
+
+	written := 0
+	for _, post := range posts {
+		name := filepath.Join(src, filepath.FromSlash(post.file))
+		content, notes, err := convertSitePost(from, &post, permalink)
+		for _, note := range notes {
+			fmt.Printf("%s: %s\n", name, note)
+		}
+		if err != nil {
+			fmt.Printf("%s: skipped, %v\n", name, err)
+			continue
+		}
+
+		dest := filepath.Join(out, post.slug+".md")
+		if post.lang != "" && post.lang != defaultLang {
+			dest = filepath.Join(out, post.lang, post.slug+".md")
+		}
+		err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			fmt.Printf("%s: skipped, %s already exists\n", name, dest)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		written++
+	}
+
+	fmt.Printf("imported %d of %d posts into %s\n", written, len(posts), out)
+	return nil
+}
+
+// readSitePosts reads the posts of a Hugo content directory, or of the
+// _posts and _drafts directories of a Jekyll site, returning the files it
+// skipped as well.
+func readSitePosts(from string, fsys fs.FS) (posts []sitePost, skipped []string, err error) {
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := path.Ext(name)
+		if ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+
+		post := sitePost{file: name}
+		base := strings.TrimSuffix(path.Base(name), ext)
+		dir := path.Dir(name)
+
+		switch from {
+		case "hugo":
+			// Translations are named post.<lang>.md.
+			if stem, lang, ok := strings.Cut(base, "."); ok {
+				base, post.lang = stem, lang
+			}
+			if base == "_index" {
+				skipped = append(skipped, name)
+				return nil
+			}
+			post.slug = base
+			if base == "index" {
+				// A page bundle, named after its directory.
+				post.slug = path.Base(dir)
+				dir = path.Dir(dir)
+			}
+			if dir != "." {
+				post.section, _, _ = strings.Cut(dir, "/")
+			}
+		case "jekyll":
+			parts := strings.Split(dir, "/")
+			switch {
+			case slices.Contains(parts, "_posts"):
+			case slices.Contains(parts, "_drafts"):
+				post.draft = true
+			default:
+				skipped = append(skipped, name)
+				return nil
+			}
+			post.slug = base
+			if m := jekyllPostName.FindStringSubmatch(base); m != nil {
+				post.date, post.slug = m[1], m[2]
+			}
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		post.front, post.body, err = parseSiteFrontmatter(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		posts = append(posts, post)
+		return nil
+	})
+
+	return posts, skipped, err
+}
+
+// parseSiteFrontmatter splits content into its frontmatter, with keys
+// lowercased, and body. Frontmatter is YAML between ---, TOML between +++
+// or a JSON object.
+func parseSiteFrontmatter(content []byte) (map[string]any, []byte, error) {
+	content = normalizeContent(content)
+	raw := map[string]any{}
+
+	yamlFront, yamlBody, yamlErr := cutFrontmatter(content, "---")
+	tomlFront, tomlBody, tomlErr := cutFrontmatter(content, "+++")
+	switch {
+	case yamlErr != nil:
+		return nil, nil, yamlErr
+	case yamlFront != nil:
+		var m yaml.MapSlice
+		err := decodeFrontmatter(yamlFront, &m)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range m {
+			raw[fmt.Sprint(item.Key)] = item.Value
+		}
+		content = yamlBody
+	case tomlErr != nil:
+		return nil, nil, tomlErr
+	case tomlFront != nil:
+		err := toml.Unmarshal(tomlFront, &raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		content = tomlBody
+	case bytes.HasPrefix(content, []byte("{")):
+		dec := json.NewDecoder(bytes.NewReader(content))
+		err := dec.Decode(&raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		content = content[dec.InputOffset():]
+	}
+
+	front := make(map[string]any, len(raw))
+	for k, v := range raw {
+		front[strings.ToLower(k)] = v
+	}
+
+	return front, bytes.TrimLeft(content, "\n"), nil
+}
+
+// convertSitePost writes post out in this blog's format, noting what
+// didn't carry over. post.slug is updated to the slug it ends up with.
+func convertSitePost(from string, post *sitePost, permalink string) ([]byte, []string, error) {
+	var notes []string
+	note := func(format string, args ...any) {
+		notes = append(notes, fmt.Sprintf(format, args...))
+	}
+	used := map[string]bool{}
+	get := func(keys ...string) any {
+		for _, key := range keys {
+			used[key] = true
+		}
+		for _, key := range keys {
+			if v, ok := post.front[key]; ok && v != nil {
+				return v
+			}
+		}
+		return nil
+	}
+
+	title := frontString(get("title"))
+	slug := slugify(firstNonEmpty(frontString(get("slug")), post.slug))
+	if from == "jekyll" {
+		// Jekyll's slug only replaces the file name's in permalinks.
+		slug = slugify(post.slug)
+	}
+	if !validSlug(slug) {
+		return nil, notes, fmt.Errorf("can't make a slug of %q", post.slug)
+	}
+	if slug != post.slug {
+		note("slug %q changed to %q", post.slug, slug)
+	}
+	post.slug = slug
+
+	date, ok := frontDate(firstNonNil(get("date", "publishdate"), post.date))
+	if !ok {
+		note("no date, the post won't be listed by date")
+	}
+
+	draft := post.draft || frontBool(get("draft"))
+	if published, ok := get("published").(bool); ok && !published {
+		draft = true
+	}
+
+	tags := frontStrings(get("tags"))
+	categories := frontStrings(get("categories", "category"))
+	if len(categories) > 1 {
+		note("only the first of the categories %s is kept", strings.Join(categories, ", "))
+	}
+	series := frontStrings(get("series"))
+	if len(series) > 1 {
+		note("only the first of the series %s is kept", strings.Join(series, ", "))
+	}
+
+	aliases := frontStrings(get("aliases", "redirect_from"))
+	oldURL := frontString(get("url", "permalink"))
+	if oldURL == "" || strings.Contains(oldURL, ":") {
+		oldURL = oldPostURL(firstNonEmpty(oldURL, permalink), post, date, categories)
+	}
+	if oldURL != "" && redirectKey(oldURL) != "/posts/"+slug && !slices.Contains(aliases, oldURL) {
+		aliases = append(aliases, oldURL)
+	}
+
+	front := yaml.MapSlice{
+		{Key: "Title", Value: title},
+		{Key: "Slug", Value: slug},
+	}
+	add := func(key string, value any, ok bool) {
+		if ok {
+			front = append(front, yaml.MapItem{Key: key, Value: value})
+		}
+	}
+	add("Date", date.Format("2006-01-02 15:04"), !date.IsZero())
+	add("Draft", true, draft)
+	description := frontString(get("description"))
+	add("Description", description, description != "")
+	summary := frontString(get("summary", "excerpt"))
+	add("Summary", summary, summary != "")
+	add("Tags", tags, len(tags) > 0)
+	add("Category", firstOf(categories), len(categories) > 0)
+	add("Series", firstOf(series), len(series) > 0)
+	add("Aliases", aliases, len(aliases) > 0)
+	weight := frontInt(get("weight"))
+	add("Order", weight, weight != 0)
+	add("Lang", post.lang, post.lang != "")
+	image := firstOf(frontStrings(get("images", "image")))
+	add("MetaImage", image, image != "")
+	authors := frontStrings(get("author", "authors"))
+	if len(authors) > 1 {
+		note("only the first of the authors %s is kept", strings.Join(authors, ", "))
+	}
+	add("author", firstOf(authors), len(authors) > 0)
+
+	// Jekyll's default layout is implied here.
+	if layout := frontString(post.front["layout"]); layout == "post" || layout == "" {
+		used["layout"] = true
+	}
+	var dropped []string
+	for key := range post.front {
+		if !used[key] {
+			dropped = append(dropped, key)
+		}
+	}
+	slices.Sort(dropped)
+	for _, key := range dropped {
+		note("dropped %s: %v", key, post.front[key])
+	}
+
+	if from == "jekyll" && liquidTag.Match(post.body) {
+		note("contains Liquid tags, which are left as they are")
+	}
+
+	b, err := yaml.Marshal(front)
+	if err != nil {
+		return nil, notes, err
+	}
+
+	var content bytes.Buffer
+	content.WriteString("---\n")
+	content.Write(b)
+	content.WriteString("---\n\n")
+	content.Write(post.body)
+
+	return content.Bytes(), notes, nil
+}
+
+// oldPostURL fills in a Hugo or Jekyll permalink pattern for post.
+func oldPostURL(pattern string, post *sitePost, date time.Time, categories []string) string {
+	if date.IsZero() && datePlaceholder.MatchString(pattern) {
+		return ""
+	}
+
+	var cats []string
+	for _, c := range categories {
+		cats = append(cats, slugify(c))
+	}
+
+	replacer := strings.NewReplacer(
+		":year", date.Format("2006"),
+		":month", date.Format("01"),
+		":day", date.Format("02"),
+		":section", post.section,
+		":categories", strings.Join(cats, "/"),
+		":slug", post.slug,
+		":title", post.slug,
+	)
+	u := replacer.Replace(pattern)
+	for strings.Contains(u, "//") {
+		u = strings.ReplaceAll(u, "//", "/")
+	}
+
+	return u
+}
+
+func frontString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		if len(v) > 0 {
+			return frontString(v[0])
+		}
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// frontStrings reads a list, or a Jekyll style space separated string.
+func frontStrings(v any) []string {
+	var values []string
+	switch v := v.(type) {
+	case nil:
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, item := range v {
+			if s := frontString(item); s != "" {
+				values = append(values, s)
+			}
+		}
+	default:
+		values = []string{fmt.Sprint(v)}
+	}
+
+	return values
+}
+
+func frontInt(v any) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+
+	return 0
+}
+
+func frontBool(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// siteDateLayouts are the date formats Hugo and Jekyll accept.
+var siteDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func frontDate(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case fmt.Stringer:
+		return frontDate(v.String())
+	case string:
+		for _, layout := range siteDateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func firstNonNil(values ...any) any {
+	for _, v := range values {
+		if v != nil && v != "" {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func firstOf(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// MenuEntry is a link in one of the site's menus.
+type MenuEntry struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Weight orders the menu, lightest first. Entries of equal weight
+	// keep the order they're defined in, those from posts coming after
+	// those from menu.yaml.
+	Weight int `yaml:"weight"`
+	// Lang limits the entry to pages in that language. Entries from
+	// menu.yaml are in every language.
+	Lang string `yaml:"-"`
+}
+
+// menuNames are the menus a post is listed in, from its Menu frontmatter:
+// a single name or a list of them.
+type menuNames []string
+
+func (names *menuNames) UnmarshalYAML(unmarshal func(any) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*names = menuNames{name}
+		return nil
+	}
+
+	var list []string
+	err := unmarshal(&list)
+	*names = list
+
+	return err
+}
+
+// Navigation holds the site's menus: those of the menus file, such as
+// header and footer, along with posts and pages listing themselves in a
+// menu with their Menu frontmatter. The header menu falls back to the nav
+// links of site.yaml.
+type Navigation struct {
+	file map[string][]MenuEntry
+
+	mu sync.RWMutex
+	// fromPosts are the entries of each store's posts by menu.
+	fromPosts map[PostStore]map[string][]MenuEntry
+}
+
+// loadNavigation reads the menus file at path. A missing file means no
+// menus besides those posts add.
+func loadNavigation(path string) (*Navigation, error) {
+	nav := &Navigation{fromPosts: map[PostStore]map[string][]MenuEntry{}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nav, nil
+	}
+	if err != nil {
+		return nav, err
+	}
+
+	err = yaml.UnmarshalStrict(b, &nav.file)
+	if err != nil {
+		return nav, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, entries := range nav.file {
+		for _, entry := range entries {
+			if entry.Name == "" || entry.URL == "" {
+				return nav, fmt.Errorf("%s: entries of menu %q need both a name and a url", path, name)
+			}
+		}
+	}
+
+	return nav, nil
+}
+
+// Watch keeps the menu entries of store's posts up to date, as of the time
+// clock tells at every reload.
+func (nav *Navigation) Watch(store PostStore, clock Clock) {
+	if store == nil {
+		return
+	}
+
+	store.OnReload(func(posts []PostData) {
+		now := clock.Now()
+		menus := map[string][]MenuEntry{}
+		for _, post := range posts {
+			// Drafts, scheduled and private posts would be listed only to
+			// lead nowhere. Scheduled ones are added when they go live,
+			// which runs the reload hooks.
+			if !post.Listed(now) {
+				continue
+			}
+
+			for _, name := range post.Menu {
+				menus[name] = append(menus[name], MenuEntry{
+					Name:   firstNonEmpty(post.MenuName, post.Title),
+					URL:    post.URL,
+					Weight: post.MenuWeight,
+					Lang:   post.Lang,
+				})
+			}
+		}
+
+		nav.mu.Lock()
+		nav.fromPosts[store] = menus
+		nav.mu.Unlock()
+	})
+}
+
+// Menus returns every menu as seen from a page in lang, sorted by weight.
+func (nav *Navigation) Menus(lang string, site SiteData) map[string][]MenuEntry {
+	menus := map[string][]MenuEntry{}
+	for name, entries := range nav.file {
+		menus[name] = append(menus[name], entries...)
+	}
+
+	nav.mu.RLock()
+	for _, fromStore := range nav.fromPosts {
+		for name, entries := range fromStore {
+			for _, entry := range entries {
+				if entry.Lang == "" || entry.Lang == lang {
+					menus[name] = append(menus[name], entry)
+				}
+			}
+		}
+	}
+	nav.mu.RUnlock()
+
+	if _, ok := menus["header"]; !ok {
+		for _, link := range site.Nav {
+			menus["header"] = append(menus["header"], MenuEntry{Name: link.Name, URL: link.URL})
+		}
+	}
+	for _, entries := range menus {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Weight < entries[j].Weight })
+	}
+
+	return menus
+}
+
+// NavigationMiddleware makes the menus available to siteData.
+func NavigationMiddleware(nav *Navigation) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Navigation", nav)
+		ctx.Next()
+	}
+}
+
+// Breadcrumb is a step of the trail from the home page to the current
+// page.
+type Breadcrumb struct {
+	Name string
+	URL  string
+	// Current marks the last crumb, the page itself.
+	Current bool
+}
+
+// setBreadcrumbs records the trail to the page being rendered, after the
+// home page, see SiteData.Breadcrumbs. The last crumb is the page itself.
+func setBreadcrumbs(ctx *gin.Context, crumbs ...Breadcrumb) {
+	ctx.Set("Breadcrumbs", crumbs)
+}
+
+// postBreadcrumbs is the trail to post: its section and category, if any.
+func postBreadcrumbs(post PostData) []Breadcrumb {
+	var crumbs []Breadcrumb
+	if post.Section != "" {
+		crumbs = append(crumbs, Breadcrumb{Name: post.Section, URL: langPrefix(post.Lang) + sectionPrefix(post.Section) + "/"})
+	}
+	if post.Category != "" {
+		crumbs = append(crumbs, Breadcrumb{Name: post.Category, URL: categoryURL(post.Category)})
+	}
+
+	return append(crumbs, Breadcrumb{Name: post.Title, URL: post.URL})
+}
+
+// breadcrumbList is the schema.org BreadcrumbList of crumbs, whose URLs
+// are absolute.
+func breadcrumbList(crumbs []Breadcrumb) map[string]any {
+	items := make([]map[string]any, len(crumbs))
+	for i, crumb := range crumbs {
+		items[i] = map[string]any{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     crumb.Name,
+			"item":     crumb.URL,
+		}
+	}
+
+	return map[string]any{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	}
+}
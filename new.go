@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// newPost creates a draft post from a title, go_blog new "My Post Title",
+// and opens it in $VISUAL or $EDITOR. The frontmatter is generated rather
+// than typed, so it is always valid YAML.
+func newPost(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	edit := flags.Bool("edit", true, "open the new post in $VISUAL or $EDITOR")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s new [-edit=false] title...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	title := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if title == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	slug := slugify(title)
+	if slug == "" {
+		return fmt.Errorf("can't make a slug of %q, the title needs some letters or digits", title)
+	}
+
+	front := yaml.MapSlice{
+		{Key: "Title", Value: title},
+		{Key: "Slug", Value: slug},
+		{Key: "Date", Value: time.Now().Format("2006-01-02 15:04")},
+		{Key: "Draft", Value: true},
+		{Key: "Description", Value: ""},
+		{Key: "Tags", Value: []string{}},
+	}
+	if cfg.Author != "" {
+		front = append(front, yaml.MapItem{Key: "author", Value: cfg.Author})
+	}
+
+	b, err := yaml.Marshal(front)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	content.WriteString("---\n")
+	content.Write(b)
+	content.WriteString("---\n\n")
+
+	file := filepath.Join(cfg.ContentDir, slug+".md")
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists", file)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(file)
+
+	editor := firstNonEmpty(os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+	if !*edit || editor == "" {
+		return nil
+	}
+
+	// The editor may come with arguments, such as "code --wait".
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], file)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"maps"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	_ "modernc.org/sqlite"
+)
+
+// Readers subscribe to the newsletter with double opt-in: POST /subscribe
+// stores the address unconfirmed and mails a confirmation link, and only
+// following it confirms the subscription. Every mail carries an
+// unsubscribe link with the same per-subscriber token.
+
+// Subscriber is an email address subscribed to the newsletter.
+type Subscriber struct {
+	Email string
+	// Token authenticates the confirmation and unsubscribe links.
+	Token     string
+	Confirmed bool
+	Created   time.Time
+}
+
+// SubscriberStore keeps newsletter subscribers in SQLite.
+type SubscriberStore struct {
+	db *sql.DB
+}
+
+// openSubscriberStore opens the database configured in cfg, or returns
+// nil when the newsletter is disabled.
+func openSubscriberStore(cfg NewsletterConfig) (*SubscriberStore, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "subscribers.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS subscribers (
+		email     TEXT PRIMARY KEY,
+		token     TEXT NOT NULL UNIQUE,
+		confirmed INTEGER NOT NULL,
+		created   INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SubscriberStore{db: db}, nil
+}
+
+// Subscribe adds an unconfirmed subscriber, or returns the existing one
+// if email is already subscribed.
+func (s *SubscriberStore) Subscribe(email string) (Subscriber, error) {
+	token, err := newSubscriberToken()
+	if err != nil {
+		return Subscriber{}, err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO subscribers (email, token, confirmed, created) VALUES (?, ?, 0, ?)
+		ON CONFLICT (email) DO NOTHING`, email, token, time.Now().Unix())
+	if err != nil {
+		return Subscriber{}, err
+	}
+
+	var sub Subscriber
+	var created int64
+	err = s.db.QueryRow(`SELECT email, token, confirmed, created FROM subscribers WHERE email = ?`, email).
+		Scan(&sub.Email, &sub.Token, &sub.Confirmed, &created)
+	sub.Created = time.Unix(created, 0).UTC()
+
+	return sub, err
+}
+
+// Confirm confirms the subscriber with the given token. ok is false if
+// there is none.
+func (s *SubscriberStore) Confirm(token string) (ok bool, err error) {
+	res, err := s.db.Exec(`UPDATE subscribers SET confirmed = 1 WHERE token = ?`, token)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Unsubscribe removes the subscriber with the given token. ok is false if
+// there is none.
+func (s *SubscriberStore) Unsubscribe(token string) (ok bool, err error) {
+	res, err := s.db.Exec(`DELETE FROM subscribers WHERE token = ?`, token)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Confirmed returns the confirmed subscribers, oldest first.
+func (s *SubscriberStore) Confirmed() ([]Subscriber, error) {
+	rows, err := s.db.Query(`SELECT email, token, confirmed, created FROM subscribers WHERE confirmed ORDER BY created, email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []Subscriber
+	for rows.Next() {
+		var sub Subscriber
+		var created int64
+		err = rows.Scan(&sub.Email, &sub.Token, &sub.Confirmed, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		sub.Created = time.Unix(created, 0).UTC()
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (s *SubscriberStore) Close() error {
+	return s.db.Close()
+}
+
+func newSubscriberToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+var errEmailInvalid = errors.New("invalid email address")
+
+// subscriberEmail validates a submitted address, accepting only a bare
+// address such as reader@example.com.
+func subscriberEmail(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	addr, err := mail.ParseAddress(input)
+	if err != nil || addr.Address != input || len(input) > 254 {
+		return "", errEmailInvalid
+	}
+
+	return strings.ToLower(input), nil
+}
+
+// SubscribeHandler accepts the subscribe form and mails a confirmation
+// link. Whether or not the address was already subscribed, the reader is
+// told to check their inbox, so the form can't be used to find out who
+// subscribed.
+func SubscribeHandler(subscribers *SubscriberStore) gin.HandlerFunc {
+	var limiter commentLimiter
+
+	return func(ctx *gin.Context) {
+		if ctx.PostForm("website") != "" {
+			subscribePage(ctx, http.StatusOK, "Almost done: check your inbox for a link to confirm your subscription.")
+			return
+		}
+
+		email, err := subscriberEmail(ctx.PostForm("email"))
+		if err != nil {
+			subscribePage(ctx, http.StatusBadRequest, "Please enter a valid email address.")
+			return
+		}
+
+		if !limiter.allow(ctx.ClientIP(), time.Now()) {
+			subscribePage(ctx, http.StatusTooManyRequests, "You're subscribing too fast, please wait a little.")
+			return
+		}
+
+		sub, err := subscribers.Subscribe(email)
+		if err != nil {
+			slog.Error("saving subscriber", "error", err)
+			subscribePage(ctx, http.StatusInternalServerError, "Your subscription couldn't be saved, please try again later.")
+			return
+		}
+
+		if !sub.Confirmed {
+			confirm := absoluteURL(ctx, "/subscribe/confirm?token="+sub.Token)
+			unsubscribe := absoluteURL(ctx, "/unsubscribe?token="+sub.Token)
+			title := siteData(ctx).Title
+			smtp := requestConfig(ctx).Newsletter.SMTP
+			// Mail servers can be slow; the reader shouldn't wait on them.
+			go func() {
+				err := sendConfirmation(smtp, title, email, confirm, unsubscribe)
+				if err != nil {
+					slog.Error("sending subscription confirmation", "error", err)
+				}
+			}()
+		}
+
+		subscribePage(ctx, http.StatusOK, "Almost done: check your inbox for a link to confirm your subscription.")
+	}
+}
+
+// ConfirmHandler confirms the subscription the emailed link is for.
+func ConfirmHandler(subscribers *SubscriberStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ok, err := subscribers.Confirm(ctx.Query("token"))
+		switch {
+		case err != nil:
+			slog.Error("confirming subscriber", "error", err)
+			subscribePage(ctx, http.StatusInternalServerError, "Your subscription couldn't be confirmed, please try again later.")
+		case !ok:
+			subscribePage(ctx, http.StatusNotFound, "This confirmation link is invalid or was already used to unsubscribe.")
+		default:
+			subscribePage(ctx, http.StatusOK, "Thanks, you're subscribed.")
+		}
+	}
+}
+
+// UnsubscribeHandler shows a button to unsubscribe on GET, so link
+// scanners following the emailed link don't unsubscribe anyone, and
+// unsubscribes on POST, which also serves one-click unsubscribing from
+// the List-Unsubscribe header.
+func UnsubscribeHandler(subscribers *SubscriberStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := ctx.Query("token")
+
+		if ctx.Request.Method == http.MethodGet {
+			renderHTML(ctx, http.StatusOK, "subscribe.html", gin.H{
+				"Title":   "Unsubscribe",
+				"Message": "Unsubscribe from the newsletter?",
+				"Token":   token,
+			})
+			return
+		}
+
+		ok, err := subscribers.Unsubscribe(token)
+		switch {
+		case err != nil:
+			slog.Error("unsubscribing", "error", err)
+			subscribePage(ctx, http.StatusInternalServerError, "You couldn't be unsubscribed, please try again later.")
+		case !ok:
+			subscribePage(ctx, http.StatusNotFound, "This unsubscribe link is invalid or you already unsubscribed.")
+		default:
+			subscribePage(ctx, http.StatusOK, "You're unsubscribed and won't get any more mail.")
+		}
+	}
+}
+
+func subscribePage(ctx *gin.Context, status int, message string) {
+	renderHTML(ctx, status, "subscribe.html", gin.H{
+		"Title":   "Newsletter",
+		"Message": message,
+	})
+}
+
+// AdminSubscribersHandler exports the confirmed subscribers as CSV.
+func AdminSubscribersHandler(subscribers *SubscriberStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		subs, err := subscribers.Confirmed()
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't load subscribers")
+			return
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"email", "subscribed"})
+		for _, sub := range subs {
+			_ = w.Write([]string{sub.Email, sub.Created.Format(time.RFC3339)})
+		}
+		w.Flush()
+
+		ctx.Header("Content-Disposition", `attachment; filename="subscribers.csv"`)
+		ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
+
+// sendConfirmation mails the link confirming a subscription.
+func sendConfirmation(cfg SMTPConfig, site, to, confirm, unsubscribe string) error {
+	body := fmt.Sprintf("Hi,\r\n\r\nplease confirm your subscription to %s by following this link:\r\n\r\n%s\r\n\r\n"+
+		"If you didn't subscribe, ignore this mail and you won't hear from us again.\r\n\r\n"+
+		"Unsubscribe: %s\r\n", site, confirm, unsubscribe)
+
+	return sendMail(cfg, to, "Confirm your subscription to "+site, body, map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribe + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	})
+}
+
+// sendMail sends a mail through the configured SMTP server, with extra
+// headers such as List-Unsubscribe. It's plain text unless header sets
+// another Content-Type, such as the digest's HTML.
+func sendMail(cfg SMTPConfig, to, subject, body string, header map[string]string) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("smtp.from: %w", err)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mimeHeader(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	header = maps.Clone(header)
+	if header["Content-Type"] == "" {
+		header["Content-Type"] = "text/plain; charset=utf-8"
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, header[name])
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	// Quoted-printable keeps lines within SMTP's limit, which rendered
+	// HTML easily goes past.
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	_, err = qp.Write([]byte(body))
+	if err == nil {
+		err = qp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	return smtp.SendMail(addr, auth, from.Address, []string{to}, []byte(msg.String()))
+}
+
+// mimeHeader encodes a header value that isn't plain ASCII.
+func mimeHeader(value string) string {
+	for _, r := range value {
+		if r > 127 {
+			return mime.QEncoding.Encode("utf-8", value)
+		}
+	}
+
+	return value
+}
+
+// subscribeForm renders the subscribe_form.html partial for the page's
+// site data, or nothing while enabled, newsletter.enabled, is false. It
+// goes through the engine's renderer so a theme's or site's version of the
+// partial is used, and so is picked up on reload in dev mode.
+func subscribeForm(route *gin.Engine, enabled bool) func(SiteData) (template.HTML, error) {
+	return func(site SiteData) (template.HTML, error) {
+		if !enabled {
+			return "", nil
+		}
+
+		instance, ok := route.HTMLRender.Instance("subscribe_form.html", site).(render.HTML)
+		if !ok {
+			return "", errors.New("subscribe form: unexpected HTML renderer")
+		}
+
+		var buf bytes.Buffer
+		err := instance.Template.ExecuteTemplate(&buf, "subscribe_form.html", site)
+
+		return template.HTML(buf.String()), err
+	}
+}
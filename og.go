@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Social cards are the size Open Graph and Twitter recommend.
+const (
+	ogWidth    = 1200
+	ogHeight   = 630
+	ogMargin   = 80
+	ogMaxLines = 4
+)
+
+var (
+	ogTitleFont  = mustParseFont(gobold.TTF)
+	ogFooterFont = mustParseFont(goregular.TTF)
+
+	ogBackground = color.RGBA{0x11, 0x18, 0x27, 0xff}
+	ogAccent     = color.RGBA{0x38, 0xbd, 0xf8, 0xff}
+	// ogShade darkens templates so the text stays readable on them.
+	ogShade = color.RGBA{0, 0, 0, 0x99}
+)
+
+func mustParseFont(ttf []byte) *opentype.Font {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+// ogImageURL is the path of post's generated social card.
+func ogImageURL(post PostData) string {
+	return langPrefix(post.Lang) + "/og/" + post.Slug + ".png"
+}
+
+// OGImageHandler serves the social card of the post /og/<slug>.png names,
+// generating it into the image cache directory on first request. Cards
+// are named after what they show, so they're made again when that
+// changes.
+func OGImageHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		slug, ok := strings.CutSuffix(ctx.Param("file"), ".png")
+		if !ok {
+			notFound(ctx, "Image not found")
+			return
+		}
+		// Cards of private posts would be cached publicly.
+		post, ok := visiblePost(ctx, store, slug)
+		if !ok || post.Private() {
+			notFound(ctx, "Image not found")
+			return
+		}
+
+		site := siteData(ctx)
+		cached, err := ensureOGImage(requestConfig(ctx).Images, post, site.Title)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't generate image")
+			return
+		}
+
+		ctx.Header("Cache-Control", "public, max-age=86400")
+		http.ServeFile(ctx.Writer, ctx.Request, cached)
+	}
+}
+
+// ensureOGImage returns the path of post's social card as cfg has it made,
+// generating it unless it's cached already.
+func ensureOGImage(cfg ImagesConfig, post PostData, siteTitle string) (string, error) {
+	var templateMod string
+	if cfg.OGTemplate != "" {
+		info, err := os.Stat(cfg.OGTemplate)
+		if err != nil {
+			return "", err
+		}
+		templateMod = info.ModTime().String()
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{post.Title, post.Author.Name, siteTitle, cfg.OGTemplate, templateMod}, "\x00")))
+	cached := filepath.Join(cfg.CacheDir, "og", post.Lang, post.Slug+"-"+hex.EncodeToString(sum[:8])+".png")
+
+	imageMu.Lock()
+	defer imageMu.Unlock()
+
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	img, err := drawOGImage(cfg.OGTemplate, post.Title, post.Author.Name, siteTitle)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return "", fmt.Errorf("encoding %s: %w", cached, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(cached), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	return cached, writeFileAtomic(cached, buf.Bytes())
+}
+
+// drawOGImage draws a social card: the title in large type over the
+// image file template or a plain background, with the author and site
+// name below.
+func drawOGImage(template, title, author, siteTitle string) (image.Image, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, ogWidth, ogHeight))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(ogBackground), image.Point{}, draw.Src)
+
+	if template != "" {
+		background, err := decodeImageFile(template)
+		if err != nil {
+			return nil, err
+		}
+		drawCover(dst, background)
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(ogShade), image.Point{}, draw.Over)
+	}
+	draw.Draw(dst, image.Rect(0, 0, 16, ogHeight), image.NewUniform(ogAccent), image.Point{}, draw.Src)
+
+	titleFace, err := opentype.NewFace(ogTitleFont, &opentype.FaceOptions{Size: 64, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	footerFace, err := opentype.NewFace(ogFooterFont, &opentype.FaceOptions{Size: 32, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer footerFace.Close()
+
+	d := &font.Drawer{Dst: dst, Src: image.White, Face: titleFace}
+	lineHeight := titleFace.Metrics().Height.Ceil() + 8
+	y := ogMargin + titleFace.Metrics().Ascent.Ceil()
+	for _, line := range wrapText(d, title, ogWidth-2*ogMargin, ogMaxLines) {
+		d.Dot = fixed.P(ogMargin, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+
+	footer := siteTitle
+	if author != "" {
+		footer = author + " · " + siteTitle
+	}
+	d = &font.Drawer{Dst: dst, Src: image.NewUniform(ogAccent), Face: footerFace}
+	d.Dot = fixed.P(ogMargin, ogHeight-ogMargin)
+	d.DrawString(footer)
+
+	return dst, nil
+}
+
+// wrapText breaks text into at most maxLines lines fitting in width when
+// drawn with d, ending the last one with an ellipsis when text doesn't fit.
+func wrapText(d *font.Drawer, text string, width, maxLines int) []string {
+	fits := func(s string) bool { return d.MeasureString(s).Ceil() <= width }
+
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line == "" || fits(line+" "+word) {
+			line = strings.TrimPrefix(line+" "+word, " ")
+			continue
+		}
+
+		lines = append(lines, line)
+		line = word
+		if len(lines) == maxLines {
+			last := lines[maxLines-1]
+			for !fits(last+"…") && strings.Contains(last, " ") {
+				last = last[:strings.LastIndexByte(last, ' ')]
+			}
+			lines[maxLines-1] = last + "…"
+			return lines
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// drawCover scales src to cover dst, cropping what overflows.
+func drawCover(dst *image.RGBA, src image.Image) {
+	sb, db := src.Bounds(), dst.Bounds()
+	if sb.Empty() {
+		return
+	}
+
+	// Crop src to dst's aspect ratio, around its center.
+	crop := sb
+	if sb.Dx()*db.Dy() > sb.Dy()*db.Dx() {
+		w := sb.Dy() * db.Dx() / db.Dy()
+		crop.Min.X += (sb.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := sb.Dx() * db.Dy() / db.Dx()
+		crop.Min.Y += (sb.Dy() - h) / 2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	draw.CatmullRom.Scale(dst, db, src, crop, draw.Src, nil)
+}
+
+// decodeImageFile decodes the image at path.
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// ogImagePaths lists the social cards of posts, for static builds.
+func ogImagePaths(posts []PostData) []string {
+	var paths []string
+	for _, post := range posts {
+		if post.MetaImage == "" {
+			paths = append(paths, ogImageURL(post))
+		}
+	}
+
+	return paths
+}
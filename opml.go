@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type opml struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Created string        `xml:"head>dateCreated,omitempty"`
+	Outline []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Text    string        `xml:"text,attr"`
+	Type    string        `xml:"type,attr,omitempty"`
+	XMLURL  string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL string        `xml:"htmlUrl,attr,omitempty"`
+	Outline []opmlOutline `xml:"outline,omitempty"`
+}
+
+// OPMLHandler lists the blog's RSS feeds as OPML, for subscribing to
+// several at once: the main feed, those of every language and section, and
+// one per tag and per author.
+func OPMLHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		site := siteData(ctx)
+		// feed outlines the feed at prefix+"/feed.xml", listing the posts
+		// of the page at home.
+		feed := func(text, prefix, home string) opmlOutline {
+			return opmlOutline{
+				Text:    text,
+				Type:    "rss",
+				XMLURL:  absoluteURL(ctx, prefix+"/feed.xml"),
+				HTMLURL: absoluteURL(ctx, home),
+			}
+		}
+
+		doc := opml{
+			Version: "2.0",
+			Title:   site.Title,
+			Created: time.Now().UTC().Format(time.RFC1123Z),
+			Outline: []opmlOutline{feed(site.Title, "", "/")},
+		}
+
+		for _, lang := range cfg.Languages {
+			doc.Outline = append(doc.Outline, feed(site.Title+" ("+lang+")", langPrefix(lang), langPrefix(lang)+"/"))
+		}
+		for _, section := range cfg.Sections {
+			doc.Outline = append(doc.Outline, feed(site.Title+" /"+section, sectionPrefix(section), sectionPrefix(section)+"/"))
+		}
+
+		posts := visiblePosts(ctx, store)
+		tags := tagCounts(posts)
+		if len(tags) > 0 {
+			outline := opmlOutline{Text: "Tags"}
+			for _, tag := range tags {
+				outline.Outline = append(outline.Outline, feed(site.Title+" #"+tag.Name, tagURL(tag.Name), tagURL(tag.Name)))
+			}
+			doc.Outline = append(doc.Outline, outline)
+		}
+
+		authors := opmlOutline{Text: "Authors"}
+		seen := map[string]bool{}
+		for _, post := range posts {
+			if url := post.Author.URL(); url != "" && !seen[url] {
+				seen[url] = true
+				authors.Outline = append(authors.Outline, feed(site.Title+": "+post.Author.Name, url, url))
+			}
+		}
+		if len(authors.Outline) > 0 {
+			doc.Outline = append(doc.Outline, authors)
+		}
+
+		writeXML(ctx, "text/x-opml; charset=utf-8", doc)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PageMeta is what the <head> of a page tells search engines and feed
+// readers about it, rendered by head.html: its canonical URL, its
+// neighbours in a sequence of pages and the feeds of its posts. Every
+// page gets it with SiteData, handlers filling in what differs from the
+// defaults with setCanonical, setPrevNext and addFeeds.
+type PageMeta struct {
+	// Canonical is the absolute URL of the page, without its query by
+	// default.
+	Canonical string
+	// Prev and Next are the absolute URLs of the pages before and after
+	// this one, such as the pages of the index.
+	Prev, Next string
+	// Feeds are the feeds offered for autodiscovery: the page's own, if
+	// any, then those of the blog, or of its language and section.
+	Feeds []FeedLink
+}
+
+// FeedLink is a feed in one of the formats the blog serves.
+type FeedLink struct {
+	Title string
+	Type  string
+	URL   string
+}
+
+// feedLinks returns the enabled feeds under prefix, such as /tags/go,
+// titled title.
+func feedLinks(ctx *gin.Context, title, prefix string) []FeedLink {
+	var links []FeedLink
+	for _, f := range enabledFeeds(requestConfig(ctx)) {
+		links = append(links, FeedLink{Title: title, Type: f.mediaType, URL: absoluteURL(ctx, prefix+f.file)})
+	}
+
+	return links
+}
+
+// setCanonical records the canonical URL of the page being rendered, a
+// site path or an absolute URL, see PageMeta.Canonical. An empty url
+// leaves it out, as for error pages.
+func setCanonical(ctx *gin.Context, url string) {
+	ctx.Set("Canonical", url)
+}
+
+// setPrevNext records the site paths of the pages before and after the
+// one being rendered, either of which may be empty.
+func setPrevNext(ctx *gin.Context, prev, next string) {
+	ctx.Set("PrevPage", prev)
+	ctx.Set("NextPage", next)
+}
+
+// addFeeds offers the feeds under prefix along with the blog's on the
+// page being rendered.
+func addFeeds(ctx *gin.Context, title, prefix string) {
+	ctx.Set("Feeds", feedLinks(ctx, title, prefix))
+}
+
+// pageMeta returns the PageMeta of the page being rendered, titling the
+// blog's feeds with the site's title.
+func pageMeta(ctx *gin.Context, title string) PageMeta {
+	var meta PageMeta
+
+	meta.Canonical = ctx.Request.URL.Path
+	if canonical, ok := ctx.Get("Canonical"); ok {
+		meta.Canonical = canonical.(string)
+	}
+	if strings.HasPrefix(meta.Canonical, "/") {
+		meta.Canonical = absoluteURL(ctx, meta.Canonical)
+	}
+
+	if prev := ctx.GetString("PrevPage"); prev != "" {
+		meta.Prev = absoluteURL(ctx, prev)
+	}
+	if next := ctx.GetString("NextPage"); next != "" {
+		meta.Next = absoluteURL(ctx, next)
+	}
+
+	if feeds, ok := ctx.Get("Feeds"); ok {
+		meta.Feeds = feeds.([]FeedLink)
+	}
+	meta.Feeds = append(meta.Feeds, feedLinks(ctx, title, requestPrefix(ctx))...)
+
+	return meta
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// hasFeedLink reports whether page has an autodiscovery link to the feed
+// of mediaType, such as application/rss+xml, at url.
+func hasFeedLink(page, mediaType, url string) bool {
+	mediaType = strings.ReplaceAll(mediaType, "+", "&#43;")
+	for _, line := range strings.Split(page, "\n") {
+		if strings.Contains(line, `<link rel="alternate" type="`+mediaType+`"`) && strings.Contains(line, `href="`+url+`"`) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestFeedAutodiscovery(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	index := get(route, "/").Body.String()
+	if !hasFeedLink(index, "application/rss+xml", "https://blog.example/feed.xml") {
+		t.Error("the index doesn't link the RSS feed")
+	}
+
+	tag := get(route, "/tags/go").Body.String()
+	if !hasFeedLink(tag, "application/rss+xml", "https://blog.example/tags/go/feed.xml") {
+		t.Error("the tag page doesn't link the tag's RSS feed")
+	}
+	if !hasFeedLink(tag, "application/rss+xml", "https://blog.example/feed.xml") {
+		t.Error("the tag page doesn't link the blog's RSS feed")
+	}
+}
+
+func TestFeedAutodiscoveryOnlyEnabled(t *testing.T) {
+	route := newTestRouter(t, func(cfg *Config) { cfg.Feeds = []string{"rss"} })
+
+	for _, path := range []string{"/", "/tags/go"} {
+		page := get(route, path).Body.String()
+		if strings.Contains(page, "application/atom&#43;xml") || strings.Contains(page, "application/feed&#43;json") {
+			t.Errorf("GET %s advertises a feed that's switched off", path)
+		}
+		if !hasFeedLink(page, "application/rss+xml", "https://blog.example/feed.xml") {
+			t.Errorf("GET %s doesn't link the RSS feed", path)
+		}
+	}
+
+	for _, path := range []string{"/atom.xml", "/feed.json", "/tags/go/atom.xml"} {
+		if w := get(route, path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestFeedsValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Feeds = []string{"rss", "rdf"}
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted an unknown feed format")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewPageStore loads the standalone pages in dir, such as about.md, which
+// are written like posts but served at /about, in every language's prefix
+// on multilingual sites, and never listed. It returns nil when dir doesn't
+// exist, as pages are optional.
+func NewPageStore(dir string, renderer *MarkdownRenderer) (*ContentStore, error) {
+	_, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	store := &ContentStore{source: dirSource{dir: dir}, renderer: renderer, pages: true, stop: make(chan struct{})}
+	err = store.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// optionalStore returns store as a PostStore, nil rather than a nil
+// *ContentStore without a pages directory, so nil checks still work.
+func optionalStore(store *ContentStore) PostStore {
+	if store == nil {
+		return nil
+	}
+
+	return store
+}
+
+// pageURL returns the path of a standalone page.
+func pageURL(page PostData) string {
+	return langPrefix(page.Lang) + "/" + page.Slug
+}
+
+// PageHandler renders the standalone page the request's path names, with
+// the page.html template or the one its Layout frontmatter picks. It runs
+// for requests no route matched, as pages can come and go without routes
+// changing, and leaves requests for anything else to the next handler.
+func PageHandler(pages PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		if pages == nil || ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			return
+		}
+
+		lang := cfg.DefaultLanguage
+		slug := strings.TrimPrefix(ctx.Request.URL.Path, "/")
+		if first, rest, ok := strings.Cut(slug, "/"); ok && cfg.multilingual() && slices.Contains(cfg.Languages, first) {
+			lang, slug = first, rest
+			ctx.Set("Lang", lang)
+		}
+		if !validSlug(slug) {
+			return
+		}
+
+		page, ok := pages.GetLang(lang, slug)
+		if !ok || !(page.Published(requestTime(ctx)) || previewing(ctx)) {
+			return
+		}
+		if !canRead(ctx, page) {
+			lockedPage(ctx, page)
+			ctx.Abort()
+			return
+		}
+		if page.Private() {
+			ctx.Header("Cache-Control", "private, no-store")
+		}
+
+		if !renderPosts(ctx, page) {
+			return
+		}
+
+		setLastModified(ctx, page)
+		setAlternates(ctx, page.Translations)
+		data := newPostPage(ctx, page)
+		data.Standalone = true
+		renderHTML(ctx, http.StatusOK, layoutTemplate(cfg, page.Layout, "page.html"), data)
+		ctx.Abort()
+	}
+}
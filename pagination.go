@@ -0,0 +1,46 @@
+package main
+
+import "strconv"
+
+// Pagination describes one page of a paginated listing for templates.
+type Pagination struct {
+	Page       int
+	TotalPages int
+	PrevURL    string
+	NextURL    string
+}
+
+// paginate returns the posts on page (counting from 1) along with links to
+// the neighbouring pages. ok is false when page is out of range; page 1 of
+// an empty listing is always valid.
+func paginate(posts []PostData, page, size int, pageURL func(int) string) (pagePosts []PostData, p Pagination, ok bool) {
+	total := (len(posts) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	if page < 1 || page > total {
+		return nil, p, false
+	}
+
+	start := (page - 1) * size
+	end := min(start+size, len(posts))
+
+	p = Pagination{Page: page, TotalPages: total}
+	if page > 1 {
+		p.PrevURL = pageURL(page - 1)
+	}
+	if page < total {
+		p.NextURL = pageURL(page + 1)
+	}
+
+	return posts[start:end], p, true
+}
+
+// indexPageURL returns the path of an index page; the first page is "/".
+func indexPageURL(page int) string {
+	if page == 1 {
+		return "/"
+	}
+
+	return "/page/" + strconv.Itoa(page)
+}
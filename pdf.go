@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PDFRenderer prints a page of the blog to PDF.
+type PDFRenderer interface {
+	PrintPDF(ctx context.Context, url string) ([]byte, error)
+}
+
+// chromeCandidates are the names headless Chrome is looked up by when
+// pdf.chrome isn't set.
+var chromeCandidates = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// chromePDF prints pages with headless Chrome, which uses the print
+// stylesheet like readers printing the page themselves would.
+type chromePDF struct {
+	path    string
+	timeout time.Duration
+	// tls is set when the blog serves TLS, see TLSConfig.
+	tls bool
+}
+
+func (c chromePDF) PrintPDF(ctx context.Context, url string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "blog-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	out := filepath.Join(dir, "page.pdf")
+	args := []string{"--headless", "--disable-gpu", "--no-pdf-header-footer", "--user-data-dir=" + dir, "--print-to-pdf=" + out}
+	if os.Geteuid() == 0 {
+		// Chrome refuses to run as root with its sandbox, as in most
+		// containers.
+		args = append(args, "--no-sandbox")
+	}
+	if c.tls {
+		// The loopback address isn't what the certificate is for.
+		args = append(args, "--ignore-certificate-errors")
+	}
+
+	output, err := exec.CommandContext(ctx, c.path, append(args, url)...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", c.path, err, output)
+	}
+
+	return os.ReadFile(out)
+}
+
+var (
+	chromeMu sync.Mutex
+	// chromePaths caches where Chrome was found by pdf.chrome, empty
+	// when it wasn't.
+	chromePaths = map[string]string{}
+	// pdfMu serializes printing, as every print starts a browser.
+	pdfMu sync.Mutex
+)
+
+// findChrome returns the path of chrome, or of the first of the
+// chromeCandidates found when chrome is empty. It is looked up once.
+func findChrome(chrome string) string {
+	chromeMu.Lock()
+	defer chromeMu.Unlock()
+
+	if path, ok := chromePaths[chrome]; ok {
+		return path
+	}
+
+	candidates := chromeCandidates
+	if chrome != "" {
+		candidates = []string{chrome}
+	}
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			chromePaths[chrome] = path
+			return path
+		}
+	}
+
+	slog.Warn("no Chrome found for printing PDFs, readers are offered the print dialog instead", "chrome", chrome)
+	chromePaths[chrome] = ""
+
+	return ""
+}
+
+// postPDFRenderer returns the PDF renderer cfg configures, or nil when
+// PDFs are disabled or Chrome can't be found.
+func postPDFRenderer(cfg *Config) PDFRenderer {
+	if !cfg.PDF.Enabled {
+		return nil
+	}
+	path := findChrome(cfg.PDF.Chrome)
+	if path == "" {
+		return nil
+	}
+
+	return chromePDF{path: path, timeout: time.Duration(cfg.PDF.Timeout), tls: len(cfg.TLS.Hosts) > 0}
+}
+
+// pdfAvailable reports whether posts of the blog cfg configures can be
+// downloaded as PDF, for templates choosing between a download and a
+// print link.
+func pdfAvailable(cfg *Config) func() bool {
+	return func() bool {
+		return postPDFRenderer(cfg) != nil
+	}
+}
+
+// servePDF answers with post printed to PDF, printing it unless it's
+// cached already. Without a PDF renderer, the reader is sent to the post
+// with ?print, which opens the browser's print dialog instead, as are
+// readers of private posts, which Chrome couldn't see.
+func servePDF(ctx *gin.Context, post PostData) {
+	cfg := requestConfig(ctx)
+	renderer := postPDFRenderer(cfg)
+	if renderer == nil || post.Private() {
+		ctx.Redirect(http.StatusFound, post.URL+"?print")
+		return
+	}
+	if !post.Published(requestTime(ctx)) {
+		// Chrome's request wouldn't see it.
+		notFound(ctx, "Post not found")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(post.File + "\x00" + post.ModTime.String()))
+	cached := filepath.Join(cfg.Images.CacheDir, "pdf", post.Lang, post.Slug+"-"+hex.EncodeToString(sum[:8])+".pdf")
+
+	err := ensurePDF(ctx.Request.Context(), renderer, cached, loopbackURL(cfg)+post.URL)
+	if err != nil {
+		ctx.Error(err)
+		ctx.String(http.StatusInternalServerError, "Couldn't print the post")
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, post.Slug))
+	http.ServeFile(ctx.Writer, ctx.Request, cached)
+}
+
+func ensurePDF(ctx context.Context, renderer PDFRenderer, cached, url string) error {
+	pdfMu.Lock()
+	defer pdfMu.Unlock()
+
+	if _, err := os.Stat(cached); err == nil {
+		return nil
+	}
+
+	b, err := renderer.PrintPDF(ctx, url)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return errors.New("printing " + url + " gave an empty PDF")
+	}
+
+	err = os.MkdirAll(filepath.Dir(cached), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(cached, b)
+}
+
+// loopbackURL is where the blog cfg serves can request its own pages.
+func loopbackURL(cfg *Config) string {
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return "http://" + cfg.Addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if len(cfg.TLS.Hosts) > 0 {
+		scheme = "https"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// itunesNS is the namespace of the iTunes podcast tags in RSS feeds.
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// Episode is the audio of a post that's a podcast episode, from its Audio
+// frontmatter. The post page plays it, and feeds enclose it.
+type Episode struct {
+	// File is the audio's absolute URL or a site path such as
+	// /static/audio/episode-1.mp3.
+	File string `yaml:"File"`
+	// Duration is how long it plays, as 1:02:03, 45:10 or seconds.
+	Duration string `yaml:"Duration"`
+	Episode  int    `yaml:"Episode"`
+	Season   int    `yaml:"Season"`
+	// Length is the file's size in bytes, looked up for files under
+	// /static/.
+	Length int64 `yaml:"Length"`
+	// Type is the file's MIME type, guessed from its extension if empty.
+	Type string `yaml:"Type"`
+}
+
+// MIMEType is the type of the episode's file.
+func (e Episode) MIMEType() string {
+	if e.Type != "" {
+		return e.Type
+	}
+
+	switch ext := strings.ToLower(path.Ext(e.File)); ext {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".m4a":
+		return "audio/mp4"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+
+	return "audio/mpeg"
+}
+
+// size is the length of the episode's file, its Length or else the size
+// of the static file, or 0 when unknown.
+func (e Episode) size(cfg *Config) int64 {
+	if e.Length > 0 {
+		return e.Length
+	}
+
+	name, ok := strings.CutPrefix(e.File, "/static/")
+	if !ok {
+		return 0
+	}
+	info, err := fs.Stat(staticFS(cfg), name)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// seconds is the episode's Duration in seconds, as iTunes wants it.
+func (e Episode) seconds() (int, error) {
+	var total int
+	for _, field := range strings.Split(e.Duration, ":") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return 0, errors.New("malformed duration")
+		}
+		total = total*60 + n
+	}
+
+	return total, nil
+}
+
+// Podcast describes the blog in the iTunes tags of its RSS feeds, for
+// podcast apps, which list its posts with Audio as episodes.
+type Podcast struct {
+	Author string `yaml:"author"`
+	// Email is the owner's, which podcast directories contact.
+	Email string `yaml:"email"`
+	// Image is the cover art, an absolute URL or a site path. Apple
+	// requires it square and at least 1400 pixels wide.
+	Image string `yaml:"image"`
+	// Category is one of Apple's, such as Technology.
+	Category string `yaml:"category"`
+	Explicit bool   `yaml:"explicit"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type itunesCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+type itunesOwner struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// setPodcast adds the iTunes tags of site's podcast to channel.
+func setPodcast(ctx *gin.Context, channel *rssChannel, podcast Podcast) {
+	channel.ItunesAuthor = podcast.Author
+	channel.ItunesExplicit = strconv.FormatBool(podcast.Explicit)
+	if podcast.Image != "" {
+		image := podcast.Image
+		if strings.HasPrefix(image, "/") {
+			image = absoluteURL(ctx, image)
+		}
+		channel.ItunesImage = &itunesImage{Href: image}
+	}
+	if podcast.Category != "" {
+		channel.ItunesCategory = &itunesCategory{Text: podcast.Category}
+	}
+	if podcast.Email != "" {
+		channel.ItunesOwner = &itunesOwner{Name: podcast.Author, Email: podcast.Email}
+	}
+}
+
+// episodeURL is the absolute URL of the episode's file.
+func episodeURL(ctx *gin.Context, episode Episode) string {
+	if strings.HasPrefix(episode.File, "/") {
+		return absoluteURL(ctx, episode.File)
+	}
+
+	return episode.File
+}
+
+// setEpisode adds the enclosure and iTunes tags of episode to item.
+func setEpisode(ctx *gin.Context, item *rssItem, episode Episode) {
+	item.Enclosure = &rssEnclosure{URL: episodeURL(ctx, episode), Length: episode.size(requestConfig(ctx)), Type: episode.MIMEType()}
+
+	if seconds, err := episode.seconds(); err == nil && episode.Duration != "" {
+		item.ItunesDuration = strconv.Itoa(seconds)
+	}
+	item.ItunesEpisode = episode.Episode
+	item.ItunesSeason = episode.Season
+}
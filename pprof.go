@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pprofRoute is where the profiles are served, the same as with the
+// net/http/pprof defaults so `go tool pprof` finds them.
+const pprofRoute = "/debug/pprof/*name"
+
+// PprofHandler serves the runtime profiles of net/http/pprof at
+// pprofRoute. Like metrics, they need token as a bearer token when set.
+func PprofHandler(token string) gin.HandlerFunc {
+	want := []byte("Bearer " + token)
+
+	return func(ctx *gin.Context) {
+		got := []byte(ctx.GetHeader("Authorization"))
+		if token != "" && subtle.ConstantTimeCompare(got, want) != 1 {
+			ctx.Header("WWW-Authenticate", `Bearer realm="pprof"`)
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		ctx.Header("Cache-Control", "no-store")
+		switch ctx.Param("name") {
+		case "/cmdline":
+			pprof.Cmdline(ctx.Writer, ctx.Request)
+		case "/profile":
+			pprof.Profile(ctx.Writer, ctx.Request)
+		case "/symbol":
+			pprof.Symbol(ctx.Writer, ctx.Request)
+		case "/trace":
+			pprof.Trace(ctx.Writer, ctx.Request)
+		default:
+			pprof.Index(ctx.Writer, ctx.Request)
+		}
+	}
+}
+
+// pprofServer serves only the profiles on addr, such as localhost:6060,
+// for keeping them off the public listener. Its write timeout leaves room
+// for CPU profiles and traces of up to a minute.
+func pprofServer(addr, token string) *http.Server {
+	route := gin.New()
+	route.Use(gin.Recovery())
+	route.Any(pprofRoute, PprofHandler(token))
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           route,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      90 * time.Second,
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestPprofValidate(t *testing.T) {
+	for _, tt := range []struct {
+		token, addr string
+		valid       bool
+	}{
+		{"", "", false},
+		{"", ":6060", false},
+		{"", "0.0.0.0:6060", false},
+		{"", "192.0.2.1:6060", false},
+		{"", "127.0.0.1:6060", true},
+		{"", "[::1]:6060", true},
+		{"", "localhost:6060", true},
+		{"secret", "", true},
+		{"secret", ":6060", true},
+	} {
+		cfg := defaultConfig()
+		cfg.Pprof = PprofConfig{Enabled: true, Token: tt.token, Addr: tt.addr}
+		if err := cfg.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate with token %q and addr %q = %v, want valid %t", tt.token, tt.addr, err, tt.valid)
+		}
+	}
+}
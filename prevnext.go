@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxNeighbours is the number of posts on either side of a post kept as
+// candidates for its previous and next ones.
+const maxNeighbours = 3
+
+// computePrevNext fills in the posts before and after every post by date,
+// among the posts of its language and section: readers paging through
+// the blog stay in the section they started in. Drafts, private and
+// undated posts are left out; posts scheduled for later are kept, with a
+// few spare candidates so hiding them at request time still leaves a
+// neighbour, see neighbour.
+func computePrevNext(posts []PostData) {
+	type group struct{ lang, section string }
+	groups := map[group][]int{}
+	for i, post := range posts {
+		if post.Draft || post.Private() || post.Date.IsZero() {
+			continue
+		}
+
+		key := group{post.Lang, post.Section}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, indexes := range groups {
+		sort.Slice(indexes, func(a, b int) bool {
+			pa, pb := posts[indexes[a]], posts[indexes[b]]
+			if !pa.Date.Equal(pb.Date) {
+				return pa.Date.Before(pb.Date)
+			}
+			return pa.Slug < pb.Slug
+		})
+
+		for at, i := range indexes {
+			older := make([]PostSummary, 0, maxNeighbours)
+			for j := at - 1; j >= 0 && len(older) < maxNeighbours; j-- {
+				older = append(older, summarize(posts[indexes[j]]))
+			}
+			newer := make([]PostSummary, 0, maxNeighbours)
+			for j := at + 1; j < len(indexes) && len(newer) < maxNeighbours; j++ {
+				newer = append(newer, summarize(posts[indexes[j]]))
+			}
+
+			posts[i].older = older
+			posts[i].newer = newer
+		}
+	}
+}
+
+// neighbour returns the nearest of candidates the request may see, or nil
+// if it may see none of them.
+func neighbour(ctx *gin.Context, store PostStore, candidates []PostSummary) *PostSummary {
+	visible := visibleSummaries(ctx, store, candidates, 1)
+	if len(visible) == 0 {
+		return nil
+	}
+
+	return &visible[0]
+}
+
+// summaryURL is the URL of summary, or "" without one.
+func summaryURL(summary *PostSummary) string {
+	if summary == nil {
+		return ""
+	}
+
+	return summary.URL
+}
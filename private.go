@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Posts with Visibility: private or a Password are private: they're left
+// out of every listing, feed and the sitemap, and only shown to readers
+// logged in at /login with the admin credentials, or who entered the
+// post's password. Both are remembered with signed cookies.
+
+const (
+	// sessionCookie holds the login session.
+	sessionCookie = "session"
+	// unlockCookiePrefix starts the names of the cookies remembering the
+	// password of a post.
+	unlockCookiePrefix = "unlock_"
+)
+
+// Private reports whether post is only shown to readers who may read it,
+// see canRead.
+func (post PostData) Private() bool {
+	return strings.EqualFold(post.Visibility, "private") || post.Password != ""
+}
+
+// Listed reports whether post is shown in listings, feeds and the sitemap
+// at now: it's published and not private.
+func (post PostData) Listed(now time.Time) bool {
+	return post.Published(now) && !post.Private()
+}
+
+// canRead reports whether the request may see post: it isn't private, or
+// the reader is logged in or previewing, or entered its password.
+func canRead(ctx *gin.Context, post PostData) bool {
+	if !post.Private() || previewing(ctx) || loggedIn(ctx) {
+		return true
+	}
+	if post.Password == "" {
+		return false
+	}
+
+	cookie, err := ctx.Cookie(unlockCookieName(post))
+	return err == nil && verifyCookie(requestConfig(ctx).Private.Secret, cookie, unlockPayload(post))
+}
+
+// passwordHash is the SHA-256 of post's password, which may be given in
+// the frontmatter as is or as sha256:<hex> to keep it out of the file.
+func passwordHash(post PostData) []byte {
+	if hexHash, ok := strings.CutPrefix(post.Password, "sha256:"); ok {
+		if sum, err := hex.DecodeString(hexHash); err == nil && len(sum) == sha256.Size {
+			return sum
+		}
+	}
+
+	sum := sha256.Sum256([]byte(post.Password))
+	return sum[:]
+}
+
+// unlockCookieName is the cookie remembering the password of post. Every
+// post has its own, so unlocking one doesn't unlock the others.
+func unlockCookieName(post PostData) string {
+	sum := sha256.Sum256([]byte(post.URL))
+	return unlockCookiePrefix + hex.EncodeToString(sum[:8])
+}
+
+// unlockPayload is what unlock cookies sign. It includes the password, so
+// changing it locks readers out again.
+func unlockPayload(post PostData) string {
+	return "unlock\x00" + post.URL + "\x00" + hex.EncodeToString(passwordHash(post))
+}
+
+// loggedIn reports whether the request carries a valid login session.
+func loggedIn(ctx *gin.Context) bool {
+	cfg := requestConfig(ctx)
+	if cfg.Admin.Password == "" {
+		return false
+	}
+
+	cookie, err := ctx.Cookie(sessionCookie)
+	return err == nil && verifyCookie(cfg.Private.Secret, cookie, "session\x00"+cfg.Admin.User)
+}
+
+// cookieKey signs cookies while private.secret is unset, for as long as
+// the blog runs.
+var (
+	cookieKeyOnce sync.Once
+	cookieKey     []byte
+)
+
+// signCookie returns a cookie value for payload that verifyCookie accepts
+// until expires, signed with secret. The payload itself isn't part of the
+// value.
+func signCookie(secret, payload string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + cookieMAC(secret, payload, exp)
+}
+
+// verifyCookie reports whether value was made by signCookie for payload
+// with secret and hasn't expired.
+func verifyCookie(secret, value, payload string) bool {
+	exp, mac, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+
+	return hmac.Equal([]byte(mac), []byte(cookieMAC(secret, payload, exp)))
+}
+
+func cookieMAC(secret, payload, exp string) string {
+	key := []byte(secret)
+	if len(key) == 0 {
+		cookieKeyOnce.Do(func() {
+			cookieKey = make([]byte, 32)
+			_, _ = rand.Read(cookieKey)
+		})
+		key = cookieKey
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload + "\x00" + exp))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setRememberCookie sets a cookie signed for payload, kept for
+// private.remember.
+func setRememberCookie(ctx *gin.Context, name, payload string) {
+	cfg := requestConfig(ctx)
+	remember := time.Duration(cfg.Private.Remember)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(name, signCookie(cfg.Private.Secret, payload, time.Now().Add(remember)), int(remember.Seconds()), "/", "", ctx.Request.TLS != nil, true)
+}
+
+// lockedPage answers a request for a private post it may not see: with the
+// password form for posts with a password, and a login link otherwise.
+func lockedPage(ctx *gin.Context, post PostData) {
+	ctx.Header("Cache-Control", "no-store")
+	renderHTML(ctx, http.StatusUnauthorized, "locked.html", gin.H{
+		"Title":    "Private post",
+		"URL":      post.URL,
+		"Password": post.Password != "",
+		"Login":    requestConfig(ctx).Admin.Password != "",
+		"Status":   ctx.Query("unlock"),
+	})
+}
+
+// UnlockHandler checks the password posted from a locked post's page and
+// redirects back to the post, remembering the password if it's right.
+// Like comments, each client gets one try per commentInterval.
+func UnlockHandler(store, pages PostStore) gin.HandlerFunc {
+	var limiter commentLimiter
+
+	return func(ctx *gin.Context) {
+		post, ok := postByURL(store, ctx.PostForm("post"))
+		if !ok && pages != nil {
+			post, ok = postByURL(pages, ctx.PostForm("post"))
+		}
+		if !ok || post.Password == "" || !post.Published(requestTime(ctx)) {
+			notFound(ctx, "Post not found")
+			return
+		}
+
+		if !limiter.allow(ctx.ClientIP(), time.Now()) {
+			ctx.Redirect(http.StatusSeeOther, post.URL+"?unlock=slow")
+			return
+		}
+
+		sum := sha256.Sum256([]byte(ctx.PostForm("password")))
+		if subtle.ConstantTimeCompare(sum[:], passwordHash(post)) != 1 {
+			ctx.Redirect(http.StatusSeeOther, post.URL+"?unlock=wrong")
+			return
+		}
+
+		setRememberCookie(ctx, unlockCookieName(post), unlockPayload(post))
+		ctx.Redirect(http.StatusSeeOther, post.URL)
+	}
+}
+
+// lockedPost returns the published post slug, in the request's language or
+// any other, when it's private and the request may not see it.
+func lockedPost(ctx *gin.Context, store PostStore, slug string) (PostData, bool) {
+	if !validSlug(slug) {
+		return PostData{}, false
+	}
+
+	post, ok := store.GetLang(requestLang(ctx), slug)
+	if !ok && requestConfig(ctx).multilingual() {
+		post, ok = store.Get(slug)
+	}
+	if !ok || !post.Published(requestTime(ctx)) || canRead(ctx, post) {
+		return PostData{}, false
+	}
+
+	return post, true
+}
+
+// postByURL returns the post of store at path.
+func postByURL(store PostStore, path string) (PostData, bool) {
+	for _, post := range store.Posts() {
+		if post.URL == path {
+			return post, true
+		}
+	}
+
+	return PostData{}, false
+}
+
+// LoginHandler shows the login form on GET, and on POST checks the admin
+// credentials, starts a session and redirects to ?next=.
+func LoginHandler() gin.HandlerFunc {
+	var limiter commentLimiter
+
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		next := ctx.Query("next")
+		if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+			next = "/"
+		}
+
+		if ctx.Request.Method == http.MethodGet {
+			ctx.Header("Cache-Control", "no-store")
+			renderHTML(ctx, http.StatusOK, "login.html", gin.H{
+				"Title":  "Log in",
+				"Return": next,
+				"Status": ctx.Query("status"),
+			})
+			return
+		}
+
+		back := func(status string) {
+			ctx.Redirect(http.StatusSeeOther, "/login?status="+status+"&next="+url.QueryEscape(next))
+		}
+
+		if !limiter.allow(ctx.ClientIP(), time.Now()) {
+			back("slow")
+			return
+		}
+
+		user := subtle.ConstantTimeCompare([]byte(ctx.PostForm("user")), []byte(cfg.Admin.User))
+		password := subtle.ConstantTimeCompare([]byte(ctx.PostForm("password")), []byte(cfg.Admin.Password))
+		if user&password != 1 {
+			back("wrong")
+			return
+		}
+
+		setRememberCookie(ctx, sessionCookie, "session\x00"+cfg.Admin.User)
+		ctx.Redirect(http.StatusSeeOther, next)
+	}
+}
+
+// LogoutHandler ends the login session.
+func LogoutHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.SetCookie(sessionCookie, "", -1, "/", "", ctx.Request.TLS != nil, true)
+		ctx.Redirect(http.StatusSeeOther, "/")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expensiveRoutes are the routes doing much more work than rendering a
+// page from memory, which scrapers hammering them would turn into load.
+// Language prefixed versions count as well.
+var expensiveRoutes = map[string]bool{
+	"/search":                true,
+	"/all":                   true,
+	"/feed.xml":              true,
+	"/atom.xml":              true,
+	"/feed.json":             true,
+	"/feeds.opml":            true,
+	"/tags/:tag/feed.xml":    true,
+	"/tags/:tag/atom.xml":    true,
+	"/tags/:tag/feed.json":   true,
+	"/sitemap.xml":           true,
+	"/api/posts":             true,
+	"/api/posts/:slug":       true,
+	"/api/posts/:slug/share": true,
+	"/images/:width/*name":   true,
+	"/og/:file":              true,
+	"/archive":               true,
+	"/archive/:year":         true,
+	"/archive/:year/:month":  true,
+	"/.well-known/webfinger": true,
+	"/subscribe/confirm":     true,
+	"/ap/outbox":             true,
+}
+
+// rateLimiter gives each client a token bucket holding up to burst
+// tokens, refilled at rate tokens a second. Every request takes a token.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from client's bucket. When it's empty, allow reports
+// how long until the next token.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(client, now)
+	if b.tokens < 1 {
+		return false, l.untilToken(b)
+	}
+	b.tokens--
+
+	return true, 0
+}
+
+// wait reports how long until client's bucket has a token again, without
+// taking one: 0 unless it's empty.
+func (l *rateLimiter) wait(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(client, now)
+	if b.tokens < 1 {
+		return l.untilToken(b)
+	}
+
+	return 0
+}
+
+func (l *rateLimiter) untilToken(b *tokenBucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// bucket returns client's bucket refilled up to now. l.mu must be held.
+func (l *rateLimiter) bucket(client string, now time.Time) *tokenBucket {
+	// Buckets that have filled up again are the same as new ones, so
+	// they're dropped now and then to keep memory bounded.
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) > full {
+		for c, b := range l.buckets {
+			if now.Sub(b.last) >= full {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	return b
+}
+
+// RateLimit limits how fast each client may request expensive routes and
+// post forms, answering 429 Too Many Requests with a Retry-After once a
+// client runs out of tokens. Clients are told apart by IP, which is only
+// taken from X-Forwarded-For when the request comes through one of the
+// trusted proxies. Admin pages are left to AdminAuth, which limits failed
+// logins instead.
+func RateLimit(cfg RateLimitConfig) gin.HandlerFunc {
+	var expensive, posts *rateLimiter
+	if cfg.PerMinute > 0 {
+		expensive = newRateLimiter(cfg.PerMinute, cfg.Burst)
+	}
+	if cfg.PostsPerMinute > 0 {
+		posts = newRateLimiter(cfg.PostsPerMinute, cfg.PostBurst)
+	}
+
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if strings.HasPrefix(route, "/admin") {
+			return
+		}
+
+		limiter := expensive
+		if ctx.Request.Method == http.MethodPost {
+			limiter = posts
+		} else if !matchRoute(requestConfig(ctx), expensiveRoutes, route) {
+			return
+		}
+		if limiter == nil {
+			return
+		}
+
+		ok, wait := limiter.allow(ctx.ClientIP(), time.Now())
+		if ok {
+			return
+		}
+
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		ctx.String(http.StatusTooManyRequests, "Too many requests, please slow down")
+		ctx.Abort()
+	}
+}
+
+// AdminAuth asks for the admin's basic auth credentials. Each wrong guess
+// takes a token from the client's bucket, and a client that has run out
+// gets 429 Too Many Requests without its credentials being looked at, so
+// the password can't be brute forced. Requests that don't try to log in,
+// such as a browser's first, don't count.
+func AdminAuth(user, password string, cfg RateLimitConfig) gin.HandlerFunc {
+	basicAuth := gin.BasicAuthForRealm(gin.Accounts{user: password}, "admin")
+	if cfg.AdminFailuresPerMinute <= 0 {
+		return basicAuth
+	}
+	failures := newRateLimiter(cfg.AdminFailuresPerMinute, cfg.AdminFailureBurst)
+
+	return func(ctx *gin.Context) {
+		client := ctx.ClientIP()
+		if wait := failures.wait(client, time.Now()); wait > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			ctx.String(http.StatusTooManyRequests, "Too many failed logins, please try again later")
+			ctx.Abort()
+			return
+		}
+
+		basicAuth(ctx)
+		if ctx.IsAborted() && ctx.GetHeader("Authorization") != "" {
+			failures.allow(client, time.Now())
+		}
+	}
+}
+
+// matchRoute reports whether the route pattern is one of routes, in any
+// language or section. Section routes match the routes they mirror, such
+// as /posts/:slug for /projects/:slug.
+func matchRoute(cfg *Config, routes map[string]bool, route string) bool {
+	if routes[route] {
+		return true
+	}
+
+	for _, lang := range append([]string{""}, cfg.Languages...) {
+		rest, ok := strings.CutPrefix(route, langPrefix(lang))
+		if !ok {
+			continue
+		}
+		if routes[rest] {
+			return true
+		}
+
+		for _, section := range cfg.Sections {
+			rest, ok := strings.CutPrefix(rest, sectionPrefix(section))
+			if rest == "/:slug" {
+				rest = "/posts/:slug"
+			}
+			if ok && routes[rest] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
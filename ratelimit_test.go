@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthLimitsFailedLogins(t *testing.T) {
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.Admin.Password = "secret"
+		cfg.RateLimit.AdminFailuresPerMinute = 1
+		cfg.RateLimit.AdminFailureBurst = 3
+	})
+
+	login := func(password, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.RemoteAddr = ip + ":1234"
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		return do(route, req).Code
+	}
+
+	// A browser asking without credentials isn't guessing.
+	for range 5 {
+		if code := login("", "192.0.2.1"); code != http.StatusUnauthorized {
+			t.Fatalf("no credentials: status %d, want 401", code)
+		}
+	}
+	for i := range 3 {
+		if code := login("guess", "192.0.2.1"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", i+1, code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.SetBasicAuth("admin", "secret")
+	w := do(route, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("right password after too many wrong ones: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without a Retry-After")
+	}
+
+	if code := login("secret", "192.0.2.2"); code != http.StatusOK {
+		t.Errorf("another client: status %d, want 200", code)
+	}
+}
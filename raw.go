@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	xhtml "golang.org/x/net/html"
+)
+
+// Posts are also available as their markdown source, at their URL with
+// .md appended or for requests accepting text/markdown, as plain text, at
+// .txt or for requests preferring text/plain, and as PDF at .pdf.
+
+// rawFormats are the raw formats of posts by extension.
+var rawFormats = map[string]string{
+	".md":  "text/markdown",
+	".txt": "text/plain",
+	// Only by extension, PDFs being downloads rather than another
+	// representation of the page.
+	".pdf": "application/pdf",
+}
+
+// rawFormat returns the slug the request is for and the raw format it
+// asks for, by extension or Accept header, or "" for HTML.
+func rawFormat(ctx *gin.Context) (slug, format string) {
+	slug = ctx.Param("slug")
+	if format, ok := rawFormats[path.Ext(slug)]; ok {
+		return strings.TrimSuffix(slug, path.Ext(slug)), format
+	}
+
+	return slug, acceptedRawFormat(ctx)
+}
+
+// acceptedRawFormat is the raw format the Accept header prefers to HTML,
+// if any. Browsers and */* get HTML.
+func acceptedRawFormat(ctx *gin.Context) string {
+	switch ctx.NegotiateFormat("text/html", "text/markdown", "text/plain") {
+	case "text/markdown":
+		return "text/markdown"
+	case "text/plain":
+		return "text/plain"
+	}
+
+	return ""
+}
+
+// rawPost answers with post in format.
+func rawPost(ctx *gin.Context, store PostStore, post PostData, format string) {
+	var body string
+	switch format {
+	case "application/pdf":
+		servePDF(ctx, post)
+		return
+	case "text/markdown":
+		source, err := store.Source(post)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't read the post")
+			return
+		}
+		body = string(source)
+	default:
+		body = post.Title + "\n\n" + htmlPlainText(string(post.Content()))
+	}
+
+	ctx.Data(http.StatusOK, format+"; charset=utf-8", []byte(body))
+}
+
+// Source returns the file post was loaded from.
+func (store *ContentStore) Source(post PostData) ([]byte, error) {
+	store.mu.RLock()
+	fsys := store.fsys
+	store.mu.RUnlock()
+
+	name, err := filepath.Rel(store.String(), post.File)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.ReadFile(fsys, filepath.ToSlash(name))
+}
+
+// htmlPlainText renders an HTML fragment as plain text: paragraphs
+// separated by blank lines, list items with a dash, links followed by
+// their URL and preformatted text as it is.
+func htmlPlainText(fragment string) string {
+	doc, err := xhtml.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return stripHTML(fragment)
+	}
+
+	var b strings.Builder
+	// breaks ends the current block with n line breaks, unless it's empty.
+	breaks := func(n int) {
+		text := b.String()
+		if text == "" {
+			return
+		}
+		trimmed := strings.TrimRight(text, " \n")
+		b.Reset()
+		b.WriteString(trimmed)
+		b.WriteString(strings.Repeat("\n", n))
+	}
+
+	var walk func(n *xhtml.Node, pre bool)
+	walk = func(n *xhtml.Node, pre bool) {
+		switch n.Type {
+		case xhtml.TextNode:
+			if pre {
+				b.WriteString(n.Data)
+			} else if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				if strings.HasPrefix(n.Data, " ") || strings.HasPrefix(n.Data, "\n") {
+					text = " " + text
+				}
+				if strings.HasSuffix(n.Data, " ") || strings.HasSuffix(n.Data, "\n") {
+					text += " "
+				}
+				if s := b.String(); s == "" || strings.HasSuffix(s, "\n") {
+					text = strings.TrimLeft(text, " ")
+				}
+				b.WriteString(text)
+			}
+			return
+		case xhtml.ElementNode, xhtml.DocumentNode:
+		default:
+			return
+		}
+
+		switch n.Data {
+		case "script", "style", "svg":
+			return
+		case "br":
+			b.WriteString("\n")
+			return
+		case "img":
+			if alt, ok := htmlAttr(n, "alt"); ok && alt != "" {
+				b.WriteString("[" + alt + "]")
+			}
+			return
+		case "hr":
+			breaks(2)
+			b.WriteString("----\n\n")
+			return
+		case "li":
+			breaks(1)
+			b.WriteString("- ")
+		case "p", "div", "pre", "blockquote", "table", "tr", "ul", "ol", "dl", "h1", "h2", "h3", "h4", "h5", "h6", "figure":
+			breaks(2)
+		}
+
+		start := b.Len()
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre || n.Data == "pre")
+		}
+
+		switch n.Data {
+		case "a":
+			// Links to headings lead nowhere in plain text, and the URLs
+			// of autolinks are their text already.
+			href, _ := htmlAttr(n, "href")
+			if href != "" && !strings.HasPrefix(href, "#") && strings.TrimSpace(b.String()[start:]) != href {
+				b.WriteString(" (" + href + ")")
+			}
+		case "td", "th":
+			b.WriteString("\t")
+		case "p", "div", "pre", "blockquote", "table", "ul", "ol", "dl", "h1", "h2", "h3", "h4", "h5", "h6", "figure":
+			breaks(2)
+		case "tr":
+			breaks(1)
+		}
+	}
+	walk(doc, false)
+
+	return strings.TrimSpace(b.String()) + "\n"
+}
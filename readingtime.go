@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wordsPerMinute is the reading speed used to estimate reading time.
+const wordsPerMinute = 200
+
+// wordCount counts the words in a post's rendered HTML.
+func wordCount(html string) int {
+	return len(strings.Fields(stripHTML(html)))
+}
+
+// readingTime formats the estimated time to read words, never less than a
+// minute.
+func readingTime(words int) string {
+	minutes := max((words+wordsPerMinute-1)/wordsPerMinute, 1)
+	return fmt.Sprintf("%d min read", minutes)
+}
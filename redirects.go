@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Redirects maps old paths to where their content lives now. Paths come
+// from redirects.yaml and from the Aliases of posts. They are only
+// consulted for requests that would otherwise be a 404, so a redirect
+// never hides a live page.
+type Redirects struct {
+	site map[string]string
+	// defaultLang is the language whose aliases also redirect without
+	// its prefix.
+	defaultLang string
+
+	mu      sync.RWMutex
+	aliases map[string]string
+}
+
+// loadRedirects reads the redirects file at path, a map of old paths to
+// new URLs:
+//
+//	/2023/old-post: /posts/new-post
+//	/about-me: https://example.com/about
+//
+// A missing file is not an error. Aliases of posts in defaultLang, the
+// default_language config, redirect without its prefix too.
+func loadRedirects(path, defaultLang string) (*Redirects, error) {
+	redirects := &Redirects{site: map[string]string{}, defaultLang: defaultLang}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return redirects, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var site map[string]string
+	err = yaml.UnmarshalStrict(b, &site)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for from, to := range site {
+		if !strings.HasPrefix(from, "/") || to == "" {
+			return nil, fmt.Errorf("%s: redirect %q must be from a path starting with / to a URL", path, from)
+		}
+		redirects.site[redirectKey(from)] = to
+	}
+
+	return redirects, nil
+}
+
+// SetPosts replaces the post aliases with those of posts. An alias is an
+// old slug, served under /posts/ like the post, or an old path starting
+// with a slash.
+func (redirects *Redirects) SetPosts(posts []PostData) {
+	aliases := map[string]string{}
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			if strings.HasPrefix(alias, "/") {
+				aliases[redirectKey(alias)] = post.URL
+				continue
+			}
+
+			aliases[langPrefix(post.Lang)+"/posts/"+alias] = post.URL
+			if post.Lang == redirects.defaultLang {
+				aliases["/posts/"+alias] = post.URL
+			}
+		}
+	}
+
+	redirects.mu.Lock()
+	redirects.aliases = aliases
+	redirects.mu.Unlock()
+}
+
+// Lookup returns where path has moved to. Post aliases win over the
+// redirects file, since they move along with the post.
+func (redirects *Redirects) Lookup(path string) (string, bool) {
+	key := redirectKey(path)
+
+	redirects.mu.RLock()
+	to, ok := redirects.aliases[key]
+	redirects.mu.RUnlock()
+	if ok {
+		return to, true
+	}
+
+	to, ok = redirects.site[key]
+	return to, ok
+}
+
+// All returns every redirect, sorted by path.
+func (redirects *Redirects) All() [][2]string {
+	redirects.mu.RLock()
+	defer redirects.mu.RUnlock()
+
+	all := map[string]string{}
+	for from, to := range redirects.site {
+		all[from] = to
+	}
+	for from, to := range redirects.aliases {
+		all[from] = to
+	}
+
+	var sorted [][2]string
+	for from, to := range all {
+		sorted = append(sorted, [2]string{from, to})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	return sorted
+}
+
+// redirectKey normalizes path so that /old and /old/ redirect alike.
+func redirectKey(path string) string {
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	return path
+}
+
+// RedirectsMiddleware makes the redirects available to notFound.
+func RedirectsMiddleware(redirects *Redirects) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Redirects", redirects)
+		ctx.Next()
+	}
+}
+
+// redirectMoved sends a 301 when the requested path has moved, reporting
+// whether it did.
+func redirectMoved(ctx *gin.Context) bool {
+	if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+		return false
+	}
+
+	value, ok := ctx.Get("Redirects")
+	if !ok {
+		return false
+	}
+
+	to, ok := value.(*Redirects).Lookup(ctx.Request.URL.Path)
+	if !ok || to == ctx.Request.URL.Path {
+		return false
+	}
+
+	if ctx.Request.URL.RawQuery != "" && !strings.Contains(to, "?") {
+		to += "?" + ctx.Request.URL.RawQuery
+	}
+	ctx.Redirect(http.StatusMovedPermanently, to)
+	return true
+}
+
+// writeRedirectsFile writes the redirects to a _redirects file under out,
+// the format Netlify and Cloudflare Pages read, since a static build can't
+// send 301s itself.
+func writeRedirectsFile(out string, redirects *Redirects) error {
+	var b strings.Builder
+	for _, redirect := range redirects.All() {
+		fmt.Fprintf(&b, "%s %s 301\n", redirect[0], redirect[1])
+	}
+
+	return os.WriteFile(filepath.Join(out, "_redirects"), []byte(b.String()), 0o644)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// maxMentionedBy is how many referrers are listed under a post.
+const maxMentionedBy = 10
+
+// spamReferrers are sites known for referrer spam: fake visits whose
+// referrer advertises them in stats and "mentioned by" lists. They're
+// always blocked, along with referrers.blocklist.
+var spamReferrers = []string{
+	"4webmasters.org",
+	"best-seo-offer.com",
+	"blackhatworth.com",
+	"buttons-for-website.com",
+	"darodar.com",
+	"free-share-buttons.com",
+	"get-free-traffic-now.com",
+	"hulfingtonpost.com",
+	"ilovevitaly.com",
+	"o-o-6-o-o.com",
+	"priceg.com",
+	"semalt.com",
+	"simple-share-buttons.com",
+	"social-buttons.com",
+	"trafficmonetize.com",
+}
+
+// Referrers collects the pages outside the blog that readers of each post
+// came from, as told by their browsers' Referer header. Referrals are
+// counted by post slug and referring URL, without query strings, batched
+// in memory and written every flush interval like Analytics' views. Bots,
+// readers asking not to be tracked and blocked sites aren't counted. A nil
+// *Referrers collects nothing.
+type Referrers struct {
+	db *sql.DB
+	// blocked are the hosts whose referrals are dropped, with their
+	// subdomains.
+	blocked []string
+
+	mu      sync.Mutex
+	pending map[referral]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// referral is a reader of the post slug coming from URL.
+type referral struct {
+	Slug string
+	URL  string
+}
+
+// Referrer is a page that sent readers to a post. Host and Path are
+// those of its URL, the host without www.
+type Referrer struct {
+	Slug     string
+	URL      string
+	Host     string
+	Path     string
+	Count    int64
+	LastSeen time.Time
+}
+
+// openReferrers opens the database configured in cfg and starts flushing
+// to it, or returns nil when referrers aren't collected.
+func openReferrers(cfg ReferrersConfig) (*Referrers, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "referrers.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS referrers (
+		slug      TEXT NOT NULL,
+		url       TEXT NOT NULL,
+		count     INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL,
+		PRIMARY KEY (slug, url)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	blocked := append(slices.Clone(spamReferrers), cfg.Blocklist...)
+	for i, host := range blocked {
+		blocked[i] = strings.TrimPrefix(strings.ToLower(host), "www.")
+	}
+
+	r := &Referrers{
+		db:      db,
+		blocked: blocked,
+		pending: make(map[referral]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.flushEvery(time.Duration(cfg.FlushInterval))
+
+	return r, nil
+}
+
+// Hit counts a reader of the post slug coming from the referrer of ctx's
+// request, if it's a page elsewhere worth counting.
+func (r *Referrers) Hit(ctx *gin.Context, slug string) {
+	if r == nil || ctx.GetHeader("DNT") == "1" || ctx.GetHeader("Sec-GPC") == "1" ||
+		browserFamily(ctx.Request.UserAgent()) == "" {
+		return
+	}
+
+	u := r.referrerURL(ctx.Request, requestConfig(ctx).BaseURL)
+	if u == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending[referral{Slug: slug, URL: u}]++
+}
+
+// referrerURL returns the page req was referred from, without its query
+// and fragment, or "" for direct visits, links within the blog at base and
+// blocked sites.
+func (r *Referrers) referrerURL(req *http.Request, base string) string {
+	u, err := url.Parse(req.Referer())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Host == req.Host {
+		return ""
+	}
+	if base, err := url.Parse(base); err == nil && strings.EqualFold(u.Host, base.Host) {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, blocked := range r.blocked {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return ""
+		}
+	}
+
+	clean := url.URL{Scheme: u.Scheme, Host: strings.ToLower(u.Host), Path: u.Path}
+	if clean.Path == "" {
+		clean.Path = "/"
+	}
+
+	return clean.String()
+}
+
+func (r *Referrers) flushEvery(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.logFlush()
+		case <-r.stop:
+			r.logFlush()
+			return
+		}
+	}
+}
+
+func (r *Referrers) logFlush() {
+	if err := r.flush(); err != nil {
+		slog.Warn("saving referrers", "error", err)
+	}
+}
+
+// flush writes the pending referrals in one transaction, keeping them
+// pending for the next flush if that fails.
+func (r *Referrers) flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[referral]int64)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := r.write(pending)
+	if err != nil {
+		r.mu.Lock()
+		for ref, n := range pending {
+			r.pending[ref] += n
+		}
+		r.mu.Unlock()
+	}
+
+	return err
+}
+
+func (r *Referrers) write(pending map[referral]int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for ref, n := range pending {
+		_, err = tx.Exec(`INSERT INTO referrers (slug, url, count, last_seen) VALUES (?, ?, ?, ?)
+			ON CONFLICT (slug, url) DO UPDATE SET count = count + excluded.count, last_seen = excluded.last_seen`,
+			ref.Slug, ref.URL, n, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// For returns the pages that sent at least minCount readers to the post
+// slug, most first, up to limit of them.
+func (r *Referrers) For(slug string, minCount, limit int) []Referrer {
+	if r == nil {
+		return nil
+	}
+
+	referrers, err := r.query(`SELECT slug, url, count, last_seen FROM referrers WHERE slug = ? AND count >= ?
+		ORDER BY count DESC, url LIMIT ?`, slug, minCount, limit)
+	if err != nil {
+		slog.Warn("loading referrers", "slug", slug, "error", err)
+	}
+
+	return referrers
+}
+
+// Top returns the pages that sent the most readers to any post, up to
+// limit of them. Pending referrals are written first so they're included.
+func (r *Referrers) Top(limit int) ([]Referrer, error) {
+	err := r.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.query(`SELECT slug, url, count, last_seen FROM referrers ORDER BY count DESC, url LIMIT ?`, limit)
+}
+
+func (r *Referrers) query(query string, args ...any) ([]Referrer, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var referrers []Referrer
+	for rows.Next() {
+		var ref Referrer
+		var lastSeen int64
+		err = rows.Scan(&ref.Slug, &ref.URL, &ref.Count, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		ref.LastSeen = time.Unix(lastSeen, 0)
+		if u, err := url.Parse(ref.URL); err == nil {
+			ref.Host = strings.TrimPrefix(u.Hostname(), "www.")
+			ref.Path = u.Path
+		}
+		referrers = append(referrers, ref)
+	}
+
+	return referrers, rows.Err()
+}
+
+// Close writes the pending referrals and closes the database.
+func (r *Referrers) Close() error {
+	close(r.stop)
+	<-r.done
+
+	return r.db.Close()
+}
+
+// AdminReferrersHandler lists the pages that sent the most readers to
+// posts.
+func AdminReferrersHandler(referrers *Referrers) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		top, err := referrers.Top(100)
+		if err != nil {
+			ctx.Error(err)
+			ctx.String(http.StatusInternalServerError, "Couldn't load referrers")
+			return
+		}
+
+		renderHTML(ctx, http.StatusOK, "admin_referrers.html", gin.H{
+			"Title":     "Referrers",
+			"Referrers": top,
+		})
+	}
+}
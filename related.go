@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRelated is the number of related posts shown under a post.
+const maxRelated = 3
+
+// PostSummary is a short reference to another post.
+type PostSummary struct {
+	Title       string
+	Slug        string
+	URL         string
+	Description string
+	Date        time.Time
+}
+
+func summarize(post PostData) PostSummary {
+	return PostSummary{
+		Title:       post.Title,
+		Slug:        post.Slug,
+		URL:         post.URL,
+		Description: post.Description,
+		Date:        post.Date,
+	}
+}
+
+// computeRelated fills in Related for every post from sources, the
+// related config, in turn, see relatedBy.
+func computeRelated(sources []string, posts []PostData) {
+	var vectors []map[string]float64
+	if slices.Contains(sources, "tags") {
+		vectors = tfidfVectors(posts)
+	}
+
+	for i := range posts {
+		// Keep a few spare candidates so hiding unpublished posts at
+		// request time still leaves enough to show.
+		var related []PostSummary
+		seen := map[int]bool{i: true}
+		for _, source := range sources {
+			for _, j := range relatedBy(source, posts, vectors, i) {
+				if len(related) == 2*maxRelated {
+					break
+				}
+				if !seen[j] {
+					seen[j] = true
+					related = append(related, summarize(posts[j]))
+				}
+			}
+		}
+		posts[i].Related = related
+	}
+}
+
+// relatedBy returns the indexes of the posts related to posts[i] by
+// source, best first. For tags, posts are scored by the number of tags
+// they share plus the cosine similarity of their TF-IDF weighted words,
+// which ranks posts without tags by content alone. Ties, and the posts of
+// the same category, are newest first.
+func relatedBy(source string, posts []PostData, vectors []map[string]float64, i int) []int {
+	type candidate struct {
+		index int
+		score float64
+	}
+	var candidates []candidate
+
+	for j := range posts {
+		if i == j {
+			continue
+		}
+
+		var score float64
+		switch source {
+		case "tags":
+			score = float64(sharedTags(posts[i].Tags, posts[j].Tags)) + cosine(vectors[i], vectors[j])
+		case "category":
+			if posts[i].Category != "" && strings.EqualFold(posts[i].Category, posts[j].Category) {
+				score = 1
+			}
+		case "recent":
+			score = 1
+		}
+		if score > 0 {
+			candidates = append(candidates, candidate{j, score})
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].score != candidates[b].score {
+			return candidates[a].score > candidates[b].score
+		}
+		return posts[candidates[a].index].Date.After(posts[candidates[b].index].Date)
+	})
+
+	related := make([]int, len(candidates))
+	for k, c := range candidates {
+		related[k] = c.index
+	}
+
+	return related
+}
+
+func sharedTags(a, b []string) int {
+	shared := 0
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				shared++
+				break
+			}
+		}
+	}
+
+	return shared
+}
+
+// tfidfVectors returns the TF-IDF weight of every word of every post,
+// normalized to unit length.
+func tfidfVectors(posts []PostData) []map[string]float64 {
+	counts := make([]map[string]int, len(posts))
+	docFreq := map[string]int{}
+
+	for i, post := range posts {
+		counts[i] = map[string]int{}
+		for _, term := range searchTerms(post.Title + " " + post.Text()) {
+			if counts[i][term] == 0 {
+				docFreq[term]++
+			}
+			counts[i][term]++
+		}
+	}
+
+	vectors := make([]map[string]float64, len(posts))
+	for i, terms := range counts {
+		vectors[i] = make(map[string]float64, len(terms))
+		var norm float64
+		for term, count := range terms {
+			weight := float64(count) * math.Log(float64(len(posts))/float64(docFreq[term]))
+			if weight == 0 {
+				continue
+			}
+			vectors[i][term] = weight
+			norm += weight * weight
+		}
+
+		norm = math.Sqrt(norm)
+		for term := range vectors[i] {
+			vectors[i][term] /= norm
+		}
+	}
+
+	return vectors
+}
+
+// cosine returns the dot product of two unit vectors.
+func cosine(a, b map[string]float64) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	var dot float64
+	for term, weight := range a {
+		dot += weight * b[term]
+	}
+
+	return dot
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var relatedLink = regexp.MustCompile(`href="(/posts/[^"]+)"`)
+
+// relatedURLs returns the links of the related posts section of a post
+// page, in order.
+func relatedURLs(body string) []string {
+	_, section, _ := strings.Cut(body, `<section class="related">`)
+	section, _, _ = strings.Cut(section, "</section>")
+
+	var urls []string
+	for _, m := range relatedLink.FindAllStringSubmatch(section, -1) {
+		urls = append(urls, m[1])
+	}
+
+	return urls
+}
+
+func TestRelatedFallback(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"tagless.md": "---\nTitle: Tagless\nDate: 2025-01-05\nCategory: Travel\n---\n\nMountains and rivers.\n",
+		"lisbon.md":  "---\nTitle: Lisbon\nDate: 2025-01-01\nCategory: travel\n---\n\nTrams climbing hills.\n",
+		"kyoto.md":   "---\nTitle: Kyoto\nDate: 2025-01-02\nCategory: Travel\n---\n\nTemples in autumn.\n",
+		"compiler.md": "---\nTitle: Compiler\nDate: 2025-01-04\nCategory: Code\nTags: [go]\n---\n\n" +
+			"Escape analysis decides allocation.\n",
+	})
+
+	for _, tc := range []struct {
+		name    string
+		related []string
+		want    []string
+	}{
+		{"default", []string{"tags", "category", "recent"}, []string{"/posts/kyoto", "/posts/lisbon", "/posts/compiler"}},
+		{"category only", []string{"category"}, []string{"/posts/kyoto", "/posts/lisbon"}},
+		{"recent first", []string{"recent", "category"}, []string{"/posts/compiler", "/posts/kyoto", "/posts/lisbon"}},
+		{"none", []string{}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			route := newTestRouter(t, func(cfg *Config) {
+				cfg.ContentDir = dir
+				cfg.Related = tc.related
+			})
+
+			got := relatedURLs(get(route, "/posts/tagless").Body.String())
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("related posts %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRelatedValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Related = []string{"tags", "author"}
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted an unknown related source")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// MarkdownRenderer turns post markdown into HTML. It is built once from
+// the config and shared by everything that renders markdown, so posts and
+// previews always come out the same.
+type MarkdownRenderer struct {
+	md goldmark.Markdown
+	// sanitizer cleans the output of untrusted posts, see
+	// MarkdownConfig.Sanitize. It is nil when sanitizing is off.
+	sanitizer *bluemonday.Policy
+	// shortcodes are the shortcode templates by name, see
+	// expandShortcodes.
+	shortcodes map[string]*template.Template
+	// cache keeps rendered posts across restarts, nil when they aren't
+	// kept, and fingerprint identifies this renderer's output in it.
+	cache       RenderCache
+	fingerprint string
+	// cfg is the config the renderer was built from, which the posts it
+	// renders are loaded with.
+	cfg *Config
+}
+
+func NewMarkdownRenderer(cfg *Config) (*MarkdownRenderer, error) {
+	opts := []goldmark.Option{
+		goldmark.WithExtensions(mermaidDiagrams{}, imageGalleries{cfg}),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID(), parser.WithHeadingAttribute()),
+		markdownHighlighting(cfg.Markdown),
+	}
+	opts = append(opts, markdownExtensions(cfg.Markdown)...)
+	opts = append(opts, markdownHTMLOptions(cfg.Markdown)...)
+	if len(cfg.Images.Widths) > 0 {
+		opts = append(opts, goldmark.WithExtensions(responsiveImages{cfg}))
+	}
+	if cfg.Markdown.Math {
+		opts = append(opts, goldmark.WithExtensions(mathExtension{}))
+	}
+	if cfg.Links.Rel != "" || cfg.Links.NewTab || cfg.Links.Track {
+		opts = append(opts, goldmark.WithExtensions(externalLinks{cfg}))
+	}
+	if cfg.Markdown.HeadingAnchors {
+		opts = append(opts, goldmark.WithExtensions(headingAnchors{}))
+	}
+	if cfg.Markdown.Emoji {
+		opts = append(opts, goldmark.WithExtensions(emojiExtension{}))
+	}
+
+	shortcodes, err := loadShortcodes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &MarkdownRenderer{shortcodes: shortcodes, cfg: cfg}
+	if cfg.Markdown.Sanitize {
+		// Raw HTML is let through by goldmark and cleaned afterwards.
+		opts = append(opts, goldmark.WithRendererOptions(html.WithUnsafe()))
+		r.sanitizer = sanitizePolicy(cfg.Markdown)
+	}
+	r.md = goldmark.New(opts...)
+
+	r.cache, err = openRenderCache(cfg.Content)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil {
+		r.fingerprint, err = renderFingerprint(r.cfg)
+		if err != nil {
+			slog.Warn("rendered posts won't be kept", "error", err)
+			r.cache = nil
+		}
+	}
+
+	return r, nil
+}
+
+// Render converts source to HTML along with its table of contents,
+// expanding shortcodes. Heading ids are prefixed with idPrefix. Unless
+// trusted, the HTML is sanitized when sanitizing is on; shortcode output
+// is always trusted. It gives up with c's error if c is done before
+// goldmark starts.
+func (r *MarkdownRenderer) Render(c context.Context, source []byte, idPrefix string, trusted bool) (template.HTML, []TOCEntry, error) {
+	defer func(start time.Time) {
+		renderDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	source, snippets, err := r.expandShortcodes(source)
+	if err != nil {
+		return "", nil, err
+	}
+	// Goldmark can't be stopped once it starts, so this is the last
+	// chance to give up.
+	if err := c.Err(); err != nil {
+		return "", nil, err
+	}
+
+	pc := parser.NewContext(parser.WithIDs(newPrefixedIDs(idPrefix)))
+	content, toc, err := renderMarkdown(r.md, source, pc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !trusted && r.sanitizer != nil {
+		content = template.HTML(r.sanitizer.Sanitize(string(content)))
+	}
+
+	return template.HTML(insertShortcodes(string(content), snippets)), toc, nil
+}
+
+// markdownHTMLOptions maps the markdown config to goldmark HTML renderer
+// options. See MarkdownConfig.Unsafe for why unsafe output needs a second
+// switch.
+func markdownHTMLOptions(cfg MarkdownConfig) []goldmark.Option {
+	var opts []renderer.Option
+
+	if cfg.HardWraps {
+		opts = append(opts, html.WithHardWraps())
+	}
+
+	if cfg.XHTML {
+		opts = append(opts, html.WithXHTML())
+	}
+
+	if cfg.Unsafe {
+		if cfg.UnsafeIUnderstandTheRisk {
+			opts = append(opts, html.WithUnsafe())
+		} else {
+			slog.Warn("markdown unsafe ignored without unsafe_i_understand_the_risk")
+		}
+	}
+
+	if len(opts) == 0 {
+		return nil
+	}
+
+	return []goldmark.Option{goldmark.WithRendererOptions(opts...)}
+}
+
+// markdownHighlighting sets up Chroma highlighting of fenced code blocks.
+// Besides the config, each block can take options in its info string, such
+// as ```go {hl_lines=[2,3] linenos=true}, and a file name, see codeBlocks.
+func markdownHighlighting(cfg MarkdownConfig) goldmark.Option {
+	wrap := codeBlockWrapper(codeBlockClass(cfg))
+
+	return goldmark.WithExtensions(
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(cfg.HighlightStyle),
+			highlighting.WithFormatOptions(chromahtml.WithLineNumbers(cfg.LineNumbers)),
+			highlighting.WithWrapperRenderer(wrap),
+		),
+		codeBlocks{wrap: wrap},
+	)
+}
+
+// codeBlockClass is the class of the div wrapping code blocks.
+func codeBlockClass(cfg MarkdownConfig) string {
+	return firstNonEmpty(cfg.CodeBlockClass, "code-block")
+}
+
+// codeBlockWrapper wraps every code block in a div of the given class with
+// its language in data-lang, giving scripts and styles a stable hook
+// whether or not the block was highlighted. A header above the code shows
+// its file name, if any, and holds a copy button, hidden until site.js
+// makes it work.
+func codeBlockWrapper(class string) highlighting.WrapperRenderer {
+	return func(w util.BufWriter, c highlighting.CodeBlockContext, entering bool) {
+		language, _ := c.Language()
+
+		if !entering {
+			if !c.Highlighted() {
+				_, _ = w.WriteString("</code></pre>")
+			}
+			_, _ = w.WriteString("</div>\n")
+			return
+		}
+
+		_, _ = w.WriteString(`<div class="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(class)))
+		_, _ = w.WriteString(`"`)
+		if language != nil {
+			_, _ = w.WriteString(` data-lang="`)
+			_, _ = w.Write(util.EscapeHTML(language))
+			_, _ = w.WriteString(`"`)
+		}
+		_, _ = w.WriteString(">")
+
+		_, _ = w.WriteString(`<div class="code-header">`)
+		if attrs := c.Attributes(); attrs != nil {
+			if file, ok := attrs.GetString("filename"); ok {
+				if file, ok := file.([]byte); ok {
+					_, _ = w.WriteString(`<span class="code-filename">`)
+					_, _ = w.Write(util.EscapeHTML(file))
+					_, _ = w.WriteString(`</span>`)
+				}
+			}
+		}
+		_, _ = w.WriteString(`<button type="button" class="code-copy" hidden>Copy</button></div>`)
+
+		if !c.Highlighted() {
+			_, _ = w.WriteString("<pre><code")
+			if language != nil {
+				_, _ = w.WriteString(` class="language-`)
+				_, _ = w.Write(util.EscapeHTML(language))
+				_, _ = w.WriteString(`"`)
+			}
+			_, _ = w.WriteString(">")
+		}
+	}
+}
+
+// markdownExtensions returns the optional goldmark extensions enabled in
+// the markdown config.
+func markdownExtensions(cfg MarkdownConfig) []goldmark.Option {
+	var extensions []goldmark.Extender
+
+	if cfg.Tables {
+		extensions = append(extensions, extension.Table)
+	}
+	if cfg.Strikethrough {
+		extensions = append(extensions, extension.Strikethrough)
+	}
+	if cfg.TaskLists {
+		extensions = append(extensions, extension.TaskList)
+	}
+	if cfg.Linkify {
+		extensions = append(extensions, extension.Linkify)
+	}
+	if cfg.Footnotes {
+		extensions = append(extensions, extension.Footnote, footnotePreviews{})
+	}
+	if cfg.Typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if cfg.DefinitionLists {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+
+	return []goldmark.Option{goldmark.WithExtensions(extensions...)}
+}
+
+// footnotePreviews renders footnote references with the footnote's plain
+// text in a data-footnote attribute, so a client script can show it as a
+// tooltip without jumping to the end of the post.
+type footnotePreviews struct{}
+
+func (footnotePreviews) Extend(m goldmark.Markdown) {
+	// The footnote extension registers its renderer at priority 500; a lower
+	// value takes precedence for the node kinds we handle.
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(footnoteLinkRenderer{}, 400),
+	))
+}
+
+type footnoteLinkRenderer struct{}
+
+func (r footnoteLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(east.KindFootnoteLink, r.renderFootnoteLink)
+}
+
+func (r footnoteLinkRenderer) renderFootnoteLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*east.FootnoteLink)
+	is := strconv.Itoa(n.Index)
+	ref := "fnref"
+	if n.RefIndex > 0 {
+		ref += strconv.Itoa(n.RefIndex)
+	}
+
+	_, _ = w.WriteString(`<sup id="` + ref + `:` + is + `"><a href="#fn:` + is +
+		`" class="footnote-ref" role="doc-noteref"`)
+	if text := footnoteText(node.OwnerDocument(), source, n.Index); text != "" {
+		_, _ = w.WriteString(` data-footnote="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(text)))
+		_, _ = w.WriteString(`"`)
+	}
+	_, _ = w.WriteString(`>` + is + `</a></sup>`)
+
+	return ast.WalkContinue, nil
+}
+
+// footnoteText returns the plain text of the footnote definition with the
+// given index, or "" if doc has none.
+func footnoteText(doc ast.Node, source []byte, index int) string {
+	if doc == nil {
+		return ""
+	}
+
+	for list := doc.FirstChild(); list != nil; list = list.NextSibling() {
+		if list.Kind() != east.KindFootnoteList {
+			continue
+		}
+
+		for fn := list.FirstChild(); fn != nil; fn = fn.NextSibling() {
+			footnote, ok := fn.(*east.Footnote)
+			if !ok || footnote.Index != index {
+				continue
+			}
+
+			return plainText(footnote, source)
+		}
+	}
+
+	return ""
+}
+
+// plainText returns the text content of n, with paragraphs separated by a
+// space. Footnote back links are left out.
+func plainText(n ast.Node, source []byte) string {
+	var text strings.Builder
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *east.FootnoteBacklink:
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			if text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+		case *ast.Text:
+			text.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				text.WriteByte(' ')
+			}
+		case *ast.String:
+			text.Write(n.Value)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return strings.TrimSpace(text.String())
+}
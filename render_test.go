@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// renderWith renders source with a renderer set up by configure
+// changing the default markdown config.
+func renderWith(t *testing.T, configure func(cfg *MarkdownConfig), source string) string {
+	t.Helper()
+
+	cfg := defaultConfig()
+	if configure != nil {
+		configure(&cfg.Markdown)
+	}
+
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, _, err := renderer.Render(context.Background(), []byte(source), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(html)
+}
+
+func TestMarkdownHTMLOptions(t *testing.T) {
+	const wrapped = "one line\nthe next"
+	const raw = "before\n\n<span class=\"raw\">raw</span>\n"
+
+	for _, tc := range []struct {
+		name      string
+		configure func(cfg *MarkdownConfig)
+		source    string
+		want      string
+		notWant   string
+	}{
+		{"soft wraps", nil, wrapped, "one line\nthe next", "<br"},
+		{"hard wraps", func(cfg *MarkdownConfig) { cfg.HardWraps = true }, wrapped, "one line<br>\nthe next", ""},
+		{"xhtml", func(cfg *MarkdownConfig) { cfg.HardWraps, cfg.XHTML = true, true }, wrapped, "one line<br />\nthe next", ""},
+		{"safe", nil, raw, "<!-- raw HTML omitted -->", `<span class="raw">`},
+		{"unsafe without the risk", func(cfg *MarkdownConfig) { cfg.Unsafe = true }, raw, "<!-- raw HTML omitted -->", `<span class="raw">`},
+		{"unsafe", func(cfg *MarkdownConfig) { cfg.Unsafe, cfg.UnsafeIUnderstandTheRisk = true, true }, raw, `<span class="raw">raw</span>`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			html := renderWith(t, tc.configure, tc.source)
+			if !strings.Contains(html, tc.want) {
+				t.Errorf("rendered %q, want it to contain %q", html, tc.want)
+			}
+			if tc.notWant != "" && strings.Contains(html, tc.notWant) {
+				t.Errorf("rendered %q, want it without %q", html, tc.notWant)
+			}
+		})
+	}
+}
+
+func TestFootnotePreviews(t *testing.T) {
+	html := renderWith(t, func(cfg *MarkdownConfig) { cfg.Footnotes = true },
+		"A claim.[^1]\n\n[^1]: Said *once*, with 1 < 2 & \"quotes\".\n")
+
+	want := `<a href="#fn:1" class="footnote-ref" role="doc-noteref" data-footnote="Said once, with 1 &lt; 2 &amp; &quot;quotes&quot;.">1</a>`
+	if !strings.Contains(html, want) {
+		t.Errorf("rendered %q, want the reference %q", html, want)
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	cfg := defaultConfig()
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	source := []byte(strings.Repeat(benchmarkBody+"\n", 10))
+	b.SetBytes(int64(len(source)))
+
+	for range b.N {
+		_, _, err := renderer.Render(context.Background(), source, "", false)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// renderCacheExpiry is how long rendered posts are kept in the render
+// cache without being used.
+const renderCacheExpiry = 30 * 24 * time.Hour
+
+// renderedBody is a post's body as rendered, as kept in a RenderCache.
+type renderedBody struct {
+	Content template.HTML `json:"content"`
+	TOC     []TOCEntry    `json:"toc"`
+	Excerpt template.HTML `json:"excerpt"`
+	Words   int           `json:"words"`
+}
+
+// RenderCache keeps rendered posts across restarts, so starting only
+// renders the posts that changed since the last run. Entries are keyed by
+// everything their output depends on, see MarkdownRenderer.cacheKey, so
+// they never need invalidating. Implementations must be safe for
+// concurrent use.
+type RenderCache interface {
+	// Get returns the body rendered for key, if kept.
+	Get(key string) (renderedBody, bool)
+	// Put keeps body as rendered for key.
+	Put(key string, body renderedBody) error
+}
+
+// openRenderCache opens the cache configured in cfg, or returns nil when
+// rendered posts aren't kept.
+func openRenderCache(cfg ContentConfig) (RenderCache, error) {
+	if cfg.RenderCacheDir == "" {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(cfg.RenderCacheDir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := diskRenderCache{dir: cfg.RenderCacheDir}
+	go c.prune(renderCacheExpiry)
+
+	return c, nil
+}
+
+// diskRenderCache keeps each rendered post in a JSON file of its own under
+// dir, named after its key.
+type diskRenderCache struct {
+	dir string
+}
+
+func (c diskRenderCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c diskRenderCache) Get(key string) (renderedBody, bool) {
+	path := c.path(key)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("reading rendered post", "file", path, "error", err)
+		}
+		return renderedBody{}, false
+	}
+
+	var body renderedBody
+	err = json.Unmarshal(b, &body)
+	if err != nil {
+		slog.Warn("reading rendered post", "file", path, "error", err)
+		return renderedBody{}, false
+	}
+
+	// Used entries are kept from expiring, see prune.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return body, true
+}
+
+func (c diskRenderCache) Put(key string, body renderedBody) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, b)
+}
+
+// prune removes the entries unused for longer than expiry: those of posts
+// since changed or removed, and of previous versions of the blog.
+func (c diskRenderCache) prune(expiry time.Duration) {
+	removed := 0
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if time.Since(info.ModTime()) > expiry && os.Remove(path) == nil {
+			removed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		slog.Warn("pruning rendered posts", "dir", c.dir, "error", err)
+	}
+	if removed > 0 {
+		slog.Info("pruned rendered posts", "dir", c.dir, "removed", removed)
+	}
+}
+
+// renderFingerprint identifies what rendering depends on besides the
+// posts themselves: the blog's own code, the config rendering is set up
+// from and the shortcode templates.
+func renderFingerprint(cfg *Config) (string, error) {
+	h := sha256.New()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	err = json.NewEncoder(h).Encode([]any{cfg.BaseURL, cfg.Markdown, cfg.Images, cfg.Links})
+	if err != nil {
+		return "", err
+	}
+
+	files, err := filepath.Glob(filepath.Join(cfg.Markdown.ShortcodesDir, "*.html"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(filepath.Base(file) + "\x00"))
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheKey is the render cache key of a post: the hash of its file, the
+// prefix its heading ids are namespaced by and the renderer's fingerprint.
+func (r *MarkdownRenderer) cacheKey(hash, idPrefix string) string {
+	sum := sha256.Sum256([]byte(r.fingerprint + "\x00" + hash + "\x00" + idPrefix))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// updatedAfter is how long after its date a post must have changed to
+// show as updated, so that fixing typos on the day doesn't count.
+const updatedAfter = 24 * time.Hour
+
+// revision is what's remembered of a post file: the hash of its content
+// and when that content was first seen.
+type revision struct {
+	Hash     string    `json:"hash"`
+	Modified time.Time `json:"modified"`
+}
+
+// Revisions remembers the content of every post file across restarts, so
+// posts are only taken as modified when their content changes. File
+// modification times change without that, such as when the git source
+// checks out the content again or files are copied to a new server.
+type Revisions struct {
+	// path is the file revisions are kept in, or empty to keep them in
+	// memory only.
+	path string
+
+	mu sync.Mutex
+	// bySource maps each content source to its files' revisions.
+	bySource map[string]map[string]revision
+}
+
+var (
+	revisionsMu sync.Mutex
+	// revisions are the loaded revisions by their file.
+	revisions = map[string]*Revisions{}
+)
+
+// loadRevisions returns the revisions kept in path, content.revisions_file,
+// shared by every store keeping them there and read the first time.
+func loadRevisions(path string) *Revisions {
+	revisionsMu.Lock()
+	defer revisionsMu.Unlock()
+
+	if r, ok := revisions[path]; ok {
+		return r
+	}
+	r := &Revisions{path: path, bySource: map[string]map[string]revision{}}
+	revisions[path] = r
+	if r.path == "" {
+		return r
+	}
+
+	b, err := os.ReadFile(r.path)
+	if err == nil {
+		err = json.Unmarshal(b, &r.bySource)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("reading post revisions, posts count as unmodified since their files were", "file", r.path, "error", err)
+		r.bySource = map[string]map[string]revision{}
+	}
+
+	return r
+}
+
+// contentHash identifies the content of a post file.
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// apply sets the DateModified of the posts loaded from source: when their
+// content last changed, and no earlier than their Date. Files whose hash
+// changed count as modified now, unless their modification time says
+// when; files never seen before as of their modification time.
+func (r *Revisions) apply(source string, posts []PostData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.bySource[source]
+	current := make(map[string]revision, len(posts))
+	changed := len(previous) != len(posts)
+	for i, post := range posts {
+		rev, ok := previous[post.File]
+		if !ok || rev.Hash != post.Hash {
+			modified := post.ModTime
+			if ok && (modified.IsZero() || !modified.After(rev.Modified)) {
+				modified = time.Now()
+			}
+			rev = revision{Hash: post.Hash, Modified: modified.UTC().Truncate(time.Second)}
+			changed = true
+		}
+		current[post.File] = rev
+
+		posts[i].DateModified = rev.Modified
+		if posts[i].DateModified.Before(post.Date) {
+			posts[i].DateModified = post.Date
+		}
+	}
+	r.bySource[source] = current
+
+	if changed && r.path != "" {
+		err := r.save()
+		if err != nil {
+			slog.Warn("saving post revisions", "file", r.path, "error", err)
+		}
+	}
+}
+
+func (r *Revisions) save() error {
+	b, err := json.MarshalIndent(r.bySource, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(r.path, b)
+}
+
+// Updated reports whether the post changed well after it was published,
+// see updatedAfter.
+func (post PostData) Updated() bool {
+	return !post.Date.IsZero() && post.DateModified.Sub(post.Date) >= updatedAfter
+}
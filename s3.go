@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3Source mirrors the objects under a prefix of an S3 bucket into dir and
+// reads posts from there. Any store speaking the S3 API works, such as
+// Google Cloud Storage at https://storage.googleapis.com with HMAC keys,
+// MinIO or R2. Requests are signed with AWS Signature Version 4, or sent
+// unsigned for public buckets when no access key is set.
+type s3Source struct {
+	cfg    S3Config
+	dir    string
+	client *http.Client
+
+	mu sync.Mutex
+	// etags are the ETags of the objects in dir, by path under the
+	// prefix, so unchanged objects aren't downloaded again.
+	etags map[string]string
+}
+
+func newS3Source(cfg S3Config, dir string) *s3Source {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+
+	return &s3Source{
+		cfg:    cfg,
+		dir:    dir,
+		client: &http.Client{Timeout: fetchTimeout},
+		etags:  map[string]string{},
+	}
+}
+
+func (src *s3Source) Load() (fs.FS, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	objects, err := src.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, src.cfg.Prefix)
+		if name == "" || strings.HasSuffix(name, "/") {
+			// Folder placeholders some consoles create.
+			continue
+		}
+		// Keys are arbitrary strings, which mustn't escape dir.
+		if !fs.ValidPath(name) {
+			slog.Warn("skipping object with unusable key", "key", obj.Key)
+			continue
+		}
+		keep[name] = true
+
+		file := filepath.Join(src.dir, filepath.FromSlash(name))
+		if _, err := os.Stat(file); err == nil && src.etags[name] == obj.ETag {
+			continue
+		}
+
+		err = src.download(ctx, obj.Key, file)
+		if err != nil {
+			return nil, err
+		}
+		src.etags[name] = obj.ETag
+	}
+
+	// Objects deleted from the bucket go away locally too.
+	err = os.MkdirAll(src.dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(src.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(src.dir, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); !keep[name] {
+			delete(src.etags, name)
+			return os.Remove(path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return os.DirFS(src.dir), nil
+}
+
+func (src *s3Source) String() string {
+	return src.dir
+}
+
+// s3Object is an entry of a ListObjectsV2 response.
+type s3Object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+}
+
+// list returns every object under the prefix, following continuation
+// tokens past the 1000 objects a response holds.
+func (src *s3Source) list(ctx context.Context) ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {src.cfg.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := src.get(ctx, "", query)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing s3://%s/%s: %w", src.cfg.Bucket, src.cfg.Prefix, err)
+		}
+
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// download writes the object at key to file.
+func (src *s3Source) download(ctx context.Context, key, file string) error {
+	resp, err := src.get(ctx, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fetching s3://%s/%s: %w", src.cfg.Bucket, key, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, content)
+}
+
+// get requests key in the bucket, or the bucket itself when key is empty,
+// using path style URLs, which every S3 compatible store understands.
+// Responses other than 200 OK are turned into errors.
+func (src *s3Source) get(ctx context.Context, key string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.cfg.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	path := req.URL.EscapedPath() + "/" + awsEscape(src.cfg.Bucket, false)
+	if key != "" {
+		path += "/" + awsEscape(key, true)
+	}
+	req.URL.RawPath = path
+	req.URL.Path, err = url.PathUnescape(path)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = awsQuery(query)
+
+	if src.cfg.AccessKey != "" {
+		signV4(req, src.cfg.Region, "s3", src.cfg.AccessKey, src.cfg.SecretKey, time.Now())
+	}
+
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// S3 explains errors in an XML body.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 GET /%s/%s: %s: %s", src.cfg.Bucket, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+// emptySHA256 is the hash of an empty payload, which GET requests have.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signV4 signs req with AWS Signature Version 4, covering the host and
+// every header set on req. Only requests without a body are supported.
+func signV4(req *http.Request, region, service, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsQuery encodes query the way Signature Version 4 canonicalizes it,
+// sorted by name, so the encoded query can be signed as is.
+func awsQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and
+// slashes if keepSlash is set, as Signature Version 4 requires.
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
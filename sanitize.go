@@ -0,0 +1,45 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// sanitizePolicy is bluemonday's policy for user generated content plus
+// the markup the renderer itself produces: highlighted code, footnote
+// previews, heading anchors, task lists, math, diagrams, galleries and responsive images.
+func sanitizePolicy(cfg MarkdownConfig) *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	classes := `language-[\w+#-]+|footnotes?|footnote-ref|footnote-backref|heading-anchor|math|math-inline|math-display|mermaid|` +
+		`code-header|code-filename|code-copy|diff-add|diff-del|diff-hunk|gallery|gallery-item|` + regexp.QuoteMeta(codeBlockClass(cfg))
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(` + classes + `)( (` + classes + `))*$`)).Globally()
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|endnotes|backlink)$`)).Globally()
+
+	// Chroma highlights with inline styles.
+	p.AllowStyles("color", "background-color", "font-weight", "font-style", "text-decoration", "margin-right", "padding").
+		OnElements("pre", "span")
+	p.AllowStyles("display").MatchingEnum("grid", "flex").OnElements("pre", "span")
+	p.AllowStyles("white-space").MatchingEnum("pre").OnElements("span")
+	p.AllowStyles("user-select", "-webkit-user-select").MatchingEnum("none").OnElements("span")
+
+	p.AllowAttrs("data-footnote", "aria-label").OnElements("a")
+	p.AllowAttrs("target").Matching(regexp.MustCompile(`^_blank$`)).OnElements("a")
+	p.AllowAttrs("data-lang").OnElements("div")
+	// Lightboxes of galleries and figures.
+	p.AllowAttrs("data-lightbox", "data-title").OnElements("a")
+	// Copy buttons of code blocks.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^button$`)).OnElements("button")
+	p.AllowAttrs("hidden").OnElements("button")
+
+	// Task list checkboxes.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	p.AllowElements("picture")
+	p.AllowAttrs("type", "srcset").OnElements("source")
+	p.AllowAttrs("srcset", "sizes", "loading", "decoding", "width", "height").OnElements("img")
+
+	return p
+}
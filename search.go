@@ -0,0 +1,269 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	xhtml "golang.org/x/net/html"
+)
+
+// Number of words shown on either side of the first match in a snippet.
+const snippetRadius = 15
+
+// titleWeight makes matches in the title count more than body matches.
+const titleWeight = 3
+
+// SearchIndex is an in-memory inverted index over post titles,
+// descriptions, and rendered text.
+type SearchIndex struct {
+	mu    sync.RWMutex
+	docs  []searchDoc
+	terms map[string]map[int]int
+}
+
+type searchDoc struct {
+	post PostData
+	text string
+}
+
+type SearchResult struct {
+	Post    PostData
+	Snippet template.HTML
+}
+
+// NewSearchIndex returns an index that is rebuilt whenever store reloads.
+func NewSearchIndex(store PostStore) *SearchIndex {
+	index := &SearchIndex{}
+	store.OnReload(index.Build)
+
+	return index
+}
+
+// Build replaces the indexed documents with posts.
+func (index *SearchIndex) Build(posts []PostData) {
+	docs := make([]searchDoc, len(posts))
+	terms := map[string]map[int]int{}
+
+	add := func(doc int, text string, weight int) {
+		for _, term := range searchTerms(text) {
+			if terms[term] == nil {
+				terms[term] = map[int]int{}
+			}
+			terms[term][doc] += weight
+		}
+	}
+
+	for i, post := range posts {
+		docs[i] = searchDoc{post: post, text: post.Text()}
+		add(i, post.Title, titleWeight)
+		add(i, post.Description, 1)
+		add(i, docs[i].text, 1)
+	}
+
+	index.mu.Lock()
+	index.docs = docs
+	index.terms = terms
+	index.mu.Unlock()
+}
+
+// Search returns the posts containing every term of query, best matches
+// first.
+func (index *SearchIndex) Search(query string) []SearchResult {
+	queryTerms := searchTerms(query)
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var scores map[int]int
+	for _, term := range queryTerms {
+		matches := index.terms[term]
+		if scores == nil {
+			scores = make(map[int]int, len(matches))
+			for doc, score := range matches {
+				scores[doc] = score
+			}
+			continue
+		}
+
+		for doc := range scores {
+			if score, ok := matches[doc]; ok {
+				scores[doc] += score
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	docs := make([]int, 0, len(scores))
+	for doc := range scores {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if scores[docs[i]] != scores[docs[j]] {
+			return scores[docs[i]] > scores[docs[j]]
+		}
+		return docs[i] < docs[j]
+	})
+
+	results := make([]SearchResult, len(docs))
+	for i, doc := range docs {
+		results[i] = SearchResult{
+			Post:    index.docs[doc].post,
+			Snippet: snippet(index.docs[doc].text, queryTerms),
+		}
+	}
+
+	return results
+}
+
+// SearchHandler renders the results for ?q=.
+func SearchHandler(index *SearchIndex) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := strings.TrimSpace(ctx.Query("q"))
+
+		var results []SearchResult
+		if query != "" {
+			results = index.Search(query)
+		}
+
+		if !previewing(ctx) {
+			now := requestTime(ctx)
+			published := results[:0]
+			for _, result := range results {
+				if result.Post.Listed(now) {
+					published = append(published, result)
+				}
+			}
+			results = published
+		}
+
+		renderHTML(ctx, http.StatusOK, "search.html", gin.H{
+			"Title":   "Search",
+			"Query":   query,
+			"Results": results,
+		})
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// searchTerms splits text into lowercased words.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+
+	return words
+}
+
+// snippet returns an HTML excerpt of text around the first occurrence of
+// any of terms, with every matching word wrapped in <mark>.
+func snippet(text string, terms []string) template.HTML {
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	type span struct{ start, end int }
+	var words []span
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			words = append(words, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, span{start, len(text)})
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	first := 0
+	for i, w := range words {
+		if wanted[strings.ToLower(text[w.start:w.end])] {
+			first = i
+			break
+		}
+	}
+
+	from := max(first-snippetRadius, 0)
+	to := min(first+snippetRadius, len(words)-1)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("… ")
+	}
+	pos := words[from].start
+	for _, w := range words[from : to+1] {
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		word := html.EscapeString(text[w.start:w.end])
+		if wanted[strings.ToLower(text[w.start:w.end])] {
+			word = "<mark>" + word + "</mark>"
+		}
+		b.WriteString(word)
+		pos = w.end
+	}
+	if to < len(words)-1 {
+		b.WriteString(" …")
+	}
+
+	return template.HTML(b.String())
+}
+
+// inlineElements don't break words, so no space is added around them when
+// their markup is stripped.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "code": true, "del": true, "em": true,
+	"i": true, "mark": true, "s": true, "small": true, "span": true,
+	"strong": true, "sub": true, "sup": true,
+}
+
+// stripHTML returns the text content of an HTML fragment, dropping tags
+// and the contents of script and style elements.
+func stripHTML(fragment string) string {
+	var b strings.Builder
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(fragment))
+	skip := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case xhtml.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "script" || string(name) == "style" {
+				if tokenType == xhtml.StartTagToken {
+					skip++
+				} else if tokenType == xhtml.EndTagToken && skip > 0 {
+					skip--
+				}
+			}
+			if !inlineElements[string(name)] {
+				b.WriteByte(' ')
+			}
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.Write(tokenizer.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reservedSections are names the blog's own routes take, which sections
+// can't use.
+var reservedSections = map[string]bool{
+	"posts": true, "page": true, "tags": true, "categories": true, "series": true,
+	"authors": true, "search": true, "archive": true, "all": true, "api": true,
+	"static": true, "images": true, "admin": true, "ap": true, "hooks": true,
+	"subscribe": true, "unsubscribe": true, "webmention": true, "metrics": true,
+	"healthz": true, "readyz": true,
+}
+
+// postSection works out the section of the post at path: the Section
+// frontmatter, else the section directory it is in, such as
+// markdown/projects/ or markdown/id/projects/. It is empty for posts
+// outside of sections.
+func postSection(cfg *Config, dir, path, section string) string {
+	if section != "" {
+		if slices.Contains(cfg.Sections, section) {
+			return section
+		}
+		slog.Warn("unknown Section, using the post's directory", "file", path, "Section", section)
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return ""
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) > 1 && slices.Contains(cfg.Languages, parts[0]) {
+		parts = parts[1:]
+	}
+	if len(parts) > 1 && slices.Contains(cfg.Sections, parts[0]) {
+		return parts[0]
+	}
+
+	return ""
+}
+
+// sectionPrefix is the path prefix of section's pages, such as
+// "/projects", or empty outside of sections.
+func sectionPrefix(section string) string {
+	if section == "" {
+		return ""
+	}
+
+	return "/" + section
+}
+
+// SectionMiddleware marks requests as listing section's posts only.
+func SectionMiddleware(section string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Section", section)
+		ctx.Next()
+	}
+}
+
+// requestSection returns the section of the current request's route
+// group, empty outside of them.
+func requestSection(ctx *gin.Context) string {
+	return ctx.GetString("Section")
+}
+
+// postsInSection returns the posts in section, reusing the posts slice.
+func postsInSection(posts []PostData, section string) []PostData {
+	matched := posts[:0]
+	for _, post := range posts {
+		if post.Section == section {
+			matched = append(matched, post)
+		}
+	}
+
+	return matched
+}
+
+// sectionTemplate returns the template a section has of its own for
+// kind, index or post: the one section_templates names, else one named
+// after the section, such as notes_index.html for the index of notes or
+// notes_post.html for its posts, or else fallback, as it is outside of
+// sections.
+func sectionTemplate(cfg *Config, section, kind, fallback string) string {
+	if section == "" {
+		return fallback
+	}
+	if name := cfg.SectionTemplates[section].template(kind); name != "" {
+		return name
+	}
+	if !layoutExists(cfg, section+"_"+kind) {
+		return fallback
+	}
+
+	return section + "_" + kind + ".html"
+}
+
+// template returns the template configured for kind, index or post.
+func (t SectionTemplates) template(kind string) string {
+	if kind == "index" {
+		return t.Index
+	}
+
+	return t.Post
+}
+
+// checkSectionTemplates reports the first template section_templates
+// of cfg names that isn't among templates.
+func checkSectionTemplates(cfg *Config, templates *template.Template) error {
+	for section, t := range cfg.SectionTemplates {
+		for _, name := range []string{t.Index, t.Post} {
+			if name != "" && templates.Lookup(name) == nil {
+				return fmt.Errorf("section_templates: no template %s for section %s", name, section)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sectionRoutes serves the posts of every section under its prefix, such
+// as /projects/:slug, along with the section's index and feeds. route is
+// the root or a language's group.
+func sectionRoutes(route gin.IRouter, cfg *Config, store PostStore, comments CommentStore, views *ViewCounter, likes *Likes, referrers *Referrers, mentions *Webmentions) {
+	for _, section := range cfg.Sections {
+		prefix := sectionPrefix(section)
+		// Post pages aren't in the section group: their series and
+		// related posts may be in other sections.
+		route.GET(prefix+"/:slug", PostHandler(store, comments, views, likes, referrers, mentions))
+
+		group := route.Group(prefix, SectionMiddleware(section))
+		group.GET("/", IndexHandler(store, views))
+		group.GET("/page/:page", IndexHandler(store, views))
+		feedRoutes(group, cfg, "", store)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSectionTemplates(t *testing.T) {
+	content := writeContent(t, map[string]string{
+		"notes/jotted.md":   "---\nTitle: Jotted\nDate: 2025-01-01\nSlug: jotted\n---\n\nA note.\n",
+		"projects/built.md": "---\nTitle: Built\nDate: 2025-01-02\nSlug: built\n---\n\nA project.\n",
+	})
+	templates := writeContent(t, map[string]string{
+		"notes_index.html": `<p class="notes-index">{{ range .Posts }}{{ .Title }} {{ end }}</p>`,
+		"notes_post.html":  `<p class="notes-post">{{ .Title }}</p>`,
+	})
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.ContentDir = content
+		cfg.TemplatesDir = templates
+		cfg.Sections = []string{"notes", "projects"}
+	})
+
+	for _, tc := range []struct {
+		path, want, notWant string
+	}{
+		{"/notes/", `<p class="notes-index">Jotted </p>`, "<html"},
+		{"/notes/jotted", `<p class="notes-post">Jotted</p>`, "<html"},
+		{"/projects/", `href="/projects/built"`, "notes-index"},
+		{"/projects/built", "A project.", "notes-post"},
+	} {
+		w := get(route, tc.path)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d", tc.path, w.Code)
+			continue
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tc.want) || strings.Contains(body, tc.notWant) {
+			t.Errorf("GET %s rendered %.200q, want %q without %q", tc.path, body, tc.want, tc.notWant)
+		}
+	}
+}
+
+func TestSectionTemplatesConfig(t *testing.T) {
+	content := writeContent(t, map[string]string{
+		"notes/jotted.md":   "---\nTitle: Jotted\nDate: 2025-01-01\nSlug: jotted\n---\n\nA note.\n",
+		"projects/built.md": "---\nTitle: Built\nDate: 2025-01-02\nSlug: built\n---\n\nA project.\n",
+	})
+	templates := writeContent(t, map[string]string{
+		"short_list.html":  `<p class="short-list">{{ range .Posts }}{{ .Title }} {{ end }}</p>`,
+		"notes_index.html": `<p class="notes-index">unused</p>`,
+	})
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.ContentDir = content
+		cfg.TemplatesDir = templates
+		cfg.Sections = []string{"notes", "projects"}
+		cfg.SectionTemplates = map[string]SectionTemplates{"notes": {Index: "short_list.html"}}
+	})
+
+	for _, tc := range []struct {
+		path, want, notWant string
+	}{
+		{"/notes/", `<p class="short-list">Jotted </p>`, "notes-index"},
+		{"/notes/jotted", "A note.", "short-list"},
+		{"/projects/", `href="/projects/built"`, "short-list"},
+	} {
+		body := get(route, tc.path).Body.String()
+		if !strings.Contains(body, tc.want) || strings.Contains(body, tc.notWant) {
+			t.Errorf("GET %s rendered %.200q, want %q without %q", tc.path, body, tc.want, tc.notWant)
+		}
+	}
+}
+
+func TestSectionTemplatesValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Sections = []string{"notes"}
+	cfg.SectionTemplates = map[string]SectionTemplates{"projects": {Index: "index.html"}}
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted templates for a section that isn't one")
+	}
+
+	cfg = testConfig(t)
+	cfg.Sections = []string{"notes"}
+	cfg.SectionTemplates = map[string]SectionTemplates{"notes": {Post: "missing.html"}}
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewContentStore(dirSource{dir: cfg.ContentDir}, renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	_, err = NewRouter(&cfg, Deps{Store: store, Renderer: renderer})
+	if err == nil || !strings.Contains(err.Error(), "missing.html") {
+		t.Errorf("NewRouter error %v, want one naming the missing template", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SeriesNav places a post within its series, for the navigation at the
+// bottom of the post. Prev and Next are nil at either end of the series.
+type SeriesNav struct {
+	Name  string
+	URL   string
+	Part  int
+	Total int
+	Prev  *PostSummary
+	Next  *PostSummary
+}
+
+func seriesURL(series string) string {
+	return "/series/" + url.PathEscape(strings.ToLower(series))
+}
+
+// postsInSeries returns the posts of a series, matched case
+// insensitively, ordered by SeriesPart and then by date.
+func postsInSeries(posts []PostData, series string) []PostData {
+	var matched []PostData
+	for _, post := range posts {
+		if post.Series != "" && strings.EqualFold(post.Series, series) {
+			matched = append(matched, post)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].SeriesPart != matched[j].SeriesPart {
+			return matched[i].SeriesPart < matched[j].SeriesPart
+		}
+		return matched[i].Date.Before(matched[j].Date)
+	})
+
+	return matched
+}
+
+// seriesNav returns the navigation of post within its series among posts,
+// or nil when the post isn't part of one.
+func seriesNav(posts []PostData, post PostData) *SeriesNav {
+	if post.Series == "" {
+		return nil
+	}
+
+	parts := postsInSeries(posts, post.Series)
+	for i, part := range parts {
+		if part.File != post.File {
+			continue
+		}
+
+		nav := &SeriesNav{
+			Name:  parts[0].Series,
+			URL:   langPrefix(post.Lang) + seriesURL(post.Series),
+			Part:  i + 1,
+			Total: len(parts),
+		}
+		if i > 0 {
+			prev := summarize(parts[i-1])
+			nav.Prev = &prev
+		}
+		if i < len(parts)-1 {
+			next := summarize(parts[i+1])
+			nav.Next = &next
+		}
+
+		return nav
+	}
+
+	return nil
+}
+
+// SeriesHandler lists the parts of a series in order.
+func SeriesHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		series := ctx.Param("name")
+		posts := postsInSeries(visiblePosts(ctx, store), series)
+		if len(posts) == 0 {
+			notFound(ctx, "No posts in series "+series)
+			return
+		}
+
+		// Use the series' own spelling rather than the lowercased path.
+		series = posts[0].Series
+
+		setLastModified(ctx, posts...)
+		renderHTML(ctx, http.StatusOK, "list.html", gin.H{
+			"Title":   series,
+			"Heading": "Series: " + series,
+			"Posts":   posts,
+		})
+	}
+}
@@ -2,182 +2,1074 @@ package main
 
 import (
 	"bytes"
-	"html/template"
-	"io"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/adrg/frontmatter"
-	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
-	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
-	"gopkg.in/yaml.v2"
 )
 
 func main() {
-	gin.SetMode(gin.ReleaseMode)
-	route := gin.Default()
-	route.Use(gzip.Gzip(gzip.DefaultCompression))
+	configPath := flag.String("config", "config.yaml", "path to the YAML config file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-config file] [serve | build [-out dir] [-force] | checklinks [-external] | digest [-days n] [-out file | -send] | export [-out file] | import [-force] file | import -from hugo|jekyll dir | new title... | validate | lint [file...]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	route.LoadHTMLGlob("templates/*")
+	loaded, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := &loaded
 
-	route.GET("/posts/:slug", PostHandler(FileReader{}))
-	route.GET("/", func(ctx *gin.Context) {
-		posts, err := loadMarkdownPosts("./markdown")
+	if len(cfg.Sites) > 0 && (flag.Arg(0) == "" || flag.Arg(0) == "serve") {
+		err = serveSites(cfg, *configPath)
 		if err != nil {
 			log.Fatal(err)
 		}
+		return
+	}
 
-		ctx.HTML(http.StatusOK, "index.html", gin.H{
-			"Posts": posts,
-		})
+	gin.SetMode(gin.ReleaseMode)
+	renderer, err := NewMarkdownRenderer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "", "serve":
+		err = serve(cfg, renderer)
+	case "build":
+		err = build(cfg, flag.Args()[1:], renderer)
+	case "new":
+		err = newPost(cfg, flag.Args()[1:])
+	case "validate":
+		err = validate(cfg)
+	case "lint":
+		err = lintProse(cfg, flag.Args()[1:])
+	case "digest":
+		err = writeDigest(cfg, flag.Args()[1:], renderer)
+	case "checklinks":
+		err = checkLinks(cfg, flag.Args()[1:], renderer)
+	case "export":
+		err = exportArchive(cfg, flag.Args()[1:], renderer)
+	case "import":
+		err = importArchive(cfg, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serve(cfg *Config, renderer *MarkdownRenderer) error {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		return err
+	}
+
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewContentStore(source, renderer)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	err = store.Watch(time.Duration(cfg.Content.Refresh))
+	if err != nil {
+		return err
+	}
+	store.PublishScheduled(time.Duration(cfg.Content.PublishCheck))
+
+	pages, err := NewPageStore(cfg.PagesDir, renderer)
+	if err != nil {
+		return err
+	}
+	if pages != nil {
+		defer pages.Close()
+		err = pages.Watch(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	comments, err := openCommentStore(cfg.Comments)
+	if err != nil {
+		return err
+	}
+	if comments != nil {
+		defer comments.Close()
+	}
+
+	// The blog is still worth serving without view counts.
+	views, err := openViewCounter(cfg.Views)
+	if err != nil {
+		slog.Warn("opening view counter, views won't be counted", "path", cfg.Views.Path, "error", err)
+	}
+	if views != nil {
+		defer views.Close()
+	}
+
+	likes, err := openLikes(cfg.Likes)
+	if err != nil {
+		slog.Warn("opening likes, posts can't be liked", "path", cfg.Likes.Path, "error", err)
+	}
+	if likes != nil {
+		defer likes.Close()
+	}
+
+	referrers, err := openReferrers(cfg.Referrers)
+	if err != nil {
+		slog.Warn("opening referrers, they won't be collected", "path", cfg.Referrers.Path, "error", err)
+	}
+	if referrers != nil {
+		defer referrers.Close()
+	}
+
+	// Like view counts, not worth failing to start over.
+	analytics, err := openAnalytics(cfg.Analytics)
+	if err != nil {
+		slog.Warn("opening analytics, page views won't be counted", "path", cfg.Analytics.Path, "error", err)
+	}
+	if analytics != nil {
+		defer analytics.Close()
+	}
+
+	subscribers, err := openSubscriberStore(cfg.Newsletter)
+	if err != nil {
+		return err
+	}
+	if subscribers != nil {
+		defer subscribers.Close()
+	}
+
+	mentions, err := openWebmentions(cfg.Webmention, cfg.BaseURL, systemClock{})
+	if err != nil {
+		return err
+	}
+	if mentions != nil {
+		defer mentions.Close()
+		store.OnReload(func(posts []PostData) { go mentions.Send(posts) })
+	}
+
+	ap, err := openActivityPub(cfg.ActivityPub, cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	if ap != nil {
+		defer ap.Close()
+		store.OnReload(func(posts []PostData) { go ap.Deliver(posts) })
+	}
+
+	accessLog, err := openAccessLog(cfg.AccessLog, "/healthz", "/readyz")
+	if err != nil {
+		return err
+	}
+	if accessLog != nil {
+		defer accessLog.Close()
+	}
+
+	indexNow := newIndexNow(cfg)
+	indexNow.Watch(store)
+	indexNow.Watch(optionalStore(pages))
+	newWebSub(cfg).Watch(store)
+
+	route, err := NewRouter(cfg, Deps{
+		Store:       store,
+		Pages:       optionalStore(pages),
+		Renderer:    renderer,
+		Site:        site,
+		Comments:    comments,
+		Views:       views,
+		Likes:       likes,
+		Referrers:   referrers,
+		Analytics:   analytics,
+		Subscribers: subscribers,
+		Mentions:    mentions,
+		ActivityPub: ap,
+		Middleware:  []gin.HandlerFunc{RequestLogger(time.Duration(cfg.SlowRequestThreshold), "/healthz", "/readyz", "/metrics", "/debug/pprof/*"), accessLog.Middleware()},
 	})
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           route,
+		ReadHeaderTimeout: time.Duration(cfg.ReadTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 4)
+	servers := []*http.Server{server}
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		metrics := metricsServer(cfg.Metrics.Addr, cfg.Metrics.Token)
+		servers = append(servers, metrics)
+
+		go func() {
+			slog.Info("listening", "addr", cfg.Metrics.Addr, "metrics", true)
+			errs <- metrics.ListenAndServe()
+		}()
+	}
+	if cfg.Pprof.Enabled && cfg.Pprof.Addr != "" {
+		profiles := pprofServer(cfg.Pprof.Addr, cfg.Pprof.Token)
+		servers = append(servers, profiles)
+
+		go func() {
+			slog.Info("listening", "addr", cfg.Pprof.Addr, "pprof", true)
+			errs <- profiles.ListenAndServe()
+		}()
+	}
+	if len(cfg.TLS.Hosts) > 0 {
+		manager := autocertManager(cfg.TLS)
+		server.TLSConfig = tlsConfig(manager)
+
+		redirect := redirectServer(cfg.TLS, manager)
+		servers = append(servers, redirect)
+
+		go func() {
+			slog.Info("listening", "addr", cfg.TLS.HTTPAddr, "redirect", "https")
+			errs <- redirect.ListenAndServe()
+		}()
+		go func() {
+			slog.Info("listening", "addr", cfg.Addr, "tls", cfg.TLS.Hosts)
+			errs <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			slog.Info("listening", "addr", cfg.Addr)
+			errs <- server.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Let in-flight requests finish, but don't wait forever on them.
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = shutdownErr
+		}
+	}
 
-	route.Static("/static", "static")
-	route.Run(":8080")
+	return err
 }
 
-type PostData struct {
-	Title                   string `yaml:"Title"`
-	Slug                    string `yaml:"Slug"`
-	Date                    string `yaml:"Date"`
-	Description             string `yaml:"Description"`
-	MetaDescription         string `yaml:"MetaDescription"`
-	MetaPropertyTitle       string `yaml:"MetaPropertyTitle"`
-	MetaPropertyDescription string `yaml:"MetaPropertyDescription"`
-	MetaOgURL               string `yaml:"MetaOgURL"`
-	Author                  Author `yaml:"author"`
-	Content                 template.HTML
+// NewRouter sets up every route of the blog on the services in deps, as
+// cfg says. Handlers get cfg from their request, see requestConfig. The
+// returned handler can be served, or exercised with httptest.
+func NewRouter(cfg *Config, deps Deps) (*gin.Engine, error) {
+	clock := deps.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	store, pages, site := deps.Store, deps.Pages, deps.Site
+	comments, views, analytics := deps.Comments, deps.Views, deps.Analytics
+	subscribers, mentions, ap := deps.Subscribers, deps.Mentions, deps.ActivityPub
+	likes, referrers := deps.Likes, deps.Referrers
+
+	searchIndex := NewSearchIndex(store)
+
+	assets, err := loadAssets(staticFS(cfg))
+	if err != nil {
+		slog.Warn("fingerprinting static files", "theme", cfg.Theme, "dirs", staticDirs(cfg), "error", err)
+	}
+	assets.dev = cfg.Dev
+
+	route := gin.New()
+	// Only fails for malformed entries, which config validation rules out.
+	_ = route.SetTrustedProxies(cfg.TrustedProxies)
+	route.Use(ConfigMiddleware(cfg))
+	route.Use(deps.Middleware...)
+	route.Use(ClockMiddleware(clock))
+	route.Use(RequestTimeout(time.Duration(cfg.RequestTimeout)))
+	if cfg.Metrics.Enabled {
+		route.Use(Metrics())
+	}
+	route.Use(SecurityHeaders(cfg.Security))
+	route.Use(RateLimit(cfg.RateLimit))
+	// Recovery runs inside Compress so the error page goes through the
+	// same, properly closed, compressed stream as any other response.
+	route.Use(Compress())
+	route.Use(Recovery())
+	route.Use(Conditional())
+	route.Use(SiteDataMiddleware(site))
+	maintenance := newMaintenance(cfg.Maintenance)
+	route.Use(maintenance.Middleware())
+
+	redirects, err := loadRedirects(cfg.RedirectsFile, cfg.DefaultLanguage)
+	if err != nil {
+		slog.Warn("loading redirects", "file", cfg.RedirectsFile, "error", err)
+		redirects = &Redirects{defaultLang: cfg.DefaultLanguage}
+	}
+	store.OnReload(redirects.SetPosts)
+	route.Use(RedirectsMiddleware(redirects))
+
+	nav, err := loadNavigation(cfg.MenuFile)
+	if err != nil {
+		slog.Warn("loading menus", "file", cfg.MenuFile, "error", err)
+	}
+	nav.Watch(store, clock)
+	nav.Watch(pages, clock)
+	route.Use(NavigationMiddleware(nav))
+
+	var cache *PageCache
+	if cfg.Cache.Enabled && !cfg.Dev {
+		cache = NewPageCache(time.Duration(cfg.Cache.TTL), cfg.Cache.MaxEntries)
+		store.OnReload(cache.SetPosts)
+	}
+	// Before the cache, so cached pages are counted too.
+	route.Use(analytics.Middleware())
+	route.Use(cache.Middleware())
+
+	translations, err := loadTranslations(cfg.I18nDir, cfg.Languages)
+	if err != nil {
+		slog.Warn("loading translations", "dir", cfg.I18nDir, "error", err)
+	}
+
+	// Dev mode shows posts that failed to load on every page.
+	problems := func() []Problem {
+		if !cfg.Dev {
+			return nil
+		}
+		if pages == nil {
+			return store.Problems()
+		}
+
+		return append(slices.Clip(store.Problems()), pages.Problems()...)
+	}
+	route.SetFuncMap(templateFuncs(cfg, route, assets, translations, deps.Renderer, newCommentCounts(comments, time.Duration(cfg.Comments.CountTTL)), problems))
+	templates, err := parseTemplates(cfg, route.FuncMap)
+	if err != nil {
+		// Without templates no page can be rendered.
+		return nil, err
+	}
+	err = checkSectionTemplates(cfg, templates)
+	if err != nil {
+		return nil, err
+	}
+	route.SetHTMLTemplate(templates)
+	if cfg.Dev {
+		// Templates are still parsed once above so broken ones fail at
+		// startup rather than on the first request.
+		route.HTMLRender = devTemplates{cfg: cfg, funcs: route.FuncMap}
+	}
+
+	if cfg.Dev {
+		liveReload := NewLiveReload()
+		store.OnReload(func([]PostData) { liveReload.Notify() })
+		liveReload.Watch(append(templateDirs(cfg), staticDirs(cfg)...)...)
+		route.GET(liveReloadPath, liveReload.Handler())
+		route.GET("/debug/content", DebugContentHandler(store, pages))
+	}
+
+	route.GET("/posts/:slug", PostHandler(store, comments, views, likes, referrers, mentions))
+	if cfg.DatePrefixedURLs {
+		route.GET("/:year/:month/:slug", PostHandler(store, comments, views, likes, referrers, mentions))
+	}
+	if mentions != nil {
+		route.POST("/webmention", WebmentionHandler(store, mentions))
+	}
+	if ap != nil {
+		route.GET("/.well-known/webfinger", WebFingerHandler())
+		route.GET("/ap/actor", ActorHandler(ap, site))
+		route.GET("/ap/outbox", OutboxHandler(store))
+		route.GET("/ap/followers", FollowersHandler(ap))
+		route.POST("/ap/inbox", InboxHandler(ap))
+	}
+	if comments != nil {
+		route.POST("/posts/:slug/comments", CommentHandler(store, comments))
+	}
+	if likes != nil {
+		route.POST("/posts/:slug/like", LikeHandler(store, likes))
+	}
+	route.POST("/unlock", UnlockHandler(store, pages))
+	if cfg.Admin.Password != "" {
+		route.GET("/login", LoginHandler())
+		route.POST("/login", LoginHandler())
+		route.POST("/logout", LogoutHandler())
+	}
+	route.GET("/", IndexHandler(store, views))
+	route.GET("/page/:page", IndexHandler(store, views))
+	if cfg.multilingual() {
+		languageRoutes(route, cfg, store, comments, views, likes, referrers, mentions)
+	}
+	sectionRoutes(route, cfg, store, comments, views, likes, referrers, mentions)
+
+	route.GET("/tags", TagsHandler(store))
+	route.GET("/tags/:tag", TagHandler(store))
+	feedRoutes(route, cfg, "/tags/:tag", store)
+	route.GET("/categories/:category", CategoryHandler(store))
+	route.GET("/series/:name", SeriesHandler(store))
+	route.GET("/authors/:name", AuthorHandler(store))
+	feedRoutes(route, cfg, "/authors/:name", store)
+	route.GET("/search", SearchHandler(searchIndex))
+	route.GET("/archive", ArchiveHandler(store))
+	route.GET("/archive/:year", ArchiveHandler(store))
+	route.GET("/archive/:year/:month", ArchiveHandler(store))
+	feedRoutes(route, cfg, "", store)
+	if slices.Contains(cfg.Feeds, "rss") {
+		route.GET("/feeds.opml", OPMLHandler(store))
+	}
+	route.GET("/sitemap.xml", SitemapHandler(store, pages))
+	route.GET("/robots.txt", RobotsHandler())
+	if cfg.IndexNow.Enabled {
+		route.GET(indexNowKeyPath(cfg.IndexNow.Key), IndexNowKeyHandler())
+	}
+	route.GET("/healthz", HealthHandler())
+	route.GET("/readyz", ReadyHandler(store))
+	route.GET("/all", AllPostsHandler(store))
+	route.POST("/theme", ThemeHandler())
+	if cfg.Links.Track {
+		route.GET("/out", OutboundHandler())
+	}
+	if subscribers != nil {
+		route.POST("/subscribe", SubscribeHandler(subscribers))
+		route.GET("/subscribe/confirm", ConfirmHandler(subscribers))
+		route.GET("/unsubscribe", UnsubscribeHandler(subscribers))
+		route.POST("/unsubscribe", UnsubscribeHandler(subscribers))
+	}
+	if cfg.Contact.Enabled {
+		route.GET("/contact", ContactHandler())
+		route.POST("/contact", ContactHandler())
+	}
+	if cfg.Deploy.Secret != "" {
+		route.POST("/hooks/deploy", DeployHandler(store))
+	}
+	if cfg.Admin.Password != "" {
+		adminRoutes(route, cfg, store, deps.Renderer, subscribers, analytics, referrers, maintenance)
+	}
+
+	route.GET("/api/posts", APIPostsHandler(store))
+	route.GET("/api/posts/:slug", APIPostHandler(store))
+	route.GET("/api/posts/:slug/share", ShareHandler(store))
+
+	if len(cfg.Images.Widths) > 0 {
+		route.GET("/images/:width/*name", ImageHandler())
+	}
+	if cfg.Images.OG {
+		route.GET("/og/:file", OGImageHandler(store))
+	}
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr == "" {
+		route.GET("/metrics", MetricsHandler(cfg.Metrics.Token))
+	}
+	if cfg.Pprof.Enabled && cfg.Pprof.Addr == "" {
+		route.Any(pprofRoute, PprofHandler(cfg.Pprof.Token))
+	}
+	route.GET("/static/*filepath", assets.Handler())
+	route.HEAD("/static/*filepath", assets.Handler())
+	route.NoRoute(PageHandler(pages), NoRouteHandler())
+
+	return route, nil
 }
 
-type PostPages struct {
-	Pages []PostData
-	Order int `yaml:"Order"`
+// setPostCacheControl lets clients and the page cache keep published
+// posts for their CacheTTL. Drafts and private posts aren't kept.
+func setPostCacheControl(ctx *gin.Context, post PostData) {
+	switch {
+	case post.Private():
+		ctx.Header("Cache-Control", "private, no-store")
+	case post.Published(requestTime(ctx)):
+		ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(post.CacheTTL.Seconds())))
+	default:
+		ctx.Header("Cache-Control", "no-store")
+	}
 }
 
-type Author struct {
-	Name  string `yaml:"name"`
-	Email string `yaml:"email"`
+// defaultPostCacheTTL is the Cache-Control max-age of post pages that don't
+// set CacheTTL in their frontmatter.
+const defaultPostCacheTTL = 10 * time.Minute
+
+// Layouts accepted for the Date frontmatter field.
+var postDateLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02",
 }
 
-type SlugRender interface {
-	Read(slug string) (string, error)
+func parsePostDate(date string) (time.Time, error) {
+	var err error
+	for _, layout := range postDateLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, strings.TrimSpace(date))
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
 }
 
-type FileReader struct{}
+// sortPostsByDate orders posts newest first. Undated posts sort last,
+// keeping their relative order.
+func sortPostsByDate(posts []PostData) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+}
 
-func (fRead FileReader) Read(slug string) (string, error) {
-	fileRead, err := os.Open("markdown/" + slug + ".md")
-	if err != nil {
-		return "", err
-	}
-	defer fileRead.Close()
-	b, err := io.ReadAll(fileRead)
+// sortPosts orders posts for listings: pinned posts first, then by date
+// or, with by set to "order" as the sort config can be, by Order with
+// unordered posts last. Ties keep newest first.
+func sortPosts(posts []PostData, by string) {
+	sortPostsByDate(posts)
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
 
-	if err != nil {
-		return "", err
+		if by == "order" && a.Order != b.Order {
+			return b.Order == 0 || a.Order != 0 && a.Order < b.Order
+		}
+
+		return false
+	})
+}
+
+// postURL returns the canonical path of a post. Posts in a section are
+// under its prefix. Undated posts keep the /posts/slug form even when date
+// prefixes are enabled in cfg.
+func postURL(cfg *Config, post PostData) string {
+	if post.Section != "" {
+		return langPrefix(post.Lang) + sectionPrefix(post.Section) + "/" + post.Slug
+	}
+	if cfg.DatePrefixedURLs && !post.Date.IsZero() {
+		return langPrefix(post.Lang) + post.Date.Format("/2006/01/") + post.Slug
 	}
 
-	return string(b), nil
+	return langPrefix(post.Lang) + "/posts/" + post.Slug
 }
 
-func loadMarkdownPosts(dir string) ([]PostData, error) {
-	md := goldmark.New()
-	var posts []PostData
+// PostData is a post: its frontmatter followed by what is computed while
+// loading it. Summary is the excerpt of posts without a <!--more-->
+// marker. Order places the post in listings sorted by order, lowest first,
+// and Pinned posts come before all others. Unsafe marks a trusted post
+// that is never sanitized, see MarkdownConfig.Sanitize. Lang is the post's
+// language on multilingual blogs, and Translations its versions in every
+// language, itself included, when it has been translated. Posts sharing a
+// Series are listed together in SeriesPart order, see SeriesHandler.
+// Section is the section the post is in, see Config.Sections. Layout
+// names the template the post is rendered with instead of post.html, such
+// as photo-essay for photo-essay.html, or page.html for standalone pages.
+// FeedContent, full or summary, overrides feed_full_content for the post.
+// Aliases are old slugs or paths of the post that redirect to it, and
+// SyndicatedTo the URLs of copies of the post on other sites. Menu lists
+// the post in menus, under MenuName or its Title, see Navigation. Math
+// loads KaTeX on the post, and is set on post pages containing math;
+// Diagrams likewise loads Mermaid. A post with a PublishAt later than its
+// Date stays hidden until then, see Published. Visibility private or a
+// Password make the post private, see Private. The rendered body is
+// available through Content and the methods next to it, see postBody.
+type PostData struct {
+	Title        string `yaml:"Title"`
+	Slug         string `yaml:"Slug"`
+	RawDate      string `yaml:"Date"`
+	RawPublishAt string `yaml:"PublishAt"`
+	Visibility   string `yaml:"Visibility"`
+	Password     string `yaml:"Password"`
+	Draft        bool   `yaml:"Draft"`
+	Description  string `yaml:"Description"`
+	Summary      string `yaml:"Summary"`
+	Meta         `yaml:",inline"`
+	Author       Author    `yaml:"author"`
+	Tags         []string  `yaml:"Tags"`
+	Category     string    `yaml:"Category"`
+	Series       string    `yaml:"Series"`
+	Aliases      []string  `yaml:"Aliases"`
+	Menu         menuNames `yaml:"Menu"`
+	MenuName     string    `yaml:"MenuName"`
+	MenuWeight   int       `yaml:"MenuWeight"`
+	SyndicatedTo []string  `yaml:"SyndicatedTo"`
+	SeriesPart   int       `yaml:"SeriesPart"`
+	RawCacheTTL  string    `yaml:"CacheTTL"`
+	Order        int       `yaml:"Order"`
+	Pinned       bool      `yaml:"Pinned"`
+	Unsafe       bool      `yaml:"Unsafe"`
+	Math         bool      `yaml:"Math"`
+	Lang         string    `yaml:"Lang"`
+	Section      string    `yaml:"Section"`
+	Layout       string    `yaml:"Layout"`
+	FeedContent  string    `yaml:"FeedContent"`
+	Audio        Episode   `yaml:"Audio"`
+	Diagrams     bool      `yaml:"-"`
+	Date         time.Time `yaml:"-"`
+	PublishAt    time.Time `yaml:"-"`
+	ModTime      time.Time `yaml:"-"`
+	// CacheTTL is how long clients may cache the post, its CacheTTL
+	// frontmatter or defaultPostCacheTTL.
+	CacheTTL time.Duration `yaml:"-"`
+	// Hash identifies the content of the post's file, and DateModified is
+	// when that last changed, see Revisions.
+	Hash         string      `yaml:"-"`
+	DateModified time.Time   `yaml:"-"`
+	URL          string      `yaml:"-"`
+	IsNew        bool        `yaml:"-"`
+	Markdown     string      `yaml:"-"`
+	File         string      `yaml:"-"`
+	Translations []Alternate `yaml:"-"`
+	Related      []PostSummary
+
+	body *postBody
+	// older and newer are the candidates for the posts before and after
+	// this one, nearest first, see computePrevNext.
+	older, newer []PostSummary
+}
+
+// postCache keeps the posts of a load for the next one to reuse, see
+// loadMarkdownPosts.
+type postCache struct {
+	authors map[string]Author
+	byFile  map[string]PostData
+}
+
+// loadMarkdownPosts loads every .md file in fsys, several at a time.
+// Posts are returned in the order of their files, whichever finishes
+// first. Post files are named as if fsys were the directory dir. Posts
+// that can't be read or rendered are skipped and returned as problems, so
+// one broken file doesn't take the others down; err is only for fsys
+// itself being unreadable.
+//
+// With a cache, posts whose files haven't been modified since the previous
+// load are reused rather than read and rendered again, unless the authors
+// changed; the cache is then updated with this load's posts.
+func loadMarkdownPosts(fsys fs.FS, dir string, renderer *MarkdownRenderer, cache *postCache) (posts []PostData, problems []Problem, err error) {
+	authors, err := loadAuthors(renderer.cfg.AuthorsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var previous map[string]PostData
+	if cache != nil && reflect.DeepEqual(cache.authors, authors) {
+		previous = cache.byFile
+	}
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	var files []fs.DirEntry
+	var names []string
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Check file .md
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			var postData PostData
-			var buf bytes.Buffer
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".md") {
+			files = append(files, d)
+			names = append(names, name)
+		}
 
-			// Split content to extract YAML front matter and Markdown body
-			split := strings.SplitN(string(content), "\n---\n", 2)
-			if len(split) > 1 {
-				// Parse YAML front matter -> Convert Markdown to HTML -> Assign HTML content to PostData
-				err = yaml.Unmarshal([]byte(split[0]), &postData)
-				if err != nil {
-					return err
-				}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-				err = md.Convert([]byte(split[1]), &buf)
-				if err != nil {
-					return err
-				}
+	type result struct {
+		post PostData
+		ok   bool
+		err  error
+	}
+	results := make([]result, len(files))
 
-				postData.Content = template.HTML(buf.String())
-			} else {
-				// Handle case where there is no front matter
-				err = md.Convert(content, &buf)
-				if err != nil {
-					return err
+	// Rendering is CPU bound, so there's no point in more workers than
+	// CPUs.
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if post, ok := unchangedPost(previous, dir, names[i], files[i]); ok {
+					results[i] = result{post, true, nil}
+					continue
 				}
 
-				postData.Content = template.HTML(buf.String())
+				post, ok, err := loadMarkdownPost(fsys, dir, names[i], files[i], renderer, authors)
+				results[i] = result{post, ok, err}
 			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
 
-			posts = append(posts, postData)
+	for i, r := range results {
+		if r.err != nil {
+			file := filepath.Join(dir, filepath.FromSlash(names[i]))
+			slog.Warn("skipping post", "file", file, "error", r.err)
+			problems = append(problems, fileProblem(file, r.err))
+			continue
+		}
+		if r.ok {
+			posts = append(posts, r.post)
 		}
+	}
 
-		return nil
-	})
+	if cache != nil {
+		cache.authors = authors
+		cache.byFile = make(map[string]PostData, len(posts))
+		for _, post := range posts {
+			cache.byFile[post.File] = post
+		}
+	}
 
-	if err != nil {
-		return nil, err
+	return posts, problems, nil
+}
+
+// unchangedPost returns the post previously loaded from the file name, if
+// the file hasn't been modified since. What's derived from the other
+// posts is reset, to be computed again along with theirs.
+func unchangedPost(previous map[string]PostData, dir, name string, d fs.DirEntry) (PostData, bool) {
+	post, ok := previous[filepath.Join(dir, filepath.FromSlash(name))]
+	if !ok {
+		return PostData{}, false
 	}
 
-	return posts, nil
+	info, err := d.Info()
+	if err != nil || !info.ModTime().Equal(post.ModTime) {
+		return PostData{}, false
+	}
+
+	post.Translations = nil
+	post.Related = nil
+	post.older, post.newer = nil, nil
+
+	return post, true
 }
 
-func PostHandler(sl SlugRender) gin.HandlerFunc {
-	mdRenderer := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("dracula"),
-			),
-		),
-	)
+// loadMarkdownPost reads the post in the file name of fsys, and renders it
+// unless content.lazy is set, see postBody. ok is false for files that
+// aren't usable as posts, which are logged and skipped.
+func loadMarkdownPost(fsys fs.FS, dir, name string, d fs.DirEntry, renderer *MarkdownRenderer, authors map[string]Author) (PostData, bool, error) {
+	cfg := renderer.cfg
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return PostData{}, false, err
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return PostData{}, false, err
+	}
+
+	var postData PostData
+
+	slug := strings.TrimSuffix(d.Name(), ".md")
+
+	front, body, err := splitFrontmatter(content)
+	if err != nil {
+		return PostData{}, false, err
+	}
+	if front != nil {
+		err = decodeFrontmatter(front, &postData)
+		if err != nil {
+			return PostData{}, false, err
+		}
+	}
+
+	postData.Tags = canonicalTags(cfg.TagAliases, postData.Tags)
+	postData.Markdown = string(body)
+
+	lead, rest, hasMore := bytes.Cut(body, []byte(moreMarker))
+	if hasMore {
+		body = append(lead[:len(lead):len(lead)], rest...)
+	} else {
+		lead = nil
+	}
+	postData.body = &postBody{renderer: renderer, source: body, lead: lead, slug: slug}
+
+	if postData.Slug == "" {
+		postData.Slug = slug
+		if !validSlug(slug) {
+			// Such as "My Post.md".
+			postData.Slug = slugify(slug)
+		}
+	}
+
+	// Slugs end up in URLs and, for static builds, file paths.
+	if !validSlug(postData.Slug) {
+		slog.Warn("skipping post with invalid slug", "file", path, "Slug", postData.Slug)
+		return PostData{}, false, nil
+	}
+
+	if key := postData.Author.Key; key != "" {
+		author, ok := authors[key]
+		if !ok {
+			slog.Warn("unknown author", "file", path, "author", key)
+			author = Author{Name: key}
+		}
+		postData.Author = author
+	}
 
+	if postData.RawDate != "" {
+		postData.Date, err = parsePostDate(postData.RawDate)
+		if err != nil {
+			slog.Warn("invalid Date, treating post as undated", "file", path, "Date", postData.RawDate)
+		}
+	}
+	if postData.RawPublishAt != "" {
+		postData.PublishAt, err = parsePostDate(postData.RawPublishAt)
+		if err != nil {
+			// Publishing it early would be worse than not at all.
+			slog.Warn("invalid PublishAt, treating post as a draft", "file", path, "PublishAt", postData.RawPublishAt)
+			postData.Draft = true
+		}
+	}
+
+	postData.CacheTTL = defaultPostCacheTTL
+	if postData.RawCacheTTL != "" {
+		ttl, err := time.ParseDuration(postData.RawCacheTTL)
+		if err != nil || ttl < 0 {
+			slog.Warn("invalid CacheTTL, using the default", "file", path, "CacheTTL", postData.RawCacheTTL)
+		} else {
+			postData.CacheTTL = ttl
+		}
+	}
+
+	if postData.CanonicalURL != "" && !isHTTPURL(postData.CanonicalURL) {
+		slog.Warn("invalid CanonicalURL, ignoring it", "file", path, "CanonicalURL", postData.CanonicalURL)
+		postData.CanonicalURL = ""
+	}
+
+	postData.Lang = postLang(cfg, dir, path, postData.Lang)
+	postData.Section = postSection(cfg, dir, path, postData.Section)
+	postData.File = path
+	postData.ModTime = info.ModTime()
+	postData.Hash = contentHash(content)
+	postData.URL = postURL(cfg, postData)
+
+	if !cfg.Content.Lazy {
+		err = postData.render().err
+		if err != nil {
+			return PostData{}, false, err
+		}
+	}
+
+	return postData, true, nil
+}
+
+// IndexHandler lists posts newest first, a page at a time. The page comes
+// from /page/:page or ?page=, and /page/1 redirects to /.
+func IndexHandler(store PostStore, views *ViewCounter) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		slug := ctx.Param("slug")
-		postMarkdown, err := sl.Read(slug)
+		cfg := requestConfig(ctx)
+		pageParam := ctx.Param("page")
+		if pageParam == "" {
+			pageParam = ctx.DefaultQuery("page", "1")
+		}
 
+		page, err := strconv.Atoi(pageParam)
 		if err != nil {
-			ctx.String(http.StatusNotFound, "Post not found", err)
+			notFound(ctx, "Page not found")
 			return
 		}
 
-		var post PostData
-		remainingMd, err := frontmatter.Parse(strings.NewReader(postMarkdown), &post)
-		if err != nil {
-			ctx.String(http.StatusInternalServerError, "Error parsing frontmatter", err)
+		prefix := requestPrefix(ctx)
+		pageURL := func(page int) string {
+			return prefix + indexPageURL(page)
+		}
+
+		if ctx.Param("page") != "" && page == 1 {
+			ctx.Redirect(http.StatusMovedPermanently, pageURL(1))
 			return
 		}
 
-		var buf bytes.Buffer
-		err = mdRenderer.Convert([]byte(remainingMd), &buf)
-		if err != nil {
-			ctx.String(http.StatusInternalServerError, "Error rendering markdown")
+		posts := visiblePosts(ctx, store)
+		if len(posts) == 0 {
+			// An empty blog is fine, one whose posts all failed to load
+			// isn't.
+			if problems := store.Problems(); len(problems) > 0 {
+				serverError(ctx, fmt.Errorf("none of %d posts could be loaded", len(problems)))
+				return
+			}
+		}
+		sortPosts(posts, cfg.Sort)
+
+		posts, pagination, ok := paginate(posts, page, cfg.PageSize, pageURL)
+		if !ok {
+			notFound(ctx, "Page not found")
+			return
+		}
+		if !renderPosts(ctx, posts...) {
 			return
 		}
 
-		post.Content = template.HTML(buf.String())
+		setLastModified(ctx, posts...)
+		// Posts are marked new for readers who have been here before, and
+		// everyone else gets the cookie on a cached page too.
+		cacheUnlessCookie(ctx, lastVisitCookie)
+		cacheOnHit(ctx, func(ctx *gin.Context) { lastVisit(ctx) })
+		if visit, ok := lastVisit(ctx); ok {
+			markNewPosts(posts, visit)
+		}
+		if cfg.multilingual() && page == 1 && requestSection(ctx) == "" {
+			setAlternates(ctx, languageIndexes(cfg.Languages))
+		}
+		if section := requestSection(ctx); section != "" {
+			setBreadcrumbs(ctx, Breadcrumb{Name: section, URL: prefix + "/"})
+		}
+		setCanonical(ctx, pageURL(page))
+		setPrevNext(ctx, pagination.PrevURL, pagination.NextURL)
 
-		ctx.HTML(http.StatusOK, "post.html", post)
+		renderHTML(ctx, http.StatusOK, sectionTemplate(cfg, requestSection(ctx), "index", "index.html"), gin.H{
+			"Posts":      posts,
+			"Pagination": pagination,
+			"Popular":    popularPosts(ctx, store, views),
+		})
+	}
+}
+
+// PostHandler renders a single post. Requests for anything other than the
+// post's canonical path, such as /posts/slug with date prefixes enabled or a
+// mismatched year/month, are redirected there.
+func PostHandler(store PostStore, comments CommentStore, views *ViewCounter, likes *Likes, referrers *Referrers, mentions *Webmentions) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		slug, format := rawFormat(ctx)
+		post, ok := visiblePost(ctx, store, slug)
+		if !ok && cfg.multilingual() {
+			// The post isn't in this language, but it may be in another,
+			// e.g. when linked from before the blog went multilingual.
+			post, ok = visiblePostAnyLang(ctx, store, slug)
+		}
+		if !ok {
+			if locked, found := lockedPost(ctx, store, slug); found {
+				lockedPage(ctx, locked)
+				return
+			}
+
+			notFound(ctx, "Post not found")
+			return
+		}
+
+		if want := post.URL + strings.TrimPrefix(ctx.Param("slug"), slug); want != ctx.Request.URL.Path {
+			target := want
+			if ctx.Request.URL.RawQuery != "" {
+				target += "?" + ctx.Request.URL.RawQuery
+			}
+
+			ctx.Redirect(http.StatusMovedPermanently, target)
+			return
+		}
+
+		ctx.Writer.Header().Add("Vary", "Accept")
+		if cfg.ActivityPub.Enabled {
+			if wantsActivity(ctx) && post.Listed(requestTime(ctx)) {
+				object := articleObject(cfg.BaseURL, post)
+				object["@context"] = activityStreams
+				activityJSONResponse(ctx, http.StatusOK, object)
+				return
+			}
+		}
+
+		if !renderPosts(ctx, post) {
+			return
+		}
+
+		if format != "" {
+			setPostCacheControl(ctx, post)
+			setLastModified(ctx, post)
+			cacheKeys(ctx, "post:"+post.Slug)
+			rawPost(ctx, store, post, format)
+			return
+		}
+
+		if post.Published(requestTime(ctx)) {
+			if ctx.Request.Method == http.MethodGet {
+				views.Hit(post.Slug)
+				referrers.Hit(ctx, post.Slug)
+				cacheOnHit(ctx, func(ctx *gin.Context) {
+					views.Hit(post.Slug)
+					referrers.Hit(ctx, post.Slug)
+				})
+			}
+		}
+		setPostCacheControl(ctx, post)
+		setLastModified(ctx, post)
+		setAlternates(ctx, post.Translations)
+		post.Related = visibleSummaries(ctx, store, post.Related, maxRelated)
+		setBreadcrumbs(ctx, postBreadcrumbs(post)...)
+		prev, next := neighbour(ctx, store, post.older), neighbour(ctx, store, post.newer)
+		setPrevNext(ctx, summaryURL(prev), summaryURL(next))
+		page := newPostPage(ctx, post)
+		page.Prev, page.Next = prev, next
+		if page.Image == "" && cfg.Images.OG {
+			page.Image = absoluteURL(ctx, ogImageURL(post))
+		}
+		page.SeriesNav = seriesNav(visiblePosts(ctx, store), post)
+		cacheKeys(ctx, "post:"+post.Slug)
+		for _, related := range post.Related {
+			cacheKeys(ctx, "post:"+related.Slug)
+		}
+		for _, near := range []*PostSummary{page.Prev, page.Next} {
+			if near != nil {
+				cacheKeys(ctx, "post:"+near.Slug)
+			}
+		}
+		if post.Series != "" {
+			cacheKeys(ctx, "series:"+strings.ToLower(post.Series))
+		}
+		page.Views = views.Views(post.Slug)
+		if mentions != nil && post.Listed(requestTime(ctx)) {
+			page.Webmention = absoluteURL(ctx, "/webmention")
+			page.Mentions = mentions.For(post.Slug)
+			ctx.Header("Link", "<"+page.Webmention+`>; rel="webmention"`)
+		}
+		if cfg.Referrers.Show && post.Listed(requestTime(ctx)) {
+			page.MentionedBy = referrers.For(post.Slug, cfg.Referrers.MinCount, maxMentionedBy)
+		}
+		if likes != nil && post.Published(requestTime(ctx)) {
+			page.Likes = likes.Count(post)
+			page.LikesURL = likeURL(post)
+			page.LikeStatus = ctx.Query("like")
+		}
+		if comments != nil && post.Published(requestTime(ctx)) {
+			page.CommentsEnabled = true
+			page.CommentsURL = langPrefix(post.Lang) + "/posts/" + post.Slug + "/comments"
+			page.Comments = postComments(comments, post.Slug)
+			page.CommentStatus = ctx.Query("comment")
+		}
+		renderHTML(ctx, http.StatusOK, layoutTemplate(cfg, post.Layout, sectionTemplate(cfg, post.Section, "post", "post.html")), page)
 	}
 }
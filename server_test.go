@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// testTime is when the fixture blog is served: after every fixture post
+// but from-the-future, which is scheduled.
+var testTime = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fixedClock is a Clock stopped at a time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testConfig is the config the fixture blog in testdata is served with,
+// from a copy of its content. Nothing is written outside the test's
+// temporary directory, and there's no rate limit for tests making many
+// requests.
+func testConfig(t testing.TB) Config {
+	cfg := defaultConfig()
+	cfg.ContentDir = copyContent(t, "testdata/content")
+	cfg.PagesDir = "testdata/pages"
+	cfg.SiteFile = "testdata/site.yaml"
+	cfg.AuthorsFile = "testdata/authors.yaml"
+	cfg.RedirectsFile = "testdata/redirects.yaml"
+	cfg.MenuFile = "testdata/menu.yaml"
+	cfg.TemplatesDir = "testdata/templates"
+	cfg.StaticDir = "testdata/static"
+	cfg.BaseURL = "https://blog.example"
+	cfg.Content.CacheDir = t.TempDir()
+	cfg.Content.RevisionsFile = ""
+	cfg.Content.RenderCacheDir = ""
+	cfg.RateLimit = RateLimitConfig{}
+
+	return cfg
+}
+
+// newTestRouter serves the blog of testConfig, as changed by configure,
+// at testTime. The config is the process's until the test ends.
+func newTestRouter(t testing.TB, configure func(cfg *Config)) *gin.Engine {
+	t.Helper()
+
+	return newTestRouterWith(t, configure, Deps{})
+}
+
+// newTestRouterWith is newTestRouter with the services in deps, the store
+// and the rest the fixture blog needs filled in.
+func newTestRouterWith(t testing.TB, configure func(cfg *Config), deps Deps) *gin.Engine {
+	t.Helper()
+
+	cfg := testConfig(t)
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewContentStore(dirSource{dir: cfg.ContentDir}, renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	site, err := loadSiteData(cfg.SiteFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps.Store, deps.Renderer, deps.Site = store, renderer, site
+	if deps.Clock == nil {
+		deps.Clock = fixedClock(testTime)
+	}
+	route, err := NewRouter(&cfg, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return route
+}
+
+// copyContent copies the posts in dir to a temporary directory, with
+// modification times before any post's date so their DateModified is
+// their Date rather than when they were checked out.
+func copyContent(t testing.TB, dir string) string {
+	t.Helper()
+
+	epoch := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := t.TempDir()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		target := filepath.Join(out, rel)
+		b, err := os.ReadFile(path)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(target), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(target, b, 0o644)
+		}
+		if err == nil {
+			err = os.Chtimes(target, epoch, epoch)
+		}
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+// do answers req with route.
+func do(route http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, req)
+
+	return w
+}
+
+// get answers a GET of target with route.
+func get(route http.Handler, target string) *httptest.ResponseRecorder {
+	return do(route, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// checkGolden compares the body of w with testdata/golden/name, or with
+// -update writes it there. The request's CSP nonce reads as NONCE, so
+// the files only change when the output does.
+func checkGolden(t *testing.T, name string, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	got := w.Body.Bytes()
+	if nonce := cspNonceOf(w.Header()); nonce != "" {
+		got = bytes.ReplaceAll(got, []byte(nonce), []byte("NONCE"))
+	}
+
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		err := os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file %s, run go test -update if that's intended:\n%s", name, path, lineDiff(string(want), string(got)))
+	}
+}
+
+// cspNonceOf returns the script nonce of a Content-Security-Policy header.
+func cspNonceOf(header http.Header) string {
+	_, after, ok := strings.Cut(header.Get("Content-Security-Policy"), "'nonce-")
+	if !ok {
+		return ""
+	}
+	nonce, _, _ := strings.Cut(after, "'")
+
+	return nonce
+}
+
+// lineDiff describes the first line where got differs from want.
+func lineDiff(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := range max(len(wantLines), len(gotLines)) {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return "line " + strconv.Itoa(i+1) + ":\n- " + w + "\n+ " + g
+		}
+	}
+
+	return ""
+}
+
+func TestGolden(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	for _, tc := range []struct {
+		path, golden, contentType string
+	}{
+		{"/", "index.html", "text/html; charset=utf-8"},
+		{"/posts/hello-world", "post.html", "text/html; charset=utf-8"},
+		{"/feed.xml", "feed.xml", "application/rss+xml; charset=utf-8"},
+		{"/sitemap.xml", "sitemap.xml", "application/xml; charset=utf-8"},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			w := get(route, tc.path)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d", tc.path, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("GET %s: Content-Type %q, want %q", tc.path, got, tc.contentType)
+			}
+			checkGolden(t, tc.golden, w)
+		})
+	}
+}
+
+func TestUnpublishedPostsAreHidden(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	for _, path := range []string{"/posts/unfinished", "/posts/from-the-future"} {
+		if w := get(route, path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, w.Code)
+		}
+	}
+	if body := get(route, "/").Body.String(); strings.Contains(body, "From the Future") {
+		t.Error("the index lists a post scheduled after the clock")
+	}
+}
+
+func TestPostCacheTTL(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"hourly.md":  "---\nTitle: Hourly\nDate: 2025-01-01\nCacheTTL: 1h\n---\n\nHourly.\n",
+		"default.md": "---\nTitle: Default\nDate: 2025-01-01\n---\n\nDefault.\n",
+		"invalid.md": "---\nTitle: Invalid\nDate: 2025-01-01\nCacheTTL: soon\n---\n\nInvalid.\n",
+	})
+	route := newTestRouter(t, func(cfg *Config) { cfg.ContentDir = dir })
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/posts/hourly", "public, max-age=3600"},
+		{"/posts/default", "public, max-age=600"},
+		{"/posts/invalid", "public, max-age=600"},
+	} {
+		w := get(route, tc.path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", tc.path, w.Code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tc.want {
+			t.Errorf("GET %s: Cache-Control %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+// benchmarkBody is the body of the posts benchmarks load and render, with
+// a bit of everything a typical post has.
+const benchmarkBody = `An opening paragraph with *emphasis*, **strong text**, ` + "`code`" + ` and
+a [link to another post](/posts/post-1).
+
+## A heading
+
+- a list
+- of a few
+- items
+
+` + "```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```" + `
+
+> A quote, followed by a footnote reference.[^1]
+
+| Column | Other |
+|--------|-------|
+| one    | two   |
+
+[^1]: The footnote.
+`
+
+// benchmarkContent writes n posts to a temporary content directory.
+func benchmarkContent(b *testing.B, n int) string {
+	b.Helper()
+
+	files := make(map[string]string, n)
+	for i := range n {
+		date := testTime.AddDate(0, 0, -i).Format("2006-01-02")
+		files[fmt.Sprintf("post-%d.md", i)] = fmt.Sprintf("---\nTitle: Post %d\nDate: %s\nSlug: post-%d\nTags: [go, tag-%d]\n---\n\n%s", i, date, i, i%20, benchmarkBody)
+	}
+
+	return writeContent(b, files)
+}
+
+func BenchmarkLoadMarkdownPosts(b *testing.B) {
+	dir := benchmarkContent(b, 2000)
+	cfg := testConfig(b)
+	renderer, err := NewMarkdownRenderer(&cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		for range b.N {
+			posts, problems, err := loadMarkdownPosts(os.DirFS(dir), dir, renderer, nil)
+			if err != nil || len(problems) > 0 || len(posts) != 2000 {
+				b.Fatalf("loaded %d posts, problems %v, error %v", len(posts), problems, err)
+			}
+		}
+	})
+
+	// A reload with nothing changed only looks at the files.
+	b.Run("unchanged", func(b *testing.B) {
+		cache := &postCache{}
+		_, _, err := loadMarkdownPosts(os.DirFS(dir), dir, renderer, cache)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+
+		for range b.N {
+			_, _, err := loadMarkdownPosts(os.DirFS(dir), dir, renderer, cache)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkRequests measures the pages readers ask for most, as rendered
+// and as served from the page cache.
+func BenchmarkRequests(b *testing.B) {
+	dir := benchmarkContent(b, 200)
+
+	for _, cached := range []bool{false, true} {
+		route := newTestRouter(b, func(cfg *Config) {
+			cfg.ContentDir = dir
+			cfg.Cache.Enabled = cached
+		})
+
+		for _, page := range []struct {
+			name, path string
+		}{
+			{"index", "/"},
+			{"post", "/posts/post-1"},
+			{"tag", "/tags/go"},
+			{"feed", "/feed.xml"},
+		} {
+			name := page.name
+			if cached {
+				name += "_cached"
+			}
+			b.Run(name, func(b *testing.B) {
+				req := httptest.NewRequest(http.MethodGet, page.path, nil)
+				for range b.N {
+					if w := do(route, req); w.Code != http.StatusOK {
+						b.Fatalf("GET %s: status %d", page.path, w.Code)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShareLinks struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Twitter  string `json:"twitter"`
+	Mastodon string `json:"mastodon"`
+	LinkedIn string `json:"linkedin"`
+	Email    string `json:"email"`
+}
+
+// ShareHandler returns prebuilt share URLs for a post so share buttons
+// don't have to assemble them client side.
+func ShareHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		post, ok := visiblePost(ctx, store, ctx.Param("slug"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, newShareLinks(post.Title, absoluteURL(ctx, post.URL)))
+	}
+}
+
+func newShareLinks(title string, canonicalURL string) ShareLinks {
+	return ShareLinks{
+		Title: title,
+		URL:   canonicalURL,
+		Twitter: "https://x.com/intent/post?" + url.Values{
+			"text": {title},
+			"url":  {canonicalURL},
+		}.Encode(),
+		Mastodon: "https://mastodonshare.com/?" + url.Values{
+			"text": {title},
+			"url":  {canonicalURL},
+		}.Encode(),
+		LinkedIn: "https://www.linkedin.com/sharing/share-offsite/?" + url.Values{
+			"url": {canonicalURL},
+		}.Encode(),
+		// Mail clients don't decode "+" as a space in mailto links.
+		Email: "mailto:?" + strings.ReplaceAll(url.Values{
+			"subject": {title},
+			"body":    {canonicalURL},
+		}.Encode(), "+", "%20"),
+	}
+}
+
+// absoluteURL resolves path against the configured base URL, or the scheme
+// and host of the current request when none is set, honoring
+// X-Forwarded-Proto from a reverse proxy.
+func absoluteURL(ctx *gin.Context, path string) string {
+	cfg := requestConfig(ctx)
+	if cfg.BaseURL != "" {
+		return cfg.BaseURL + path
+	}
+
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := ctx.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + ctx.Request.Host + path
+}
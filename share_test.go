@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNewShareLinks(t *testing.T) {
+	links := newShareLinks("Go & You: 100% Fun?", "https://blog.example/posts/go-and-you")
+
+	want := ShareLinks{
+		Title:    "Go & You: 100% Fun?",
+		URL:      "https://blog.example/posts/go-and-you",
+		Twitter:  "https://x.com/intent/post?text=Go+%26+You%3A+100%25+Fun%3F&url=https%3A%2F%2Fblog.example%2Fposts%2Fgo-and-you",
+		Mastodon: "https://mastodonshare.com/?text=Go+%26+You%3A+100%25+Fun%3F&url=https%3A%2F%2Fblog.example%2Fposts%2Fgo-and-you",
+		LinkedIn: "https://www.linkedin.com/sharing/share-offsite/?url=https%3A%2F%2Fblog.example%2Fposts%2Fgo-and-you",
+		Email:    "mailto:?body=https%3A%2F%2Fblog.example%2Fposts%2Fgo-and-you&subject=Go%20%26%20You%3A%20100%25%20Fun%3F",
+	}
+	if links != want {
+		t.Errorf("newShareLinks =\n%+v\nwant\n%+v", links, want)
+	}
+}
+
+func TestShareHandler(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	w := get(route, "/api/posts/readers/share")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var links ShareLinks
+	err := json.Unmarshal(w.Body.Bytes(), &links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := newShareLinks("Readers & Writers", "https://blog.example/posts/readers"); links != want {
+		t.Errorf("share links %+v, want %+v", links, want)
+	}
+
+	if w := get(route, "/api/posts/unfinished/share"); w.Code != http.StatusNotFound {
+		t.Errorf("share links of a draft: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Shortcodes embed content that markdown can't express, written in posts
+// as {{< name arg key="value" >}}. Each is a template, built in or from
+// <name>.html in the shortcodes directory, executed with a Shortcode.
+// Write {{</* name */>}} to show a shortcode without expanding it.
+
+// builtinShortcodes are available on every site. Files in the shortcodes
+// directory replace them.
+var builtinShortcodes = map[string]string{
+	"youtube": `<div class="embed embed-video"><iframe src="https://www.youtube-nocookie.com/embed/{{ .Arg 0 }}" title="{{ or (.Param "title") "YouTube video" }}" loading="lazy" allow="encrypted-media; picture-in-picture; fullscreen" allowfullscreen></iframe></div>`,
+	"tweet":   `<blockquote class="embed embed-tweet"><p><a href="https://twitter.com/i/status/{{ .Arg 0 }}">View the post on X</a></p></blockquote>`,
+	"gist":    `<p class="embed embed-gist"><a href="https://gist.github.com/{{ .Arg 0 }}/{{ .Arg 1 }}{{ with .Arg 2 }}#file-{{ . }}{{ end }}">Gist {{ .Arg 0 }}/{{ .Arg 1 }}</a></p>`,
+	"figure":  `{{ figure (or (.Param "src") (.Arg 0)) (.Param "caption") (.Param "alt") }}`,
+}
+
+// shortcodeFuncs are the functions shortcode templates can call besides
+// the standard ones. figure renders an image like galleries do, see
+// figureHTML.
+func shortcodeFuncs(cfg *Config) template.FuncMap {
+	return template.FuncMap{
+		"figure": shortcodeFigure(cfg),
+	}
+}
+
+var shortcodePattern = regexp.MustCompile(`\{\{<\s*(/\*)?\s*(.*?)\s*(\*/)?\s*>\}\}`)
+
+// Shortcode is the data shortcode templates are executed with.
+type Shortcode struct {
+	Name string
+	// Args are the positional arguments, Params the key="value" ones.
+	Args   []string
+	Params map[string]string
+}
+
+// Arg returns the i-th positional argument, or "" when there are fewer.
+func (sc Shortcode) Arg(i int) string {
+	if i < 0 || i >= len(sc.Args) {
+		return ""
+	}
+
+	return sc.Args[i]
+}
+
+// Param returns the named argument key, or "" when it wasn't given.
+func (sc Shortcode) Param(key string) string {
+	return sc.Params[key]
+}
+
+// loadShortcodes parses the built-in shortcodes and the <name>.html
+// templates in cfg's shortcodes directory, which need not exist.
+func loadShortcodes(cfg *Config) (map[string]*template.Template, error) {
+	funcs := shortcodeFuncs(cfg)
+	shortcodes := map[string]*template.Template{}
+	for name, text := range builtinShortcodes {
+		shortcodes[name] = template.Must(template.New(name).Funcs(funcs).Parse(text))
+	}
+
+	files, err := filepath.Glob(filepath.Join(cfg.Markdown.ShortcodesDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(file), ".html")
+		tmpl, err := template.New(name).Funcs(funcs).Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("shortcode %s: %w", name, err)
+		}
+		shortcodes[name] = tmpl
+	}
+
+	return shortcodes, nil
+}
+
+// expandShortcodes replaces the shortcodes in source with placeholders
+// that come through markdown untouched, and returns the HTML each stands
+// for. The HTML is put in place by insertShortcodes after rendering, so it
+// is neither escaped by goldmark nor stripped by the sanitizer.
+func (r *MarkdownRenderer) expandShortcodes(source []byte) ([]byte, []string, error) {
+	if !bytes.Contains(source, []byte("{{<")) {
+		return source, nil, nil
+	}
+
+	var snippets []string
+	var expandErr error
+	expanded := shortcodePattern.ReplaceAllFunc(source, func(match []byte) []byte {
+		groups := shortcodePattern.FindSubmatch(match)
+		if len(groups[1]) > 0 && len(groups[3]) > 0 {
+			return []byte("{{< " + string(groups[2]) + " >}}")
+		}
+
+		sc, err := parseShortcode(string(groups[2]))
+		if err == nil {
+			var html string
+			html, err = r.executeShortcode(sc)
+			if err == nil {
+				snippets = append(snippets, html)
+				return []byte(shortcodePlaceholder(len(snippets) - 1))
+			}
+		}
+
+		if expandErr == nil {
+			expandErr = err
+		}
+		return match
+	})
+
+	return expanded, snippets, expandErr
+}
+
+func (r *MarkdownRenderer) executeShortcode(sc Shortcode) (string, error) {
+	tmpl, ok := r.shortcodes[sc.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown shortcode %q", sc.Name)
+	}
+
+	var b strings.Builder
+	err := tmpl.Execute(&b, sc)
+	if err != nil {
+		return "", fmt.Errorf("shortcode %s: %w", sc.Name, err)
+	}
+
+	return b.String(), nil
+}
+
+// parseShortcode splits the inside of {{< >}} into the name and arguments,
+// which may be quoted to contain spaces.
+func parseShortcode(s string) (Shortcode, error) {
+	var fields []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := strings.IndexAny(s, " \t\n")
+		if end < 0 {
+			end = len(s)
+		}
+		if quote := strings.IndexByte(s[:end], '"'); quote >= 0 {
+			closing := strings.IndexByte(s[quote+1:], '"')
+			if closing < 0 {
+				return Shortcode{}, fmt.Errorf("shortcode %q: unterminated quote", s)
+			}
+			end = quote + 1 + closing + 1
+		}
+
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+
+	if len(fields) == 0 {
+		return Shortcode{}, errors.New("empty shortcode")
+	}
+
+	sc := Shortcode{Name: fields[0], Params: map[string]string{}}
+	for _, field := range fields[1:] {
+		key, value, named := strings.Cut(field, "=")
+		if !named || strings.HasPrefix(field, `"`) {
+			key, value = "", field
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		if key == "" {
+			sc.Args = append(sc.Args, value)
+		} else {
+			sc.Params[key] = value
+		}
+	}
+
+	return sc, nil
+}
+
+// shortcodePlaceholder is a token markdown leaves alone, standing in for
+// the i-th shortcode of a post.
+func shortcodePlaceholder(i int) string {
+	return "GOBLOGSHORTCODE" + strconv.Itoa(i) + "X"
+}
+
+// insertShortcodes swaps the placeholders in rendered HTML for the
+// shortcodes' output. A shortcode alone on its line ends up as a
+// paragraph of its own, which is dropped so block embeds aren't nested in
+// a <p>.
+func insertShortcodes(html string, snippets []string) string {
+	for i := len(snippets) - 1; i >= 0; i-- {
+		placeholder := shortcodePlaceholder(i)
+		html = strings.ReplaceAll(html, "<p>"+placeholder+"</p>", snippets[i])
+		html = strings.ReplaceAll(html, placeholder, snippets[i])
+	}
+
+	return html
+}
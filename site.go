@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// SiteData holds site-wide values from site.yaml that every template can
+// reach through .Site.
+type SiteData struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Nav         []Link `yaml:"nav"`
+	Social      []Link `yaml:"social"`
+	Footer      string `yaml:"footer"`
+	// Author is who the blog is by, for the footer's copyright line.
+	Author string `yaml:"author"`
+	// Theme is the default theme, "dark" or "light". Pages are rendered
+	// in the one the reader picked instead, if any.
+	Theme string `yaml:"theme"`
+	// Podcast describes the blog to podcast apps, which list the posts
+	// with Audio.
+	Podcast Podcast `yaml:"podcast"`
+	// Nonce is the request's CSP nonce, see SecurityHeaders.
+	Nonce string `yaml:"-"`
+	// BaseURL is the blog's absolute URL without a trailing slash, Year
+	// the current one and Version the blog's build, see buildVersion.
+	BaseURL string `yaml:"-"`
+	Year    int    `yaml:"-"`
+	Version string `yaml:"-"`
+	// Lang is the language of the page, and Alternates its versions in
+	// other languages, see Config.Languages.
+	Lang       string      `yaml:"-"`
+	Alternates []Alternate `yaml:"-"`
+	// Languages links every language's index while the blog is
+	// multilingual.
+	Languages []Alternate `yaml:"-"`
+	// Menus are the site's menus by name, such as header and footer, see
+	// Navigation.
+	Menus map[string][]MenuEntry `yaml:"-"`
+	// Breadcrumbs is the trail from the home page to the page, on pages
+	// that have one, and BreadcrumbList the same as schema.org JSON-LD.
+	Breadcrumbs    []Breadcrumb   `yaml:"-"`
+	BreadcrumbList map[string]any `yaml:"-"`
+	// Meta is what the page's <head> links to.
+	Meta PageMeta `yaml:"-"`
+}
+
+type Link struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	Icon string `yaml:"icon"`
+}
+
+func loadSiteData(path string) (SiteData, error) {
+	var site SiteData
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return site, err
+	}
+
+	err = yaml.UnmarshalStrict(b, &site)
+	if err != nil {
+		return site, fmt.Errorf("%s: %w", path, err)
+	}
+
+	err = site.validate()
+	if err != nil {
+		return site, fmt.Errorf("%s: %w", path, err)
+	}
+	if site.Theme == "" {
+		site.Theme = "dark"
+	}
+
+	return site, nil
+}
+
+func (site SiteData) validate() error {
+	if site.Title == "" {
+		return errors.New("title is required")
+	}
+
+	for _, link := range site.Nav {
+		if link.Name == "" || link.URL == "" {
+			return errors.New("nav links need both a name and a url")
+		}
+	}
+
+	for _, link := range site.Social {
+		if link.URL == "" {
+			return errors.New("social links need a url")
+		}
+	}
+
+	if site.Theme != "" && !validTheme(site.Theme) {
+		return errors.New(`theme must be "dark" or "light"`)
+	}
+
+	return nil
+}
+
+// SiteDataMiddleware makes the site data available to handlers, and
+// through renderHTML to their templates as Site.
+func SiteDataMiddleware(site SiteData) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("Site", site)
+		ctx.Next()
+	}
+}
+
+func siteData(ctx *gin.Context) SiteData {
+	cfg := requestConfig(ctx)
+	site, _ := ctx.Get("Site")
+	s, _ := site.(SiteData)
+	s.Nonce = cspNonce(ctx)
+	s.BaseURL = absoluteURL(ctx, "")
+	s.Year = requestTime(ctx).Year()
+	s.Version = buildVersion()
+	s.Lang = requestLang(ctx)
+	s.Theme = requestTheme(ctx, s)
+	if alternates, ok := ctx.Get("Alternates"); ok {
+		// hreflang links must be absolute.
+		for _, alternate := range alternates.([]Alternate) {
+			s.Alternates = append(s.Alternates, Alternate{Lang: alternate.Lang, URL: absoluteURL(ctx, alternate.URL)})
+		}
+	}
+	if cfg.multilingual() {
+		s.Languages = languageIndexes(cfg.Languages)
+	}
+	if nav, ok := ctx.Get("Navigation"); ok {
+		s.Menus = nav.(*Navigation).Menus(s.Lang, s)
+	}
+	if crumbs, ok := ctx.Get("Breadcrumbs"); ok {
+		s.Breadcrumbs = append([]Breadcrumb{{Name: s.Title, URL: langPrefix(ctx.GetString("Lang")) + "/"}}, crumbs.([]Breadcrumb)...)
+		s.Breadcrumbs[len(s.Breadcrumbs)-1].Current = true
+		absolute := make([]Breadcrumb, len(s.Breadcrumbs))
+		for i, crumb := range s.Breadcrumbs {
+			absolute[i] = Breadcrumb{Name: crumb.Name, URL: absoluteURL(ctx, crumb.URL)}
+		}
+		s.BreadcrumbList = breadcrumbList(absolute)
+	}
+	s.Meta = pageMeta(ctx, s.Title)
+	return s
+}
+
+// renderHTML renders the template name with data, giving gin.H data the
+// request's site data as Site. Pages rendered from a struct, such as
+// PostPage, carry their own Site.
+func renderHTML(ctx *gin.Context, status int, name string, data any) {
+	if h, ok := data.(gin.H); ok {
+		if _, ok := h["Site"]; !ok {
+			h["Site"] = siteData(ctx)
+		}
+	}
+
+	ctx.HTML(status, name, data)
+}
+
+// buildVersion is the version of the blog's module, or the commit it was
+// built from for builds of a checkout, marked dirty with uncommitted
+// changes.
+var buildVersion = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	var revision string
+	var dirty bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value[:min(len(setting.Value), 12)]
+		case "vcs.modified":
+			dirty = setting.Value == "true"
+		}
+	}
+	if revision != "" && dirty {
+		revision += "-dirty"
+	}
+
+	return revision
+})
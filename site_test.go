@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteNavIsRendered(t *testing.T) {
+	siteFile := filepath.Join(t.TempDir(), "site.yaml")
+	err := os.WriteFile(siteFile, []byte("title: Fixture Blog\nnav:\n  - name: Now Reading\n    url: /now\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := newTestRouter(t, func(cfg *Config) { cfg.SiteFile = siteFile })
+
+	for _, path := range []string{"/", "/posts/hello-world", "/archive"} {
+		body := get(route, path).Body.String()
+		if !strings.Contains(body, `href="/now"`) || !strings.Contains(body, "Now Reading") {
+			t.Errorf("GET %s doesn't link to the nav link of site.yaml", path)
+		}
+	}
+}
+
+func TestLoadSiteDataValidates(t *testing.T) {
+	for _, tc := range []struct {
+		name, yaml, err string
+	}{
+		{"valid", "title: Blog\nnav:\n  - name: Home\n    url: /\n", ""},
+		{"no title", "description: Untitled\n", "title is required"},
+		{"nav link without url", "title: Blog\nnav:\n  - name: Home\n", "nav links need both a name and a url"},
+		{"social link without url", "title: Blog\nsocial:\n  - name: GitHub\n", "social links need a url"},
+		{"unknown field", "title: Blog\ncolour: red\n", "field colour not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "site.yaml")
+			err := os.WriteFile(path, []byte(tc.yaml), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = loadSiteData(path)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("loadSiteData: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("loadSiteData error %v, want one containing %q", err, tc.err)
+			}
+		})
+	}
+}
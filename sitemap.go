@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapHandler lists the home page, the index of every language, and
+// every published post and page, except those whose CanonicalURL is
+// elsewhere. pages is nil without standalone pages.
+func SitemapHandler(store, pages PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		posts := visiblePostsAnyLang(ctx, store)
+		sortPostsByDate(posts)
+		if pages != nil {
+			posts = append(posts, visiblePostsAnyLang(ctx, pages)...)
+		}
+
+		urls := sitemapURLSet{URLs: []sitemapURL{{Loc: absoluteURL(ctx, "/")}}}
+		for _, index := range languageIndexes(requestConfig(ctx).Languages) {
+			urls.URLs = append(urls.URLs, sitemapURL{Loc: absoluteURL(ctx, index.URL)})
+		}
+		for _, post := range posts {
+			if post.CanonicalURL != "" {
+				continue
+			}
+
+			entry := sitemapURL{Loc: absoluteURL(ctx, post.URL)}
+
+			if !post.DateModified.IsZero() {
+				entry.LastMod = post.DateModified.Format("2006-01-02")
+			}
+
+			urls.URLs = append(urls.URLs, entry)
+		}
+
+		writeXML(ctx, "application/xml; charset=utf-8", urls)
+	}
+}
+
+// RobotsHandler serves robots_txt from the config, or by default allows
+// everything and points crawlers at the sitemap.
+func RobotsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := requestConfig(ctx)
+		robots := cfg.RobotsTxt
+		if robots == "" {
+			robots = "User-agent: *\nAllow: /\n"
+			if cfg.Links.Track {
+				robots += "Disallow: /out\n"
+			}
+			robots += "\nSitemap: " + absoluteURL(ctx, "/sitemap.xml") + "\n"
+		}
+		if !strings.HasSuffix(robots, "\n") {
+			robots += "\n"
+		}
+
+		ctx.String(http.StatusOK, robots)
+	}
+}
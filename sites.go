@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// With sites set, one server hosts several blogs: serveSites runs each
+// blog as its own process on a loopback port, with its own config, and
+// proxies requests to it by Host. Each blog keeps the process-wide state
+// it's written around, such as its metrics, while they share the front
+// server's address and TLS certificates.
+
+// siteProcess is the process serving the blog of a host.
+type siteProcess struct {
+	host   string
+	config string
+	addr   string
+	cmd    *exec.Cmd
+	// done is closed once the process has exited.
+	done chan struct{}
+}
+
+// serveSites serves the blogs of cfg.Sites until interrupted, or until
+// one of them stops. Their config files are relative to configPath's
+// directory.
+func serveSites(cfg *Config, configPath string) error {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	hosts := make([]string, 0, len(cfg.Sites))
+	for host := range cfg.Sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	sites := map[string]*siteProcess{}
+	for _, host := range hosts {
+		path := cfg.Sites[host]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(configPath), path)
+		}
+
+		site, err := newSiteProcess(self, host, path)
+		if err != nil {
+			return fmt.Errorf("site %s: %w", host, err)
+		}
+		sites[strings.ToLower(host)] = site
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(sites)+2)
+	started := make([]*siteProcess, 0, len(sites))
+	defer func() {
+		for _, site := range started {
+			site.stop(time.Duration(cfg.ShutdownTimeout))
+		}
+	}()
+
+	for _, host := range hosts {
+		site := sites[strings.ToLower(host)]
+		if err := site.cmd.Start(); err != nil {
+			return fmt.Errorf("site %s: %w", host, err)
+		}
+		started = append(started, site)
+		slog.Info("serving site", "host", host, "config", site.config, "addr", site.addr)
+
+		go func() {
+			err := site.cmd.Wait()
+			close(site.done)
+			errs <- fmt.Errorf("site %s stopped: %v", site.host, err)
+		}()
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           sitesProxy(sites),
+		ReadHeaderTimeout: time.Duration(cfg.ReadTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+	servers := []*http.Server{server}
+
+	if len(cfg.TLS.Hosts) > 0 {
+		manager := autocertManager(cfg.TLS)
+		server.TLSConfig = tlsConfig(manager)
+
+		redirect := redirectServer(cfg.TLS, manager)
+		servers = append(servers, redirect)
+
+		go func() {
+			slog.Info("listening", "addr", cfg.TLS.HTTPAddr, "redirect", "https")
+			errs <- redirect.ListenAndServe()
+		}()
+		go func() {
+			slog.Info("listening", "addr", cfg.Addr, "tls", cfg.TLS.Hosts, "sites", hosts)
+			errs <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			slog.Info("listening", "addr", cfg.Addr, "sites", hosts)
+			errs <- server.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+
+	return err
+}
+
+// newSiteProcess checks the config of host's blog at path and prepares the
+// process serving it on a free loopback port.
+func newSiteProcess(self, host, path string) (*siteProcess, error) {
+	// Unlike the main config, a missing one is a mistake.
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Sites) > 0 {
+		return nil, fmt.Errorf("%s: sites can't have sites of their own", path)
+	}
+	if len(cfg.TLS.Hosts) > 0 {
+		return nil, fmt.Errorf("%s: set tls in the main config, the sites are served behind it", path)
+	}
+
+	addr, err := freeLoopbackAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(self, "-config", path, "serve")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The environment configures the main server; the sites get their
+	// config from their files alone.
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "BLOG_") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, "BLOG_ADDR="+addr, "BLOG_TRUSTED_PROXIES=127.0.0.1")
+
+	return &siteProcess{host: host, config: path, addr: addr, cmd: cmd, done: make(chan struct{})}, nil
+}
+
+// stop asks the site's process to shut down and waits for it, up to
+// timeout.
+func (site *siteProcess) stop(timeout time.Duration) {
+	_ = site.cmd.Process.Signal(syscall.SIGTERM)
+
+	select {
+	case <-site.done:
+	case <-time.After(timeout):
+		_ = site.cmd.Process.Kill()
+		<-site.done
+	}
+}
+
+// freeLoopbackAddr returns a loopback address with a port nothing listens
+// on.
+func freeLoopbackAddr() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
+
+// sitesProxy forwards each request to the site of its host, keeping the
+// Host header so the site sees the address it's served at.
+func sitesProxy(sites map[string]*siteProcess) http.Handler {
+	proxies := map[string]*httputil.ReverseProxy{}
+	for host, site := range sites {
+		target := &url.URL{Scheme: "http", Host: site.addr}
+		proxies[host] = &httputil.ReverseProxy{
+			Rewrite: func(req *httputil.ProxyRequest) {
+				req.SetURL(target)
+				req.Out.Host = req.In.Host
+				req.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				if !errors.Is(err, context.Canceled) {
+					slog.Warn("proxying to site", "host", site.host, "error", err)
+				}
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		proxy, ok := proxies[strings.ToLower(host)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
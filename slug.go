@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// slugPattern is the set of slugs a post may have: letters, digits, "-"
+// and "_", so a slug can never act as a path or need escaping in a URL.
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}$`)
+
+var errOutsideRoot = errors.New("path escapes its root directory")
+
+func validSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// duplicateSlugs returns an error naming the files of every slug used by
+// more than one post of the same language.
+func duplicateSlugs(posts []PostData) error {
+	files := map[string][]string{}
+	var keys []string
+	for _, post := range posts {
+		key := post.Lang + "/" + post.Slug
+		if files[key] == nil {
+			keys = append(keys, key)
+		}
+		files[key] = append(files[key], post.File)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		if len(files[key]) > 1 {
+			_, slug, _ := strings.Cut(key, "/")
+			errs = append(errs, fmt.Errorf("duplicate slug %q in %s", slug, strings.Join(files[key], ", ")))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// slugify turns text such as a title into a slug: lowercase ASCII letters
+// and digits, with accents dropped and everything else collapsed to "-".
+func slugify(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents split off by NFD.
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > 128 {
+		slug = strings.TrimRight(slug[:128], "-")
+	}
+
+	return slug
+}
+
+// safeJoin joins name onto root, refusing names that would resolve outside
+// root such as "../etc/passwd" or absolute paths.
+func safeJoin(root, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.ContainsRune(name, 0) {
+		return "", errOutsideRoot
+	}
+
+	joined := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, joined)
+	if err != nil {
+		return "", err
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+
+	return joined, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidSlug(t *testing.T) {
+	for _, tc := range []struct {
+		slug string
+		want bool
+	}{
+		{"hello-world", true},
+		{"io_reader", true},
+		{"Go2", true},
+		{"", false},
+		{"-leading-dash", false},
+		{"_leading-underscore", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a.md", false},
+		{"with space", false},
+		{"percent%2F", false},
+		{"nul\x00", false},
+		{"café", false},
+		{string(make([]byte, 129)), false},
+	} {
+		if got := validSlug(tc.slug); got != tc.want {
+			t.Errorf("validSlug(%q) = %v, want %v", tc.slug, got, tc.want)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := filepath.FromSlash("/srv/blog/markdown")
+
+	for _, tc := range []struct {
+		name, want string
+		err        error
+	}{
+		{"post.md", filepath.FromSlash("/srv/blog/markdown/post.md"), nil},
+		{"id/post.md", filepath.FromSlash("/srv/blog/markdown/id/post.md"), nil},
+		{"a/../post.md", filepath.FromSlash("/srv/blog/markdown/post.md"), nil},
+		{"..", "", errOutsideRoot},
+		{"../post.md", "", errOutsideRoot},
+		{"../../etc/passwd", "", errOutsideRoot},
+		{"a/../../markdown-private/post.md", "", errOutsideRoot},
+		{"/etc/passwd", "", errOutsideRoot},
+		{"post\x00.md", "", errOutsideRoot},
+	} {
+		got, err := safeJoin(root, tc.name)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("safeJoin(%q) = %q, %v, want %q, %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestPostTraversal(t *testing.T) {
+	route := newTestRouter(t, nil)
+
+	for _, path := range []string{
+		"/posts/..%2F..%2Fetc%2Fpasswd",
+		"/posts/..%2Fsite.yaml",
+		"/posts/..%2F..%2Fetc%2Fpasswd.md",
+		"/posts/%2E%2E",
+		"/posts/hello-world%00",
+		"/api/posts/..%2F..%2Fetc%2Fpasswd",
+	} {
+		if w := get(route, path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, w.Code)
+		}
+	}
+}
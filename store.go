@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay debounces bursts of file events, such as an editor writing a
+// temp file and renaming it, into a single reload.
+const reloadDelay = 200 * time.Millisecond
+
+// ContentStore keeps every post of a content source rendered in memory and
+// reloads them when the content changes.
+type ContentStore struct {
+	source   ContentSource
+	renderer *MarkdownRenderer
+	// pages marks a store of standalone pages, see NewPageStore.
+	pages bool
+
+	mu       sync.RWMutex
+	fsys     fs.FS
+	posts    []PostData
+	problems []Problem
+	bySlug   map[string]int
+	loadedAt time.Time
+	// reloadMu serializes reloads, which share cache.
+	reloadMu sync.Mutex
+	// cache lets reloads skip rendering the posts that haven't changed.
+	cache postCache
+
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+
+	hooksMu sync.Mutex
+	hooks   []func([]PostData)
+}
+
+// NewContentStore loads all posts of source, rendering them with renderer.
+func NewContentStore(source ContentSource, renderer *MarkdownRenderer) (*ContentStore, error) {
+	store := &ContentStore{source: source, renderer: renderer, stop: make(chan struct{})}
+	err := store.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// String names the content source the posts are loaded from.
+func (store *ContentStore) String() string {
+	return store.source.String()
+}
+
+// Reload re-reads the posts of the content source, rendering again only
+// those whose files changed. Posts that fail to load are skipped, see
+// Problems. The previously loaded posts are kept if
+// the source can't be read, or no post at all could be loaded.
+func (store *ContentStore) Reload() error {
+	store.reloadMu.Lock()
+	defer store.reloadMu.Unlock()
+
+	fsys, err := store.source.Load()
+	if err != nil {
+		return err
+	}
+	// Only on the first load, polled sources would repeat them every
+	// refresh otherwise.
+	if store.LoadedAt().IsZero() && !store.pages {
+		warnContentProblems(store.renderer.cfg, fsys, store.String())
+	}
+
+	posts, problems, err := loadMarkdownPosts(fsys, store.String(), store.renderer, &store.cache)
+	if err != nil {
+		return err
+	}
+	// Most likely something broke all of them at once, such as the
+	// authors file or a template, which is better fixed than served.
+	if len(posts) == 0 && len(problems) > 0 && !store.LoadedAt().IsZero() {
+		return fmt.Errorf("none of %d posts could be loaded, keeping the previous ones", len(problems))
+	}
+
+	// One of the posts would be unreachable, and which one would depend
+	// on the order files are read in.
+	err = duplicateSlugs(posts)
+	if err != nil {
+		return err
+	}
+	loadRevisions(store.renderer.cfg.Content.RevisionsFile).apply(store.String(), posts)
+
+	if store.pages {
+		for i := range posts {
+			posts[i].URL = pageURL(posts[i])
+		}
+	} else {
+		computeRelated(store.renderer.cfg.Related, posts)
+		computePrevNext(posts)
+	}
+	linkTranslations(posts)
+
+	// Posts are indexed by slug, preferring the default language, and
+	// by lang/slug for each language's version.
+	bySlug := make(map[string]int, len(posts))
+	for i, post := range posts {
+		if j, ok := bySlug[post.Slug]; !ok || posts[j].Lang != store.renderer.cfg.DefaultLanguage {
+			bySlug[post.Slug] = i
+		}
+		if post.Lang != "" {
+			bySlug[post.Lang+"/"+post.Slug] = i
+		}
+	}
+
+	store.mu.Lock()
+	store.fsys = fsys
+	store.posts = posts
+	store.problems = problems
+	store.bySlug = bySlug
+	store.loadedAt = time.Now()
+	store.mu.Unlock()
+
+	store.runHooks()
+	return nil
+}
+
+func (store *ContentStore) runHooks() {
+	store.hooksMu.Lock()
+	defer store.hooksMu.Unlock()
+	for _, hook := range store.hooks {
+		hook(store.Posts())
+	}
+}
+
+// OnReload registers hook to be called with the posts after every reload,
+// so that data derived from them can be rebuilt. hook is also called right
+// away with the current posts.
+func (store *ContentStore) OnReload(hook func([]PostData)) {
+	store.hooksMu.Lock()
+	defer store.hooksMu.Unlock()
+
+	store.hooks = append(store.hooks, hook)
+	hook(store.Posts())
+}
+
+// Posts returns a copy of all loaded posts that callers are free to modify.
+func (store *ContentStore) Posts() []PostData {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	posts := make([]PostData, len(store.posts))
+	copy(posts, store.posts)
+
+	return posts
+}
+
+// Problems returns the posts skipped by the last reload because they
+// couldn't be loaded.
+func (store *ContentStore) Problems() []Problem {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.problems
+}
+
+// Readable reports whether the content the posts were last loaded from
+// can still be read, so reloads have a chance of working.
+func (store *ContentStore) Readable() bool {
+	store.mu.RLock()
+	fsys := store.fsys
+	store.mu.RUnlock()
+
+	if fsys == nil {
+		return false
+	}
+	_, err := fs.ReadDir(fsys, ".")
+
+	return err == nil
+}
+
+// Dir returns the local directory posts are read from and can be written
+// to, or "" when they come from elsewhere.
+func (store *ContentStore) Dir() string {
+	if src, ok := store.source.(dirSource); ok {
+		return src.dir
+	}
+
+	return ""
+}
+
+// LoadedAt returns when the posts were last loaded successfully.
+func (store *ContentStore) LoadedAt() time.Time {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.loadedAt
+}
+
+// GetLang returns the post with the given slug in lang. lang is ignored
+// while the site isn't multilingual.
+func (store *ContentStore) GetLang(lang, slug string) (PostData, bool) {
+	if store.renderer.cfg.multilingual() {
+		slug = lang + "/" + slug
+	}
+
+	return store.Get(slug)
+}
+
+// Get returns the post with the given slug, in the default language if it
+// has been translated.
+func (store *ContentStore) Get(slug string) (PostData, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	i, ok := store.bySlug[slug]
+	if !ok {
+		postLookups.WithLabelValues("miss").Inc()
+		return PostData{}, false
+	}
+	postLookups.WithLabelValues("hit").Inc()
+
+	return store.posts[i], true
+}
+
+// Watch reloads the store whenever something under its directory changes,
+// until Close is called. Remote sources can't be watched and are fetched
+// again every refresh instead, if refresh is set.
+func (store *ContentStore) Watch(refresh time.Duration) error {
+	dir := store.Dir()
+	if dir == "" {
+		if refresh > 0 {
+			go store.poll(refresh)
+		}
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// fsnotify doesn't watch recursively, so every directory is added.
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	store.watcher = watcher
+	go store.watch(dir)
+
+	return nil
+}
+
+func (store *ContentStore) watch(dir string) {
+	reload := time.NewTimer(reloadDelay)
+	reload.Stop()
+
+	for {
+		select {
+		case event, ok := <-store.watcher.Events:
+			if !ok {
+				reload.Stop()
+				return
+			}
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = store.watcher.Add(event.Name)
+				}
+			}
+
+			reload.Reset(reloadDelay)
+
+		case <-reload.C:
+			if err := store.Reload(); err != nil {
+				slog.Error("reloading posts", "dir", dir, "err", err)
+			}
+
+		case err, ok := <-store.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			slog.Error("watching posts", "dir", dir, "err", err)
+		}
+	}
+}
+
+func (store *ContentStore) poll(refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := store.Reload(); err != nil {
+				slog.Error("reloading posts", "source", store.String(), "err", err)
+			}
+
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+// PublishScheduled checks every interval, until Close is called, whether
+// scheduled posts have gone live since the last check, and runs the reload
+// hooks if so: caches and feeds catch up, and new posts are announced,
+// without the content changing.
+func (store *ContentStore) PublishScheduled(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				live := false
+				for _, post := range store.Posts() {
+					if at := post.PublishTime(); !post.Draft && at.After(last) && !at.After(now) {
+						slog.Info("scheduled post published", "slug", post.Slug, "lang", post.Lang, "at", at)
+						live = true
+					}
+				}
+				last = now
+
+				if live {
+					store.runHooks()
+				}
+
+			case <-store.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching for changes.
+func (store *ContentStore) Close() error {
+	close(store.stop)
+	if store.watcher == nil {
+		return nil
+	}
+
+	return store.watcher.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// tagCounts returns every tag used by posts with the number of posts using
+// it, sorted by name. Tags differing only in case are counted together
+// under the first spelling seen.
+func tagCounts(posts []PostData) []TagCount {
+	index := map[string]int{}
+	var tags []TagCount
+
+	for _, post := range posts {
+		for _, tag := range post.Tags {
+			key := strings.ToLower(tag)
+			i, ok := index[key]
+			if !ok {
+				i = len(tags)
+				index[key] = i
+				tags = append(tags, TagCount{Name: tag})
+			}
+			tags[i].Count++
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name)
+	})
+
+	return tags
+}
+
+// canonicalTags returns tags the way posts are listed under them, see
+// canonicalTag, leaving out empty and repeated tags.
+func canonicalTags(aliases map[string]string, tags []string) []string {
+	var canonical []string
+	for _, tag := range tags {
+		tag = canonicalTag(aliases, tag)
+		if tag != "" && !slices.Contains(canonical, tag) {
+			canonical = append(canonical, tag)
+		}
+	}
+
+	return canonical
+}
+
+// canonicalTag returns the tag aliases, the tag_aliases config, maps tag
+// to, or tag trimmed and lowercased when it isn't an alias.
+func canonicalTag(aliases map[string]string, tag string) string {
+	tag = strings.TrimSpace(tag)
+	for alias, canonical := range aliases {
+		if strings.EqualFold(strings.TrimSpace(alias), tag) {
+			return strings.ToLower(strings.TrimSpace(canonical))
+		}
+	}
+
+	return strings.ToLower(tag)
+}
+
+// tagURL returns the path of a tag's listing page. Tags are matched case
+// insensitively, so the path is always lowercase.
+func tagURL(tag string) string {
+	return "/tags/" + url.PathEscape(strings.ToLower(tag))
+}
+
+func categoryURL(category string) string {
+	return "/categories/" + url.PathEscape(strings.ToLower(category))
+}
+
+func postsWithTag(posts []PostData, tag string) []PostData {
+	var matched []PostData
+	for _, post := range posts {
+		for _, t := range post.Tags {
+			if strings.EqualFold(t, tag) {
+				matched = append(matched, post)
+				break
+			}
+		}
+	}
+
+	return matched
+}
+
+func postsInCategory(posts []PostData, category string) []PostData {
+	var matched []PostData
+	for _, post := range posts {
+		if strings.EqualFold(post.Category, category) {
+			matched = append(matched, post)
+		}
+	}
+
+	return matched
+}
+
+// TagsHandler lists every tag.
+func TagsHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		setBreadcrumbs(ctx, Breadcrumb{Name: "Tags", URL: "/tags"})
+		renderHTML(ctx, http.StatusOK, "tags.html", gin.H{
+			"Title": "Tags",
+			"Tags":  tagCounts(visiblePosts(ctx, store)),
+		})
+	}
+}
+
+// TagHandler lists the posts with a tag.
+func TagHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tag := ctx.Param("tag")
+		posts := postsWithTag(visiblePosts(ctx, store), tag)
+		if len(posts) == 0 {
+			notFound(ctx, "No posts are tagged #"+tag)
+			return
+		}
+		cacheKeys(ctx, "tag:"+strings.ToLower(tag))
+
+		setBreadcrumbs(ctx, Breadcrumb{Name: "Tags", URL: "/tags"}, Breadcrumb{Name: "#" + tag, URL: tagURL(tag)})
+		addFeeds(ctx, siteData(ctx).Title+": #"+tag, tagURL(tag))
+		renderHTML(ctx, http.StatusOK, "list.html", gin.H{
+			"Title":   "#" + tag,
+			"Heading": "Posts tagged #" + tag,
+			"Posts":   posts,
+		})
+	}
+}
+
+// CategoryHandler lists the posts in a category.
+func CategoryHandler(store PostStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		category := ctx.Param("category")
+		posts := postsInCategory(visiblePosts(ctx, store), category)
+		if len(posts) == 0 {
+			notFound(ctx, "No posts in category "+category)
+			return
+		}
+
+		setBreadcrumbs(ctx, Breadcrumb{Name: category, URL: categoryURL(category)})
+		renderHTML(ctx, http.StatusOK, "list.html", gin.H{
+			"Title":   category,
+			"Heading": "Posts in " + category,
+			"Posts":   posts,
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeContent writes files, by slash-separated path, to a temporary
+// directory, such as posts to a content directory.
+func writeContent(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestCanonicalTags(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TagAliases = map[string]string{"golang": "go", "Go-Lang": "Go"}
+
+	got := canonicalTags(cfg.TagAliases, []string{" GoLang ", "go-lang", "Web", "go", "", "  "})
+	if want := []string{"go", "web"}; !slices.Equal(got, want) {
+		t.Errorf("canonicalTags = %q, want %q", got, want)
+	}
+}
+
+func TestTagAliasesMerge(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"one.md": "---\nTitle: One\nDate: 2025-01-01\nSlug: one\nTags: [golang]\n---\n\nOne.\n",
+		"two.md": "---\nTitle: Two\nDate: 2025-01-02\nSlug: two\nTags: [Go-Lang, web]\n---\n\nTwo.\n",
+	})
+	route := newTestRouter(t, func(cfg *Config) {
+		cfg.ContentDir = dir
+		cfg.TagAliases = map[string]string{"golang": "go", "go-lang": "go"}
+	})
+
+	w := get(route, "/tags/go")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /tags/go: status %d", w.Code)
+	}
+	for _, slug := range []string{"one", "two"} {
+		if !strings.Contains(w.Body.String(), `href="/posts/`+slug+`"`) {
+			t.Errorf("/tags/go doesn't list %s", slug)
+		}
+	}
+
+	for _, alias := range []string{"golang", "go-lang"} {
+		if w := get(route, "/tags/"+alias); w.Code != http.StatusNotFound {
+			t.Errorf("GET /tags/%s: status %d, want 404", alias, w.Code)
+		}
+	}
+
+	tags := get(route, "/tags").Body.String()
+	if strings.Contains(tags, "/tags/golang") || strings.Contains(tags, "/tags/go-lang") {
+		t.Error("/tags lists an alias as a tag of its own")
+	}
+}
+
+func TestTagAliasesValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TagAliases = map[string]string{"golang": "go", "GoLang": "rust"}
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted an alias mapped to two tags")
+	}
+
+	cfg.TagAliases = map[string]string{"golang": " "}
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted an alias to an empty tag")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateFuncs are the functions every template can use besides the
+// built-in ones.
+func templateFuncs(cfg *Config, route *gin.Engine, assets *Assets, translations Translations, renderer Renderer, commentCounts *CommentCounts, problems func() []Problem) template.FuncMap {
+	return template.FuncMap{
+		"t":             translations.T,
+		"tagURL":        tagURL,
+		"categoryURL":   categoryURL,
+		"asset":         assets.URL,
+		"liveReload":    liveReloadTag(cfg.Dev),
+		"dateFormat":    dateFormat,
+		"truncate":      truncate,
+		"slugify":       slugify,
+		"absURL":        absURL(cfg.BaseURL),
+		"markdownify":   markdownify(renderer),
+		"subscribeForm": subscribeForm(route, cfg.Newsletter.Enabled),
+		"pdf":           pdfAvailable(cfg),
+		"commentCount":  commentCounts.Count,
+		"problems":      problems,
+	}
+}
+
+// dateFormat formats t with a Go layout, and gives "" for the zero time
+// of undated posts:
+//
+//	{{ with dateFormat "Jan 2, 2006" .Date }}{{ . }}{{ end }}
+func dateFormat(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(layout)
+}
+
+// truncate shortens text, which may be HTML, to at most n characters of
+// plain text, cutting at a word boundary where possible and adding an
+// ellipsis when anything was cut.
+func truncate(n int, text any) string {
+	var s string
+	switch text := text.(type) {
+	case template.HTML:
+		s = stripHTML(string(text))
+	case string:
+		s = text
+	default:
+		return ""
+	}
+
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	cut := string(runes[:n])
+	if space := strings.LastIndexByte(cut, ' '); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// absURL turns a site path into an absolute URL on baseURL, the
+// configured base URL. Paths stay relative while base_url is unset, and
+// URLs are left alone.
+func absURL(baseURL string) func(string) string {
+	return func(path string) string {
+		if strings.Contains(path, "://") {
+			return path
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		return baseURL + path
+	}
+}
+
+// markdownify renders a markdown string, such as a frontmatter field, to
+// HTML. A single paragraph is returned without its <p>, so the result can
+// be used inline.
+func markdownify(renderer Renderer) func(string) (template.HTML, error) {
+	return func(s string) (template.HTML, error) {
+		html, _, err := renderer.Render(context.Background(), []byte(s), "md", false)
+		if err != nil {
+			return "", err
+		}
+
+		inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(string(html)), "<p>"), "</p>")
+		if !strings.Contains(inner, "<p>") && len(inner) < len(strings.TrimSpace(string(html))) {
+			return template.HTML(inner), nil
+		}
+
+		return html, nil
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+// The look of the blog comes from a theme, themes/<name>/templates and
+// themes/<name>/static. The site's own templates and static directories
+// are layered on top: a file there replaces the theme's file of the same
+// name, so a site can change single templates without forking the theme.
+//
+// The themes are built into the binary, so it runs with nothing but the
+// site's own files around it. Setting ThemesDir reads them from disk
+// instead, for working on a theme.
+
+//go:embed themes
+var embeddedThemes embed.FS
+
+// themeDirs returns the theme's subdirectory kind, "templates" or
+// "static", followed by the site's own directory, which takes precedence.
+// The theme's directory is left out while the theme is built in.
+func themeDirs(cfg *Config, kind, siteDir string) []string {
+	if cfg.Theme == "" || cfg.ThemesDir == "" {
+		return []string{siteDir}
+	}
+
+	return []string{filepath.Join(cfg.ThemesDir, cfg.Theme, kind), siteDir}
+}
+
+func templateDirs(cfg *Config) []string {
+	return themeDirs(cfg, "templates", cfg.TemplatesDir)
+}
+
+func staticDirs(cfg *Config) []string {
+	return themeDirs(cfg, "static", cfg.StaticDir)
+}
+
+// themeFS returns the files of the theme's subdirectory kind layered with
+// the site's own directory.
+func themeFS(cfg *Config, kind, siteDir string) fs.FS {
+	var l layers
+	if cfg.Theme != "" && cfg.ThemesDir == "" {
+		// Theme names with dots or slashes don't name a built in theme,
+		// and leave the theme out like an unknown name does.
+		if theme, err := fs.Sub(embeddedThemes, path.Join("themes", cfg.Theme, kind)); err == nil {
+			l = append(l, theme)
+		}
+	}
+	for _, dir := range themeDirs(cfg, kind, siteDir) {
+		l = append(l, os.DirFS(dir))
+	}
+
+	return l
+}
+
+// templateFS returns the theme's templates with the site's on top.
+func templateFS(cfg *Config) fs.FS {
+	return themeFS(cfg, "templates", cfg.TemplatesDir)
+}
+
+// staticFS returns the theme's static files with the site's on top.
+func staticFS(cfg *Config) fs.FS {
+	return themeFS(cfg, "static", cfg.StaticDir)
+}
+
+// layers is a file system made of others stacked on top of each other: a
+// file in a later layer hides the file of the same name in earlier ones,
+// and directories list the files of every layer. Layers need not exist.
+type layers []fs.FS
+
+func (l layers) Open(name string) (fs.File, error) {
+	for i := len(l) - 1; i >= 0; i-- {
+		f, err := l[i].Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l layers) ReadDir(name string) ([]fs.DirEntry, error) {
+	byName := map[string]fs.DirEntry{}
+	found := false
+	for _, layer := range l {
+		entries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+		for _, entry := range entries {
+			byName[entry.Name()] = entry
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(byName))
+	for _, entry := range byName {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// parseTemplates parses every template of the theme, with those the site
+// overrides replaced by the site's.
+func parseTemplates(cfg *Config, funcs template.FuncMap) (*template.Template, error) {
+	fsys := templateFS(cfg)
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no templates found in theme %q or %s", cfg.Theme, cfg.TemplatesDir)
+	}
+
+	return template.New("").Funcs(funcs).ParseFS(fsys, names...)
+}
+
+// devTemplates parses the templates again for every page, so template
+// changes show up without restarting the server.
+type devTemplates struct {
+	cfg   *Config
+	funcs template.FuncMap
+}
+
+func (d devTemplates) Instance(name string, data any) render.Render {
+	return render.HTML{
+		Template: template.Must(parseTemplates(d.cfg, d.funcs)),
+		Name:     name,
+		Data:     data,
+	}
+}
+
+// layoutTemplate returns the template of the layout named in frontmatter,
+// such as photo-essay.html for "photo-essay", or fallback when layout is
+// empty or has no template.
+func layoutTemplate(cfg *Config, layout, fallback string) string {
+	if layout == "" {
+		return fallback
+	}
+	if !layoutExists(cfg, layout) {
+		slog.Warn("no template for Layout, using default", "Layout", layout, "template", fallback)
+		return fallback
+	}
+
+	return layout + ".html"
+}
+
+// layoutExists reports whether the theme or the site has a template for
+// layout.
+func layoutExists(cfg *Config, layout string) bool {
+	if !validSlug(layout) {
+		return false
+	}
+	_, err := fs.Stat(templateFS(cfg), layout+".html")
+
+	return err == nil
+}
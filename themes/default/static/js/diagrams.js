@@ -0,0 +1,4 @@
+// Draws the mermaid diagrams the markdown renderer emits, once Mermaid,
+// loaded before this script on posts with diagrams, is available.
+mermaid.initialize({ startOnLoad: false, theme: "dark" });
+mermaid.run({ querySelector: "pre.mermaid" });
@@ -0,0 +1,8 @@
+// Typesets the math elements the markdown renderer emits with KaTeX,
+// which is loaded before this script on posts with math.
+document.querySelectorAll(".math").forEach((el) => {
+    katex.render(el.textContent, el, {
+        displayMode: el.classList.contains("math-display"),
+        throwOnError: false,
+    });
+});
@@ -0,0 +1,92 @@
+// Behaviour that would otherwise need inline event handlers, which the
+// Content-Security-Policy doesn't allow.
+
+// Cards with data-href link to their post, except for clicks on links
+// inside the card.
+document.addEventListener("click", (event) => {
+    const card = event.target.closest("[data-href]");
+    if (card && !event.target.closest("a")) {
+        window.location.href = card.dataset.href;
+    }
+});
+
+// Forms with data-confirm ask before submitting.
+document.addEventListener("submit", (event) => {
+    const message = event.target.dataset.confirm;
+    if (message && !window.confirm(message)) {
+        event.preventDefault();
+    }
+});
+
+// The theme toggle switches themes in place, storing the choice in the
+// cookie the server renders pages with.
+document.addEventListener("submit", (event) => {
+    const form = event.target.closest("[data-theme-toggle]");
+    if (!form) {
+        return;
+    }
+    event.preventDefault();
+
+    const button = form.querySelector("button");
+    const theme = button.value;
+    document.cookie = `theme=${theme}; path=/; max-age=31536000; samesite=lax`;
+    document.documentElement.classList.remove("theme-dark", "theme-light");
+    document.documentElement.classList.add(`theme-${theme}`);
+
+    const other = theme === "dark" ? "light" : "dark";
+    button.value = other;
+    button.textContent = other === "dark" ? "☾" : "☀";
+    button.title = form.dataset[other];
+});
+
+// Print links open the print dialog, as does ?print, which PDF links
+// redirect to when the blog can't print PDFs itself.
+document.addEventListener("click", (event) => {
+    if (event.target.closest("[data-print]")) {
+        event.preventDefault();
+        window.print();
+    }
+});
+
+if (new URLSearchParams(window.location.search).has("print")) {
+    window.addEventListener("load", () => window.print());
+}
+
+// Code blocks' copy buttons, hidden without scripts, copy the code without
+// its line numbers.
+for (const button of document.querySelectorAll(".code-copy")) {
+    button.hidden = !navigator.clipboard;
+}
+
+document.addEventListener("click", (event) => {
+    const button = event.target.closest(".code-copy");
+    const code = button && button.parentElement.parentElement.querySelector("pre");
+    if (!code) {
+        return;
+    }
+
+    const copy = code.cloneNode(true);
+    for (const number of copy.querySelectorAll('[style*="user-select:none"]')) {
+        number.remove();
+    }
+    navigator.clipboard.writeText(copy.textContent).then(() => {
+        const label = button.textContent;
+        button.textContent = "Copied";
+        setTimeout(() => { button.textContent = label; }, 2000);
+    });
+});
+
+// The left and right arrow keys go to the previous and next posts, unless
+// the reader is typing or holding a modifier.
+document.addEventListener("keydown", (event) => {
+    if (event.altKey || event.ctrlKey || event.metaKey || event.shiftKey ||
+        event.target.closest("input, textarea, select, [contenteditable]")) {
+        return;
+    }
+
+    const rel = { ArrowLeft: "prev", ArrowRight: "next" }[event.key];
+    const link = rel && document.querySelector(`link[rel="${rel}"]`);
+    if (link) {
+        window.location.href = link.href;
+    }
+});
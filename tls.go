@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertManager gets and renews certificates for the configured hosts
+// from Let's Encrypt, keeping them in the cache dir across restarts.
+func autocertManager(cfg TLSConfig) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Hosts...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+	}
+}
+
+// redirectServer answers ACME HTTP-01 challenges on cfg.HTTPAddr and
+// redirects every other request to HTTPS.
+func redirectServer(cfg TLSConfig, manager *autocert.Manager) *http.Server {
+	return &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
+
+// tlsConfig serves certificates from manager, and also answers ACME
+// TLS-ALPN-01 challenges.
+func tlsConfig(manager *autocert.Manager) *tls.Config {
+	cfg := manager.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Headings of these levels make it into a post's table of contents.
+const (
+	tocMinLevel = 2
+	tocMaxLevel = 3
+)
+
+// TOCEntry is a heading in a post's table of contents, linking to the
+// heading's id.
+type TOCEntry struct {
+	Level int
+	ID    string
+	Title string
+}
+
+// renderMarkdown converts source to HTML, also returning the table of
+// contents. md must generate heading ids for the entries to have anchors.
+func renderMarkdown(md goldmark.Markdown, source []byte, pc parser.Context) (template.HTML, []TOCEntry, error) {
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+
+	var buf bytes.Buffer
+	err := md.Renderer().Render(&buf, source, doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return template.HTML(buf.String()), tableOfContents(doc, source), nil
+}
+
+func tableOfContents(doc ast.Node, source []byte) []TOCEntry {
+	var toc []TOCEntry
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		if heading.Level >= tocMinLevel && heading.Level <= tocMaxLevel {
+			id, _ := heading.AttributeString("id")
+			idBytes, _ := id.([]byte)
+			toc = append(toc, TOCEntry{
+				Level: heading.Level,
+				ID:    string(idBytes),
+				Title: plainText(heading, source),
+			})
+		}
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return toc
+}
+
+// headingAnchors renders headings with a permalink to their id. The link
+// is empty, its ¶ coming from the stylesheet, so it doesn't end up in the
+// text of posts, excerpts and feeds.
+type headingAnchors struct{}
+
+func (headingAnchors) Extend(m goldmark.Markdown) {
+	// The default HTML renderer has priority 1000.
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(headingAnchorRenderer{}, 500),
+	))
+}
+
+type headingAnchorRenderer struct{}
+
+func (r headingAnchorRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r headingAnchorRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	level := strconv.Itoa(n.Level)
+
+	if entering {
+		_, _ = w.WriteString("<h" + level)
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, n, html.HeadingAttributeFilter)
+		}
+		_ = w.WriteByte('>')
+		return ast.WalkContinue, nil
+	}
+
+	if id, ok := n.AttributeString("id"); ok {
+		if id, ok := id.([]byte); ok {
+			_, _ = w.WriteString(` <a class="heading-anchor" href="#`)
+			_, _ = w.Write(util.EscapeHTML(id))
+			_, _ = w.WriteString(`" aria-label="Permalink"></a>`)
+		}
+	}
+	_, _ = w.WriteString("</h" + level + ">\n")
+
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// Problem is something wrong with a post file, as found by lintContent
+// and lintProse.
+type Problem struct {
+	File string
+	// Line is where in File the problem is, 0 for the whole file.
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+
+	return p.File + ": " + p.Message
+}
+
+// lintContent checks the frontmatter of every post in fsys, named as if it
+// were dir: Title, Slug and Date must be set, the date must parse, the slug
+// must match the file name and no two posts in a language may share a
+// slug. Posts aren't rendered, so this is quick enough to run on every
+// start. Layouts and languages are those of cfg.
+func lintContent(cfg *Config, fsys fs.FS, dir string) ([]Problem, error) {
+	var problems []Problem
+	report := func(file, format string, args ...any) {
+		problems = append(problems, Problem{File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// bySlug maps lang/slug to the first file using it.
+	bySlug := map[string]string{}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		front, _, err := splitFrontmatter(content)
+		if err == nil && front == nil {
+			report(path, "no frontmatter")
+			return nil
+		}
+
+		var post PostData
+		if err == nil {
+			err = decodeFrontmatter(front, &post)
+		}
+		if err != nil {
+			problems = append(problems, fileProblem(path, err))
+			return nil
+		}
+
+		base := strings.TrimSuffix(d.Name(), ".md")
+		if post.Title == "" {
+			report(path, "missing Title")
+		}
+
+		switch {
+		case post.Slug == "":
+			report(path, "missing Slug")
+		case !validSlug(post.Slug):
+			report(path, "invalid Slug %q, use letters, digits, - and _", post.Slug)
+		case post.Slug != base:
+			report(path, "Slug %q doesn't match the file name %q", post.Slug, d.Name())
+		}
+
+		if post.RawDate == "" {
+			report(path, "missing Date")
+		} else if _, err := parsePostDate(post.RawDate); err != nil {
+			report(path, "malformed Date %q", post.RawDate)
+		}
+		if post.RawPublishAt != "" {
+			if _, err := parsePostDate(post.RawPublishAt); err != nil {
+				report(path, "malformed PublishAt %q", post.RawPublishAt)
+			}
+		}
+
+		if v := strings.ToLower(post.Visibility); v != "" && v != "public" && v != "private" {
+			report(path, "unknown Visibility %q, use public or private", post.Visibility)
+		}
+
+		if post.CanonicalURL != "" && !isHTTPURL(post.CanonicalURL) {
+			report(path, "CanonicalURL %q isn't an absolute http(s) URL", post.CanonicalURL)
+		}
+		for _, u := range post.SyndicatedTo {
+			if !isHTTPURL(u) {
+				report(path, "SyndicatedTo %q isn't an absolute http(s) URL", u)
+			}
+		}
+
+		if post.Audio.File != "" {
+			if _, err := post.Audio.seconds(); post.Audio.Duration != "" && err != nil {
+				report(path, "malformed Audio Duration %q, use 1:02:03, 45:10 or seconds", post.Audio.Duration)
+			}
+		} else if post.Audio != (Episode{}) {
+			report(path, "Audio needs a File")
+		}
+
+		if v := strings.ToLower(post.FeedContent); v != "" && v != "full" && v != "summary" {
+			report(path, "unknown FeedContent %q, use full or summary", post.FeedContent)
+		}
+
+		if post.Layout != "" && !layoutExists(cfg, post.Layout) {
+			report(path, "no template for Layout %q", post.Layout)
+		}
+
+		key := postLang(cfg, dir, path, post.Lang) + "/" + firstNonEmpty(post.Slug, base)
+		if other, ok := bySlug[key]; ok {
+			report(path, "Slug %q is already used by %s", firstNonEmpty(post.Slug, base), other)
+		} else {
+			bySlug[key] = path
+		}
+
+		return nil
+	})
+
+	return problems, err
+}
+
+// lintSource lints the content cfg selects.
+func lintSource(cfg *Config) ([]Problem, error) {
+	source, err := openContentSource(*cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := source.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return lintContent(cfg, fsys, source.String())
+}
+
+// validate lints the content for CI, printing every problem and failing if
+// there are any.
+func validate(cfg *Config) error {
+	problems, err := lintSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+
+	return nil
+}
+
+// warnContentProblems logs the problems lintContent finds in fsys, so they
+// don't go unnoticed while the posts render anyway.
+func warnContentProblems(cfg *Config, fsys fs.FS, dir string) {
+	problems, err := lintContent(cfg, fsys, dir)
+	if err != nil {
+		slog.Warn("checking posts", "dir", dir, "error", err)
+		return
+	}
+
+	for _, p := range problems {
+		slog.Warn("post problem", "file", p.File, "problem", p.Message)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// ViewCounter counts post views by slug in SQLite. Counts are kept in
+// memory and written in batches every flush interval, so a busy post
+// doesn't mean a write per request. A nil *ViewCounter counts nothing,
+// which is what the blog runs with when views are disabled or the
+// database can't be opened.
+type ViewCounter struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	counts map[string]int64
+	// pending are the views not yet written to the database.
+	pending map[string]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openViewCounter opens the database configured in cfg and starts
+// flushing to it, or returns nil when views are disabled.
+func openViewCounter(cfg ViewsConfig) (*ViewCounter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "views.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS views (
+		slug  TEXT PRIMARY KEY,
+		count INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	counts, err := loadViews(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	v := &ViewCounter{
+		db:      db,
+		counts:  counts,
+		pending: make(map[string]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go v.flushEvery(time.Duration(cfg.FlushInterval))
+
+	return v, nil
+}
+
+func loadViews(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query(`SELECT slug, count FROM views`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var slug string
+		var count int64
+		err = rows.Scan(&slug, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[slug] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// Hit counts a view of the post with the given slug.
+func (v *ViewCounter) Hit(slug string) {
+	if v == nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.counts[slug]++
+	v.pending[slug]++
+}
+
+// Views returns the number of views of the post with the given slug.
+func (v *ViewCounter) Views(slug string) int64 {
+	if v == nil {
+		return 0
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.counts[slug]
+}
+
+// Popular returns the slugs of the most viewed posts, most viewed first.
+func (v *ViewCounter) Popular() []string {
+	if v == nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	slugs := make([]string, 0, len(v.counts))
+	for slug := range v.counts {
+		slugs = append(slugs, slug)
+	}
+	sort.Slice(slugs, func(i, j int) bool {
+		ci, cj := v.counts[slugs[i]], v.counts[slugs[j]]
+		if ci != cj {
+			return ci > cj
+		}
+
+		return slugs[i] < slugs[j]
+	})
+	v.mu.Unlock()
+
+	return slugs
+}
+
+func (v *ViewCounter) flushEvery(interval time.Duration) {
+	defer close(v.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			v.logFlush()
+		case <-v.stop:
+			v.logFlush()
+			return
+		}
+	}
+}
+
+func (v *ViewCounter) logFlush() {
+	if err := v.flush(); err != nil {
+		slog.Warn("saving view counts", "error", err)
+	}
+}
+
+// flush writes the pending views in one transaction. If that fails they
+// stay pending and are retried on the next flush.
+func (v *ViewCounter) flush() error {
+	v.mu.Lock()
+	pending := v.pending
+	v.pending = make(map[string]int64)
+	v.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := v.write(pending)
+	if err != nil {
+		v.mu.Lock()
+		for slug, n := range pending {
+			v.pending[slug] += n
+		}
+		v.mu.Unlock()
+	}
+
+	return err
+}
+
+func (v *ViewCounter) write(pending map[string]int64) error {
+	tx, err := v.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for slug, n := range pending {
+		_, err = tx.Exec(`INSERT INTO views (slug, count) VALUES (?, ?)
+			ON CONFLICT (slug) DO UPDATE SET count = count + excluded.count`, slug, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Close writes the pending views and closes the database.
+func (v *ViewCounter) Close() error {
+	close(v.stop)
+	<-v.done
+
+	return v.db.Close()
+}
+
+// popularPosts returns up to views.popular of the most viewed posts
+// the request may see, leaving out private ones.
+func popularPosts(ctx *gin.Context, store PostStore, views *ViewCounter) []PostSummary {
+	var popular []PostSummary
+	for _, slug := range views.Popular() {
+		if len(popular) == requestConfig(ctx).Views.Popular {
+			break
+		}
+
+		if post, ok := visiblePost(ctx, store, slug); ok && !post.Private() {
+			popular = append(popular, summarize(post))
+		}
+	}
+
+	return popular
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const lastVisitCookie = "last_visit"
+
+// lastVisit returns the time stored in the reader's last-visit cookie and
+// refreshes the cookie to now. ok is false for first-time visitors.
+func lastVisit(ctx *gin.Context) (visit time.Time, ok bool) {
+	if value, err := ctx.Cookie(lastVisitCookie); err == nil {
+		if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+			visit, ok = time.Unix(unix, 0), true
+		}
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(lastVisitCookie, strconv.FormatInt(requestTime(ctx).Unix(), 10),
+		int((365 * 24 * time.Hour).Seconds()), "/", "", false, true)
+
+	return visit, ok
+}
+
+// markNewPosts flags posts published or updated after the reader's last
+// visit.
+func markNewPosts(posts []PostData, visit time.Time) {
+	for i, post := range posts {
+		changed := post.PublishTime()
+		if post.DateModified.After(changed) {
+			changed = post.DateModified
+		}
+		posts[i].IsNew = changed.After(visit)
+	}
+}
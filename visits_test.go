@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newBadges returns the URLs of the post cards of body with a New badge.
+func newBadges(body string) []string {
+	var urls []string
+	for _, card := range strings.Split(body, `data-href="`)[1:] {
+		url, _, _ := strings.Cut(card, `"`)
+		if strings.Contains(card, `class="new-badge"`) {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+func TestNewSinceLastVisit(t *testing.T) {
+	dir := writeContent(t, map[string]string{
+		"old.md":     "---\nTitle: Old\nDate: 2025-01-01\n---\n\nOld.\n",
+		"fresh.md":   "---\nTitle: Fresh\nDate: 2025-05-20\n---\n\nFresh.\n",
+		"updated.md": "---\nTitle: Updated\nDate: 2025-01-02\n---\n\nUpdated.\n",
+	})
+	// Files count as modified when last written.
+	for name, modified := range map[string]time.Time{
+		"old.md":     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		"fresh.md":   time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC),
+		"updated.md": time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC),
+	} {
+		err := os.Chtimes(filepath.Join(dir, name), modified, modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	route := newTestRouter(t, func(cfg *Config) { cfg.ContentDir = dir })
+
+	t.Run("first visit", func(t *testing.T) {
+		w := get(route, "/")
+		if badges := newBadges(w.Body.String()); len(badges) != 0 {
+			t.Errorf("first-time visitor sees New on %q", badges)
+		}
+
+		var cookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == lastVisitCookie {
+				cookie = c
+			}
+		}
+		if want := strconv.FormatInt(testTime.Unix(), 10); cookie == nil || cookie.Value != want {
+			t.Errorf("last visit cookie %v, want %s", cookie, want)
+		}
+	})
+
+	t.Run("returning", func(t *testing.T) {
+		visit := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: lastVisitCookie, Value: strconv.FormatInt(visit.Unix(), 10)})
+
+		badges := newBadges(do(route, req).Body.String())
+		slices.Sort(badges)
+		if want := []string{"/posts/fresh", "/posts/updated"}; !slices.Equal(badges, want) {
+			t.Errorf("New on %q, want %q", badges, want)
+		}
+	})
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	xhtml "golang.org/x/net/html"
+	_ "modernc.org/sqlite"
+)
+
+// The blog speaks Webmention (https://www.w3.org/TR/webmention/) both ways.
+// Other sites notify /webmention when they link to a post; the source is
+// fetched in the background and, if it really links to the post, shown
+// under it. And whenever posts are loaded, the sites that published posts
+// link to are notified, once per link.
+
+// maxWebmentionBody caps how much of a page is read when verifying a
+// mention or discovering an endpoint.
+const maxWebmentionBody = 1 << 20
+
+// Webmention is a verified mention of a post on another site.
+type Webmention struct {
+	Source  string
+	Slug    string
+	Title   string
+	Created time.Time
+}
+
+// incomingMention is a received mention waiting to be verified.
+type incomingMention struct {
+	source, target, slug string
+}
+
+// Webmentions stores received mentions and remembers sent ones in SQLite,
+// verifying and sending in the background.
+type Webmentions struct {
+	db     *sql.DB
+	client *http.Client
+	// base is the blog's base URL, which sent mentions name posts by.
+	base string
+	// clock tells Send which posts are published, and dates verified
+	// mentions.
+	clock Clock
+
+	queue chan incomingMention
+	done  chan struct{}
+
+	// sendMu keeps sending runs from overlapping when posts are reloaded
+	// in quick succession.
+	sendMu sync.Mutex
+}
+
+// openWebmentions opens the database configured in cfg and starts
+// verifying received mentions, or returns nil when Webmention is
+// disabled.
+func openWebmentions(cfg WebmentionConfig, base string, clock Clock) (*Webmentions, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	db, err := sql.Open("sqlite", firstNonEmpty(cfg.Path, "webmentions.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS webmentions (
+		source  TEXT NOT NULL,
+		slug    TEXT NOT NULL,
+		title   TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		PRIMARY KEY (source, slug)
+	);
+	CREATE TABLE IF NOT EXISTS webmentions_sent (
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		PRIMARY KEY (source, target)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	m := &Webmentions{
+		db:     db,
+		client: outboundClient(cfg.AllowPrivate),
+		base:   base,
+		clock:  clock,
+		queue:  make(chan incomingMention, 100),
+		done:   make(chan struct{}),
+	}
+	go m.verifyQueued()
+
+	return m, nil
+}
+
+// For returns the mentions of the post with the given slug, oldest first,
+// logging failures so a broken database doesn't take post pages down.
+func (m *Webmentions) For(slug string) []Webmention {
+	if m == nil {
+		return nil
+	}
+
+	rows, err := m.db.Query(`SELECT source, slug, title, created FROM webmentions WHERE slug = ? ORDER BY created, source`, slug)
+	if err != nil {
+		slog.Error("loading webmentions", "slug", slug, "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var mentions []Webmention
+	for rows.Next() {
+		var wm Webmention
+		var created int64
+		err = rows.Scan(&wm.Source, &wm.Slug, &wm.Title, &created)
+		if err != nil {
+			slog.Error("loading webmentions", "slug", slug, "error", err)
+			return mentions
+		}
+
+		wm.Created = time.Unix(created, 0).UTC()
+		mentions = append(mentions, wm)
+	}
+
+	return mentions
+}
+
+// Close stops verifying and closes the database. Mentions still queued
+// are verified first; a sending run in progress fails and is picked up
+// again on the next start.
+func (m *Webmentions) Close() error {
+	close(m.queue)
+	<-m.done
+
+	return m.db.Close()
+}
+
+// WebmentionHandler accepts a mention of a post. The source is verified
+// later, so the request is answered with 202 Accepted.
+func WebmentionHandler(store PostStore, mentions *Webmentions) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		source, target := ctx.PostForm("source"), ctx.PostForm("target")
+
+		sourceURL, err := url.Parse(source)
+		if err != nil || !httpURL(sourceURL) {
+			ctx.String(http.StatusBadRequest, "source must be an http or https URL")
+			return
+		}
+		targetURL, err := url.Parse(target)
+		if err != nil || !httpURL(targetURL) {
+			ctx.String(http.StatusBadRequest, "target must be an http or https URL")
+			return
+		}
+		if source == target {
+			ctx.String(http.StatusBadRequest, "source and target must differ")
+			return
+		}
+
+		post, ok := postAtPath(store, targetURL.Path, requestTime(ctx))
+		if !ok {
+			ctx.String(http.StatusBadRequest, "target is not a post on this blog")
+			return
+		}
+
+		select {
+		case mentions.queue <- incomingMention{source: source, target: target, slug: post.Slug}:
+			ctx.String(http.StatusAccepted, "Mention accepted and will be verified")
+		default:
+			ctx.Header("Retry-After", "60")
+			ctx.String(http.StatusServiceUnavailable, "Too many mentions waiting, try again later")
+		}
+	}
+}
+
+func httpURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isHTTPURL reports whether s parses as an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && httpURL(u)
+}
+
+// postAtPath returns the post whose URL is path, if listed at now.
+// Private posts don't take mentions, as no one could have linked to them
+// publicly.
+func postAtPath(store PostStore, path string, now time.Time) (PostData, bool) {
+	for _, post := range store.Posts() {
+		if post.URL == path && post.Listed(now) {
+			return post, true
+		}
+	}
+
+	return PostData{}, false
+}
+
+func (m *Webmentions) verifyQueued() {
+	defer close(m.done)
+
+	for mention := range m.queue {
+		err := m.verify(mention)
+		if err != nil {
+			slog.Warn("verifying webmention", "source", mention.source, "target", mention.target, "error", err)
+		}
+	}
+}
+
+// verify fetches the source of a mention and stores the mention if the
+// source links to its target. A mention whose source is gone or no longer
+// links to the target is deleted, as the spec asks for updates.
+func (m *Webmentions) verify(mention incomingMention) error {
+	resp, err := m.client.Get(mention.source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return m.delete(mention)
+	case resp.StatusCode != http.StatusOK:
+		return errors.New(resp.Status)
+	}
+
+	base := resp.Request.URL
+	links, title, err := pageLinks(io.LimitReader(resp.Body, maxWebmentionBody), base)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if link == mention.target {
+			_, err = m.db.Exec(`INSERT INTO webmentions (source, slug, title, created) VALUES (?, ?, ?, ?)
+				ON CONFLICT (source, slug) DO UPDATE SET title = excluded.title`,
+				mention.source, mention.slug, firstNonEmpty(title, mention.source), m.clock.Now().Unix())
+			return err
+		}
+	}
+
+	return m.delete(mention)
+}
+
+func (m *Webmentions) delete(mention incomingMention) error {
+	_, err := m.db.Exec(`DELETE FROM webmentions WHERE source = ? AND slug = ?`, mention.source, mention.slug)
+	return err
+}
+
+// pageLinks returns the absolute targets of the links in an HTML page and
+// the page's title.
+func pageLinks(r io.Reader, base *url.URL) (links []string, title string, err error) {
+	doc, err := xhtml.Parse(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.Data {
+			case "a":
+				if href, ok := htmlAttr(n, "href"); ok {
+					if u, err := base.Parse(href); err == nil {
+						links = append(links, u.String())
+					}
+				}
+			case "title":
+				if title == "" && n.FirstChild != nil {
+					title = strings.TrimSpace(n.FirstChild.Data)
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links, title, nil
+}
+
+func htmlAttr(n *xhtml.Node, name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// Send notifies the sites linked from published posts that haven't been
+// notified of that link yet. It needs base_url, since mentions must name
+// the post by its public URL. Links to sites without a Webmention endpoint
+// are remembered as well, so they aren't looked up again on every load.
+func (m *Webmentions) Send(posts []PostData) {
+	if m == nil {
+		return
+	}
+	if m.base == "" {
+		slog.Warn("not sending webmentions without base_url")
+		return
+	}
+
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+
+	now := m.clock.Now()
+	for _, post := range posts {
+		if !post.Listed(now) {
+			continue
+		}
+
+		source := m.base + post.URL
+		base, err := url.Parse(source)
+		if err != nil {
+			continue
+		}
+
+		links, _, err := pageLinks(strings.NewReader(string(post.Content())), base)
+		if err != nil {
+			continue
+		}
+
+		for _, target := range links {
+			if !strings.HasPrefix(target, "http") || strings.HasPrefix(target, m.base+"/") || m.sent(source, target) {
+				continue
+			}
+
+			err = m.send(source, target)
+			if err != nil {
+				slog.Warn("sending webmention", "source", source, "target", target, "error", err)
+				continue
+			}
+
+			_, err = m.db.Exec(`INSERT OR IGNORE INTO webmentions_sent (source, target) VALUES (?, ?)`, source, target)
+			if err != nil {
+				slog.Error("saving sent webmention", "error", err)
+			}
+		}
+	}
+}
+
+func (m *Webmentions) sent(source, target string) bool {
+	var n int
+	err := m.db.QueryRow(`SELECT COUNT(*) FROM webmentions_sent WHERE source = ? AND target = ?`, source, target).Scan(&n)
+
+	return err == nil && n > 0
+}
+
+// send notifies the endpoint of target, if it has one, that source links
+// to it.
+func (m *Webmentions) send(source, target string) error {
+	endpoint, err := m.discoverEndpoint(target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+
+	resp, err := m.client.PostForm(endpoint, url.Values{"source": {source}, "target": {target}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(resp.Status)
+	}
+	slog.Info("sent webmention", "source", source, "target", target, "endpoint", endpoint)
+
+	return nil
+}
+
+// discoverEndpoint returns the Webmention endpoint of target from its Link
+// header or, failing that, its first <link> or <a> with rel="webmention".
+// It returns "" if target has none.
+func (m *Webmentions) discoverEndpoint(target string) (string, error) {
+	resp, err := m.client.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	base := resp.Request.URL
+	resolve := func(ref string) (string, error) {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+
+		return u.String(), nil
+	}
+
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			ref, params, ok := strings.Cut(link, ";")
+			ref = strings.TrimSpace(ref)
+			if !ok || !strings.HasPrefix(ref, "<") || !strings.HasSuffix(ref, ">") {
+				continue
+			}
+			if relWebmention(linkParam(params, "rel")) {
+				return resolve(strings.Trim(ref, "<>"))
+			}
+		}
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return "", nil
+	}
+
+	doc, err := xhtml.Parse(io.LimitReader(resp.Body, maxWebmentionBody))
+	if err != nil {
+		return "", err
+	}
+
+	var endpoint *string
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if endpoint != nil {
+			return
+		}
+		if n.Type == xhtml.ElementNode && (n.Data == "link" || n.Data == "a") {
+			rel, _ := htmlAttr(n, "rel")
+			if href, ok := htmlAttr(n, "href"); ok && relWebmention(rel) {
+				endpoint = &href
+				return
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if endpoint == nil {
+		return "", nil
+	}
+
+	return resolve(*endpoint)
+}
+
+// linkParam returns the value of the parameter name in the parameters of a
+// Link header entry, such as `rel="webmention"`.
+func linkParam(params, name string) string {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+
+	return ""
+}
+
+func relWebmention(rel string) bool {
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, "webmention") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// hubFeeds are the feeds under every feed path that declare the hub, when
+// enabled: the RSS and Atom ones.
+var hubFeeds = []string{"/feed.xml", "/atom.xml"}
+
+// WebSub tells the configured WebSub hub when feeds change, so it pushes
+// them to subscribers right away instead of them polling, see
+// https://www.w3.org/TR/websub/. The RSS and Atom feeds declare the hub.
+// Like IndexNow, posts are compared with the previous reload of their
+// store. A nil *WebSub notifies no one.
+type WebSub struct {
+	cfg    *Config
+	client *http.Client
+}
+
+// newWebSub returns the publisher, or nil when cfg disables WebSub.
+func newWebSub(cfg *Config) *WebSub {
+	if !cfg.WebSub.Enabled {
+		return nil
+	}
+
+	// Only the configured hub is requested.
+	return &WebSub{cfg: cfg, client: outboundClient(true)}
+}
+
+// Watch publishes the feeds every reload of store changes: those listing
+// posts that were added, changed or removed.
+func (w *WebSub) Watch(store PostStore) {
+	if w == nil || store == nil {
+		return
+	}
+
+	type listed struct {
+		hash  string
+		feeds []string
+	}
+	// The published posts as of the previous reload, by URL.
+	var seen map[string]listed
+	store.OnReload(func(posts []PostData) {
+		now := time.Now()
+		current := make(map[string]listed, len(posts))
+		changed := map[string]bool{}
+		for _, post := range posts {
+			if !post.Listed(now) {
+				continue
+			}
+
+			current[post.URL] = listed{post.Hash, postFeeds(w.cfg, post)}
+			if prev, ok := seen[post.URL]; !ok || prev.hash != post.Hash {
+				for _, feed := range current[post.URL].feeds {
+					changed[feed] = true
+				}
+			}
+		}
+		for u, prev := range seen {
+			if _, ok := current[u]; !ok {
+				for _, feed := range prev.feeds {
+					changed[feed] = true
+				}
+			}
+		}
+
+		// The first call, at start, only takes stock.
+		first := seen == nil
+		seen = current
+		if first || len(changed) == 0 {
+			return
+		}
+
+		topics := make([]string, 0, len(changed))
+		for feed := range changed {
+			topics = append(topics, feed)
+		}
+		slices.Sort(topics)
+		go w.publish(topics)
+	})
+}
+
+// postFeeds are the URLs of the feeds listing post: those of the blog, its
+// language and section, and its tags.
+func postFeeds(cfg *Config, post PostData) []string {
+	dirs := []string{"", langPrefix(post.Lang)}
+	if post.Section != "" {
+		dirs = append(dirs, langPrefix(post.Lang)+sectionPrefix(post.Section))
+	}
+	for _, tag := range post.Tags {
+		dirs = append(dirs, tagURL(tag))
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	var feeds []string
+	for _, dir := range dirs {
+		for _, f := range enabledFeeds(cfg) {
+			if slices.Contains(hubFeeds, f.file) {
+				feeds = append(feeds, cfg.BaseURL+dir+f.file)
+			}
+		}
+	}
+
+	return feeds
+}
+
+// publish tells the hub each of topics has new content. Hubs take one
+// topic per request.
+func (w *WebSub) publish(topics []string) {
+	failed := 0
+	for _, topic := range topics {
+		err := w.send(topic)
+		if err != nil {
+			slog.Warn("publishing to WebSub hub", "hub", w.cfg.WebSub.Hub, "topic", topic, "error", err)
+			failed++
+		}
+	}
+
+	slog.Info("published to WebSub hub", "hub", w.cfg.WebSub.Hub, "topics", len(topics)-failed)
+}
+
+func (w *WebSub) send(topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	form := url.Values{"hub.mode": {"publish"}, "hub.url": {topic}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.WebSub.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// hubLinks are the links declaring cfg's hub in the RSS and Atom feeds.
+func hubLinks(cfg *Config) []atomLink {
+	if !cfg.WebSub.Enabled {
+		return nil
+	}
+
+	return []atomLink{{Href: cfg.WebSub.Hub, Rel: "hub"}}
+}